@@ -0,0 +1,53 @@
+package common
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResolveClientIP 返回请求的真实客户端 IP。配置了 CLIENT_IP_HEADERS 与 CLIENT_IP_TRUSTED_PROXIES 时，
+// 仅当直连来源属于可信代理才依次读取请求头；对 X-Forwarded-For 这类逗号分隔的链路从右向左跳过可信代理，
+// 取第一个不可信地址，从而在多层代理后仍能得到正确 IP 且无法被客户端伪造。未配置时沿用 gin 的 ClientIP。
+func ResolveClientIP(c *gin.Context) string {
+	if len(ClientIPHeaders) == 0 || len(ClientIPTrustedProxies) == 0 {
+		return c.ClientIP()
+	}
+	remoteIP := c.RemoteIP()
+	if !isTrustedClientIPProxy(remoteIP) {
+		return remoteIP
+	}
+	for _, header := range ClientIPHeaders {
+		if ip, ok := resolveClientIPFromHeader(c.GetHeader(header)); ok {
+			return ip
+		}
+	}
+	return remoteIP
+}
+
+func resolveClientIPFromHeader(value string) (string, bool) {
+	if strings.TrimSpace(value) == "" {
+		return "", false
+	}
+	items := strings.Split(value, ",")
+	leftmost := ""
+	for i := len(items) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(items[i]))
+		if ip == nil {
+			// 链路中出现无法解析的地址时不再继续向左信任
+			break
+		}
+		if !IsIpInCIDRList(ip, ClientIPTrustedProxies) {
+			return ip.String(), true
+		}
+		leftmost = ip.String()
+	}
+	// 整条链路都是可信代理时取最左侧的地址
+	return leftmost, leftmost != ""
+}
+
+func isTrustedClientIPProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && IsIpInCIDRList(parsed, ClientIPTrustedProxies)
+}
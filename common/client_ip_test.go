@@ -0,0 +1,48 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newClientIPTestContext(remoteAddr string, headers map[string]string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		c.Request.Header.Set(key, value)
+	}
+	return c
+}
+
+func TestResolveClientIP(t *testing.T) {
+	oldHeaders, oldProxies := ClientIPHeaders, ClientIPTrustedProxies
+	t.Cleanup(func() { ClientIPHeaders, ClientIPTrustedProxies = oldHeaders, oldProxies })
+	ClientIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+	ClientIPTrustedProxies = []string{"10.0.0.0/8", "172.16.0.0/12"}
+
+	// 两层代理：跳过链路右侧的可信代理，取第一个不可信地址
+	c := newClientIPTestContext("10.0.0.2:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.9, 172.16.0.5"})
+	require.Equal(t, "203.0.113.9", ResolveClientIP(c))
+
+	// 首个请求头缺失时使用下一个
+	c = newClientIPTestContext("10.0.0.2:1234", map[string]string{"X-Real-IP": "198.51.100.7"})
+	require.Equal(t, "198.51.100.7", ResolveClientIP(c))
+
+	// 非可信来源携带的请求头不被信任
+	c = newClientIPTestContext("203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"})
+	require.Equal(t, "203.0.113.5", ResolveClientIP(c))
+
+	// 可信来源但没有任何请求头时回退到直连地址
+	c = newClientIPTestContext("10.0.0.2:1234", nil)
+	require.Equal(t, "10.0.0.2", ResolveClientIP(c))
+
+	// 未配置时沿用 gin 默认行为
+	ClientIPHeaders = nil
+	c = newClientIPTestContext("203.0.113.5:1234", nil)
+	require.Equal(t, c.ClientIP(), ResolveClientIP(c))
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// nowFunc 为限流等逻辑使用的时钟，测试中可通过 SetClockForTest 替换为 FakeClock
+var nowFunc atomic.Value // func() time.Time
+
+// Now 返回当前时间，默认等同于 time.Now
+func Now() time.Time {
+	if fn, ok := nowFunc.Load().(func() time.Time); ok && fn != nil {
+		return fn()
+	}
+	return time.Now()
+}
+
+// SetClockForTest 将 Now 替换为 now，返回用于恢复默认时钟的函数，仅供测试使用
+func SetClockForTest(now func() time.Time) (restore func()) {
+	prev, _ := nowFunc.Load().(func() time.Time)
+	nowFunc.Store(now)
+	return func() {
+		nowFunc.Store(prev)
+	}
+}
+
+// FakeClock 是可手动推进的测试时钟
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance 将时钟向前推进 d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -132,6 +132,9 @@ var BatchUpdateInterval int
 var BatchUpdateConcurrency = 1
 var BatchUpdateConcurrencyMax = 64
 
+// BatchUpdateQueueWarnSize 任一批量更新队列的待写入记录数超过该值时输出告警（仅告警不丢弃），0 表示不告警
+var BatchUpdateQueueWarnSize int
+
 var RelayTimeout int // unit is second
 
 var RelayMaxIdleConns int
@@ -193,8 +196,29 @@ var (
 var RateLimitKeyExpirationDuration = 20 * time.Minute
 var RateLimitKeyShardCount = 1 // >1 时为限流 key 增加 shard 后缀，缓解单 key 热点
 var RateLimitRedisOpTimeout = 1500 * time.Millisecond
+
+// RateLimitFailOpen 为 true 时模型请求限流在 Redis 出错时放行请求而不是返回 500，
+// RateLimitFailOpenMemoryFallback 控制放行时是否退回进程内限流
+var RateLimitFailOpen = false
+var RateLimitFailOpenMemoryFallback = true
 var RedisPoolStatsLogInterval = time.Duration(0)
 
+// RedisHashCompressThreshold 大于 0 时，RedisHSetObj 写入的字符串字段超过该字节数会以 gzip 压缩存储
+var RedisHashCompressThreshold = 0
+
+// RateLimitKeyShardHash64 为 true 时 shard 使用分布更均匀的 64 位哈希（会改变已有 key 名）
+var RateLimitKeyShardHash64 = false
+
+// RateLimitFingerprintHeader 非空时，来自 RateLimitFingerprintTrustedProxies 的请求
+// 以客户端 IP 加该请求头的哈希作为 IP 限流键，适用于多个用户共享 CDN 出口 IP 的场景
+var RateLimitFingerprintHeader = ""
+var RateLimitFingerprintTrustedProxies []string
+
+// ClientIPHeaders 与 ClientIPTrustedProxies 同时配置时，ResolveClientIP 按顺序从这些请求头解析客户端 IP，
+// 仅信任来自可信代理网段的请求头，用于多层反向代理部署
+var ClientIPHeaders []string
+var ClientIPTrustedProxies []string
+
 const (
 	UserStatusEnabled  = 1 // don't use 0, 0 is the default value!
 	UserStatusDisabled = 2 // also don't use 0
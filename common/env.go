@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -47,3 +48,37 @@ func GetEnvOrDefaultDurationMS(env string, defaultMs int) time.Duration {
 	}
 	return time.Duration(ms) * time.Millisecond
 }
+
+// deprecatedEnvWarned 记录已输出过弃用警告的别名，每个别名只警告一次
+var deprecatedEnvWarned sync.Map
+
+// resolveEnvName 返回实际应读取的环境变量名：优先使用 primary，未设置时依次回退到 aliases（旧名称）。
+// 使用旧名称时输出一次弃用警告；均未设置时返回 primary。
+func resolveEnvName(primary string, aliases []string) string {
+	if primary == "" || os.Getenv(primary) != "" {
+		return primary
+	}
+	for _, alias := range aliases {
+		if alias == "" || os.Getenv(alias) == "" {
+			continue
+		}
+		if _, warned := deprecatedEnvWarned.LoadOrStore(alias, struct{}{}); !warned {
+			SysLog(fmt.Sprintf("WARNING: environment variable %s is deprecated, please use %s instead", alias, primary))
+		}
+		return alias
+	}
+	return primary
+}
+
+// GetEnvWithAliases 与 GetEnvOrDefault 相同，primary 未设置时依次读取已弃用的别名
+func GetEnvWithAliases(primary string, aliases []string, defaultValue int) int {
+	return GetEnvOrDefault(resolveEnvName(primary, aliases), defaultValue)
+}
+
+func GetEnvStringWithAliases(primary string, aliases []string, defaultValue string) string {
+	return GetEnvOrDefaultString(resolveEnvName(primary, aliases), defaultValue)
+}
+
+func GetEnvBoolWithAliases(primary string, aliases []string, defaultValue bool) bool {
+	return GetEnvOrDefaultBool(resolveEnvName(primary, aliases), defaultValue)
+}
@@ -0,0 +1,22 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEnvWithAliases_PrefersPrimaryThenAliases(t *testing.T) {
+	t.Setenv("ENV_ALIAS_TEST_OLD", "7")
+	require.Equal(t, 7, GetEnvWithAliases("ENV_ALIAS_TEST_NEW", []string{"ENV_ALIAS_TEST_OLDER", "ENV_ALIAS_TEST_OLD"}, 1))
+	_, warned := deprecatedEnvWarned.Load("ENV_ALIAS_TEST_OLD")
+	require.True(t, warned)
+
+	t.Setenv("ENV_ALIAS_TEST_NEW", "9")
+	require.Equal(t, 9, GetEnvWithAliases("ENV_ALIAS_TEST_NEW", []string{"ENV_ALIAS_TEST_OLD"}, 1))
+
+	require.Equal(t, "fallback", GetEnvStringWithAliases("ENV_ALIAS_TEST_MISSING", []string{"ENV_ALIAS_TEST_MISSING_OLD"}, "fallback"))
+
+	t.Setenv("ENV_ALIAS_TEST_BOOL_OLD", "true")
+	require.True(t, GetEnvBoolWithAliases("ENV_ALIAS_TEST_BOOL", []string{"ENV_ALIAS_TEST_BOOL_OLD"}, false))
+}
@@ -4,8 +4,10 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"hash/crc32"
+	"hash/fnv"
 	"strconv"
 )
 
@@ -44,3 +46,43 @@ func HashShard(input string, shardCount int) string {
 	sum := crc32.ChecksumIEEE([]byte(input))
 	return strconv.FormatUint(uint64(sum%uint32(shardCount)), 10)
 }
+
+// HashShard64 与 HashShard 相同，但使用 FNV-1a 64 位哈希并经 fmix64 混淆，
+// 对连续数字 ID 等输入分布更均匀。两者结果不同，切换会改变已有 key 的 shard 后缀。
+func HashShard64(input string, shardCount int) string {
+	if shardCount <= 1 {
+		return "0"
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(input))
+	return strconv.FormatUint(Fmix64(h.Sum64())%uint64(shardCount), 10)
+}
+
+// Fmix64 是 MurmurHash3 的 64 位终结混淆函数，使连续整数等低熵输入在各位上均匀分布
+func Fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// RateLimitKeyShard 返回限流 key 的 shard 后缀，RateLimitKeyShardHash64 开启时使用 HashShard64
+func RateLimitKeyShard(input string) string {
+	if RateLimitKeyShardHash64 {
+		return HashShard64(input, RateLimitKeyShardCount)
+	}
+	return HashShard(input, RateLimitKeyShardCount)
+}
+
+// SecureCompare 以常量时间比较两个字符串（如令牌、验证码）。
+// 先对两侧做 SHA-256 再比较，比较耗时与输入长度是否一致无关，不会泄露长度信息。
+func SecureCompare(a, b string) bool {
+	return SecureCompareHash(Sha256Raw([]byte(a)), Sha256Raw([]byte(b)))
+}
+
+// SecureCompareHash 以常量时间比较两个摘要，长度不同时直接返回 false
+func SecureCompareHash(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
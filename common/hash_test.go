@@ -0,0 +1,38 @@
+package common
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureCompare(t *testing.T) {
+	require.True(t, SecureCompare("sk-abc123", "sk-abc123"))
+	require.True(t, SecureCompare("", ""))
+	require.False(t, SecureCompare("sk-abc123", "sk-abc124"))
+	require.False(t, SecureCompare("sk-abc123", "sk-abc1234"))
+	require.False(t, SecureCompare("", "sk-abc123"))
+}
+
+func TestSecureCompareHash(t *testing.T) {
+	a := Sha256Raw([]byte("token"))
+	require.True(t, SecureCompareHash(a, Sha256Raw([]byte("token"))))
+	require.False(t, SecureCompareHash(a, Sha256Raw([]byte("other"))))
+	require.False(t, SecureCompareHash(a, a[:16]))
+}
+
+func TestHashShard64_DistributesSequentialIDs(t *testing.T) {
+	require.Equal(t, "0", HashShard64("42", 1))
+	require.Equal(t, HashShard64("42", 8), HashShard64("42", 8))
+
+	const shardCount = 8
+	counts := make(map[string]int, shardCount)
+	for id := 0; id < 8000; id++ {
+		counts[HashShard64(strconv.Itoa(id*shardCount), shardCount)]++
+	}
+	require.Len(t, counts, shardCount)
+	for _, count := range counts {
+		require.InDelta(t, 1000, count, 200)
+	}
+}
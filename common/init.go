@@ -108,6 +108,7 @@ func InitEnv() {
 	if BatchUpdateConcurrency > BatchUpdateConcurrencyMax {
 		BatchUpdateConcurrency = BatchUpdateConcurrencyMax
 	}
+	BatchUpdateQueueWarnSize = GetEnvOrDefault("BATCH_UPDATE_QUEUE_WARN_SIZE", 0)
 	RelayTimeout = GetEnvOrDefault("RELAY_TIMEOUT", 0)
 	RelayMaxIdleConns = GetEnvOrDefault("RELAY_MAX_IDLE_CONNS", 500)
 	RelayMaxIdleConnsPerHost = GetEnvOrDefault("RELAY_MAX_IDLE_CONNS_PER_HOST", 100)
@@ -136,16 +137,40 @@ func InitEnv() {
 	if RateLimitKeyShardCount > 1024 {
 		RateLimitKeyShardCount = 1024
 	}
+	RateLimitKeyShardHash64 = GetEnvOrDefaultBool("RATE_LIMIT_KEY_SHARD_HASH64", RateLimitKeyShardHash64)
 
 	RateLimitRedisOpTimeout = GetEnvOrDefaultDurationMS("RATE_LIMIT_REDIS_OP_TIMEOUT_MS", int(RateLimitRedisOpTimeout.Milliseconds()))
 	if RateLimitRedisOpTimeout < 50*time.Millisecond {
 		RateLimitRedisOpTimeout = 50 * time.Millisecond
 	}
+	// Redis 出错时模型请求限流默认拒绝请求（fail-closed），开启后放行并可退回进程内限流
+	RateLimitFailOpen = GetEnvOrDefaultBool("RATE_LIMIT_FAIL_OPEN", RateLimitFailOpen)
+	RateLimitFailOpenMemoryFallback = GetEnvOrDefaultBool("RATE_LIMIT_FAIL_OPEN_MEMORY_FALLBACK", RateLimitFailOpenMemoryFallback)
+	RateLimitFingerprintHeader = strings.TrimSpace(GetEnvOrDefaultString("RATE_LIMIT_FINGERPRINT_HEADER", ""))
+	RateLimitFingerprintTrustedProxies = nil
+	for _, proxy := range strings.Split(GetEnvOrDefaultString("RATE_LIMIT_FINGERPRINT_TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			RateLimitFingerprintTrustedProxies = append(RateLimitFingerprintTrustedProxies, proxy)
+		}
+	}
+	ClientIPHeaders = nil
+	for _, header := range strings.Split(GetEnvOrDefaultString("CLIENT_IP_HEADERS", ""), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			ClientIPHeaders = append(ClientIPHeaders, header)
+		}
+	}
+	ClientIPTrustedProxies = nil
+	for _, proxy := range strings.Split(GetEnvOrDefaultString("CLIENT_IP_TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			ClientIPTrustedProxies = append(ClientIPTrustedProxies, proxy)
+		}
+	}
 
 	RedisPoolStatsLogIntervalSeconds := GetEnvOrDefault("REDIS_POOL_STATS_LOG_INTERVAL_SECONDS", int(RedisPoolStatsLogInterval.Seconds()))
 	if RedisPoolStatsLogIntervalSeconds > 0 {
 		RedisPoolStatsLogInterval = time.Duration(RedisPoolStatsLogIntervalSeconds) * time.Second
 	}
+	RedisHashCompressThreshold = GetEnvOrDefault("REDIS_HASH_COMPRESS_THRESHOLD", RedisHashCompressThreshold)
 
 	initConstantEnv()
 }
@@ -155,8 +180,25 @@ func initConstantEnv() {
 	constant.DifyDebug = GetEnvOrDefaultBool("DIFY_DEBUG", true)
 	constant.MaxFileDownloadMB = GetEnvOrDefault("MAX_FILE_DOWNLOAD_MB", 64)
 	constant.StreamScannerMaxBufferMB = GetEnvOrDefault("STREAM_SCANNER_MAX_BUFFER_MB", 64)
+	// StreamEventIdEnabled 为流式响应的每个 data 事件附加递增的 id 行
+	constant.StreamEventIdEnabled = GetEnvOrDefaultBool("STREAM_EVENT_ID_ENABLED", false)
+	// StreamReplayBufferSize 每个流保留用于 Last-Event-ID 重放的事件数，0 表示禁用重放
+	constant.StreamReplayBufferSize = GetEnvOrDefault("STREAM_REPLAY_BUFFER_SIZE", 0)
+	constant.StreamReplayBufferMaxKB = GetEnvOrDefault("STREAM_REPLAY_BUFFER_MAX_KB", 1024)
+	constant.StreamReplayMaxStreams = GetEnvOrDefault("STREAM_REPLAY_MAX_STREAMS", 1000)
+	constant.StreamReplayTTLSeconds = GetEnvOrDefault("STREAM_REPLAY_TTL_SECONDS", 300)
 	// MaxRequestBodyMB 请求体最大大小（解压后），用于防止超大请求/zip bomb导致内存暴涨
 	constant.MaxRequestBodyMB = GetEnvOrDefault("MAX_REQUEST_BODY_MB", 128)
+	// MaxRequestBodyBytes 分发渠道前校验的请求体上限（字节），超出返回 413，multipart 上传接口不受限，0 表示不限制
+	constant.MaxRequestBodyBytes = int64(GetEnvOrDefault("MAX_REQUEST_BODY_BYTES", 0))
+	// CostAwareRoutingEnabled 首次选择渠道时在同优先级候选中优先选择按预估用量成本最低的渠道，成本相同或无法估算时回退为随机选择
+	constant.CostAwareRoutingEnabled = GetEnvOrDefaultBool("COST_AWARE_ROUTING_ENABLED", false)
+	// QuotaWriteThroughEnabled 要求立即落库（db=true）的额度变更在同一调用内同步写库并更新缓存，批量路径不受影响
+	constant.QuotaWriteThroughEnabled = GetEnvOrDefaultBool("QUOTA_WRITE_THROUGH", false)
+	// ConvertedRequestMaxBodyKB 格式转换（如 Chat Completions 转 Responses）后发往上游的请求体上限，0 表示不限制
+	constant.ConvertedRequestMaxBodyKB = GetEnvOrDefault("CONVERTED_REQUEST_MAX_BODY_KB", 0)
+	// ParamOverrideMaxOperations 单个渠道参数覆盖允许的最大操作数（含旧格式的键），保存渠道时校验，0 表示不限制
+	constant.ParamOverrideMaxOperations = GetEnvOrDefault("PARAM_OVERRIDE_MAX_OPERATIONS", 100)
 	// ForceStreamOption 覆盖请求参数，强制返回usage信息
 	constant.ForceStreamOption = GetEnvOrDefaultBool("FORCE_STREAM_OPTION", true)
 	constant.CountToken = GetEnvOrDefaultBool("CountToken", true)
@@ -170,10 +212,16 @@ func initConstantEnv() {
 	constant.GenerateDefaultToken = GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
 	// 是否启用错误日志
 	constant.ErrorLogEnabled = GetEnvOrDefaultBool("ERROR_LOG_ENABLED", false)
+	// 是否为每个中继请求输出一行 JSON 结构化访问日志
+	constant.AccessLogJsonEnabled = GetEnvOrDefaultBool("ACCESS_LOG_JSON_ENABLED", false)
 	// 任务轮询时查询的最大数量
 	constant.TaskQueryLimit = GetEnvOrDefault("TASK_QUERY_LIMIT", 1000)
 	// 异步任务超时时间（分钟），超过此时间未完成的任务将被标记为失败并退款。0 表示禁用。
 	constant.TaskTimeoutMinutes = GetEnvOrDefault("TASK_TIMEOUT_MINUTES", 1440)
+	// 定期清理已用完、已禁用或已过期兑换码的间隔（分钟），0 表示不启用
+	constant.RedemptionCleanupIntervalMinutes = GetEnvOrDefault("REDEMPTION_CLEANUP_INTERVAL_MINUTES", 0)
+	// 退款去重记录的保留天数，超过后由清理任务删除，0 表示不清理
+	constant.QuotaRefundRecordRetentionDays = GetEnvOrDefault("QUOTA_REFUND_RECORD_RETENTION_DAYS", 30)
 
 	soraPatchStr := GetEnvOrDefaultString("TASK_PRICE_PATCH", "")
 	if soraPatchStr != "" {
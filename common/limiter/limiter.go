@@ -22,8 +22,19 @@ const (
 	SlidingWindowModeCheckAndRecord = 1
 	SlidingWindowModeRecord         = 2
 	SlidingWindowModeRollback       = 3
+
+	// slidingWindowModeStatus 只读查询窗口状态，仅供 SlidingWindowStatus 使用
+	slidingWindowModeStatus = 4
 )
 
+// Redis 键约定：
+//   - 令牌桶（Allow）：以 key 本身保存 Hash，字段为 tokens / last_time
+//   - 滑动窗口（SlidingWindow*）：以 key 本身保存 List，并以 key + SlidingWindowIndexSuffix
+//     保存 entry 后缀到完整记录的索引 Hash（用于按 entry 回滚），后缀需与 lua/sliding_window.lua 保持一致
+//
+// Reset 会同时删除以上键，因此同一个 key 无论用于哪种限流都可以被清除。
+const SlidingWindowIndexSuffix = ":idx"
+
 type RedisLimiter struct {
 	client                 *redis.Client
 	limitScriptSHA         string
@@ -40,9 +51,9 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 	once.Do(func() {
 		instance = &RedisLimiter{client: r}
 	})
-	if instance != nil && instance.client == nil {
-		instance.client = r
-	}
+	// Redis 重新初始化（如故障切换后替换 common.RDB）时切换到新的 client，
+	// 旧 client 上加载的脚本 SHA 不一定对新实例有效，一并清空以便重新加载
+	instance.refreshClient(r)
 	// 避免每次请求都 SCRIPT LOAD，仅在首次/丢失 SHA 时加载。
 	if instance.getRateScriptSHA() == "" || instance.getSlidingWindowScriptSHA() == "" {
 		if err := instance.loadScripts(ctx); err != nil {
@@ -52,6 +63,31 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 	return instance
 }
 
+func (rl *RedisLimiter) refreshClient(r *redis.Client) {
+	if r == nil {
+		return
+	}
+	rl.mu.RLock()
+	same := rl.client == r
+	rl.mu.RUnlock()
+	if same {
+		return
+	}
+	rl.mu.Lock()
+	if rl.client != r {
+		rl.client = r
+		rl.limitScriptSHA = ""
+		rl.slidingWindowScriptSHA = ""
+	}
+	rl.mu.Unlock()
+}
+
+func (rl *RedisLimiter) getClient() *redis.Client {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.client
+}
+
 func (rl *RedisLimiter) loadScripts(ctx context.Context) error {
 	var errs []string
 	if err := rl.loadRateScript(ctx); err != nil {
@@ -67,7 +103,7 @@ func (rl *RedisLimiter) loadScripts(ctx context.Context) error {
 }
 
 func (rl *RedisLimiter) loadRateScript(ctx context.Context) error {
-	sha, err := rl.client.ScriptLoad(ctx, rateLimitScript).Result()
+	sha, err := rl.getClient().ScriptLoad(ctx, rateLimitScript).Result()
 	if err != nil {
 		return err
 	}
@@ -78,7 +114,7 @@ func (rl *RedisLimiter) loadRateScript(ctx context.Context) error {
 }
 
 func (rl *RedisLimiter) loadSlidingWindowScript(ctx context.Context) error {
-	sha, err := rl.client.ScriptLoad(ctx, slidingWindowScript).Result()
+	sha, err := rl.getClient().ScriptLoad(ctx, slidingWindowScript).Result()
 	if err != nil {
 		return err
 	}
@@ -108,9 +144,10 @@ func isNoScriptErr(err error) bool {
 }
 
 func (rl *RedisLimiter) evalRateLimit(ctx context.Context, key string, args ...interface{}) (int, error) {
+	client := rl.getClient()
 	sha := rl.getRateScriptSHA()
 	if sha != "" {
-		res, err := rl.client.EvalSha(ctx, sha, []string{key}, args...).Int()
+		res, err := client.EvalSha(ctx, sha, []string{key}, args...).Int()
 		if err == nil {
 			return res, nil
 		}
@@ -122,7 +159,7 @@ func (rl *RedisLimiter) evalRateLimit(ctx context.Context, key string, args ...i
 	if err := rl.loadRateScript(ctx); err == nil {
 		sha = rl.getRateScriptSHA()
 		if sha != "" {
-			res, err := rl.client.EvalSha(ctx, sha, []string{key}, args...).Int()
+			res, err := client.EvalSha(ctx, sha, []string{key}, args...).Int()
 			if err == nil {
 				return res, nil
 			}
@@ -132,35 +169,48 @@ func (rl *RedisLimiter) evalRateLimit(ctx context.Context, key string, args ...i
 		}
 	}
 
-	return rl.client.Eval(ctx, rateLimitScript, []string{key}, args...).Int()
+	return client.Eval(ctx, rateLimitScript, []string{key}, args...).Int()
 }
 
 func (rl *RedisLimiter) evalSlidingWindow(ctx context.Context, key string, args ...interface{}) (int, error) {
+	res, err := rl.evalSlidingWindowResult(ctx, key, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := res.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sliding window result type %T", res)
+	}
+	return int(n), nil
+}
+
+func (rl *RedisLimiter) evalSlidingWindowResult(ctx context.Context, key string, args ...interface{}) (interface{}, error) {
+	client := rl.getClient()
 	sha := rl.getSlidingWindowScriptSHA()
 	if sha != "" {
-		res, err := rl.client.EvalSha(ctx, sha, []string{key}, args...).Int()
+		res, err := client.EvalSha(ctx, sha, []string{key}, args...).Result()
 		if err == nil {
 			return res, nil
 		}
 		if !isNoScriptErr(err) {
-			return 0, err
+			return nil, err
 		}
 	}
 
 	if err := rl.loadSlidingWindowScript(ctx); err == nil {
 		sha = rl.getSlidingWindowScriptSHA()
 		if sha != "" {
-			res, err := rl.client.EvalSha(ctx, sha, []string{key}, args...).Int()
+			res, err := client.EvalSha(ctx, sha, []string{key}, args...).Result()
 			if err == nil {
 				return res, nil
 			}
 			if !isNoScriptErr(err) {
-				return 0, err
+				return nil, err
 			}
 		}
 	}
 
-	return rl.client.Eval(ctx, slidingWindowScript, []string{key}, args...).Int()
+	return client.Eval(ctx, slidingWindowScript, []string{key}, args...).Result()
 }
 
 func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (bool, error) {
@@ -178,7 +228,7 @@ func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (
 	}
 
 	// 执行限流
-	result, err := rl.evalRateLimit(ctx, key, config.Requested, config.Rate, config.Capacity, config.ExpireSeconds)
+	result, err := rl.evalRateLimit(ctx, key, config.Requested, config.Rate, config.Capacity, config.ExpireSeconds, config.InitialTokens)
 	if err != nil {
 		return false, fmt.Errorf("rate limit failed: %w", err)
 	}
@@ -205,12 +255,46 @@ func (rl *RedisLimiter) SlidingWindowWithEntry(ctx context.Context, key string,
 	return result == 1, nil
 }
 
+// SlidingWindowStatus 只读查询滑动窗口状态，返回窗口内的记录数与其中最早一条记录距今的秒数，
+// 不占用名额，也不刷新过期时间。剩余名额可由调用方按 maxRequestNum - current 计算。
+func (rl *RedisLimiter) SlidingWindowStatus(ctx context.Context, key string, windowSeconds int64) (current int, oldestAgeSeconds int64, err error) {
+	if windowSeconds <= 0 {
+		return 0, 0, nil
+	}
+	res, err := rl.evalSlidingWindowResult(ctx, key, 0, windowSeconds, 0, slidingWindowModeStatus, "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("sliding window status failed: %w", err)
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("unexpected sliding window status result: %v", res)
+	}
+	count, ok1 := values[0].(int64)
+	age, ok2 := values[1].(int64)
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("unexpected sliding window status result: %v", res)
+	}
+	return int(count), age, nil
+}
+
+// Reset 清除 key 对应的限流状态（令牌桶与滑动窗口均适用），用于管理员手动解除误触发的限流
+func (rl *RedisLimiter) Reset(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("rate limit key is empty")
+	}
+	if err := rl.getClient().Del(ctx, key, key+SlidingWindowIndexSuffix).Err(); err != nil {
+		return fmt.Errorf("reset rate limit failed: %w", err)
+	}
+	return nil
+}
+
 // Config 配置选项模式
 type Config struct {
 	Capacity      int64
 	Rate          int64
 	Requested     int64
 	ExpireSeconds int64
+	InitialTokens int64
 }
 
 type Option func(*Config)
@@ -230,3 +314,10 @@ func WithRequested(n int64) Option {
 func WithExpireSeconds(seconds int64) Option {
 	return func(cfg *Config) { cfg.ExpireSeconds = seconds }
 }
+
+// WithInitialTokens 设置桶首次创建时的初始令牌数，使新键可以立即承受一次突发请求，之后按 Rate 补充。
+// 与 WithCapacity 的关系：Capacity 是稳态上限，补充不会超过它；初始令牌可以大于 Capacity，
+// 超出部分只会被消耗而不会补充，消耗到 Capacity 以下后恢复常规补充。n <= 0 时按 Capacity 初始化。
+func WithInitialTokens(n int64) Option {
+	return func(cfg *Config) { cfg.InitialTokens = n }
+}
@@ -0,0 +1,169 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+// newMiniRedisLimiter 返回连接到 miniredis 的限流器，用于执行 Lua 脚本的行为测试
+func newMiniRedisLimiter(t *testing.T) (*RedisLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return New(context.Background(), client), mr
+}
+
+// newUnreachableClient 返回指向不可用地址的 client，仅用于校验实例切换，不会真正发出请求
+func newUnreachableClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 50 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+}
+
+func TestNewRefreshesClientWhenChanged(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	first := newUnreachableClient()
+	second := newUnreachableClient()
+	t.Cleanup(func() {
+		_ = first.Close()
+		_ = second.Close()
+	})
+
+	lim := New(ctx, first)
+	require.Same(t, first, lim.getClient())
+
+	lim.mu.Lock()
+	lim.limitScriptSHA = "stale-rate-sha"
+	lim.slidingWindowScriptSHA = "stale-window-sha"
+	lim.mu.Unlock()
+
+	// 传入相同 client 时保留已加载的脚本 SHA
+	lim.refreshClient(first)
+	require.Equal(t, "stale-rate-sha", lim.getRateScriptSHA())
+
+	swapped := New(ctx, second)
+	require.Same(t, lim, swapped)
+	require.Same(t, second, swapped.getClient())
+	require.NotEqual(t, "stale-rate-sha", swapped.getRateScriptSHA())
+	require.NotEqual(t, "stale-window-sha", swapped.getSlidingWindowScriptSHA())
+
+	// nil client 不会覆盖现有 client
+	New(ctx, nil)
+	require.Same(t, second, swapped.getClient())
+}
+
+func TestResetClearsTokenBucketAndSlidingWindow(t *testing.T) {
+	lim, mr := newMiniRedisLimiter(t)
+	ctx := context.Background()
+
+	bucketKey := "rateLimit:test:bucket"
+	allowed, err := lim.Allow(ctx, bucketKey, WithCapacity(1), WithRate(1))
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, err = lim.Allow(ctx, bucketKey, WithCapacity(1), WithRate(1))
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	windowKey := "rateLimit:test:window"
+	allowed, err = lim.SlidingWindowWithEntry(ctx, windowKey, 1, 60, 120, SlidingWindowModeCheckAndRecord, "req-1")
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.True(t, mr.Exists(windowKey+SlidingWindowIndexSuffix))
+	allowed, err = lim.SlidingWindow(ctx, windowKey, 1, 60, 120, SlidingWindowModeCheckAndRecord)
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	require.NoError(t, lim.Reset(ctx, bucketKey))
+	require.NoError(t, lim.Reset(ctx, windowKey))
+	require.False(t, mr.Exists(bucketKey))
+	require.False(t, mr.Exists(windowKey))
+	require.False(t, mr.Exists(windowKey+SlidingWindowIndexSuffix))
+
+	allowed, err = lim.Allow(ctx, bucketKey, WithCapacity(1), WithRate(1))
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, err = lim.SlidingWindow(ctx, windowKey, 1, 60, 120, SlidingWindowModeCheckAndRecord)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	require.Error(t, lim.Reset(ctx, ""))
+}
+
+func TestSlidingWindowStatusIsReadOnly(t *testing.T) {
+	lim, mr := newMiniRedisLimiter(t)
+	ctx := context.Background()
+	key := "rateLimit:test:status"
+
+	current, age, err := lim.SlidingWindowStatus(ctx, key, 60)
+	require.NoError(t, err)
+	require.Zero(t, current)
+	require.Zero(t, age)
+
+	// 一条窗口外的旧记录与两条窗口内的记录
+	now := time.Now()
+	formatEntry := func(ts time.Time) string {
+		return fmt.Sprintf("%d.%06d", ts.Unix(), ts.Nanosecond()/1000)
+	}
+	_, err = mr.Lpush(key, formatEntry(now.Add(-120*time.Second)))
+	require.NoError(t, err)
+	_, err = mr.Lpush(key, formatEntry(now.Add(-30*time.Second)))
+	require.NoError(t, err)
+	_, err = mr.Lpush(key, formatEntry(now.Add(-5*time.Second))+"-req")
+	require.NoError(t, err)
+
+	current, age, err = lim.SlidingWindowStatus(ctx, key, 60)
+	require.NoError(t, err)
+	require.Equal(t, 2, current)
+	require.InDelta(t, 30, age, 2)
+
+	// 查询不占用名额，也不修改记录
+	entries, err := mr.List(key)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.False(t, mr.Exists(key+SlidingWindowIndexSuffix))
+
+	current, _, err = lim.SlidingWindowStatus(ctx, key, 0)
+	require.NoError(t, err)
+	require.Zero(t, current)
+}
+
+func TestAllowWithInitialTokensSeedsNewBucket(t *testing.T) {
+	lim, mr := newMiniRedisLimiter(t)
+	ctx := context.Background()
+	start := time.Now()
+	mr.SetTime(start)
+
+	allowN := func(key string, opts ...Option) int {
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			ok, err := lim.Allow(ctx, key, opts...)
+			require.NoError(t, err)
+			if ok {
+				allowed++
+			}
+		}
+		return allowed
+	}
+
+	// 未设置初始令牌时按容量初始化
+	require.Equal(t, 2, allowN("rateLimit:test:default", WithCapacity(2), WithRate(1)))
+
+	// 初始令牌可超过容量，用于新键的首次突发
+	key := "rateLimit:test:initial"
+	require.Equal(t, 5, allowN(key, WithCapacity(2), WithRate(1), WithInitialTokens(5)))
+
+	// 之后按速率补充且不超过容量，初始令牌对已存在的桶不再生效
+	mr.SetTime(start.Add(10 * time.Second))
+	require.Equal(t, 2, allowN(key, WithCapacity(2), WithRate(1), WithInitialTokens(5)))
+}
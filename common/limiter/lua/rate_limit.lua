@@ -4,12 +4,14 @@
 -- ARGV[2]: 令牌生成速率 (每秒)
 -- ARGV[3]: 桶容量
 -- ARGV[4]: 过期时间（秒，可选；<=0 时自动按容量/速率推导）
+-- ARGV[5]: 初始令牌数（可选；仅在桶首次创建时生效，<=0 时按桶容量初始化）
 
 local key = KEYS[1]
 local requested = tonumber(ARGV[1])
 local rate = tonumber(ARGV[2])
 local capacity = tonumber(ARGV[3])
 local expire_seconds = tonumber(ARGV[4])
+local initial_tokens = tonumber(ARGV[5])
 
 if not requested or requested <= 0 then
     return 1
@@ -40,12 +42,15 @@ local last_time = tonumber(bucket[2])
 -- 初始化桶（首次请求或过期）
 if not tokens or not last_time then
     tokens = capacity
+    if initial_tokens and initial_tokens > 0 then
+        tokens = initial_tokens
+    end
     last_time = nowInSeconds
 else
-    -- 计算新增令牌
+    -- 计算新增令牌；初始令牌超过容量时，超出部分只消耗不补充，直到回落到容量以内
     local elapsed = nowInSeconds - last_time
     local add_tokens = elapsed * rate
-    tokens = math.min(capacity, tokens + add_tokens)
+    tokens = math.max(tokens, math.min(capacity, tokens + add_tokens))
     last_time = nowInSeconds
 end
 
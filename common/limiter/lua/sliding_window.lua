@@ -3,7 +3,7 @@
 -- ARGV[1]: 最大请求数
 -- ARGV[2]: 时间窗口（秒）
 -- ARGV[3]: 过期时间（秒）
--- ARGV[4]: 模式（0=仅检查, 1=检查并记录, 2=仅记录, 3=回滚单条记录）
+-- ARGV[4]: 模式（0=仅检查, 1=检查并记录, 2=仅记录, 3=回滚单条记录, 4=只读查询窗口状态）
 -- ARGV[5]: entry（可选，mode=1/2 用于写入，mode=3 用于回滚）
 
 local key = KEYS[1]
@@ -55,6 +55,31 @@ if mode == 3 then
     return 0
 end
 
+if mode == 4 then
+    -- 只读：返回 {窗口内记录数, 窗口内最早记录距今秒数}，不修改任何状态
+    if not window_seconds or window_seconds <= 0 then
+        return {0, 0}
+    end
+    local now = redis.call('TIME')
+    local now_number = tonumber(string.format('%d.%06d', tonumber(now[1]), tonumber(now[2])))
+    local entries = redis.call('LRANGE', key, 0, -1)
+    local count = 0
+    local oldest_age = 0
+    for _, value in ipairs(entries) do
+        local ts = tonumber(string.match(tostring(value), '^[0-9]+%.?[0-9]*'))
+        if ts then
+            local age = now_number - ts
+            if age < window_seconds then
+                count = count + 1
+                if age > oldest_age then
+                    oldest_age = age
+                end
+            end
+        end
+    end
+    return {count, math.floor(oldest_age)}
+end
+
 if not max_requests or max_requests <= 0 then
     return 1
 end
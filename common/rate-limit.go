@@ -28,16 +28,20 @@ func (l *InMemoryRateLimiter) Init(expirationDuration time.Duration) {
 func (l *InMemoryRateLimiter) clearExpiredItems() {
 	for {
 		time.Sleep(l.expirationDuration)
-		l.mutex.Lock()
-		now := time.Now().Unix()
-		for key := range l.store {
-			queue := l.store[key]
-			size := len(*queue)
-			if size == 0 || now-(*queue)[size-1] > int64(l.expirationDuration.Seconds()) {
-				delete(l.store, key)
-			}
+		l.clearExpiredItemsOnce()
+	}
+}
+
+func (l *InMemoryRateLimiter) clearExpiredItemsOnce() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := Now().Unix()
+	for key := range l.store {
+		queue := l.store[key]
+		size := len(*queue)
+		if size == 0 || now-(*queue)[size-1] > int64(l.expirationDuration.Seconds()) {
+			delete(l.store, key)
 		}
-		l.mutex.Unlock()
 	}
 }
 
@@ -65,7 +69,7 @@ func (l *InMemoryRateLimiter) checkLocked(key string, maxRequestNum int, duratio
 		return true
 	}
 	queue, ok := l.store[key]
-	now := time.Now().Unix()
+	now := Now().Unix()
 	if ok {
 		if len(*queue) < maxRequestNum {
 			return true
@@ -81,7 +85,7 @@ func (l *InMemoryRateLimiter) checkLocked(key string, maxRequestNum int, duratio
 func (l *InMemoryRateLimiter) requestLocked(key string, maxRequestNum int, duration int64) bool {
 	// [old <-- new]
 	queue, ok := l.store[key]
-	now := time.Now().Unix()
+	now := Now().Unix()
 	if ok {
 		if len(*queue) < maxRequestNum {
 			*queue = append(*queue, now)
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryRateLimiter_WindowBoundaryWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	t.Cleanup(SetClockForTest(clock.Now))
+
+	var l InMemoryRateLimiter
+	l.Init(0)
+
+	require.True(t, l.Request("k", 2, 60))
+	require.True(t, l.Request("k", 2, 60))
+	require.False(t, l.Request("k", 2, 60))
+
+	clock.Advance(59 * time.Second)
+	require.False(t, l.Request("k", 2, 60))
+
+	// 最早一次请求恰好满一个窗口后释放名额
+	clock.Advance(time.Second)
+	require.True(t, l.Request("k", 2, 60))
+}
+
+func TestInMemoryRateLimiter_ClearExpiredItemsWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	t.Cleanup(SetClockForTest(clock.Now))
+
+	l := InMemoryRateLimiter{store: make(map[string]*[]int64), expirationDuration: time.Minute}
+	require.True(t, l.Request("k", 1, 60))
+
+	clock.Advance(time.Minute)
+	l.clearExpiredItemsOnce()
+	require.Contains(t, l.store, "k")
+
+	clock.Advance(time.Second)
+	l.clearExpiredItemsOnce()
+	require.NotContains(t, l.store, "k")
+}
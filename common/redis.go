@@ -116,12 +116,24 @@ func startRedisPoolStatsLogger() {
 		ticker := time.NewTicker(RedisPoolStatsLogInterval)
 		defer ticker.Stop()
 		for range ticker.C {
-			stats := RDB.PoolStats()
+			stats, ok := GetRedisPoolStats()
+			if !ok {
+				continue
+			}
 			SysLog(fmt.Sprintf("Redis pool stats: hits=%d misses=%d timeouts=%d total_conns=%d idle_conns=%d stale_conns=%d", stats.Hits, stats.Misses, stats.Timeouts, stats.TotalConns, stats.IdleConns, stats.StaleConns))
 		}
 	}()
 }
 
+// GetRedisPoolStats 返回 Redis 连接池的当前统计，未启用 Redis 时返回 false；
+// Timeouts 持续增长通常意味着连接池耗尽
+func GetRedisPoolStats() (*redis.PoolStats, bool) {
+	if !RedisEnabled || RDB == nil {
+		return nil, false
+	}
+	return RDB.PoolStats(), true
+}
+
 func ParseRedisOption() *redis.Options {
 	opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
 	if err != nil {
@@ -147,6 +159,38 @@ func RedisGet(key string) (string, error) {
 	return val, err
 }
 
+// RedisMGet 通过 pipeline 批量读取多个字符串键，仅返回存在的键；单个键不存在（redis.Nil）时跳过，
+// 其余错误直接返回
+func RedisMGet(keys []string) (map[string]string, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis MGET: keys=%v", keys))
+	}
+	result := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	ctx := context.Background()
+	pipe := RDB.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to execute pipeline: %w", err)
+	}
+	for i, cmd := range cmds {
+		val, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key %s: %w", keys[i], err)
+		}
+		result[keys[i]] = val
+	}
+	return result, nil
+}
+
 //func RedisExpire(key string, expiration time.Duration) error {
 //	ctx := context.Background()
 //	return RDB.Expire(ctx, key, expiration).Err()
@@ -173,26 +217,104 @@ func RedisDelKey(key string) error {
 	return RDB.Del(ctx, key).Err()
 }
 
-func RedisHSetObj(key string, obj interface{}, expiration time.Duration) error {
+// redisUnlockScript 仅当锁仍由调用方持有时才删除，避免误删其他节点的锁
+var redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisTryLock 使用 SET NX PX 尝试获取分布式锁，成功时返回用于解锁的随机 token
+func RedisTryLock(key string, ttl time.Duration) (token string, acquired bool, err error) {
+	if ttl <= 0 {
+		return "", false, fmt.Errorf("invalid lock ttl: %v", ttl)
+	}
 	if DebugEnabled {
-		SysLog(fmt.Sprintf("Redis HSET: key=%s, obj=%+v, expiration=%v", key, obj, expiration))
+		SysLog(fmt.Sprintf("Redis LOCK: key=%s, ttl=%v", key, ttl))
+	}
+	token = GetUUID()
+	ctx := context.Background()
+	acquired, err = RDB.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if !acquired {
+		return "", false, nil
+	}
+	return token, true, nil
+}
+
+// RedisUnlock 释放由 RedisTryLock 获取的锁，token 不匹配时不做任何操作
+func RedisUnlock(key, token string) error {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis UNLOCK: key=%s", key))
+	}
+	if token == "" {
+		return errors.New("empty lock token")
 	}
 	ctx := context.Background()
+	if err := redisUnlockScript.Run(ctx, RDB, []string{key}, token).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to release lock %s: %w", key, err)
+	}
+	return nil
+}
+
+// redisHashJSONTag 标记需要以 JSON 编码写入 hash 的字段，如 `redis:"json"`
+const redisHashJSONTag = "json"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func redisHashFieldUsesJSON(field reflect.StructField) bool {
+	return field.Tag.Get("redis") == redisHashJSONTag
+}
+
+func isRedisHashJSONKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Struct, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	default:
+		return false
+	}
+}
+
+// redisHashFromObj 将结构体转换为 hash 字段，基础类型走快速路径，
+// time.Time 使用 RFC3339Nano，其余 struct/slice/map 字段以 JSON 编码
+func redisHashFromObj(obj interface{}) (map[string]interface{}, error) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("obj must be a struct or a pointer to a struct, got %T", obj)
+	}
 
 	data := make(map[string]interface{})
 
 	// 使用反射遍历结构体字段
-	v := reflect.ValueOf(obj).Elem()
 	t := v.Type()
 	for i := 0; i < v.NumField(); i++ {
 		field := t.Field(i)
 		value := v.Field(i)
 
+		if !field.IsExported() {
+			continue
+		}
+
 		// Skip DeletedAt field
 		if field.Type.String() == "gorm.DeletedAt" {
 			continue
 		}
 
+		if redisHashFieldUsesJSON(field) {
+			encoded, err := Marshal(value.Interface())
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal field %s: %w", field.Name, err)
+			}
+			data[field.Name] = string(encoded)
+			continue
+		}
+
 		// 处理指针类型
 		if value.Kind() == reflect.Ptr {
 			if value.IsNil() {
@@ -202,14 +324,37 @@ func RedisHSetObj(key string, obj interface{}, expiration time.Duration) error {
 			value = value.Elem()
 		}
 
-		// 处理布尔类型
-		if value.Kind() == reflect.Bool {
+		switch {
+		case value.Kind() == reflect.Bool:
+			// 处理布尔类型
 			data[field.Name] = strconv.FormatBool(value.Bool())
-			continue
+		case value.Type() == timeType:
+			data[field.Name] = value.Interface().(time.Time).Format(time.RFC3339Nano)
+		case value.Kind() == reflect.String:
+			data[field.Name] = compressRedisHashString(value.String())
+		case isRedisHashJSONKind(value.Kind()):
+			encoded, err := Marshal(value.Interface())
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal field %s: %w", field.Name, err)
+			}
+			data[field.Name] = string(encoded)
+		default:
+			// 其他类型直接转换为字符串
+			data[field.Name] = fmt.Sprintf("%v", value.Interface())
 		}
+	}
+	return data, nil
+}
+
+func RedisHSetObj(key string, obj interface{}, expiration time.Duration) error {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HSET: key=%s, obj=%+v, expiration=%v", key, obj, expiration))
+	}
+	ctx := context.Background()
 
-		// 其他类型直接转换为字符串
-		data[field.Name] = fmt.Sprintf("%v", value.Interface())
+	data, err := redisHashFromObj(obj)
+	if err != nil {
+		return err
 	}
 
 	txn := RDB.TxPipeline()
@@ -220,7 +365,7 @@ func RedisHSetObj(key string, obj interface{}, expiration time.Duration) error {
 		txn.Expire(ctx, key, expiration)
 	}
 
-	_, err := txn.Exec(ctx)
+	_, err = txn.Exec(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to execute transaction: %w", err)
 	}
@@ -242,6 +387,11 @@ func RedisHGetObj(key string, obj interface{}) error {
 		return fmt.Errorf("key %s not found in Redis", key)
 	}
 
+	return redisHashToObj(result, obj)
+}
+
+// redisHashToObj 将 hash 字段回填到结构体，与 redisHashFromObj 的编码规则对应
+func redisHashToObj(result map[string]string, obj interface{}) error {
 	// Handle both pointer and non-pointer values
 	val := reflect.ValueOf(obj)
 	if val.Kind() != reflect.Ptr {
@@ -257,57 +407,127 @@ func RedisHGetObj(key string, obj interface{}) error {
 	for i := 0; i < v.NumField(); i++ {
 		field := t.Field(i)
 		fieldName := field.Name
-		if value, ok := result[fieldName]; ok {
-			fieldValue := v.Field(i)
+		value, ok := result[fieldName]
+		if !ok || !field.IsExported() {
+			continue
+		}
+		fieldValue := v.Field(i)
 
-			// Handle pointer types
-			if fieldValue.Kind() == reflect.Ptr {
-				if value == "" {
-					continue
-				}
-				if fieldValue.IsNil() {
-					fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
-				}
-				fieldValue = fieldValue.Elem()
+		if redisHashFieldUsesJSON(field) {
+			if err := Unmarshal([]byte(value), fieldValue.Addr().Interface()); err != nil {
+				return fmt.Errorf("failed to unmarshal field %s: %w", fieldName, err)
 			}
+			continue
+		}
 
-			// Enhanced type handling for Token struct
-			switch fieldValue.Kind() {
-			case reflect.String:
-				fieldValue.SetString(value)
-			case reflect.Int, reflect.Int64:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err != nil {
-					return fmt.Errorf("failed to parse int field %s: %w", fieldName, err)
-				}
-				fieldValue.SetInt(intValue)
-			case reflect.Bool:
-				boolValue, err := strconv.ParseBool(value)
-				if err != nil {
-					return fmt.Errorf("failed to parse bool field %s: %w", fieldName, err)
-				}
-				fieldValue.SetBool(boolValue)
-			case reflect.Struct:
+		// Handle pointer types
+		if fieldValue.Kind() == reflect.Ptr {
+			if value == "" {
+				continue
+			}
+			if fieldValue.IsNil() {
+				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		// Enhanced type handling for Token struct
+		switch fieldValue.Kind() {
+		case reflect.String:
+			decoded, err := decompressRedisHashString(value)
+			if err != nil {
+				return fmt.Errorf("failed to decode string field %s: %w", fieldName, err)
+			}
+			fieldValue.SetString(decoded)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			intValue, err := strconv.ParseInt(value, 10, fieldValue.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("failed to parse int field %s: %w", fieldName, err)
+			}
+			fieldValue.SetInt(intValue)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			uintValue, err := strconv.ParseUint(value, 10, fieldValue.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("failed to parse uint field %s: %w", fieldName, err)
+			}
+			fieldValue.SetUint(uintValue)
+		case reflect.Float32, reflect.Float64:
+			floatValue, err := strconv.ParseFloat(value, fieldValue.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("failed to parse float field %s: %w", fieldName, err)
+			}
+			fieldValue.SetFloat(floatValue)
+		case reflect.Bool:
+			boolValue, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse bool field %s: %w", fieldName, err)
+			}
+			fieldValue.SetBool(boolValue)
+		case reflect.Struct:
+			switch {
+			case fieldValue.Type().String() == "gorm.DeletedAt":
 				// Special handling for gorm.DeletedAt
-				if fieldValue.Type().String() == "gorm.DeletedAt" {
-					if value != "" {
-						timeValue, err := time.Parse(time.RFC3339, value)
-						if err != nil {
-							return fmt.Errorf("failed to parse DeletedAt field %s: %w", fieldName, err)
-						}
-						fieldValue.Set(reflect.ValueOf(gorm.DeletedAt{Time: timeValue, Valid: true}))
+				if value != "" {
+					timeValue, err := time.Parse(time.RFC3339, value)
+					if err != nil {
+						return fmt.Errorf("failed to parse DeletedAt field %s: %w", fieldName, err)
+					}
+					fieldValue.Set(reflect.ValueOf(gorm.DeletedAt{Time: timeValue, Valid: true}))
+				}
+			case fieldValue.Type() == timeType:
+				if value != "" {
+					timeValue, err := time.Parse(time.RFC3339Nano, value)
+					if err != nil {
+						return fmt.Errorf("failed to parse time field %s: %w", fieldName, err)
 					}
+					fieldValue.Set(reflect.ValueOf(timeValue))
 				}
 			default:
-				return fmt.Errorf("unsupported field type: %s for field %s", fieldValue.Kind(), fieldName)
+				if err := Unmarshal([]byte(value), fieldValue.Addr().Interface()); err != nil {
+					return fmt.Errorf("failed to unmarshal field %s: %w", fieldName, err)
+				}
+			}
+		case reflect.Slice, reflect.Map, reflect.Array:
+			if err := Unmarshal([]byte(value), fieldValue.Addr().Interface()); err != nil {
+				return fmt.Errorf("failed to unmarshal field %s: %w", fieldName, err)
 			}
+		default:
+			return fmt.Errorf("unsupported field type: %s for field %s", fieldValue.Kind(), fieldName)
 		}
 	}
 
 	return nil
 }
 
+// redisTTLNoExpire 为 TTL 命令对“键存在但没有过期时间”返回的值（键不存在时为 -2）
+const redisTTLNoExpire = time.Duration(-1)
+
+// 持久键在同一脚本内检查存在并写入，避免键在 TTL 查询之后被删除时重新创建出不完整的条目；键不存在时返回 nil
+var (
+	redisIncrIfExistsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+return redis.call('INCRBY', KEYS[1], ARGV[1])
+`)
+	redisHIncrByIfExistsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+return redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+`)
+	redisHSetFieldIfExistsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+)
+
 // RedisIncr Add this function to handle atomic increments
+// RedisIncr、RedisHIncrBy 与 RedisHSetField 只修改已存在的键：带过期时间的键在事务中保留原 TTL，
+// 持久键通过脚本原子地检查存在并写入；键不存在时不做任何操作，避免为缓存生成不完整的条目
 func RedisIncr(key string, delta int64) error {
 	if DebugEnabled {
 		SysLog(fmt.Sprintf("Redis INCR: key=%s, delta=%d", key, delta))
@@ -338,17 +558,30 @@ func RedisIncr(key string, delta int64) error {
 		_, err = txn.Exec(ctx)
 		return err
 	}
+	if ttl == redisTTLNoExpire {
+		err := redisIncrIfExistsScript.Run(context.Background(), RDB, []string{key}, delta).Err()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
 	return nil
 }
 
 func RedisHIncrBy(key, field string, delta int64) error {
+	_, _, err := RedisHIncrByWithResult(key, field, delta)
+	return err
+}
+
+// RedisHIncrByWithResult 与 RedisHIncrBy 相同，额外返回自增后的值；键不存在时不做修改，applied 为 false
+func RedisHIncrByWithResult(key, field string, delta int64) (value int64, applied bool, err error) {
 	if DebugEnabled {
 		SysLog(fmt.Sprintf("Redis HINCRBY: key=%s, field=%s, delta=%d", key, field, delta))
 	}
 	ttlCmd := RDB.TTL(context.Background(), key)
 	ttl, err := ttlCmd.Result()
 	if err != nil && !errors.Is(err, redis.Nil) {
-		return fmt.Errorf("failed to get TTL: %w", err)
+		return 0, false, fmt.Errorf("failed to get TTL: %w", err)
 	}
 
 	if ttl > 0 {
@@ -357,15 +590,27 @@ func RedisHIncrBy(key, field string, delta int64) error {
 
 		incrCmd := txn.HIncrBy(ctx, key, field, delta)
 		if err := incrCmd.Err(); err != nil {
-			return err
+			return 0, false, err
 		}
 
 		txn.Expire(ctx, key, ttl)
 
-		_, err = txn.Exec(ctx)
-		return err
+		if _, err = txn.Exec(ctx); err != nil {
+			return 0, false, err
+		}
+		return incrCmd.Val(), true, nil
 	}
-	return nil
+	if ttl == redisTTLNoExpire {
+		value, err := redisHIncrByIfExistsScript.Run(context.Background(), RDB, []string{key}, field, delta).Int64()
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		return value, true, nil
+	}
+	return 0, false, nil
 }
 
 func RedisHSetField(key, field string, value interface{}) error {
@@ -392,5 +637,12 @@ func RedisHSetField(key, field string, value interface{}) error {
 		_, err = txn.Exec(ctx)
 		return err
 	}
+	if ttl == redisTTLNoExpire {
+		err := redisHSetFieldIfExistsScript.Run(context.Background(), RDB, []string{key}, field, value).Err()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
 	return nil
 }
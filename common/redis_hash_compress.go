@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// redisHashCompressedPrefix 标记经 gzip 压缩的 hash 字符串字段，以控制字符开头，不会与正常文本冲突
+const redisHashCompressedPrefix = "\x1fgz1:"
+
+// compressRedisHashString 在开启 RedisHashCompressThreshold 且字符串超过阈值时返回带标记的 gzip 数据，
+// 小字段或压缩后没有变小的值保持原样，读取时无需额外开销
+func compressRedisHashString(value string) string {
+	if RedisHashCompressThreshold <= 0 || len(value) <= RedisHashCompressThreshold {
+		return value
+	}
+	var buf bytes.Buffer
+	buf.WriteString(redisHashCompressedPrefix)
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(value)); err != nil {
+		return value
+	}
+	if err := writer.Close(); err != nil {
+		return value
+	}
+	if buf.Len() >= len(value) {
+		return value
+	}
+	return buf.String()
+}
+
+// decompressRedisHashString 还原 compressRedisHashString 写入的值，未带标记的值原样返回，
+// 因此关闭压缩后仍可读取此前写入的压缩数据
+func decompressRedisHashString(value string) (string, error) {
+	if !strings.HasPrefix(value, redisHashCompressedPrefix) {
+		return value, nil
+	}
+	reader, err := gzip.NewReader(strings.NewReader(value[len(redisHashCompressedPrefix):]))
+	if err != nil {
+		return "", fmt.Errorf("failed to open compressed hash value: %w", err)
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress hash value: %w", err)
+	}
+	return string(decoded), nil
+}
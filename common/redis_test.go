@@ -0,0 +1,219 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+type redisHashTestSettings struct {
+	Theme  string `json:"theme"`
+	Limits []int  `json:"limits"`
+	Nested *struct {
+		Enabled bool `json:"enabled"`
+	} `json:"nested,omitempty"`
+}
+
+type redisHashTestObj struct {
+	Id        int
+	Name      string
+	Ratio     float64
+	Enabled   bool
+	Remark    *string
+	CreatedAt time.Time
+	Settings  redisHashTestSettings
+	Tags      []string
+	Extra     map[string]int
+	Raw       string                 `redis:"json"`
+	Opt       *redisHashTestSettings `redis:"json"`
+}
+
+func TestRedisHashObjRoundTrip(t *testing.T) {
+	remark := "hello"
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	src := redisHashTestObj{
+		Id:        42,
+		Name:      "user",
+		Ratio:     1.5,
+		Enabled:   true,
+		Remark:    &remark,
+		CreatedAt: createdAt,
+		Settings:  redisHashTestSettings{Theme: "dark", Limits: []int{1, 2, 3}},
+		Tags:      []string{"a", "b"},
+		Extra:     map[string]int{"x": 1},
+		Raw:       "with \"quotes\"",
+		Opt:       &redisHashTestSettings{Theme: "light"},
+	}
+
+	data, err := redisHashFromObj(&src)
+	require.NoError(t, err)
+	require.Equal(t, "42", data["Id"])
+	require.Equal(t, "true", data["Enabled"])
+	require.Equal(t, createdAt.Format(time.RFC3339Nano), data["CreatedAt"])
+	require.Equal(t, `{"theme":"dark","limits":[1,2,3]}`, data["Settings"])
+	require.Equal(t, `"with \"quotes\""`, data["Raw"])
+
+	result := make(map[string]string, len(data))
+	for k, v := range data {
+		result[k] = v.(string)
+	}
+
+	var dst redisHashTestObj
+	require.NoError(t, redisHashToObj(result, &dst))
+	require.Equal(t, src.Id, dst.Id)
+	require.Equal(t, src.Name, dst.Name)
+	require.Equal(t, src.Ratio, dst.Ratio)
+	require.Equal(t, src.Enabled, dst.Enabled)
+	require.NotNil(t, dst.Remark)
+	require.Equal(t, remark, *dst.Remark)
+	require.True(t, createdAt.Equal(dst.CreatedAt))
+	require.Equal(t, src.Settings, dst.Settings)
+	require.Equal(t, src.Tags, dst.Tags)
+	require.Equal(t, src.Extra, dst.Extra)
+	require.Equal(t, src.Raw, dst.Raw)
+	require.Equal(t, src.Opt, dst.Opt)
+}
+
+func TestRedisHashObjNilPointers(t *testing.T) {
+	data, err := redisHashFromObj(&redisHashTestObj{})
+	require.NoError(t, err)
+	require.Equal(t, "", data["Remark"])
+	require.Equal(t, "null", data["Opt"])
+
+	result := make(map[string]string, len(data))
+	for k, v := range data {
+		result[k] = v.(string)
+	}
+	var dst redisHashTestObj
+	require.NoError(t, redisHashToObj(result, &dst))
+	require.Nil(t, dst.Remark)
+	require.Nil(t, dst.Opt)
+}
+
+func TestRedisHashToObjRequiresStructPointer(t *testing.T) {
+	var dst redisHashTestObj
+	require.Error(t, redisHashToObj(map[string]string{"Id": "1"}, dst))
+	require.Error(t, redisHashToObj(map[string]string{"Id": "abc"}, &dst))
+}
+
+func TestRedisHashObjCompressesLargeStrings(t *testing.T) {
+	original := RedisHashCompressThreshold
+	t.Cleanup(func() { RedisHashCompressThreshold = original })
+	RedisHashCompressThreshold = 64
+
+	large := strings.Repeat(`{"sidebar":"chat,console,setting"}`, 50)
+	src := redisHashTestObj{Name: large, Remark: &large, Raw: "small"}
+	data, err := redisHashFromObj(&src)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(data["Name"].(string), redisHashCompressedPrefix))
+	require.Less(t, len(data["Name"].(string)), len(large))
+	require.True(t, strings.HasPrefix(data["Remark"].(string), redisHashCompressedPrefix))
+
+	result := make(map[string]string, len(data))
+	for k, v := range data {
+		result[k] = v.(string)
+	}
+	var dst redisHashTestObj
+	require.NoError(t, redisHashToObj(result, &dst))
+	require.Equal(t, large, dst.Name)
+	require.Equal(t, large, *dst.Remark)
+
+	// 关闭压缩后仍能读取已压缩的数据，小字段不压缩
+	RedisHashCompressThreshold = 0
+	dst = redisHashTestObj{}
+	require.NoError(t, redisHashToObj(result, &dst))
+	require.Equal(t, large, dst.Name)
+	require.Equal(t, "short", compressRedisHashString("short"))
+}
+
+func TestRedisMGetMixedHitAndMiss(t *testing.T) {
+	server := miniredis.RunT(t)
+	originalRDB := RDB
+	RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		_ = RDB.Close()
+		RDB = originalRDB
+	})
+
+	require.NoError(t, server.Set("mget:a", "1"))
+	require.NoError(t, server.Set("mget:c", "3"))
+
+	result, err := RedisMGet([]string{"mget:a", "mget:b", "mget:c"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"mget:a": "1", "mget:c": "3"}, result)
+
+	result, err = RedisMGet(nil)
+	require.NoError(t, err)
+	require.Empty(t, result)
+}
+
+func TestRedisCounterWritesPreserveTTLAndPersistentKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	originalRDB := RDB
+	RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		_ = RDB.Close()
+		RDB = originalRDB
+	})
+
+	// 持久键（无 TTL）也应执行写入
+	require.NoError(t, server.Set("counter:persistent", "10"))
+	require.NoError(t, RedisIncr("counter:persistent", 5))
+	value, err := server.Get("counter:persistent")
+	require.NoError(t, err)
+	require.Equal(t, "15", value)
+	require.Zero(t, server.TTL("counter:persistent"))
+
+	server.HSet("hash:persistent", "Quota", "100")
+	require.NoError(t, RedisHIncrBy("hash:persistent", "Quota", -30))
+	require.Equal(t, "70", server.HGet("hash:persistent", "Quota"))
+	require.NoError(t, RedisHSetField("hash:persistent", "Status", 2))
+	require.Equal(t, "2", server.HGet("hash:persistent", "Status"))
+
+	// 带 TTL 的键在写入后保留原过期时间
+	server.HSet("hash:ttl", "Quota", "100")
+	server.SetTTL("hash:ttl", time.Minute)
+	require.NoError(t, RedisHIncrBy("hash:ttl", "Quota", 1))
+	require.Equal(t, "101", server.HGet("hash:ttl", "Quota"))
+	require.Equal(t, time.Minute, server.TTL("hash:ttl"))
+
+	// 不存在的键不会被创建
+	require.NoError(t, RedisIncr("counter:missing", 1))
+	require.NoError(t, RedisHIncrBy("hash:missing", "Quota", 1))
+	require.False(t, server.Exists("counter:missing"))
+	require.False(t, server.Exists("hash:missing"))
+
+	// 持久键在 TTL 查询之后被删除时，脚本内的存在检查同样不会重新创建
+	ctx := context.Background()
+	require.ErrorIs(t, redisIncrIfExistsScript.Run(ctx, RDB, []string{"counter:missing"}, 1).Err(), redis.Nil)
+	require.ErrorIs(t, redisHIncrByIfExistsScript.Run(ctx, RDB, []string{"hash:missing"}, "Quota", 1).Err(), redis.Nil)
+	require.ErrorIs(t, redisHSetFieldIfExistsScript.Run(ctx, RDB, []string{"hash:missing"}, "Status", 2).Err(), redis.Nil)
+	require.False(t, server.Exists("counter:missing"))
+	require.False(t, server.Exists("hash:missing"))
+}
+
+func TestGetRedisPoolStats(t *testing.T) {
+	originalRDB, originalEnabled := RDB, RedisEnabled
+	t.Cleanup(func() { RDB, RedisEnabled = originalRDB, originalEnabled })
+
+	RDB, RedisEnabled = nil, true
+	_, ok := GetRedisPoolStats()
+	require.False(t, ok)
+
+	server := miniredis.RunT(t)
+	RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = RDB.Close() })
+	require.NoError(t, RedisSet("pool:stats", "1", 0))
+	stats, ok := GetRedisPoolStats()
+	require.True(t, ok)
+	require.GreaterOrEqual(t, stats.TotalConns, uint32(1))
+
+	RedisEnabled = false
+	_, ok = GetRedisPoolStats()
+	require.False(t, ok)
+}
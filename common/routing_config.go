@@ -0,0 +1,30 @@
+package common
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// routingConfigVersion 路由相关配置（分组、自动分组等）的版本号，每次变更递增，
+// 路由解析缓存据此判定条目是否在配置变更前写入，无需遍历缓存即可立即失效
+var routingConfigVersion atomic.Uint64
+
+// routingConfigChangedAt 最近一次路由配置变更的时间（UnixNano），用于判断跨节点共享的缓存条目是否写于变更之前
+var routingConfigChangedAt atomic.Int64
+
+// RoutingConfigVersion 返回当前路由配置版本号
+func RoutingConfigVersion() uint64 {
+	return routingConfigVersion.Load()
+}
+
+// BumpRoutingConfigVersion 在路由相关配置变更后递增版本号，返回新版本号
+func BumpRoutingConfigVersion() uint64 {
+	// 先记录变更时间再递增版本号，读到新版本号的一方一定也能看到新的变更时间
+	routingConfigChangedAt.Store(time.Now().UnixNano())
+	return routingConfigVersion.Add(1)
+}
+
+// RoutingConfigChangedAt 返回最近一次路由配置变更的时间（UnixNano），从未变更时为 0
+func RoutingConfigChangedAt() int64 {
+	return routingConfigChangedAt.Load()
+}
@@ -0,0 +1,288 @@
+package common
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTTLCacheShardCount = 16
+	// minTTLCacheShardEntries 保证每个分片至少有这么多容量，避免小缓存因分片过细而频繁误淘汰
+	minTTLCacheShardEntries = 64
+)
+
+// TTLCacheStats 是单个命名缓存的运行指标
+type TTLCacheStats struct {
+	Name        string `json:"name"`
+	Size        int    `json:"size"`
+	MaxEntries  int    `json:"max_entries"`
+	TTLSeconds  int64  `json:"ttl_seconds"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+type ttlCacheStatsProvider interface {
+	Stats() TTLCacheStats
+}
+
+var ttlCacheRegistry sync.Map // map[string]ttlCacheStatsProvider
+
+type ttlCacheEntry[K comparable, V any] struct {
+	key              K
+	value            V
+	expireAtUnixNano int64
+}
+
+type ttlCacheShard[K comparable, V any] struct {
+	mu         sync.Mutex
+	items      map[K]*list.Element
+	lru        *list.List
+	maxEntries int
+}
+
+// TTLCache 是分片的 LRU 缓存，每个条目带独立过期时间，用于负缓存等有界短期缓存场景。
+// 容量按分片均分，分片满时淘汰该分片中最久未使用的条目。
+type TTLCache[K comparable, V any] struct {
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	seed       maphash.Seed
+	shards     []*ttlCacheShard[K, V]
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// NewTTLCache 创建并注册一个命名缓存，maxEntries/ttl <= 0 时分别使用 10000 与 1 分钟
+func NewTTLCache[K comparable, V any](name string, maxEntries int, ttl time.Duration) *TTLCache[K, V] {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	shardCount := defaultTTLCacheShardCount
+	if maxEntries/minTTLCacheShardEntries < shardCount {
+		shardCount = max(1, maxEntries/minTTLCacheShardEntries)
+	}
+	perShard := (maxEntries + shardCount - 1) / shardCount
+	cache := &TTLCache[K, V]{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		seed:       maphash.MakeSeed(),
+		shards:     make([]*ttlCacheShard[K, V], shardCount),
+	}
+	for i := range cache.shards {
+		cache.shards[i] = &ttlCacheShard[K, V]{
+			items:      make(map[K]*list.Element),
+			lru:        list.New(),
+			maxEntries: perShard,
+		}
+	}
+	if name != "" {
+		ttlCacheRegistry.Store(name, cache)
+	}
+	return cache
+}
+
+// NewTTLCacheFromEnv 创建命名缓存，容量与 TTL 可通过 <NAME>_CACHE_MAX_ENTRIES 与
+// <NAME>_CACHE_TTL_SECONDS 环境变量覆盖，NAME 为 name 转大写并将 - 和 . 替换为 _
+func NewTTLCacheFromEnv[K comparable, V any](name string, defaultMaxEntries int, defaultTTL time.Duration) *TTLCache[K, V] {
+	prefix := TTLCacheEnvPrefix(name)
+	maxEntries := GetEnvOrDefault(prefix+"_CACHE_MAX_ENTRIES", defaultMaxEntries)
+	ttlSeconds := GetEnvOrDefault(prefix+"_CACHE_TTL_SECONDS", int(defaultTTL/time.Second))
+	return NewTTLCache[K, V](name, maxEntries, time.Duration(ttlSeconds)*time.Second)
+}
+
+func TTLCacheEnvPrefix(name string) string {
+	return strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(strings.ToUpper(strings.TrimSpace(name)))
+}
+
+func (c *TTLCache[K, V]) shard(key K) *ttlCacheShard[K, V] {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[maphash.Comparable(c.seed, key)%uint64(len(c.shards))]
+}
+
+func (c *TTLCache[K, V]) Name() string {
+	return c.name
+}
+
+func (c *TTLCache[K, V]) TTL() time.Duration {
+	return c.ttl
+}
+
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	s := c.shard(key)
+	nowNanos := time.Now().UnixNano()
+
+	s.mu.Lock()
+	elem, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		c.misses.Add(1)
+		return zero, false
+	}
+	entry := elem.Value.(*ttlCacheEntry[K, V])
+	if nowNanos > entry.expireAtUnixNano {
+		s.lru.Remove(elem)
+		delete(s.items, key)
+		s.mu.Unlock()
+		c.expirations.Add(1)
+		c.misses.Add(1)
+		return zero, false
+	}
+	s.lru.MoveToFront(elem)
+	value := entry.value
+	s.mu.Unlock()
+	c.hits.Add(1)
+	return value, true
+}
+
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *TTLCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	expireAt := time.Now().Add(ttl).UnixNano()
+	s := c.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		entry := elem.Value.(*ttlCacheEntry[K, V])
+		entry.value = value
+		entry.expireAtUnixNano = expireAt
+		s.lru.MoveToFront(elem)
+		return
+	}
+	for s.lru.Len() >= s.maxEntries {
+		oldest := s.lru.Back()
+		if oldest == nil {
+			break
+		}
+		s.lru.Remove(oldest)
+		delete(s.items, oldest.Value.(*ttlCacheEntry[K, V]).key)
+		c.evictions.Add(1)
+	}
+	s.items[key] = s.lru.PushFront(&ttlCacheEntry[K, V]{key: key, value: value, expireAtUnixNano: expireAt})
+}
+
+func (c *TTLCache[K, V]) Delete(key K) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.items[key]
+	if !ok {
+		return false
+	}
+	s.lru.Remove(elem)
+	delete(s.items, key)
+	return true
+}
+
+func (c *TTLCache[K, V]) Purge() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.items = make(map[K]*list.Element)
+		s.lru.Init()
+		s.mu.Unlock()
+	}
+}
+
+// DeleteIf 删除 match 返回 true 的条目（含已过期条目），返回删除数量。需遍历全部条目，仅用于低频的批量失效
+func (c *TTLCache[K, V]) DeleteIf(match func(key K, value V) bool) int {
+	removed := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for elem := s.lru.Back(); elem != nil; {
+			prev := elem.Prev()
+			entry := elem.Value.(*ttlCacheEntry[K, V])
+			if match(entry.key, entry.value) {
+				s.lru.Remove(elem)
+				delete(s.items, entry.key)
+				removed++
+			}
+			elem = prev
+		}
+		s.mu.Unlock()
+	}
+	return removed
+}
+
+// CleanupExpired 主动清理已过期条目，返回清理数量
+func (c *TTLCache[K, V]) CleanupExpired() int {
+	nowNanos := time.Now().UnixNano()
+	removed := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for elem := s.lru.Back(); elem != nil; {
+			prev := elem.Prev()
+			entry := elem.Value.(*ttlCacheEntry[K, V])
+			if nowNanos > entry.expireAtUnixNano {
+				s.lru.Remove(elem)
+				delete(s.items, entry.key)
+				removed++
+			}
+			elem = prev
+		}
+		s.mu.Unlock()
+	}
+	if removed > 0 {
+		c.expirations.Add(uint64(removed))
+	}
+	return removed
+}
+
+func (c *TTLCache[K, V]) Len() int {
+	total := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		total += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return total
+}
+
+func (c *TTLCache[K, V]) Stats() TTLCacheStats {
+	return TTLCacheStats{
+		Name:        c.name,
+		Size:        c.Len(),
+		MaxEntries:  c.maxEntries,
+		TTLSeconds:  int64(c.ttl / time.Second),
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// GetTTLCacheStats 返回所有已注册命名缓存的指标，按名称排序
+func GetTTLCacheStats() []TTLCacheStats {
+	stats := make([]TTLCacheStats, 0)
+	ttlCacheRegistry.Range(func(_, value any) bool {
+		if provider, ok := value.(ttlCacheStatsProvider); ok {
+			stats = append(stats, provider.Stats())
+		}
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
@@ -0,0 +1,161 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLCacheGetSetDelete(t *testing.T) {
+	cache := NewTTLCache[string, int]("test_basic", 100, time.Minute)
+
+	_, ok := cache.Get("missing")
+	require.False(t, ok)
+
+	cache.Set("a", 1)
+	v, ok := cache.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	cache.Set("a", 2)
+	v, _ = cache.Get("a")
+	require.Equal(t, 2, v)
+	require.Equal(t, 1, cache.Len())
+
+	require.True(t, cache.Delete("a"))
+	require.False(t, cache.Delete("a"))
+	_, ok = cache.Get("a")
+	require.False(t, ok)
+
+	stats := cache.Stats()
+	require.Equal(t, "test_basic", stats.Name)
+	require.Equal(t, uint64(2), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestTTLCacheExpiry(t *testing.T) {
+	cache := NewTTLCache[int, string]("test_expiry", 10, time.Minute)
+	cache.SetWithTTL(1, "short", 20*time.Millisecond)
+	cache.Set(2, "long")
+
+	time.Sleep(40 * time.Millisecond)
+	_, ok := cache.Get(1)
+	require.False(t, ok)
+	_, ok = cache.Get(2)
+	require.True(t, ok)
+
+	cache.SetWithTTL(3, "short", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, 1, cache.CleanupExpired())
+	require.Equal(t, 1, cache.Len())
+	require.Equal(t, uint64(2), cache.Stats().Expirations)
+}
+
+func TestTTLCacheDeleteIf(t *testing.T) {
+	cache := NewTTLCache[int, string]("test_delete_if", 100, time.Minute)
+	for i := 0; i < 10; i++ {
+		cache.Set(i, fmt.Sprintf("v%d", i%2))
+	}
+	require.Equal(t, 5, cache.DeleteIf(func(_ int, value string) bool { return value == "v1" }))
+	require.Equal(t, 5, cache.Len())
+	_, ok := cache.Get(1)
+	require.False(t, ok)
+	_, ok = cache.Get(2)
+	require.True(t, ok)
+	require.Zero(t, cache.DeleteIf(func(int, string) bool { return false }))
+}
+
+func TestTTLCacheLRUEviction(t *testing.T) {
+	cache := NewTTLCache[int, int]("test_lru", 3, time.Minute)
+	require.Len(t, cache.shards, 1)
+	sharded := NewTTLCache[int, int]("test_lru_sharded", 4096, time.Minute)
+	require.Len(t, sharded.shards, defaultTTLCacheShardCount)
+
+	single := NewTTLCache[int, int]("", 1, time.Minute)
+	single.Set(1, 1)
+	single.Set(2, 2)
+	_, ok := single.Get(1)
+	require.False(t, ok)
+	_, ok = single.Get(2)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), single.Stats().Evictions)
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	require.LessOrEqual(t, cache.Len(), 3)
+	require.GreaterOrEqual(t, cache.Stats().Evictions, uint64(997))
+}
+
+func TestTTLCacheLRUKeepsRecentlyUsed(t *testing.T) {
+	cache := NewTTLCache[string, int]("", 2, time.Minute)
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	_, _ = cache.Get("a")
+	cache.Set("c", 3)
+
+	_, ok := cache.Get("a")
+	require.True(t, ok)
+	_, ok = cache.Get("b")
+	require.False(t, ok)
+	_, ok = cache.Get("c")
+	require.True(t, ok)
+}
+
+func TestTTLCacheRegistryAndEnv(t *testing.T) {
+	t.Setenv("TEST_ENV_NEG_CACHE_MAX_ENTRIES", "5")
+	t.Setenv("TEST_ENV_NEG_CACHE_TTL_SECONDS", "7")
+	cache := NewTTLCacheFromEnv[string, bool]("test-env.neg", 100, time.Minute)
+	require.Equal(t, 7*time.Second, cache.TTL())
+	require.Equal(t, 5, cache.Stats().MaxEntries)
+
+	found := false
+	for _, s := range GetTTLCacheStats() {
+		if s.Name == "test-env.neg" {
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestTTLCacheConcurrentAccess(t *testing.T) {
+	cache := NewTTLCache[string, int]("test_concurrent", 512, 50*time.Millisecond)
+
+	const workers = 32
+	const ops = 2000
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				key := fmt.Sprintf("k-%d", (w*ops+i)%1024)
+				switch i % 5 {
+				case 0, 1:
+					cache.Set(key, i)
+				case 2:
+					if v, ok := cache.Get(key); ok && v < 0 {
+						t.Errorf("unexpected value %d", v)
+					}
+				case 3:
+					cache.Delete(key)
+				case 4:
+					if i%200 == 4 {
+						cache.CleanupExpired()
+					} else {
+						cache.SetWithTTL(key, i, time.Millisecond)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, cache.Len(), 512+len(cache.shards))
+	stats := cache.Stats()
+	require.Equal(t, uint64(workers*ops/5), stats.Hits+stats.Misses)
+}
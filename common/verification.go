@@ -52,7 +52,7 @@ func VerifyCodeWithKey(key string, code string, purpose string) bool {
 	if !okay || int(now.Sub(value.time).Seconds()) >= VerificationValidMinutes*60 {
 		return false
 	}
-	return code == value.code
+	return SecureCompare(code, value.code)
 }
 
 func DeleteKey(key string, purpose string) {
@@ -25,6 +25,10 @@ const (
 	ContextKeyTokenRateLimitSuccessCount   ContextKey = "token_rate_limit_success_count"
 	ContextKeyTokenIPRateLimitCount        ContextKey = "token_ip_rate_limit_count"
 	ContextKeyTokenIPRateLimitSuccessCount ContextKey = "token_ip_rate_limit_success_count"
+	ContextKeyTokenModelMapping            ContextKey = "token_model_mapping"
+	// ContextKeyTokenRequestedModel 令牌级模型映射生效时记录客户端请求的原始模型，映射后的模型见 ContextKeyOriginalModel
+	ContextKeyTokenRequestedModel ContextKey = "token_requested_model"
+	ContextKeyTokenMappedModel    ContextKey = "token_mapped_model"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -44,6 +48,9 @@ const (
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
 
+	// ContextKeyChannelParamOverrideVersion 渠道参数覆盖原始配置的哈希，未被亲和模板改写时才设置，用于复用已编译的覆盖规则
+	ContextKeyChannelParamOverrideVersion ContextKey = "param_override_version"
+
 	ContextKeyAutoGroup           ContextKey = "auto_group"
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
@@ -73,4 +80,7 @@ const (
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
 	ContextKeyIsStream ContextKey = "is_stream"
+
+	// ContextKeyConsumeLogParams stores the last consume log params of the request for the structured access log
+	ContextKeyConsumeLogParams ContextKey = "consume_log_params"
 )
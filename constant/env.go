@@ -4,19 +4,32 @@ var StreamingTimeout int
 var DifyDebug bool
 var MaxFileDownloadMB int
 var StreamScannerMaxBufferMB int
+var StreamEventIdEnabled bool
+var StreamReplayBufferSize int
+var StreamReplayBufferMaxKB int
+var StreamReplayMaxStreams int
+var StreamReplayTTLSeconds int
 var ForceStreamOption bool
 var CountToken bool
 var GetMediaToken bool
 var GetMediaTokenNotStream bool
 var UpdateTask bool
 var MaxRequestBodyMB int
+var MaxRequestBodyBytes int64
+var CostAwareRoutingEnabled bool
+var QuotaWriteThroughEnabled bool
+var ConvertedRequestMaxBodyKB int
+var ParamOverrideMaxOperations int
 var AzureDefaultAPIVersion string
 var NotifyLimitCount int
 var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
 var ErrorLogEnabled bool
+var AccessLogJsonEnabled bool
 var TaskQueryLimit int
 var TaskTimeoutMinutes int
+var RedemptionCleanupIntervalMinutes int
+var QuotaRefundRecordRetentionDays int
 
 // temporary variable for sora patch, will be removed in future
 var TaskPricePatches []string
@@ -160,6 +160,8 @@ func testChannel(channel *model.Channel, testModel string, endpointType string,
 	group, _ := model.GetUserGroup(1, false)
 	c.Set("group", group)
 
+	// 测试请求不经过分发中间件，需自行释放 SetupContextForSelectedChannel 占用的渠道并发计数
+	defer service.ReleaseChannelInFlight(c)
 	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, testModel)
 	if newAPIError != nil {
 		return testResult{
@@ -170,7 +170,7 @@ func completeCodexOAuthWithChannelID(c *gin.Context, channelID int) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "oauth flow not started or session expired"})
 		return
 	}
-	if state != expectedState {
+	if !common.SecureCompare(state, expectedState) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "state mismatch"})
 		return
 	}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
@@ -124,7 +125,7 @@ func UpdateMidjourneyTaskBulk() {
 				useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
 				// 如果时间超过一小时，且进度不是100%，则认为任务失败
 				if useTime > 3600000 && task.Progress != "100%" {
-					responseItem.FailReason = "上游任务超时（超过1小时）"
+					responseItem.FailReason = i18n.TForUser(task.UserId, i18n.MsgTaskUpstreamTimeout)
 					responseItem.Status = "FAILURE"
 				}
 				if !checkMjTaskNeedUpdate(task, responseItem) {
@@ -190,7 +191,7 @@ func UpdateMidjourneyTaskBulk() {
 						Quota:     task.Quota,
 						Other: map[string]interface{}{
 							"task_id": task.MjId,
-							"reason":  "构图失败",
+							"reason":  i18n.TForUser(task.UserId, i18n.MsgTaskMidjourneyFailed),
 						},
 					})
 				}
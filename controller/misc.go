@@ -79,6 +79,8 @@ func GetStatus(c *gin.Context) {
 		"sse_concurrency_limit_enabled":     operation_setting.GetGeneralSetting().SSEConcurrencyLimitEnabled,
 		"sse_max_concurrent_per_user":       operation_setting.GetGeneralSetting().SSEMaxConcurrentPerUser,
 		"sse_max_concurrent_per_token":      operation_setting.GetGeneralSetting().SSEMaxConcurrentPerToken,
+		"sse_max_concurrent_per_group":      operation_setting.GetGeneralSetting().SSEMaxConcurrentPerGroup,
+		"sse_max_concurrent_per_ip":         operation_setting.GetGeneralSetting().SSEMaxConcurrentPerIP,
 		"quota_per_unit":                    common.QuotaPerUnit,
 		// 兼容旧前端：保留 display_in_currency，同时提供新的 quota_display_type
 		"display_in_currency":           operation_setting.IsCurrencyDisplay(),
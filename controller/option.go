@@ -262,6 +262,42 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "RateLimitExemptTokenIds", "RateLimitExemptUserIds":
+		err = setting.CheckRateLimitExemptIds(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ModelRequestRateLimitDurationMinutes",
+		"ModelRequestRateLimitDurationSeconds",
+		"ModelRequestIPRateLimitDurationSeconds":
+		v, parseErr := strconv.Atoi(option.Value.(string))
+		if parseErr != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": option.Key + " 必须是整数",
+			})
+			return
+		}
+		// 分钟与秒至少有一项为正数，秒数大于 0 时优先生效
+		switch option.Key {
+		case "ModelRequestRateLimitDurationMinutes":
+			err = setting.CheckRateLimitWindow(v, setting.ModelRequestRateLimitDurationSeconds)
+		case "ModelRequestRateLimitDurationSeconds":
+			err = setting.CheckRateLimitWindow(setting.ModelRequestRateLimitDurationMinutes, v)
+		default:
+			err = setting.CheckRateLimitWindow(setting.ModelRequestIPRateLimitDurationMinutes, v)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "ModelRequestIPRateLimitDurationMinutes":
 		v, parseErr := strconv.Atoi(option.Value.(string))
 		if parseErr != nil {
@@ -7,7 +7,10 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 )
 
 // PerformanceStats 性能统计信息
@@ -22,6 +25,16 @@ type PerformanceStats struct {
 	DiskSpaceInfo common.DiskSpaceInfo `json:"disk_space_info"`
 	// 配置信息
 	Config PerformanceConfig `json:"config"`
+	// 流式请求按结束原因的累计次数
+	StreamEndStats map[string]uint64 `json:"stream_end_stats"`
+	// 批量更新各类型待写入记录数
+	BatchUpdateQueueDepths [model.BatchUpdateTypeCount]int `json:"batch_update_queue_depths"`
+	// 用户缓存各层命中统计
+	UserCacheStats model.UserCacheStats `json:"user_cache_stats"`
+	// 各命名内存缓存（TTLCache）的容量、命中与淘汰统计
+	TTLCacheStats []common.TTLCacheStats `json:"ttl_cache_stats"`
+	// Redis 连接池统计，未启用 Redis 时为空
+	RedisPoolStats *redis.PoolStats `json:"redis_pool_stats,omitempty"`
 }
 
 // MemoryStats 内存统计
@@ -122,9 +135,16 @@ func GetPerformanceStats(c *gin.Context) {
 			NumGC:        memStats.NumGC,
 			NumGoroutine: runtime.NumGoroutine(),
 		},
-		DiskCacheInfo: diskCacheInfo,
-		DiskSpaceInfo: diskSpaceInfo,
-		Config:        config,
+		DiskCacheInfo:  diskCacheInfo,
+		DiskSpaceInfo:  diskSpaceInfo,
+		Config:         config,
+		StreamEndStats: relaycommon.GetStreamEndReasonStats(),
+	}
+	stats.BatchUpdateQueueDepths = model.BatchUpdateQueueDepths()
+	stats.UserCacheStats = model.GetUserCacheStats()
+	stats.TTLCacheStats = common.GetTTLCacheStats()
+	if poolStats, ok := common.GetRedisPoolStats(); ok {
+		stats.RedisPoolStats = poolStats
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -152,6 +172,8 @@ func ClearDiskCache(c *gin.Context) {
 // ResetPerformanceStats 重置性能统计
 func ResetPerformanceStats(c *gin.Context) {
 	common.ResetDiskCacheStats()
+	relaycommon.ResetStreamEndReasonStats()
+	model.ResetUserCacheStats()
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPerformanceStatsIncludesTTLCacheStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := common.NewTTLCache[string, int]("performance_stats_test", 16, time.Minute)
+	cache.Set("a", 1)
+	_, _ = cache.Get("a")
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/performance/stats", nil)
+	GetPerformanceStats(c)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var resp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			TTLCacheStats []common.TTLCacheStats `json:"ttl_cache_stats"`
+		} `json:"data"`
+	}
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.True(t, resp.Success)
+	var found *common.TTLCacheStats
+	for i := range resp.Data.TTLCacheStats {
+		if resp.Data.TTLCacheStats[i].Name == "performance_stats_test" {
+			found = &resp.Data.TTLCacheStats[i]
+		}
+	}
+	require.NotNil(t, found)
+	require.Equal(t, 1, found.Size)
+	require.Equal(t, uint64(1), found.Hits)
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ResetRateLimitRequest struct {
+	// Key 为完整的 Redis 限流键，必须以 rateLimit: 开头
+	Key string `json:"key"`
+	// Identifier 为模型请求限流的标识符，会同时清除总请求数与成功请求数两个限流键
+	Identifier string `json:"identifier"`
+}
+
+const rateLimitKeyPrefix = "rateLimit:"
+
+// ResetRateLimit 清除指定的限流状态，用于手动解除误触发的限流，仅支持基于 Redis 的限流
+func ResetRateLimit(c *gin.Context) {
+	if !common.RedisEnabled || common.RDB == nil {
+		common.ApiError(c, errors.New("未启用 Redis，无法重置限流"))
+		return
+	}
+
+	var req ResetRateLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.Key = strings.TrimSpace(req.Key)
+	req.Identifier = strings.TrimSpace(req.Identifier)
+
+	var keys []string
+	if req.Key != "" {
+		if !strings.HasPrefix(req.Key, rateLimitKeyPrefix) {
+			common.ApiError(c, fmt.Errorf("限流键必须以 %s 开头", rateLimitKeyPrefix))
+			return
+		}
+		keys = append(keys, req.Key)
+	}
+	if req.Identifier != "" {
+		keys = append(keys, middleware.ModelRateLimitRedisKeys(req.Identifier)...)
+	}
+	if len(keys) == 0 {
+		common.ApiError(c, errors.New("请提供 key 或 identifier"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), common.RateLimitRedisOpTimeout)
+	defer cancel()
+	lim := limiter.New(ctx, common.RDB)
+	for _, key := range keys {
+		if err := lim.Reset(ctx, key); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("管理员重置限流：%s", strings.Join(keys, ", ")))
+	common.ApiSuccess(c, gin.H{"keys": keys})
+}
+
+type RateLimitKillSwitchRequest struct {
+	Disabled bool `json:"disabled"`
+}
+
+// GetRateLimitKillSwitch 返回当前实例的限流应急开关状态
+func GetRateLimitKillSwitch(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{"disabled": middleware.IsRateLimitGloballyDisabled()})
+}
+
+// SetRateLimitKillSwitch 切换当前实例的限流应急开关，开启后所有限流中间件直接放行
+func SetRateLimitKillSwitch(c *gin.Context) {
+	var req RateLimitKillSwitchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	middleware.SetRateLimitGloballyDisabled(req.Disabled)
+	if req.Disabled {
+		model.RecordLog(c.GetInt("id"), model.LogTypeManage, "管理员开启限流应急开关，所有限流已停用")
+	} else {
+		model.RecordLog(c.GetInt("id"), model.LogTypeManage, "管理员关闭限流应急开关，限流已恢复")
+	}
+	common.ApiSuccess(c, gin.H{"disabled": req.Disabled})
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rateLimitExplainRequest struct {
+	// Config 为待预览的分组限流 JSON，留空时使用当前已保存的配置
+	Config     string `json:"config"`
+	UserGroup  string `json:"user_group"`
+	TokenGroup string `json:"token_group"`
+}
+
+// ExplainRateLimitGroup 预览分组限流配置对指定 (用户分组, 令牌分组) 的生效结果，不会保存配置
+func ExplainRateLimitGroup(c *gin.Context) {
+	var req rateLimitExplainRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	config := strings.TrimSpace(req.Config)
+	if config == "" {
+		config = setting.ModelRequestRateLimitGroup2JSONString()
+	}
+	total, success, source, err := setting.ExplainRateLimitGroup(config, strings.TrimSpace(req.UserGroup), strings.TrimSpace(req.TokenGroup))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"total_count":   total,
+			"success_count": success,
+			"source":        source,
+		},
+	})
+}
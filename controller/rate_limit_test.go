@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetRateLimit(t *testing.T) {
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.Log{}))
+
+	mr := miniredis.RunT(t)
+	oldRDB, oldEnabled := common.RDB, common.RedisEnabled
+	common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		_ = common.RDB.Close()
+		common.RDB, common.RedisEnabled = oldRDB, oldEnabled
+	})
+
+	reset := func(body string) tokenAPIResponse {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/rate_limit/reset", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("id", 1)
+		ResetRateLimit(c)
+		var resp tokenAPIResponse
+		require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// 只允许清除 rateLimit: 前缀的键，且必须提供 key 或 identifier
+	require.NoError(t, mr.Set("session:1", "x"))
+	resp := reset(`{"key":"session:1"}`)
+	require.False(t, resp.Success)
+	require.True(t, mr.Exists("session:1"))
+	require.False(t, reset(`{}`).Success)
+
+	ctx := context.Background()
+	require.NoError(t, common.RDB.HSet(ctx, "rateLimit:custom", "tokens", 0).Err())
+	modelKeys := middleware.ModelRateLimitRedisKeys("42")
+	for _, key := range modelKeys {
+		require.NoError(t, common.RDB.LPush(ctx, key, "1.000000").Err())
+	}
+
+	resp = reset(`{"key":"rateLimit:custom","identifier":"42"}`)
+	require.True(t, resp.Success, resp.Message)
+	require.False(t, mr.Exists("rateLimit:custom"))
+	for _, key := range modelKeys {
+		require.False(t, mr.Exists(key))
+	}
+}
@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/QuantumNous/new-api/common"
@@ -89,29 +91,32 @@ func AddRedemption(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": msg})
 		return
 	}
-	var keys []string
-	for i := 0; i < redemption.Count; i++ {
-		key := common.GetUUID()
-		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt("id"),
-			Name:        redemption.Name,
-			Key:         key,
-			CreatedTime: common.GetTimestamp(),
-			Quota:       redemption.Quota,
-			MaxUses:     redemption.MaxUses,
-			ExpiredTime: redemption.ExpiredTime,
-		}
-		err = cleanRedemption.Insert()
-		if err != nil {
-			common.SysError("failed to insert redemption: " + err.Error())
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": i18n.T(c, i18n.MsgRedemptionCreateFailed),
-				"data":    keys,
-			})
-			return
-		}
-		keys = append(keys, key)
+	if !validateRedemptionPlan(redemption.PlanId) {
+		common.ApiErrorI18n(c, i18n.MsgRedemptionPlanUnavailable)
+		return
+	}
+	if len(strings.TrimSpace(redemption.Prefix)) > model.RedemptionKeyMaxPrefixLength {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	redemption.UserId = c.GetInt("id")
+	created, err := model.BatchCreateRedemptions(redemption, redemption.Count, redemption.Prefix)
+	if errors.Is(err, model.ErrRedemptionInvalidDisplayAmount) {
+		common.ApiError(c, err)
+		return
+	}
+	if err != nil {
+		common.SysError("failed to insert redemption: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.T(c, i18n.MsgRedemptionCreateFailed),
+			"data":    []string{},
+		})
+		return
+	}
+	keys := make([]string, 0, len(created))
+	for _, item := range created {
+		keys = append(keys, model.FormatRedemptionKey(item.Key, redemption.Prefix))
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -121,6 +126,18 @@ func AddRedemption(c *gin.Context) {
 	return
 }
 
+// validateRedemptionPlan 校验兑换码绑定的订阅套餐存在且已启用，planId 为 0 表示不绑定套餐
+func validateRedemptionPlan(planId int) bool {
+	if planId == 0 {
+		return true
+	}
+	if planId < 0 {
+		return false
+	}
+	plan, err := model.GetSubscriptionPlanById(planId)
+	return err == nil && plan != nil && plan.Enabled
+}
+
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	err := model.DeleteRedemptionById(id)
@@ -175,11 +192,19 @@ func UpdateRedemption(c *gin.Context) {
 			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
 			return
 		}
+		if redemption.PlanId != cleanRedemption.PlanId && !validateRedemptionPlan(redemption.PlanId) {
+			common.ApiErrorI18n(c, i18n.MsgRedemptionPlanUnavailable)
+			return
+		}
 		// If you add more fields, please also update redemption.Update()
 		cleanRedemption.Name = redemption.Name
+		// 额度与展示金额由 redemption.Update() 按数据库原值协调
 		cleanRedemption.Quota = redemption.Quota
+		cleanRedemption.DisplayAmount = redemption.DisplayAmount
+		cleanRedemption.DisplayCurrency = redemption.DisplayCurrency
 		cleanRedemption.MaxUses = redemption.MaxUses
 		cleanRedemption.ExpiredTime = redemption.ExpiredTime
+		cleanRedemption.PlanId = redemption.PlanId
 		if cleanRedemption.UsedCount >= cleanRedemption.MaxUses {
 			cleanRedemption.Status = common.RedemptionCodeStatusUsed
 		} else if cleanRedemption.Status == common.RedemptionCodeStatusUsed {
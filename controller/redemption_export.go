@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+var redemptionUsageCSVHeader = []string{
+	"usage_id", "redemption_id", "redemption_name", "quota", "plan_id",
+	"user_id", "username", "email", "redeemed_time", "deleted",
+}
+
+// ExportRedemptionUsages 以 CSV（默认）或 JSON 流式导出兑换记录，按批次查询并边查边写，避免一次性加载全部数据。
+// 查询参数：start_timestamp / end_timestamp（秒，0 表示不限制），format=csv|json
+func ExportRedemptionUsages(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if startTimestamp > 0 && endTimestamp > 0 && startTimestamp > endTimestamp {
+		common.ApiError(c, errors.New("start_timestamp must not be greater than end_timestamp"))
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		common.ApiError(c, errors.New("format must be csv or json"))
+		return
+	}
+
+	filename := fmt.Sprintf("redemption_usages_%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+
+	var err error
+	if format == "json" {
+		err = streamRedemptionUsagesJSON(c, startTimestamp, endTimestamp)
+	} else {
+		err = streamRedemptionUsagesCSV(c, startTimestamp, endTimestamp)
+	}
+	if err != nil {
+		// 响应头已发送，只能记录日志并截断输出
+		logger.LogError(c, "export redemption usages failed: "+err.Error())
+	}
+}
+
+func streamRedemptionUsagesCSV(c *gin.Context, startTimestamp, endTimestamp int64) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(redemptionUsageCSVHeader); err != nil {
+		return err
+	}
+	return model.StreamRedemptionUsages(startTimestamp, endTimestamp, 0, func(batch []model.RedemptionUsageExport) error {
+		for _, row := range batch {
+			record := []string{
+				strconv.Itoa(row.UsageId),
+				strconv.Itoa(row.RedemptionId),
+				escapeCSVFormulaCell(row.RedemptionName),
+				strconv.Itoa(row.Quota),
+				strconv.Itoa(row.PlanId),
+				strconv.Itoa(row.UserId),
+				escapeCSVFormulaCell(row.Username),
+				escapeCSVFormulaCell(row.Email),
+				strconv.FormatInt(row.RedeemedTime, 10),
+				strconv.FormatBool(row.Deleted),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		c.Writer.Flush()
+		return writer.Error()
+	})
+}
+
+// escapeCSVFormulaCell 为以公式字符开头的用户可控文本加上单引号前缀，避免在表格软件中打开时被当作公式执行
+func escapeCSVFormulaCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func streamRedemptionUsagesJSON(c *gin.Context, startTimestamp, endTimestamp int64) error {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	if _, err := c.Writer.WriteString("["); err != nil {
+		return err
+	}
+	first := true
+	err := model.StreamRedemptionUsages(startTimestamp, endTimestamp, 0, func(batch []model.RedemptionUsageExport) error {
+		for _, row := range batch {
+			data, err := common.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if !first {
+				if _, err := c.Writer.WriteString(","); err != nil {
+					return err
+				}
+			}
+			first = false
+			if _, err := c.Writer.Write(data); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.WriteString("]")
+	return err
+}
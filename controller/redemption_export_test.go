@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRedemptionUsages(t *testing.T) {
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Redemption{}, &model.RedemptionUsage{}))
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "alice", Email: "alice@example.com", AffCode: "aff-1"}).Error)
+	require.NoError(t, db.Create(&model.Redemption{Id: 10, Name: "spring, campaign", Key: "export-key", Quota: 500}).Error)
+	require.NoError(t, db.Create(&model.RedemptionUsage{RedemptionId: 10, UserId: 1, RedeemedTime: 1700000000}).Error)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/redemption/usage/export?"+query, nil)
+		ExportRedemptionUsages(c)
+		return recorder
+	}
+
+	recorder := export("")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Header().Get("Content-Type"), "text/csv")
+	records, err := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		redemptionUsageCSVHeader,
+		{"1", "10", "spring, campaign", "500", "0", "1", "alice", "alice@example.com", "1700000000", "false"},
+	}, records)
+
+	recorder = export("format=json")
+	var rows []model.RedemptionUsageExport
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &rows))
+	require.Len(t, rows, 1)
+	require.Equal(t, "alice", rows[0].Username)
+
+	recorder = export("format=json&start_timestamp=1800000000")
+	require.Equal(t, "[]", recorder.Body.String())
+
+	recorder = export("format=xml")
+	require.Contains(t, recorder.Body.String(), "format must be csv or json")
+}
+
+func TestExportRedemptionUsagesEscapesFormulaCells(t *testing.T) {
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Redemption{}, &model.RedemptionUsage{}))
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "=cmd|' /C calc'!A0", Email: "+1@example.com", AffCode: "aff-1"}).Error)
+	require.NoError(t, db.Create(&model.User{Id: 2, Username: "bob-1", Email: "-bob@example.com", AffCode: "aff-2"}).Error)
+	require.NoError(t, db.Create(&model.Redemption{Id: 10, Name: "@SUM(A1:A2)", Key: "export-key", Quota: 500}).Error)
+	require.NoError(t, db.Create(&[]model.RedemptionUsage{
+		{RedemptionId: 10, UserId: 1, RedeemedTime: 1700000000},
+		{RedemptionId: 10, UserId: 2, RedeemedTime: 1700000001},
+	}).Error)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/redemption/usage/export", nil)
+	ExportRedemptionUsages(c)
+
+	records, err := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, []string{"'@SUM(A1:A2)", "'=cmd|' /C calc'!A0", "'+1@example.com"}, []string{records[1][2], records[1][6], records[1][7]})
+	// 仅首字符为公式字符时转义
+	require.Equal(t, []string{"'@SUM(A1:A2)", "bob-1", "'-bob@example.com"}, []string{records[2][2], records[2][6], records[2][7]})
+}
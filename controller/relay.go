@@ -66,6 +66,12 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
+	// 携带 Last-Event-ID 的重连请求直接从重放缓冲续传，不会再次请求上游或计费
+	if relayFormat != types.RelayFormatOpenAIRealtime && helper.ServeStreamReplay(c) {
+		return
+	}
+	defer helper.CloseStreamEventTracker(c)
+
 	requestId := c.GetString(common.RequestIdKey)
 	//group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 	//originalModel := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
@@ -210,12 +216,14 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 		var releaseSSESlot func()
 		if relayInfo.IsStream {
-			releaseSSESlot, err = service.AcquireSSEConcurrencySlot(relayInfo.UserId, relayInfo.TokenId)
+			releaseSSESlot, err = service.AcquireSSEConcurrencySlotFor(c.Request.Context(), service.SSEConcurrencyIdentity{
+				UserID:   relayInfo.UserId,
+				TokenID:  relayInfo.TokenId,
+				Group:    relayInfo.UserGroup,
+				ClientIP: common.ResolveClientIP(c),
+			})
 			if err != nil {
-				newAPIError = types.NewOpenAIError(err, types.ErrorCodeSSEConcurrencyLimitExceeded, http.StatusTooManyRequests,
-					types.ErrOptionWithSkipRetry(),
-					types.ErrOptionWithNoRecordErrorLog(),
-				)
+				newAPIError = service.NewSSEConcurrencyLimitAPIError(c, err)
 				break
 			}
 		}
@@ -242,6 +250,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
+		newAPIError = relayInfo.NormalizeRequestBudgetError(newAPIError)
 		relayInfo.LastError = newAPIError
 
 		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
@@ -366,6 +375,7 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 
 func processChannelError(c *gin.Context, channelError types.ChannelError, err *types.NewAPIError) {
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
+	service.RecordChannelRecentFailure(channelError.ChannelId, err)
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	if service.ShouldDisableChannel(err) && channelError.AutoBan {
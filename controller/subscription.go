@@ -88,6 +88,31 @@ func UpdateSubscriptionPreference(c *gin.Context) {
 	common.ApiSuccess(c, gin.H{"billing_preference": pref})
 }
 
+type SubscriptionAutoRenewRequest struct {
+	AutoRenew bool `json:"auto_renew"`
+}
+
+// UpdateSubscriptionAutoRenew 开启或关闭当前用户某条订阅的钱包余额自动续费
+func UpdateSubscriptionAutoRenew(c *gin.Context) {
+	userId := c.GetInt("id")
+	subscriptionId, _ := strconv.Atoi(c.Param("id"))
+	if subscriptionId <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	var req SubscriptionAutoRenewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	sub, err := model.SetUserSubscriptionAutoRenew(userId, subscriptionId, req.AutoRenew)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"id": sub.Id, "auto_renew": sub.AutoRenew})
+}
+
 // ---- Admin APIs ----
 
 func AdminListSubscriptionPlans(c *gin.Context) {
@@ -322,6 +347,7 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 			"exclusive_plan_ids":         normalizedExclusive,
 			"disallow_stack":             disallowStack,
 			"allow_wallet_pay":           allowWalletPay,
+			"allow_proration":            req.Plan.AllowProration,
 			"total_amount":               req.Plan.TotalAmount,
 			"upgrade_group":              req.Plan.UpgradeGroup,
 			"quota_reset_period":         req.Plan.QuotaResetPeriod,
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
@@ -42,10 +43,6 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if !plan.Enabled {
-		common.ApiErrorMsg(c, "套餐未启用")
-		return
-	}
 	if plan.CreemProductId == "" {
 		common.ApiErrorMsg(c, "该套餐未配置 CreemProductId")
 		return
@@ -65,8 +62,15 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		common.ApiErrorMsg(c, "用户不存在")
 		return
 	}
+	if ok, reason, err := service.CanUserPurchasePlan(userId, plan); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
+		common.ApiErrorMsg(c, reason)
+		return
+	}
 	if err := model.CheckSubscriptionPurchaseEligibility(userId, plan); err != nil {
-		common.ApiErrorMsg(c, err.Error())
+		common.ApiErrorMsg(c, service.SubscriptionPurchaseErrorMessage(userId, err))
 		return
 	}
 
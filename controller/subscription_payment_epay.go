@@ -34,10 +34,6 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if !plan.Enabled {
-		common.ApiErrorMsg(c, "套餐未启用")
-		return
-	}
 	if plan.PriceAmount < 0.01 {
 		common.ApiErrorMsg(c, "套餐金额过低")
 		return
@@ -48,8 +44,15 @@ func SubscriptionRequestEpay(c *gin.Context) {
 	}
 
 	userId := c.GetInt("id")
+	if ok, reason, err := service.CanUserPurchasePlan(userId, plan); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
+		common.ApiErrorMsg(c, reason)
+		return
+	}
 	if err := model.CheckSubscriptionPurchaseEligibility(userId, plan); err != nil {
-		common.ApiErrorMsg(c, err.Error())
+		common.ApiErrorMsg(c, service.SubscriptionPurchaseErrorMessage(userId, err))
 		return
 	}
 
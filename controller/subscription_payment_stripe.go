@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/gin-gonic/gin"
@@ -33,10 +34,6 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if !plan.Enabled {
-		common.ApiErrorMsg(c, "套餐未启用")
-		return
-	}
 	if plan.StripePriceId == "" {
 		common.ApiErrorMsg(c, "该套餐未配置 StripePriceId")
 		return
@@ -60,8 +57,15 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 		common.ApiErrorMsg(c, "用户不存在")
 		return
 	}
+	if ok, reason, err := service.CanUserPurchasePlan(userId, plan); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
+		common.ApiErrorMsg(c, reason)
+		return
+	}
 	if err := model.CheckSubscriptionPurchaseEligibility(userId, plan); err != nil {
-		common.ApiErrorMsg(c, err.Error())
+		common.ApiErrorMsg(c, service.SubscriptionPurchaseErrorMessage(userId, err))
 		return
 	}
 
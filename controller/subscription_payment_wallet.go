@@ -2,13 +2,14 @@ package controller
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
-	"github.com/shopspring/decimal"
 )
 
 const PaymentMethodWallet = "wallet"
@@ -17,6 +18,11 @@ type SubscriptionWalletPayRequest struct {
 	PlanId int `json:"plan_id"`
 }
 
+const (
+	subscriptionWalletIdempotencyHeader = "Idempotency-Key"
+	subscriptionWalletIdempotencyTTL    = 24 * time.Hour
+)
+
 func SubscriptionRequestWalletPay(c *gin.Context) {
 	var req SubscriptionWalletPayRequest
 	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
@@ -24,17 +30,51 @@ func SubscriptionRequestWalletPay(c *gin.Context) {
 		return
 	}
 
+	userId := c.GetInt("id")
+
+	// 携带 Idempotency-Key 时，订单号由该键确定性生成：重复请求直接返回首次结果，
+	// 并发的重复请求会因订单号唯一约束而无法重复扣费；同一个键不能用于购买其他套餐
+	tradeNo := ""
+	if idempotencyKey := strings.TrimSpace(c.GetHeader(subscriptionWalletIdempotencyHeader)); idempotencyKey != "" {
+		if len(idempotencyKey) > 255 {
+			common.ApiErrorMsg(c, "Idempotency-Key 过长")
+			return
+		}
+		tradeNo = subscriptionWalletIdempotentTradeNo(userId, idempotencyKey)
+		if replaySubscriptionWalletPay(c, userId, req.PlanId, tradeNo) {
+			return
+		}
+		if common.RedisEnabled {
+			redisKey := subscriptionWalletIdempotencyRedisKey(userId, idempotencyKey)
+			acquired, err := common.RDB.SetNX(c.Request.Context(), redisKey, tradeNo, subscriptionWalletIdempotencyTTL).Result()
+			if err != nil {
+				common.SysError("subscription wallet idempotency check via redis failed, falling back to db: " + err.Error())
+			} else if !acquired {
+				if !replaySubscriptionWalletPay(c, userId, req.PlanId, tradeNo) {
+					common.ApiErrorMsg(c, "相同的请求正在处理中，请稍后重试")
+				}
+				return
+			} else {
+				defer func() {
+					// 未生成订单（校验失败或扣费事务回滚）时释放该键，允许客户端使用同一个键重试
+					if model.GetSubscriptionOrderByTradeNo(tradeNo) == nil {
+						_ = common.RedisDel(redisKey)
+					}
+				}()
+			}
+		}
+	}
+
 	plan, err := model.GetSubscriptionPlanById(req.PlanId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
-	if !plan.Enabled {
-		common.ApiErrorMsg(c, "套餐未启用")
+	if ok, reason, err := service.CanUserPurchasePlan(userId, plan); err != nil {
+		common.ApiError(c, err)
 		return
-	}
-	if plan.PriceAmount < 0 {
-		common.ApiErrorMsg(c, "套餐金额不合法")
+	} else if !ok {
+		common.ApiErrorMsg(c, reason)
 		return
 	}
 	if !plan.AllowWalletPay {
@@ -42,14 +82,23 @@ func SubscriptionRequestWalletPay(c *gin.Context) {
 		return
 	}
 
-	userId := c.GetInt("id")
-	if err := model.CheckSubscriptionPurchaseEligibility(userId, plan); err != nil {
-		common.ApiErrorMsg(c, err.Error())
+	proration, err := model.GetSubscriptionProration(userId, plan)
+	if err != nil {
+		common.ApiError(c, err)
 		return
 	}
+	if err := model.CheckSubscriptionUpgradeEligibility(userId, plan, proration); err != nil {
+		common.ApiErrorMsg(c, service.SubscriptionPurchaseErrorMessage(userId, err))
+		return
+	}
+
+	quotaCost, displayAmount, displayRate := service.CalcSubscriptionWalletQuota(plan, proration)
 
-	quotaCost, displayAmount, displayRate := calcSubscriptionWalletQuota(plan)
-	tradeNo := fmt.Sprintf("SUBWALLET%dNO%s", userId, fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix()))
+	// 余额校验在事务内针对锁定的用户记录进行，余额不足时由 SubscriptionPurchaseErrorMessage 给出差额提示
+	idempotent := tradeNo != ""
+	if !idempotent {
+		tradeNo = fmt.Sprintf("SUBWALLET%dNO%s", userId, fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix()))
+	}
 
 	payload := map[string]any{
 		"payment_method": PaymentMethodWallet,
@@ -58,16 +107,31 @@ func SubscriptionRequestWalletPay(c *gin.Context) {
 		"display_rate":   displayRate,
 		"display_type":   operation_setting.GetQuotaDisplayType(),
 	}
+	if !proration.IsEmpty() {
+		payload["proration_credit"] = proration.Credit
+		payload["replaced_subscription_ids"] = proration.ReplacedSubscriptionIds
+	}
 	payloadStr := ""
 	if payloadBytes, err := common.Marshal(payload); err == nil {
 		payloadStr = string(payloadBytes)
 	}
 
-	if err := model.CompleteWalletSubscriptionOrder(tradeNo, userId, plan, PaymentMethodWallet, quotaCost, payloadStr); err != nil {
-		common.ApiErrorMsg(c, err.Error())
+	if err := model.CompleteWalletSubscriptionOrder(tradeNo, userId, plan, PaymentMethodWallet, quotaCost, payloadStr, proration); err != nil {
+		// 未启用 Redis 时并发的相同请求只能由订单号唯一约束拦截，此时按幂等结果返回而不是数据库错误
+		if idempotent && model.GetSubscriptionOrderByTradeNo(tradeNo) != nil {
+			if !replaySubscriptionWalletPay(c, userId, plan.Id, tradeNo) {
+				common.ApiErrorMsg(c, "相同的请求正在处理中，请稍后重试")
+			}
+			return
+		}
+		common.ApiErrorMsg(c, service.SubscriptionPurchaseErrorMessage(userId, err))
 		return
 	}
 
+	writeSubscriptionWalletPaySuccess(c, tradeNo)
+}
+
+func writeSubscriptionWalletPaySuccess(c *gin.Context, tradeNo string) {
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
@@ -76,39 +140,28 @@ func SubscriptionRequestWalletPay(c *gin.Context) {
 	})
 }
 
-func calcSubscriptionWalletQuota(plan *model.SubscriptionPlan) (int, float64, float64) {
-	rate := getSubscriptionWalletDisplayRate()
-	if rate <= 0 {
-		rate = 1
-	}
-	dRate := decimal.NewFromFloat(rate)
-	dPrice := decimal.NewFromFloat(plan.PriceAmount)
-	dDisplay := dPrice.Mul(dRate)
+func subscriptionWalletIdempotentTradeNo(userId int, idempotencyKey string) string {
+	return fmt.Sprintf("SUBWALLET%dIDEM%s", userId, common.Sha1([]byte(idempotencyKey))[:24])
+}
 
-	usdAmount := dPrice
-	if !dRate.IsZero() {
-		usdAmount = dDisplay.Div(dRate)
-	}
-	quota := usdAmount.Mul(decimal.NewFromFloat(common.QuotaPerUnit))
-	return int(quota.IntPart()), dDisplay.InexactFloat64(), rate
+func subscriptionWalletIdempotencyRedisKey(userId int, idempotencyKey string) string {
+	return fmt.Sprintf("subscription_wallet_idem:%d:%s", userId, common.Sha1([]byte(idempotencyKey)))
 }
 
-func getSubscriptionWalletDisplayRate() float64 {
-	generalSetting := operation_setting.GetGeneralSetting()
-	switch generalSetting.QuotaDisplayType {
-	case operation_setting.QuotaDisplayTypeUSD:
-		return 1
-	case operation_setting.QuotaDisplayTypeCNY:
-		if operation_setting.USDExchangeRate > 0 {
-			return operation_setting.USDExchangeRate
-		}
-		return 1
-	case operation_setting.QuotaDisplayTypeCustom:
-		if generalSetting.CustomCurrencyExchangeRate > 0 {
-			return generalSetting.CustomCurrencyExchangeRate
-		}
-		return 1
-	default:
-		return 1
+// replaySubscriptionWalletPay 若该订单号已由同一用户成功支付，则直接返回首次的成功结果；
+// 订单对应的套餐与本次请求不同时拒绝复用该幂等键。返回 true 表示已写入响应
+func replaySubscriptionWalletPay(c *gin.Context, userId int, planId int, tradeNo string) bool {
+	order := model.GetSubscriptionOrderByTradeNo(tradeNo)
+	if order == nil || order.UserId != userId {
+		return false
+	}
+	if order.PlanId != planId {
+		common.ApiErrorMsg(c, "Idempotency-Key 已用于购买其他套餐，请使用新的键")
+		return true
+	}
+	if order.Status != common.TopUpStatusSuccess {
+		return false
 	}
+	writeSubscriptionWalletPaySuccess(c, tradeNo)
+	return true
 }
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSubscriptionWalletTestDB(t *testing.T) {
+	t.Helper()
+
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(
+		&model.User{},
+		&model.Log{},
+		&model.TopUp{},
+		&model.SubscriptionPlan{},
+		&model.SubscriptionOrder{},
+		&model.UserSubscription{},
+	))
+}
+
+func performSubscriptionWalletPay(t *testing.T, userId int, planId int, idempotencyKey string) tokenAPIResponse {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	body, err := common.Marshal(SubscriptionWalletPayRequest{PlanId: planId})
+	require.NoError(t, err)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/subscription/wallet/pay", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		c.Request.Header.Set(subscriptionWalletIdempotencyHeader, idempotencyKey)
+	}
+	c.Set("id", userId)
+
+	SubscriptionRequestWalletPay(c)
+
+	var resp tokenAPIResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestSubscriptionRequestWalletPay_IdempotencyKeyReplaysWithoutCharging(t *testing.T) {
+	setupSubscriptionWalletTestDB(t)
+
+	user := &model.User{Username: "wallet_idem", AffCode: "wallet_idem_aff", Quota: int(10 * common.QuotaPerUnit)}
+	require.NoError(t, model.DB.Create(user).Error)
+	plan := &model.SubscriptionPlan{Title: "monthly", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1}
+	require.NoError(t, model.DB.Create(plan).Error)
+
+	first := performSubscriptionWalletPay(t, user.Id, plan.Id, "retry-key-1")
+	require.Equal(t, "success", first.Message)
+
+	var afterFirst model.User
+	require.NoError(t, model.DB.First(&afterFirst, user.Id).Error)
+	require.Less(t, afterFirst.Quota, user.Quota)
+
+	replay := performSubscriptionWalletPay(t, user.Id, plan.Id, "retry-key-1")
+	require.Equal(t, "success", replay.Message)
+	require.JSONEq(t, string(first.Data), string(replay.Data))
+
+	var afterReplay model.User
+	require.NoError(t, model.DB.First(&afterReplay, user.Id).Error)
+	require.Equal(t, afterFirst.Quota, afterReplay.Quota)
+
+	var orderCount int64
+	require.NoError(t, model.DB.Model(&model.SubscriptionOrder{}).Where("user_id = ?", user.Id).Count(&orderCount).Error)
+	require.EqualValues(t, 1, orderCount)
+
+	// 不同的键视为新的购买
+	other := performSubscriptionWalletPay(t, user.Id, plan.Id, "retry-key-2")
+	require.Equal(t, "success", other.Message)
+	require.NotEqual(t, string(first.Data), string(other.Data))
+}
+
+func TestSubscriptionRequestWalletPay_IdempotencyKeyConflicts(t *testing.T) {
+	setupSubscriptionWalletTestDB(t)
+
+	user := &model.User{Username: "wallet_idem_conflict", AffCode: "wallet_idem_conflict_aff", Quota: int(10 * common.QuotaPerUnit)}
+	require.NoError(t, model.DB.Create(user).Error)
+	monthly := &model.SubscriptionPlan{Title: "monthly", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1}
+	require.NoError(t, model.DB.Create(monthly).Error)
+	yearly := &model.SubscriptionPlan{Title: "yearly", PriceAmount: 2, Enabled: true, AllowWalletPay: true, DurationUnit: "year", DurationValue: 1}
+	require.NoError(t, model.DB.Create(yearly).Error)
+	model.InvalidateSubscriptionPlanCache(monthly.Id)
+	model.InvalidateSubscriptionPlanCache(yearly.Id)
+
+	first := performSubscriptionWalletPay(t, user.Id, monthly.Id, "conflict-key-1")
+	require.Equal(t, "success", first.Message)
+
+	// 同一个键用于其他套餐时拒绝，不扣费
+	var afterFirst model.User
+	require.NoError(t, model.DB.First(&afterFirst, user.Id).Error)
+	mismatch := performSubscriptionWalletPay(t, user.Id, yearly.Id, "conflict-key-1")
+	require.False(t, mismatch.Success)
+	require.Contains(t, mismatch.Message, "Idempotency-Key")
+	var afterMismatch model.User
+	require.NoError(t, model.DB.First(&afterMismatch, user.Id).Error)
+	require.Equal(t, afterFirst.Quota, afterMismatch.Quota)
+
+	// 模拟并发的相同请求已写入订单但尚未完成：订单号唯一约束冲突时返回处理中，而不是数据库错误
+	tradeNo := subscriptionWalletIdempotentTradeNo(user.Id, "conflict-key-2")
+	require.NoError(t, model.DB.Create(&model.SubscriptionOrder{
+		UserId: user.Id, PlanId: monthly.Id, TradeNo: tradeNo, PaymentMethod: PaymentMethodWallet, Status: common.TopUpStatusPending,
+	}).Error)
+	inFlight := performSubscriptionWalletPay(t, user.Id, monthly.Id, "conflict-key-2")
+	require.False(t, inFlight.Success)
+	require.Equal(t, "相同的请求正在处理中，请稍后重试", inFlight.Message)
+	var afterInFlight model.User
+	require.NoError(t, model.DB.First(&afterInFlight, user.Id).Error)
+	require.Equal(t, afterFirst.Quota, afterInFlight.Quota)
+}
+
+func TestSubscriptionRequestWalletPay_InsufficientBalanceReportsShortfall(t *testing.T) {
+	setupSubscriptionWalletTestDB(t)
+	require.NoError(t, i18n.Init())
+
+	user := &model.User{Username: "wallet_short", AffCode: "wallet_short_aff", Quota: int(common.QuotaPerUnit / 4)}
+	require.NoError(t, model.DB.Create(user).Error)
+	plan := &model.SubscriptionPlan{Title: "monthly", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1}
+	require.NoError(t, model.DB.Create(plan).Error)
+
+	resp := performSubscriptionWalletPay(t, user.Id, plan.Id, "")
+	require.False(t, resp.Success)
+	require.Contains(t, resp.Message, "0.750000")
+
+	var orderCount int64
+	require.NoError(t, model.DB.Model(&model.SubscriptionOrder{}).Where("user_id = ?", user.Id).Count(&orderCount).Error)
+	require.Zero(t, orderCount)
+}
+
+func TestSubscriptionRequestWalletPay_ProrationCreditsActiveExclusivePlan(t *testing.T) {
+	setupSubscriptionWalletTestDB(t)
+
+	user := &model.User{Username: "wallet_prorate", AffCode: "wallet_prorate_aff", Quota: int(10 * common.QuotaPerUnit)}
+	require.NoError(t, model.DB.Create(user).Error)
+	basic := &model.SubscriptionPlan{Title: "monthly", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1}
+	require.NoError(t, model.DB.Create(basic).Error)
+	pro := &model.SubscriptionPlan{Title: "pro", PriceAmount: 2, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1, AllowProration: true}
+	pro.ExclusivePlanIds = model.FormatPlanIDList([]int{basic.Id})
+	require.NoError(t, model.DB.Create(pro).Error)
+
+	require.Equal(t, "success", performSubscriptionWalletPay(t, user.Id, basic.Id, "").Message)
+	var afterBasic model.User
+	require.NoError(t, model.DB.First(&afterBasic, user.Id).Error)
+
+	require.Equal(t, "success", performSubscriptionWalletPay(t, user.Id, pro.Id, "").Message)
+	var afterPro model.User
+	require.NoError(t, model.DB.First(&afterPro, user.Id).Error)
+
+	// 基础套餐几乎未使用，升级只需补足差价
+	spent := afterBasic.Quota - afterPro.Quota
+	require.GreaterOrEqual(t, spent, int(common.QuotaPerUnit))
+	require.Less(t, spent, int(common.QuotaPerUnit*1.01))
+
+	var replaced model.UserSubscription
+	require.NoError(t, model.DB.Where("user_id = ? AND plan_id = ?", user.Id, basic.Id).First(&replaced).Error)
+	require.Equal(t, "cancelled", replaced.Status)
+}
+
+func TestSubscriptionRequestWalletPay_RejectsWhenPurchaseLimitReached(t *testing.T) {
+	setupSubscriptionWalletTestDB(t)
+	require.NoError(t, i18n.Init())
+
+	user := &model.User{Username: "wallet_limit", AffCode: "wallet_limit_aff", Quota: int(common.QuotaPerUnit * 10)}
+	require.NoError(t, model.DB.Create(user).Error)
+	plan := &model.SubscriptionPlan{Title: "once", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1, MaxPurchasePerUser: 1}
+	require.NoError(t, model.DB.Create(plan).Error)
+	// 其他用例可能以相同 id 缓存了套餐
+	model.InvalidateSubscriptionPlanCache(plan.Id)
+	require.NoError(t, model.DB.Create(&model.UserSubscription{UserId: user.Id, PlanId: plan.Id, Status: "expired"}).Error)
+
+	resp := performSubscriptionWalletPay(t, user.Id, plan.Id, "")
+	require.False(t, resp.Success)
+	require.Equal(t, i18n.TForUser(user.Id, i18n.MsgSubscriptionPurchaseMax), resp.Message)
+}
+
+func TestSubscriptionRequestWalletPay_ProrationIgnoresConsumedAndProratedSubscriptions(t *testing.T) {
+	setupSubscriptionWalletTestDB(t)
+
+	user := &model.User{Username: "wallet_prorate_used", AffCode: "wallet_prorate_used_aff", Quota: int(10 * common.QuotaPerUnit)}
+	require.NoError(t, model.DB.Create(user).Error)
+	basic := &model.SubscriptionPlan{Title: "monthly", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1, TotalAmount: 1000}
+	require.NoError(t, model.DB.Create(basic).Error)
+	pro := &model.SubscriptionPlan{Title: "pro", PriceAmount: 2, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1, AllowProration: true}
+	pro.ExclusivePlanIds = model.FormatPlanIDList([]int{basic.Id})
+	require.NoError(t, model.DB.Create(pro).Error)
+	ultra := &model.SubscriptionPlan{Title: "ultra", PriceAmount: 3, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1, AllowProration: true}
+	ultra.ExclusivePlanIds = model.FormatPlanIDList([]int{pro.Id})
+	require.NoError(t, model.DB.Create(ultra).Error)
+	// 其他用例可能以相同 id 缓存了套餐
+	for _, plan := range []*model.SubscriptionPlan{basic, pro, ultra} {
+		model.InvalidateSubscriptionPlanCache(plan.Id)
+	}
+
+	require.Equal(t, "success", performSubscriptionWalletPay(t, user.Id, basic.Id, "").Message)
+	var basicSub model.UserSubscription
+	require.NoError(t, model.DB.Where("user_id = ? AND plan_id = ?", user.Id, basic.Id).First(&basicSub).Error)
+	require.EqualValues(t, int64(common.QuotaPerUnit), basicSub.PaidQuota)
+	// 额度已用完的订阅只剩时长，不应再获得抵扣
+	require.NoError(t, model.DB.Model(&basicSub).Update("amount_used", basicSub.AmountTotal).Error)
+
+	var beforePro model.User
+	require.NoError(t, model.DB.First(&beforePro, user.Id).Error)
+	require.Equal(t, "success", performSubscriptionWalletPay(t, user.Id, pro.Id, "").Message)
+	var afterPro model.User
+	require.NoError(t, model.DB.First(&afterPro, user.Id).Error)
+	require.Equal(t, int(2*common.QuotaPerUnit), beforePro.Quota-afterPro.Quota)
+
+	var proSub model.UserSubscription
+	require.NoError(t, model.DB.Where("user_id = ? AND plan_id = ?", user.Id, pro.Id).First(&proSub).Error)
+	require.True(t, proSub.Prorated)
+
+	// 由折算升级购买的订阅不再参与折算
+	require.Equal(t, "success", performSubscriptionWalletPay(t, user.Id, ultra.Id, "").Message)
+	var afterUltra model.User
+	require.NoError(t, model.DB.First(&afterUltra, user.Id).Error)
+	require.Equal(t, int(3*common.QuotaPerUnit), afterPro.Quota-afterUltra.Quota)
+}
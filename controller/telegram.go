@@ -121,5 +121,5 @@ func checkTelegramAuthorization(params map[string][]string, token string) bool {
 	hmachash := hmac.New(sha256.New, sha256hash.Sum(nil))
 	io.WriteString(hmachash, imploded)
 	ss := hex.EncodeToString(hmachash.Sum(nil))
-	return hash == ss
+	return common.SecureCompare(hash, ss)
 }
@@ -53,6 +53,22 @@ func validateTokenRateLimit(token *model.Token) error {
 	}
 	return nil
 }
+
+func validateTokenModelMapping(token *model.Token) error {
+	if strings.TrimSpace(token.ModelMapping) == "" {
+		return nil
+	}
+	var mapping map[string]string
+	if err := common.UnmarshalJsonStr(token.ModelMapping, &mapping); err != nil {
+		return errors.New("模型映射必须是合法的 JSON 对象，键和值均为模型名称")
+	}
+	for from, to := range mapping {
+		if strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			return errors.New("模型映射的模型名称不能为空")
+		}
+	}
+	return nil
+}
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
 	pageInfo := common.GetPageQuery(c)
@@ -213,6 +229,10 @@ func AddToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := validateTokenModelMapping(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -251,6 +271,7 @@ func AddToken(c *gin.Context) {
 		RateLimitSuccessCount:   token.RateLimitSuccessCount,
 		IPRateLimitCount:        token.IPRateLimitCount,
 		IPRateLimitSuccessCount: token.IPRateLimitSuccessCount,
+		ModelMapping:            token.ModelMapping,
 		Group:                   token.Group,
 		CrossGroupRetry:         token.CrossGroupRetry,
 	}
@@ -307,6 +328,10 @@ func UpdateToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := validateTokenModelMapping(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -339,6 +364,7 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.RateLimitSuccessCount = token.RateLimitSuccessCount
 		cleanToken.IPRateLimitCount = token.IPRateLimitCount
 		cleanToken.IPRateLimitSuccessCount = token.IPRateLimitSuccessCount
+		cleanToken.ModelMapping = token.ModelMapping
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
 	}
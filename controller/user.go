@@ -590,6 +590,47 @@ func UpdateUser(c *gin.Context) {
 	return
 }
 
+// RecomputeUserQuota 以数据库为准校正指定用户的额度缓存
+func RecomputeUserQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
+		return
+	}
+	if err := model.RecomputeUserQuota(user.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RecomputeAllUserQuotas 以数据库为准校正所有用户的额度缓存，返回被修正的用户数
+func RecomputeAllUserQuotas(c *gin.Context) {
+	fixed, err := model.RecomputeAllUserQuotas()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    gin.H{"corrected": fixed},
+	})
+}
+
 func AdminClearUserBinding(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -1106,7 +1147,7 @@ func TopUp(c *gin.Context) {
 			return
 		}
 		switch err.Error() {
-		case i18n.MsgRedemptionInvalid, i18n.MsgRedemptionUsed, i18n.MsgRedemptionExpired, i18n.MsgRedemptionNotProvided:
+		case i18n.MsgRedemptionInvalid, i18n.MsgRedemptionUsed, i18n.MsgRedemptionExpired, i18n.MsgRedemptionNotProvided, i18n.MsgRedemptionPlanUnavailable, i18n.MsgRedemptionVelocityExceeded:
 			common.ApiErrorI18n(c, err.Error())
 		default:
 			common.ApiError(c, err)
@@ -1,5 +1,7 @@
 package dto
 
+import "strings"
+
 type ChannelSettings struct {
 	ForceFormat            bool     `json:"force_format,omitempty"`
 	ThinkingToContent      bool     `json:"thinking_to_content,omitempty"`
@@ -8,8 +10,21 @@ type ChannelSettings struct {
 	SystemPrompt           string   `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool     `json:"system_prompt_override,omitempty"`
 	HiddenModels           []string `json:"hidden_models,omitempty"`
+	PingFormat             string   `json:"ping_format,omitempty"`       // 下游保活 ping 格式：comment（默认）或 data
+	MaxConcurrency         int      `json:"max_concurrency,omitempty"`   // 本实例内渠道并发上限，0 表示不限制；达到上限时渠道亲和性会按配置降级
+	StreamingTimeout       int      `json:"streaming_timeout,omitempty"` // 渠道流式超时秒数，0 表示使用全局 STREAMING_TIMEOUT
+	CostRatio              float64  `json:"cost_ratio,omitempty"`        // 渠道成本倍率，仅用于成本感知路由排序，<=0 视为 1
+	// Chat Completions 经 Responses 转换的非流式响应中，将推理摘要以 reasoning_content 返回（流式响应始终返回）
+	ResponsesReasoningContent bool `json:"responses_reasoning_content,omitempty"`
+	// Chat Completions 经 Responses 转换失败时，回退到渠道原生 Chat 接口
+	FallbackToNativeChatOnResponsesError bool `json:"fallback_to_native_chat_on_responses_error,omitempty"`
 }
 
+const (
+	PingFormatComment = "comment" // ": PING\n\n"，SSE 注释行
+	PingFormatData    = "data"    // "data: {}\n\n"，空数据帧，适用于会过滤注释行的 CDN/代理
+)
+
 type VertexKeyType string
 
 const (
@@ -36,12 +51,47 @@ type ChannelOtherSettings struct {
 	DisableStore                          bool          `json:"disable_store,omitempty"`             // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowIncludeObfuscation               bool          `json:"allow_include_obfuscation,omitempty"` // 是否允许 stream_options.include_obfuscation 透传（默认过滤以避免关闭流混淆保护）
 	AwsKeyType                            AwsKeyType    `json:"aws_key_type,omitempty"`
+	PreservePartialOnStreamError          bool          `json:"preserve_partial_on_stream_error,omitempty"`           // 流式响应中途上游出错时保留已输出内容，以 finish_reason=error 结束
 	UpstreamModelUpdateCheckEnabled       bool          `json:"upstream_model_update_check_enabled,omitempty"`        // 是否检测上游模型更新
 	UpstreamModelUpdateAutoSyncEnabled    bool          `json:"upstream_model_update_auto_sync_enabled,omitempty"`    // 是否自动同步上游模型更新
 	UpstreamModelUpdateLastCheckTime      int64         `json:"upstream_model_update_last_check_time,omitempty"`      // 上次检测时间
 	UpstreamModelUpdateLastDetectedModels []string      `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
 	UpstreamModelUpdateLastRemovedModels  []string      `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
 	UpstreamModelUpdateIgnoredModels      []string      `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+	// DisabledFields 转发前从请求体顶层移除的字段，对该渠道所有模型生效
+	DisabledFields []string `json:"disabled_fields,omitempty"`
+	// ModelDisabledFields 按模型名额外移除的顶层字段，与 DisabledFields 取并集
+	ModelDisabledFields map[string][]string `json:"model_disabled_fields,omitempty"`
+}
+
+// GetDisabledFields 返回渠道级与给定模型的移除字段并集，按首次出现顺序去重，忽略空字段名
+func (s *ChannelOtherSettings) GetDisabledFields(modelNames ...string) []string {
+	if s == nil {
+		return nil
+	}
+	var fields []string
+	seen := make(map[string]struct{})
+	appendFields := func(list []string) {
+		for _, field := range list {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if _, ok := seen[field]; ok {
+				continue
+			}
+			seen[field] = struct{}{}
+			fields = append(fields, field)
+		}
+	}
+	appendFields(s.DisabledFields)
+	for _, modelName := range modelNames {
+		if modelName == "" {
+			continue
+		}
+		appendFields(s.ModelDisabledFields[modelName])
+	}
+	return fields
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
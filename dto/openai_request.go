@@ -860,6 +860,14 @@ type OpenAIResponsesRequest struct {
 	Preset json.RawMessage `json:"preset,omitempty"`
 }
 
+// IsStateful 判断请求是否使用 responses 的有状态会话（续接 previous_response_id 或要求上游存储）
+func (r *OpenAIResponsesRequest) IsStateful() bool {
+	if r == nil {
+		return false
+	}
+	return r.PreviousResponseID != "" || strings.TrimSpace(string(r.Store)) == "true"
+}
+
 func (r *OpenAIResponsesRequest) GetTokenCountMeta() *types.TokenCountMeta {
 	var fileMeta = make([]*types.FileMeta, 0)
 	var texts = make([]string, 0)
@@ -347,6 +347,8 @@ type ResponsesOutput struct {
 	CallId    string                   `json:"call_id,omitempty"`
 	Name      string                   `json:"name,omitempty"`
 	Arguments string                   `json:"arguments,omitempty"`
+	// reasoning 类型输出的推理摘要
+	Summary []ResponsesReasoningSummaryPart `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -387,6 +389,8 @@ type ResponsesStreamResponse struct {
 	SummaryIndex *int                           `json:"summary_index,omitempty"`
 	ItemID       string                         `json:"item_id,omitempty"`
 	Part         *ResponsesReasoningSummaryPart `json:"part,omitempty"`
+	// response.function_call_arguments.done 中的完整参数
+	Arguments string `json:"arguments,omitempty"`
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -112,6 +112,29 @@ func Translate(lang, key string, args ...map[string]any) string {
 	return msg
 }
 
+// TForUser translates a message key using the preferred language of the given user.
+// It is intended for async flows without a gin context (task callbacks, notifications);
+// falls back to the default language when the user has no supported preference.
+func TForUser(userId int, key string, args ...map[string]any) string {
+	return Translate(GetUserLang(userId), key, args...)
+}
+
+// GetUserLang resolves the preferred language of a user via the registered loader
+func GetUserLang(userId int) string {
+	if userId <= 0 || userLangLoaderFunc == nil {
+		return DefaultLang
+	}
+	lang := userLangLoaderFunc(userId)
+	if lang == "" {
+		return DefaultLang
+	}
+	normalized := normalizeLang(lang)
+	if !IsSupported(normalized) {
+		return DefaultLang
+	}
+	return normalized
+}
+
 // userLangLoaderFunc is a function that loads user language from database/cache
 // It's set by the model package to avoid circular imports
 var userLangLoaderFunc func(userId int) string
@@ -0,0 +1,32 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTForUserUsesUserLanguage(t *testing.T) {
+	require.NoError(t, Init())
+	original := userLangLoaderFunc
+	t.Cleanup(func() { userLangLoaderFunc = original })
+	SetUserLangLoader(func(userId int) string {
+		switch userId {
+		case 1:
+			return "zh-CN"
+		case 2:
+			return "zh-TW"
+		case 3:
+			return "fr"
+		default:
+			return ""
+		}
+	})
+
+	args := map[string]any{"Minutes": 30}
+	require.Equal(t, "任务超时（30分钟）", TForUser(1, MsgTaskTimeout, args))
+	require.Equal(t, "任務超時（30分鐘）", TForUser(2, MsgTaskTimeout, args))
+	require.Equal(t, "Task timed out (30 minutes)", TForUser(3, MsgTaskTimeout, args))
+	require.Equal(t, "Task timed out (30 minutes)", TForUser(4, MsgTaskTimeout, args))
+	require.Equal(t, DefaultLang, GetUserLang(0))
+}
@@ -69,6 +69,8 @@ const (
 	MsgRedemptionFailed            = "redemption.failed"
 	MsgRedemptionNotProvided       = "redemption.not_provided"
 	MsgRedemptionExpireTimeInvalid = "redemption.expire_time_invalid"
+	MsgRedemptionPlanUnavailable   = "redemption.plan_unavailable"
+	MsgRedemptionVelocityExceeded  = "redemption.velocity_exceeded"
 )
 
 // User related messages
@@ -139,6 +141,7 @@ const (
 	MsgSubscriptionPurchaseMax      = "subscription.purchase_max"
 	MsgSubscriptionInvalidId        = "subscription.invalid_id"
 	MsgSubscriptionInvalidUserId    = "subscription.invalid_user_id"
+	MsgSubscriptionBalanceShort     = "subscription.balance_short"
 )
 
 // Payment related messages
@@ -233,6 +236,8 @@ const (
 const (
 	MsgRateLimitReached      = "rate_limit.reached"
 	MsgRateLimitTotalReached = "rate_limit.total_reached"
+
+	MsgSSEConcurrencyLimitExceeded = "rate_limit.sse_concurrency_exceeded"
 )
 
 // Setting related messages
@@ -295,6 +300,7 @@ const (
 	MsgOAuthTrustLevelLow             = "oauth.trust_level_low"
 	MsgOAuthDiscordGuildConfigInvalid = "oauth.discord_guild_config_invalid"
 	MsgOAuthDiscordGuildRequired      = "oauth.discord_guild_required"
+	MsgOAuthDiscordGuildDenied        = "oauth.discord_guild_denied"
 	MsgOAuthDiscordGuildCheckFailed   = "oauth.discord_guild_check_failed"
 )
 
@@ -320,6 +326,16 @@ const (
 	MsgDistributorNoAvailableChannel  = "distributor.no_available_channel"
 	MsgDistributorInvalidMidjourney   = "distributor.invalid_midjourney_request"
 	MsgDistributorInvalidParseModel   = "distributor.invalid_request_parse_model"
+	MsgDistributorRequestTooLarge     = "distributor.request_body_too_large"
+)
+
+// Async task related messages
+const (
+	MsgTaskTimeout          = "task.timeout"
+	MsgTaskTimeoutLegacy    = "task.timeout_legacy"
+	MsgTaskUpstreamTimeout  = "task.upstream_timeout"
+	MsgTaskMidjourneyFailed = "task.midjourney_failed"
+	MsgTaskFailed           = "task.failed"
 )
 
 // Custom OAuth provider related messages
@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -112,6 +116,18 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Subscription auto renewal from wallet balance for subscriptions with auto_renew enabled
+	service.StartSubscriptionAutoRenewTask()
+
+	// Expired/used redemption cleanup task, disabled unless REDEMPTION_CLEANUP_INTERVAL_MINUTES > 0
+	service.StartRedemptionCleanupTask()
+
+	// Quota refund dedup record cleanup, disabled when QUOTA_REFUND_RECORD_RETENTION_DAYS is 0
+	service.StartQuotaRefundRecordCleanupTask()
+
+	// Routing warm cache snapshot, disabled unless SNAPSHOT_ROUTING_WARM_CACHE=true
+	middleware.StartModelRequestWarmCacheSnapshotTask()
+
 	// Wire task polling adaptor factory (breaks service -> relay import cycle)
 	service.GetTaskAdaptorFunc = func(platform constant.TaskPlatform) service.TaskPollingAdaptor {
 		a := relay.GetTaskAdaptor(platform)
@@ -192,10 +208,32 @@ func main() {
 	// Log startup success message
 	common.LogStartupSuccess(startTime, port)
 
-	err = server.Run(":" + port)
-	if err != nil {
-		common.FatalLog("failed to start HTTP server: " + err.Error())
+	httpServer := &http.Server{
+		Addr:    ":" + port,
+		Handler: server,
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			common.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	common.SysLog("shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		common.SysError("server shutdown error: " + err.Error())
+	}
+
+	// 请求处理完毕后再落库批量更新中的额度变更，避免重新部署时丢失
+	if common.BatchUpdateEnabled {
+		model.FlushBatchUpdates()
 	}
+	common.SysLog("server exited")
 }
 
 func InjectUmamiAnalytics() {
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relayAccessLog 结构化访问日志的一行，字段名保持稳定以便 ELK/Loki 解析
+type relayAccessLog struct {
+	Time             string `json:"time"`
+	RequestId        string `json:"request_id"`
+	UserId           int    `json:"user_id"`
+	TokenId          int    `json:"token_id"`
+	Group            string `json:"group"`
+	Model            string `json:"model"`
+	ChannelId        int    `json:"channel_id"`
+	RelayMode        int    `json:"relay_mode"`
+	Method           string `json:"method"`
+	Path             string `json:"path"`
+	Status           int    `json:"status"`
+	LatencyMs        int64  `json:"latency_ms"`
+	FirstByteMs      int64  `json:"first_byte_ms"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int    `json:"quota"`
+	IsStream         bool   `json:"is_stream"`
+}
+
+// buildRelayAccessLog 根据中继结束后的上下文生成访问日志，用量与首字延迟取自本次请求记录的消费日志参数
+func buildRelayAccessLog(c *gin.Context) relayAccessLog {
+	now := time.Now()
+	entry := relayAccessLog{
+		Time:      now.Format(time.RFC3339Nano),
+		RequestId: c.GetString(common.RequestIdKey),
+		UserId:    c.GetInt("id"),
+		TokenId:   common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		Group:     common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		Model:     common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		ChannelId: common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		Status:    c.Writer.Status(),
+	}
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		entry.Group = autoGroup
+	}
+	if c.Request != nil && c.Request.URL != nil {
+		entry.Method = c.Request.Method
+		entry.Path = c.Request.URL.Path
+	}
+	if relayMode, ok := c.Get("relay_mode"); ok {
+		entry.RelayMode, _ = relayMode.(int)
+	} else {
+		entry.RelayMode = relayconstant.Path2RelayMode(entry.Path)
+	}
+	if startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime); !startTime.IsZero() {
+		entry.LatencyMs = now.Sub(startTime).Milliseconds()
+	}
+	if raw, ok := common.GetContextKey(c, constant.ContextKeyConsumeLogParams); ok {
+		if params, ok := raw.(model.RecordConsumeLogParams); ok {
+			entry.PromptTokens = params.PromptTokens
+			entry.CompletionTokens = params.CompletionTokens
+			entry.Quota = params.Quota
+			entry.IsStream = params.IsStream
+			if frt, ok := params.Other["frt"].(float64); ok && frt > 0 {
+				entry.FirstByteMs = int64(frt)
+			}
+		}
+	}
+	return entry
+}
+
+// writeRelayAccessLog 在 ACCESS_LOG_JSON_ENABLED 开启时输出一行 JSON 访问日志
+func writeRelayAccessLog(c *gin.Context) {
+	if !constant.AccessLogJsonEnabled {
+		return
+	}
+	line, err := common.Marshal(buildRelayAccessLog(c))
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(gin.DefaultWriter, "%s\n", line)
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRelayAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalEnabled, originalWriter := constant.AccessLogJsonEnabled, gin.DefaultWriter
+	var buf bytes.Buffer
+	gin.DefaultWriter = &buf
+	t.Cleanup(func() { constant.AccessLogJsonEnabled, gin.DefaultWriter = originalEnabled, originalWriter })
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set(common.RequestIdKey, "req-1")
+	c.Set("id", 7)
+	common.SetContextKey(c, constant.ContextKeyTokenId, 11)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "auto")
+	common.SetContextKey(c, constant.ContextKeyAutoGroup, "vip")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "gpt-4o")
+	common.SetContextKey(c, constant.ContextKeyChannelId, 3)
+	common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now().Add(-time.Second))
+	common.SetContextKey(c, constant.ContextKeyConsumeLogParams, model.RecordConsumeLogParams{
+		PromptTokens:     10,
+		CompletionTokens: 20,
+		Quota:            300,
+		IsStream:         true,
+		Other:            map[string]interface{}{"frt": float64(120)},
+	})
+	c.Status(http.StatusOK)
+
+	constant.AccessLogJsonEnabled = false
+	writeRelayAccessLog(c)
+	require.Zero(t, buf.Len())
+
+	constant.AccessLogJsonEnabled = true
+	writeRelayAccessLog(c)
+	var entry relayAccessLog
+	require.NoError(t, common.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry))
+	require.Equal(t, "req-1", entry.RequestId)
+	require.Equal(t, 7, entry.UserId)
+	require.Equal(t, 11, entry.TokenId)
+	require.Equal(t, "vip", entry.Group)
+	require.Equal(t, "gpt-4o", entry.Model)
+	require.Equal(t, 3, entry.ChannelId)
+	require.Equal(t, relayconstant.RelayModeChatCompletions, entry.RelayMode)
+	require.Equal(t, http.StatusOK, entry.Status)
+	require.GreaterOrEqual(t, entry.LatencyMs, int64(1000))
+	require.Equal(t, int64(120), entry.FirstByteMs)
+	require.Equal(t, 10, entry.PromptTokens)
+	require.Equal(t, 20, entry.CompletionTokens)
+	require.Equal(t, 300, entry.Quota)
+	require.True(t, entry.IsStream)
+}
+
+func TestDistributeWritesAccessLogOnEarlyAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, i18n.Init())
+	originalEnabled, originalWriter := constant.AccessLogJsonEnabled, gin.DefaultWriter
+	var buf bytes.Buffer
+	gin.DefaultWriter = &buf
+	constant.AccessLogJsonEnabled = true
+	t.Cleanup(func() { constant.AccessLogJsonEnabled, gin.DefaultWriter = originalEnabled, originalWriter })
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", Distribute(), func(c *gin.Context) {
+		t.Fatal("relay handler should not run for an invalid request")
+	})
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString("{invalid"))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var entry relayAccessLog
+	require.NoError(t, common.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry))
+	require.Equal(t, http.StatusBadRequest, entry.Status)
+	require.Equal(t, "/v1/chat/completions", entry.Path)
+}
@@ -348,14 +348,14 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
-		clientIp := c.ClientIP()
+		clientIp := common.ResolveClientIP(c)
 		common.SetContextKey(c, constant.ContextKeyClientIP, clientIp)
 
 		allowIps := token.GetIpLimits()
 		if len(allowIps) > 0 {
 			clientIp := common.GetContextKeyString(c, constant.ContextKeyClientIP)
 			if clientIp == "" {
-				clientIp = c.ClientIP()
+				clientIp = common.ResolveClientIP(c)
 				common.SetContextKey(c, constant.ContextKeyClientIP, clientIp)
 			}
 			logger.LogDebug(c, "Token has IP restrictions, checking client IP %s", clientIp)
@@ -439,6 +439,9 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	common.SetContextKey(c, constant.ContextKeyTokenRateLimitSuccessCount, token.RateLimitSuccessCount)
 	common.SetContextKey(c, constant.ContextKeyTokenIPRateLimitCount, token.IPRateLimitCount)
 	common.SetContextKey(c, constant.ContextKeyTokenIPRateLimitSuccessCount, token.IPRateLimitSuccessCount)
+	if mapping := token.GetModelMappingMap(); mapping != nil {
+		common.SetContextKey(c, constant.ContextKeyTokenModelMapping, mapping)
+	}
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
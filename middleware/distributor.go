@@ -8,7 +8,6 @@ import (
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -39,17 +38,18 @@ type modelRequestCacheEntry struct {
 	TokenGroup           string
 	TokenGroupSet        bool
 	ExpireAtUnixNanoTime int64
+	// ConfigVersion 写入时的路由配置版本号，与当前版本不一致的条目视为未命中
+	ConfigVersion uint64
 }
 
 var (
-	modelRequestParseCache            = sync.Map{}
+	// modelRequestParseCache 路由解析本地 L1 缓存，容量与 TTL 由 ROUTING_PARSE_CACHE_MAX_ENTRIES / ROUTING_PARSE_CACHE_TTL_SECONDS 配置，满时按 LRU 淘汰
+	modelRequestParseCache            = common.NewTTLCacheFromEnv[string, *modelRequestCacheEntry]("routing_parse", 20000, 8*time.Second)
 	modelRequestCacheEnabled          = common.GetEnvOrDefaultBool("ROUTING_PARSE_CACHE_ENABLED", true)
-	modelRequestCacheTTL              = time.Duration(common.GetEnvOrDefault("ROUTING_PARSE_CACHE_TTL_SECONDS", 8)) * time.Second
+	modelRequestCacheTTL              = modelRequestParseCache.TTL()
 	modelRequestCacheBodyMaxBytes     = int64(common.GetEnvOrDefault("ROUTING_PARSE_CACHE_BODY_MAX_BYTES", 1<<20))
 	modelRequestCacheMaxQueryBytes    = int64(common.GetEnvOrDefault("ROUTING_PARSE_CACHE_MAX_QUERY_BYTES", 2048))
-	modelRequestCacheMaxEntries       = int64(common.GetEnvOrDefault("ROUTING_PARSE_CACHE_MAX_ENTRIES", 20000))
 	modelRequestCacheCleanupInterval  = time.Duration(common.GetEnvOrDefault("ROUTING_PARSE_CACHE_CLEANUP_INTERVAL_SECONDS", 15)) * time.Second
-	modelRequestCacheEntryCount       = atomic.Int64{}
 	modelRequestCacheCleanupRunning   = atomic.Bool{}
 	modelRequestCacheLastCleanupNanos = atomic.Int64{}
 	modelRequestWarmModels            = parseModelRequestWarmModels(common.GetEnvOrDefaultString("ROUTING_PARSE_CACHE_WARMUP_MODELS", "gpt-4o,gpt-4o-mini,gemini-2.0-flash"))
@@ -60,24 +60,22 @@ func init() {
 	if !modelRequestCacheEnabled {
 		return
 	}
-	if modelRequestCacheTTL <= 0 {
-		modelRequestCacheTTL = 8 * time.Second
-	}
 	if modelRequestCacheBodyMaxBytes <= 0 {
 		modelRequestCacheBodyMaxBytes = 1 << 20
 	}
 	if modelRequestCacheMaxQueryBytes <= 0 {
 		modelRequestCacheMaxQueryBytes = 2048
 	}
-	if modelRequestCacheMaxEntries <= 0 {
-		modelRequestCacheMaxEntries = 20000
-	}
 	if modelRequestCacheCleanupInterval <= 0 {
 		modelRequestCacheCleanupInterval = 15 * time.Second
 	}
 	modelRequestCacheLastCleanupNanos.Store(time.Now().UnixNano())
 	prewarmModelRequestParseCache()
 	maybeCleanupModelRequestCache(true)
+	// 渠道被自动禁用/启用时同样清除其模型的路由解析缓存
+	model.OnChannelStatusChanged(func(channel *model.Channel) {
+		InvalidateModelRequestCacheForChannels(channel)
+	})
 }
 
 func parseModelRequestWarmModels(raw string) []string {
@@ -166,7 +164,7 @@ func getModelRequestCacheTokenScope(c *gin.Context) string {
 	}
 	raw, ok := common.GetContextKey(c, constant.ContextKeyTokenId)
 	if !ok || raw == nil {
-		return ""
+		return resolveModelRequestCacheDerivedTokenScope(c)
 	}
 	var tokenScope string
 	switch v := raw.(type) {
@@ -195,13 +193,52 @@ func getModelRequestCacheTokenScope(c *gin.Context) string {
 	default:
 		tokenScope = fmt.Sprintf("%v", raw)
 	}
-	return strings.ReplaceAll(tokenScope, "|", "_")
+	return tokenScope
+}
+
+// buildModelRequestCacheKeyParts 以 name=长度:值 的形式拼接各组成部分，
+// 长度前缀保证组件中出现的 `|`、`=`、`:` 等字符无法伪造出与其他请求相同的 key。
+func buildModelRequestCacheKeyParts(parts ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(parts); i += 2 {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteString(parts[i])
+		b.WriteByte('=')
+		b.WriteString(strconv.Itoa(len(parts[i+1])))
+		b.WriteByte(':')
+		b.WriteString(parts[i+1])
+	}
+	return b.String()
 }
 
 func buildModelRequestCacheKeyFromBody(method, path, contentType, tokenScope string, body []byte) string {
 	normalizedCT := normalizeModelRequestContentType(contentType)
 	checksum := sha256.Sum256(body)
-	return fmt.Sprintf("t=%s|m=%s|p=%s|ct=%s|l=%d|h=%x", tokenScope, method, path, normalizedCT, len(body), checksum)
+	return buildModelRequestCacheKeyParts(
+		"t", tokenScope,
+		"m", method,
+		"p", path,
+		"ct", normalizedCT,
+		"l", strconv.Itoa(len(body)),
+		"h", fmt.Sprintf("%x", checksum),
+	)
+}
+
+func buildModelRequestQueryCacheKey(method, path, tokenScope, rawQuery string) string {
+	queryChecksum := sha256.Sum256([]byte(rawQuery))
+	return buildModelRequestCacheKeyParts(
+		"t", tokenScope,
+		"m", method,
+		"p", path,
+		"ql", strconv.Itoa(len(rawQuery)),
+		"qh", fmt.Sprintf("%x", queryChecksum),
+	)
+}
+
+func buildModelRequestPathCacheKey(method, path, tokenScope string) string {
+	return buildModelRequestCacheKeyParts("t", tokenScope, "m", method, "p", path)
 }
 
 func isModelRequestModelWarmPath(path string) bool {
@@ -225,7 +262,7 @@ func normalizeModelNameForModelWarmCache(modelName string) string {
 }
 
 func buildModelRequestWarmCacheKeyForModel(method, path, tokenScope, modelName string) string {
-	return fmt.Sprintf("t=%s|m=%s|p=%s|wm=%s", tokenScope, method, path, modelName)
+	return buildModelRequestCacheKeyParts("t", tokenScope, "m", method, "p", path, "wm", modelName)
 }
 
 func extractModelNameForModelRequestWarmCache(c *gin.Context) (string, bool) {
@@ -306,15 +343,14 @@ func buildModelRequestCacheKeyWithTokenScope(c *gin.Context, tokenScope string,
 		if int64(len(rawQuery)) > modelRequestCacheMaxQueryBytes {
 			return "", false
 		}
-		queryChecksum := sha256.Sum256([]byte(rawQuery))
-		return fmt.Sprintf("t=%s|m=%s|p=%s|ql=%d|qh=%x", tokenScope, method, path, len(rawQuery), queryChecksum), true
+		return buildModelRequestQueryCacheKey(method, path, tokenScope, rawQuery), true
 	}
 
 	if strings.Contains(path, "/suno/") ||
 		(strings.Contains(path, "/v1/videos/") && strings.HasSuffix(path, "/remix")) ||
 		strings.HasPrefix(path, "/v1beta/models/") ||
 		strings.HasPrefix(path, "/v1/models/") {
-		return fmt.Sprintf("t=%s|m=%s|p=%s", tokenScope, method, path), true
+		return buildModelRequestPathCacheKey(method, path, tokenScope), true
 	}
 
 	if method == http.MethodPost && isModelRequestModelWarmPath(path) {
@@ -352,31 +388,54 @@ func buildModelRequestModelWarmCacheKey(c *gin.Context) (string, bool) {
 	return buildModelRequestModelWarmCacheKeyWithTokenScope(c, "", true)
 }
 
-func decreaseModelRequestCacheEntryCount(delta int64) {
-	if delta <= 0 {
-		return
+func deleteModelRequestCacheByKey(cacheKey string) bool {
+	if cacheKey == "" {
+		return false
+	}
+	return modelRequestParseCache.Delete(cacheKey)
+}
+
+// InvalidateModelRequestCacheForModel 删除模型为 modelName（含 compact 后缀变体）的路由解析缓存条目，返回删除的本地条目数量；
+// 启用 Redis L2 时同时递增该模型的代数，使其他节点写入的共享条目一并失效。
+// 缓存键为不透明的哈希，需遍历条目按 ModelRequest.Model 匹配，仅在渠道变更等低频场景调用。
+func InvalidateModelRequestCacheForModel(modelName string) int {
+	modelName = normalizeModelNameForModelWarmCache(modelName)
+	if modelName == "" {
+		return 0
 	}
-	for {
-		current := modelRequestCacheEntryCount.Load()
-		next := current - delta
-		if next < 0 {
-			next = 0
+	bumpModelRequestRedisGeneration(modelRequestRedisModelGenerationKey(modelName))
+	return deleteModelRequestCacheIf(func(entry *modelRequestCacheEntry) bool {
+		return normalizeModelNameForModelWarmCache(entry.ModelRequest.Model) == modelName
+	})
+}
+
+// InvalidateModelRequestCacheForChannels 渠道变更后清除其模型对应的路由解析缓存，修改渠道时应同时传入新旧渠道
+func InvalidateModelRequestCacheForChannels(channels ...*model.Channel) {
+	seen := make(map[string]struct{})
+	for _, channel := range channels {
+		if channel == nil {
+			continue
 		}
-		if modelRequestCacheEntryCount.CompareAndSwap(current, next) {
-			return
+		for _, modelName := range channel.GetModels() {
+			if _, ok := seen[modelName]; ok {
+				continue
+			}
+			seen[modelName] = struct{}{}
+			InvalidateModelRequestCacheForModel(modelName)
 		}
 	}
 }
 
-func deleteModelRequestCacheByKey(cacheKey any) bool {
-	if cacheKey == nil {
-		return false
-	}
-	if _, loaded := modelRequestParseCache.LoadAndDelete(cacheKey); loaded {
-		decreaseModelRequestCacheEntryCount(1)
-		return true
-	}
-	return false
+// FlushModelRequestCache 清空全部路由解析缓存，返回删除的本地条目数量；启用 Redis L2 时递增全局代数使共享条目失效
+func FlushModelRequestCache() int {
+	bumpModelRequestRedisGeneration(modelRequestRedisGenerationKey)
+	return deleteModelRequestCacheIf(func(*modelRequestCacheEntry) bool { return true })
+}
+
+func deleteModelRequestCacheIf(match func(entry *modelRequestCacheEntry) bool) int {
+	return modelRequestParseCache.DeleteIf(func(_ string, entry *modelRequestCacheEntry) bool {
+		return entry == nil || match(entry)
+	})
 }
 
 func maybeCleanupModelRequestCache(force bool) {
@@ -392,15 +451,8 @@ func maybeCleanupModelRequestCache(force bool) {
 	}
 	defer modelRequestCacheCleanupRunning.Store(false)
 
-	nowNanos = time.Now().UnixNano()
-	modelRequestCacheLastCleanupNanos.Store(nowNanos)
-	modelRequestParseCache.Range(func(key, value any) bool {
-		entry, ok := value.(*modelRequestCacheEntry)
-		if !ok || entry == nil || nowNanos > entry.ExpireAtUnixNanoTime {
-			deleteModelRequestCacheByKey(key)
-		}
-		return true
-	})
+	modelRequestCacheLastCleanupNanos.Store(time.Now().UnixNano())
+	modelRequestParseCache.CleanupExpired()
 }
 
 func getModelRequestCache(cacheKey string) (*modelRequestCacheEntry, bool) {
@@ -408,16 +460,11 @@ func getModelRequestCache(cacheKey string) (*modelRequestCacheEntry, bool) {
 		return nil, false
 	}
 	maybeCleanupModelRequestCache(false)
-	cached, ok := modelRequestParseCache.Load(cacheKey)
+	entry, ok := modelRequestParseCache.Get(cacheKey)
 	if !ok {
-		return nil, false
-	}
-	entry, ok := cached.(*modelRequestCacheEntry)
-	if !ok || entry == nil {
-		deleteModelRequestCacheByKey(cacheKey)
-		return nil, false
+		return getModelRequestCacheFromRedis(cacheKey)
 	}
-	if time.Now().UnixNano() > entry.ExpireAtUnixNanoTime {
+	if entry == nil || entry.ConfigVersion != common.RoutingConfigVersion() {
 		deleteModelRequestCacheByKey(cacheKey)
 		return nil, false
 	}
@@ -431,24 +478,18 @@ func setModelRequestCache(cacheKey string, entry *modelRequestCacheEntry) {
 	maybeCleanupModelRequestCache(false)
 	ttl := modelRequestCacheTTLForModel(entry.ModelRequest.Model)
 	entry.ExpireAtUnixNanoTime = time.Now().Add(ttl).UnixNano()
+	entry.ConfigVersion = common.RoutingConfigVersion()
+	setModelRequestCacheToRedis(cacheKey, entry, ttl)
+	storeModelRequestCacheLocal(cacheKey, entry)
+}
 
-	for {
-		if modelRequestCacheEntryCount.Load() >= modelRequestCacheMaxEntries {
-			maybeCleanupModelRequestCache(true)
-			if modelRequestCacheEntryCount.Load() >= modelRequestCacheMaxEntries {
-				return
-			}
-		}
-		existingValue, loaded := modelRequestParseCache.LoadOrStore(cacheKey, entry)
-		if !loaded {
-			modelRequestCacheEntryCount.Add(1)
-			return
-		}
-		if modelRequestParseCache.CompareAndSwap(cacheKey, existingValue, entry) {
-			return
-		}
-		// 并发下 key 可能在 LoadOrStore 与更新之间被删除或替换，重试可避免计数漂移。
+// storeModelRequestCacheLocal 写入本地 L1 缓存，条目按 entry.ExpireAtUnixNanoTime 过期，需已设置
+func storeModelRequestCacheLocal(cacheKey string, entry *modelRequestCacheEntry) {
+	ttl := time.Until(time.Unix(0, entry.ExpireAtUnixNanoTime))
+	if ttl <= 0 {
+		return
 	}
+	modelRequestParseCache.SetWithTTL(cacheKey, entry, ttl)
 }
 
 func buildModelRequestCacheEntryFromContext(c *gin.Context, modelRequest *ModelRequest, shouldSelectChannel bool) *modelRequestCacheEntry {
@@ -512,25 +553,41 @@ func prewarmModelRequestParseCache() {
 			continue
 		}
 		for _, path := range modelWarmPaths {
-			warmedModelName := normalizedModelName
-			if path == "/v1/responses/compact" {
-				warmedModelName = ratio_setting.WithCompactModelSuffix(normalizedModelName)
-			}
-			cacheKey := buildModelRequestWarmCacheKeyForModel(http.MethodPost, path, "", normalizedModelName)
-			setModelRequestCache(cacheKey, &modelRequestCacheEntry{
-				ModelRequest:        ModelRequest{Model: warmedModelName},
-				ShouldSelectChannel: true,
-			})
+			warmModelRequestCacheForPath(path, normalizedModelName)
 		}
 	}
 }
 
+// warmModelRequestCacheForPath 为 path 写入 normalizedModelName 的无令牌预热缓存条目，
+// 条目保存未改写的模型名，命中时再应用模型名改写器
+func warmModelRequestCacheForPath(path string, normalizedModelName string) {
+	warmedModelName := normalizedModelName
+	if path == "/v1/responses/compact" {
+		warmedModelName = ratio_setting.WithCompactModelSuffix(normalizedModelName)
+	}
+	cacheKey := buildModelRequestWarmCacheKeyForModel(http.MethodPost, path, "", normalizedModelName)
+	setModelRequestCache(cacheKey, &modelRequestCacheEntry{
+		ModelRequest:        ModelRequest{Model: warmedModelName},
+		ShouldSelectChannel: true,
+	})
+}
+
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		// 请求被提前拒绝（请求体过大、无可用渠道等）时同样输出访问日志
+		defer writeRelayAccessLog(c)
 		var channel *model.Channel
+		if limitRequestBody(c) {
+			abortWithOpenAiMessage(c, http.StatusRequestEntityTooLarge, i18n.T(c, i18n.MsgDistributorRequestTooLarge, map[string]any{"Max": constant.MaxRequestBodyBytes}), types.ErrorCodeReadRequestBodyFailed)
+			return
+		}
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
+			if isRequestBodyLimitExceeded(c) {
+				abortWithOpenAiMessage(c, http.StatusRequestEntityTooLarge, i18n.T(c, i18n.MsgDistributorRequestTooLarge, map[string]any{"Max": constant.MaxRequestBodyBytes}), types.ErrorCodeReadRequestBodyFailed)
+				return
+			}
 			abortWithOpenAiMessage(c, http.StatusBadRequest, i18n.T(c, i18n.MsgDistributorInvalidRequest, map[string]any{"Error": err.Error()}))
 			return
 		}
@@ -597,7 +654,11 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				// 客户端显式指定的粘性路由键优先于自动亲和性
+				if routed, routedGroup, ok := service.GetChannelByRoutingKey(c, modelRequest.Model, usingGroup); ok {
+					channel = routed
+					selectGroup = routedGroup
+				} else if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					preferred, err := model.CacheGetChannel(preferredChannelID)
 					if err == nil && preferred != nil {
 						if preferred.Status != common.ChannelStatusEnabled {
@@ -605,26 +666,36 @@ func Distribute() func(c *gin.Context) {
 								abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorChannelDisabled))
 								return
 							}
-						} else if usingGroup == "auto" {
-							userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
-							autoGroups := service.GetUserAutoGroup(userGroup)
-							for _, g := range autoGroups {
-								if model.IsChannelEnabledForGroupModel(g, modelRequest.Model, preferred.Id) {
-									selectGroup = g
-									common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
-									channel = preferred
-									service.MarkChannelAffinityUsed(c, g, preferred.Id)
-									break
+						} else {
+							preferredGroup := ""
+							if usingGroup == "auto" {
+								userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+								for _, g := range service.GetUserAutoGroup(userGroup) {
+									if model.IsChannelEnabledForGroupModel(g, modelRequest.Model, preferred.Id) {
+										preferredGroup = g
+										break
+									}
 								}
+							} else if model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, preferred.Id) {
+								preferredGroup = usingGroup
+							}
+							// 首选渠道并发已满时按配置等待或降级为常规选择
+							if preferredGroup != "" && service.ShouldUseAffinityPreferredChannel(c, preferred.Id, preferred.GetSetting().MaxConcurrency) {
+								if usingGroup == "auto" {
+									common.SetContextKey(c, constant.ContextKeyAutoGroup, preferredGroup)
+								}
+								channel = preferred
+								selectGroup = preferredGroup
+								service.MarkChannelAffinityUsed(c, preferredGroup, preferred.Id)
 							}
-						} else if model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, preferred.Id) {
-							channel = preferred
-							selectGroup = usingGroup
-							service.MarkChannelAffinityUsed(c, usingGroup, preferred.Id)
 						}
 					}
 				}
 
+				if channel == nil && constant.CostAwareRoutingEnabled {
+					channel, selectGroup, _ = service.CacheGetCostAwareChannel(c, modelRequest.Model, usingGroup, estimateRoutingRequestTokens(c, modelRequest.Model))
+				}
+
 				if channel == nil {
 					channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
 						Ctx:        c,
@@ -650,11 +721,16 @@ func Distribute() func(c *gin.Context) {
 						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, i18n.T(c, i18n.MsgDistributorNoAvailableChannel, map[string]any{"Group": usingGroup, "Model": modelRequest.Model}), types.ErrorCodeModelNotFound)
 						return
 					}
+					if decayedID := service.GetChannelAffinityDecayedChannel(c); decayedID > 0 && channel.Id == decayedID {
+						channel, selectGroup = reselectAwayFromDecayedChannel(c, modelRequest.Model, usingGroup, channel, selectGroup)
+					}
 				}
 			}
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
+		defer service.ReleaseChannelInFlight(c)
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		wrapQuotaHeaderWriter(c)
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
@@ -662,6 +738,81 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// isMultipartUploadRequest 判断是否为文件上传类接口，这类请求不受 MaxRequestBodyBytes 限制
+func isMultipartUploadRequest(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/v1/audio/transcriptions") ||
+		strings.HasPrefix(path, "/v1/audio/translations") ||
+		strings.HasPrefix(path, "/v1/images/edits") {
+		return true
+	}
+	return strings.Contains(normalizeModelRequestContentType(c.Request.Header.Get("Content-Type")), "multipart/form-data")
+}
+
+// limitRequestBody 在选择渠道前限制请求体大小，避免超大请求被转发到上游。
+// 声明的 Content-Length 超限时直接返回 true；否则以 http.MaxBytesReader 包装请求体而不预先读取，
+// 之后任何读取超过上限都会失败（错误可由 common.IsRequestBodyTooLargeError 识别）
+func limitRequestBody(c *gin.Context) bool {
+	maxBytes := constant.MaxRequestBodyBytes
+	if maxBytes <= 0 || c.Request == nil || c.Request.Body == nil || isMultipartUploadRequest(c) {
+		return false
+	}
+	if c.Request.ContentLength > maxBytes {
+		return true
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	return false
+}
+
+// isRequestBodyLimitExceeded 在解析请求失败后判断是否因请求体超过 limitRequestBody 设置的上限。
+// MaxBytesReader 超限后的读取错误会保留，因此可通过再次获取请求体存储确认
+func isRequestBodyLimitExceeded(c *gin.Context) bool {
+	if constant.MaxRequestBodyBytes <= 0 || c.Request == nil || c.Request.Body == nil || isMultipartUploadRequest(c) {
+		return false
+	}
+	_, err := common.GetBodyStorage(c)
+	return common.IsRequestBodyTooLargeError(err)
+}
+
+// affinityDecayReselectAttempts 亲和首选渠道降级后，随机选择再次命中该渠道时的重选次数
+const affinityDecayReselectAttempts = 3
+
+// reselectAwayFromDecayedChannel 尽量避开因并发已满或近期失败被跳过的亲和首选渠道，多次重选仍命中时沿用该渠道
+func reselectAwayFromDecayedChannel(c *gin.Context, modelName string, usingGroup string, channel *model.Channel, selectGroup string) (*model.Channel, string) {
+	decayedID := channel.Id
+	for i := 0; i < affinityDecayReselectAttempts; i++ {
+		candidate, group, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+			Ctx:        c,
+			ModelName:  modelName,
+			TokenGroup: usingGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err != nil || candidate == nil {
+			break
+		}
+		if candidate.Id != decayedID {
+			return candidate, group
+		}
+	}
+	return channel, selectGroup
+}
+
+// estimateRoutingRequestTokens 按请求体粗略估算 token 数供成本感知路由使用，文件上传或读取失败时返回 0
+func estimateRoutingRequestTokens(c *gin.Context, modelName string) int {
+	if c.Request == nil || c.Request.Body == nil || isMultipartUploadRequest(c) {
+		return 0
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return 0
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return 0
+	}
+	return service.EstimateTokenByModel(modelName, string(body))
+}
+
 // getModelFromRequest 从请求中读取模型信息
 // 根据 Content-Type 自动处理：
 // - application/json
@@ -687,12 +838,18 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		if entry, ok := getModelRequestCache(cacheKey); ok {
 			modelRequest := entry.ModelRequest
 			applyModelRequestCacheEntry(c, entry)
+			recordModelRequestWarmHit(c, modelRequest.Model)
+			applyTokenModelMapping(c, &modelRequest)
 			return &modelRequest, entry.ShouldSelectChannel, nil
 		}
 		if modelWarmKey, warmModelEnabled := buildModelRequestModelWarmCacheKey(c); warmModelEnabled && modelWarmKey != cacheKey {
 			if entry, ok := getModelRequestCache(modelWarmKey); ok {
 				modelRequest := entry.ModelRequest
+				// 预热条目在初始化阶段写入，早于改写器注册，保存的是未改写的模型名
+				modelRequest.Model = applyModelNameTransformers(c.Request.URL.Path, modelRequest.Model)
 				applyModelRequestCacheEntry(c, entry)
+				recordModelRequestWarmHit(c, modelRequest.Model)
+				applyTokenModelMapping(c, &modelRequest)
 				return &modelRequest, entry.ShouldSelectChannel, nil
 			}
 		}
@@ -714,9 +871,12 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			if path == "/v1/responses/compact" && result.Model != "" {
 				result.Model = ratio_setting.WithCompactModelSuffix(result.Model)
 			}
+			result.Model = applyModelNameTransformers(path, result.Model)
 			if cacheEnabled {
 				setModelRequestCache(cacheKey, buildModelRequestCacheEntryFromContext(c, result, true))
 			}
+			recordModelRequestWarmHit(c, result.Model)
+			applyTokenModelMapping(c, result)
 			return result, true, nil
 		}
 	}
@@ -882,10 +1042,12 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		modelRequest.Model = ratio_setting.WithCompactModelSuffix(modelRequest.Model)
 	}
 
+	modelRequest.Model = applyModelNameTransformers(path, modelRequest.Model)
 	result := &modelRequest
 	if cacheEnabled {
 		setModelRequestCache(cacheKey, buildModelRequestCacheEntryFromContext(c, result, shouldSelectChannel))
 	}
+	applyTokenModelMapping(c, result)
 	return result, shouldSelectChannel, nil
 }
 
@@ -894,6 +1056,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	if channel == nil {
 		return types.NewError(errors.New("channel is nil"), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
+	service.TrackChannelInFlight(c, channel.Id)
 	common.SetContextKey(c, constant.ContextKeyChannelId, channel.Id)
 	common.SetContextKey(c, constant.ContextKeyChannelName, channel.Name)
 	common.SetContextKey(c, constant.ContextKeyChannelType, channel.Type)
@@ -902,10 +1065,13 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, channel.GetOtherSettings())
 	paramOverride := channel.GetParamOverride()
 	headerOverride := channel.GetHeaderOverride()
+	paramOverrideVersion := channel.GetParamOverrideVersion()
 	if mergedParam, applied := service.ApplyChannelAffinityOverrideTemplate(c, paramOverride); applied {
 		paramOverride = mergedParam
+		paramOverrideVersion = ""
 	}
 	common.SetContextKey(c, constant.ContextKeyChannelParamOverride, paramOverride)
+	common.SetContextKey(c, constant.ContextKeyChannelParamOverrideVersion, paramOverrideVersion)
 	common.SetContextKey(c, constant.ContextKeyChannelHeaderOverride, headerOverride)
 	if nil != channel.OpenAIOrganization && *channel.OpenAIOrganization != "" {
 		common.SetContextKey(c, constant.ContextKeyChannelOrganization, *channel.OpenAIOrganization)
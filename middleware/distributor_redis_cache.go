@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	modelRequestRedisCacheKeyPrefix = "routing_parse_cache:"
+	// modelRequestRedisGenerationKey 全局代数，FlushModelRequestCache 递增后所有 L2 条目失效
+	modelRequestRedisGenerationKey = "routing_parse_cache_gen"
+	// modelRequestRedisModelGenerationPrefix 按模型的代数，InvalidateModelRequestCacheForModel 递增后该模型的 L2 条目失效
+	modelRequestRedisModelGenerationPrefix = "routing_parse_cache_gen:model:"
+)
+
+// modelRequestCacheRedisEnabled 开启后将 Redis 作为路由解析缓存的 L2，多副本共享解析结果。
+// Redis 中只保存 modelRequestCacheEntry（模型、relay mode、平台、令牌分组），不保存请求体；
+// 条目保留写入时的过期时间，并记录写入时的全局与模型代数，清空或按模型失效时递增代数使其失效。
+var modelRequestCacheRedisEnabled = common.GetEnvOrDefaultBool("ROUTING_PARSE_CACHE_REDIS_ENABLED", false)
+
+// modelRequestRedisCacheValue Redis 中保存的条目，WrittenAt 用于判断是否写于本节点最近一次路由配置变更之前
+type modelRequestRedisCacheValue struct {
+	Entry     modelRequestCacheEntry `json:"entry"`
+	WrittenAt int64                  `json:"written_at"`
+}
+
+// modelRequestRedisSetScript 以当前全局与模型代数为前缀写入条目：KEYS[1] 条目，KEYS[2] 全局代数，KEYS[3] 模型代数
+var modelRequestRedisSetScript = redis.NewScript(`
+local gen = redis.call('GET', KEYS[2]) or '0'
+local modelGen = redis.call('GET', KEYS[3]) or '0'
+redis.call('SET', KEYS[1], gen .. '|' .. modelGen .. '|' .. KEYS[3] .. '\n' .. ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// modelRequestRedisGetScript 读取条目并校验代数，任一代数已变化时删除条目并返回 nil：KEYS[1] 条目，KEYS[2] 全局代数
+var modelRequestRedisGetScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+	return false
+end
+local gen, modelGen, modelKey, payload = string.match(raw, '^(%d+)|(%d+)|([^\n]*)\n(.*)$')
+if not gen then
+	redis.call('DEL', KEYS[1])
+	return false
+end
+if gen ~= (redis.call('GET', KEYS[2]) or '0') or modelGen ~= (redis.call('GET', modelKey) or '0') then
+	redis.call('DEL', KEYS[1])
+	return false
+end
+return payload
+`)
+
+func isModelRequestRedisCacheAvailable() bool {
+	return modelRequestCacheRedisEnabled && common.RedisEnabled && common.RDB != nil
+}
+
+func modelRequestRedisModelGenerationKey(modelName string) string {
+	return modelRequestRedisModelGenerationPrefix + normalizeModelNameForModelWarmCache(modelName)
+}
+
+// getModelRequestCacheFromRedis 在本地未命中时查询 Redis，命中后回填本地缓存。
+// 条目沿用写入时的过期时间；写于本节点最近一次路由配置变更之前的条目视为未命中
+func getModelRequestCacheFromRedis(cacheKey string) (*modelRequestCacheEntry, bool) {
+	if !isModelRequestRedisCacheAvailable() {
+		return nil, false
+	}
+	// 先读取版本号再读取变更时间，保证标记的版本不会晚于校验所用的变更时间
+	version := common.RoutingConfigVersion()
+	changedAt := common.RoutingConfigChangedAt()
+	raw, err := modelRequestRedisGetScript.Run(context.Background(), common.RDB,
+		[]string{modelRequestRedisCacheKeyPrefix + cacheKey, modelRequestRedisGenerationKey}).Text()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			common.SysError("routing parse cache redis get failed: " + err.Error())
+		}
+		return nil, false
+	}
+	var value modelRequestRedisCacheValue
+	if err := common.UnmarshalJsonStr(raw, &value); err != nil {
+		return nil, false
+	}
+	if value.WrittenAt < changedAt || time.Now().UnixNano() > value.Entry.ExpireAtUnixNanoTime {
+		return nil, false
+	}
+	entry := value.Entry
+	// 配置版本号仅在进程内有效，通过上面的变更时间校验后按本节点读取时的版本标记
+	entry.ConfigVersion = version
+	storeModelRequestCacheLocal(cacheKey, &entry)
+	return &entry, true
+}
+
+func setModelRequestCacheToRedis(cacheKey string, entry *modelRequestCacheEntry, ttl time.Duration) {
+	if !isModelRequestRedisCacheAvailable() || ttl <= 0 {
+		return
+	}
+	data, err := common.Marshal(modelRequestRedisCacheValue{Entry: *entry, WrittenAt: time.Now().UnixNano()})
+	if err != nil {
+		return
+	}
+	keys := []string{
+		modelRequestRedisCacheKeyPrefix + cacheKey,
+		modelRequestRedisGenerationKey,
+		modelRequestRedisModelGenerationKey(entry.ModelRequest.Model),
+	}
+	if err := modelRequestRedisSetScript.Run(context.Background(), common.RDB, keys,
+		string(data), strconv.FormatInt(ttl.Milliseconds(), 10)).Err(); err != nil {
+		common.SysError("routing parse cache redis set failed: " + err.Error())
+	}
+}
+
+// bumpModelRequestRedisGeneration 递增 Redis 中的代数，使对应的 L2 条目在下次读取时失效
+func bumpModelRequestRedisGeneration(key string) {
+	if !isModelRequestRedisCacheAvailable() {
+		return
+	}
+	if err := common.RDB.Incr(context.Background(), key).Err(); err != nil {
+		common.SysError("routing parse cache redis generation bump failed: " + err.Error())
+	}
+}
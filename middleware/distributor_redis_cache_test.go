@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func setupModelRequestRedisCacheTest(t *testing.T) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	originalRDB, originalRedisEnabled, originalEnabled := common.RDB, common.RedisEnabled, modelRequestCacheRedisEnabled
+	common.RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	common.RedisEnabled = true
+	modelRequestCacheRedisEnabled = true
+	t.Cleanup(func() {
+		_ = common.RDB.Close()
+		common.RDB, common.RedisEnabled, modelRequestCacheRedisEnabled = originalRDB, originalRedisEnabled, originalEnabled
+	})
+}
+
+func TestModelRequestRedisCacheKeepsOriginalExpiry(t *testing.T) {
+	setupModelRequestRedisCacheTest(t)
+	const key = "redis-l2-expiry"
+	setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: "redis-l2-model"}, ShouldSelectChannel: true})
+	t.Cleanup(func() { deleteModelRequestCacheByKey(key) })
+	local, ok := getModelRequestCache(key)
+	require.True(t, ok)
+	expireAt := local.ExpireAtUnixNanoTime
+
+	// 模拟其他节点：本地未命中，从 Redis 读取
+	deleteModelRequestCacheByKey(key)
+	entry, ok := getModelRequestCache(key)
+	require.True(t, ok)
+	require.Equal(t, "redis-l2-model", entry.ModelRequest.Model)
+	require.Equal(t, expireAt, entry.ExpireAtUnixNanoTime)
+}
+
+func TestModelRequestRedisCacheFlushAndInvalidate(t *testing.T) {
+	setupModelRequestRedisCacheTest(t)
+	keys := map[string]string{
+		"redis-l2-target": "redis-l2-target-model",
+		"redis-l2-other":  "redis-l2-other-model",
+	}
+	for key, modelName := range keys {
+		setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: modelName}, ShouldSelectChannel: true})
+	}
+	t.Cleanup(func() {
+		for key := range keys {
+			deleteModelRequestCacheByKey(key)
+		}
+	})
+
+	// 按模型失效后，该模型的共享条目不会从 Redis 回填
+	InvalidateModelRequestCacheForModel("redis-l2-target-model")
+	deleteModelRequestCacheByKey("redis-l2-other")
+	_, ok := getModelRequestCache("redis-l2-target")
+	require.False(t, ok)
+	_, ok = getModelRequestCache("redis-l2-other")
+	require.True(t, ok)
+
+	// 清空后所有共享条目失效
+	FlushModelRequestCache()
+	_, ok = getModelRequestCache("redis-l2-other")
+	require.False(t, ok)
+
+	// 失效后重新写入的条目正常命中
+	setModelRequestCache("redis-l2-target", &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: "redis-l2-target-model"}})
+	deleteModelRequestCacheByKey("redis-l2-target")
+	_, ok = getModelRequestCache("redis-l2-target")
+	require.True(t, ok)
+}
+
+func TestModelRequestRedisCacheRejectsEntriesBeforeConfigChange(t *testing.T) {
+	setupModelRequestRedisCacheTest(t)
+	const key = "redis-l2-config"
+	setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: "redis-l2-config-model"}})
+	t.Cleanup(func() { deleteModelRequestCacheByKey(key) })
+
+	common.BumpRoutingConfigVersion()
+	_, ok := getModelRequestCache(key)
+	require.False(t, ok)
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildModelRequestCacheKeyPartsResistsDelimiterInjection(t *testing.T) {
+	cases := []struct {
+		name string
+		a    []string
+		b    []string
+	}{
+		{
+			name: "pipe in token scope",
+			a:    []string{"t", "1|m=POST", "m", "GET", "p", "/v1/models"},
+			b:    []string{"t", "1", "m", "POST|m=GET", "p", "/v1/models"},
+		},
+		{
+			name: "pipe and equals in path",
+			a:    []string{"t", "1", "m", "POST", "p", "/a|wm=b"},
+			b:    []string{"t", "1", "m", "POST", "p", "/a", "wm", "b"},
+		},
+		{
+			name: "colon and length prefix lookalike",
+			a:    []string{"t", "3:abc", "m", "GET"},
+			b:    []string{"t", "3", "m", "abc|m=3:GET"},
+		},
+		{
+			name: "pipe replaced by underscore",
+			a:    []string{"t", "a|b"},
+			b:    []string{"t", "a_b"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NotEqual(t, buildModelRequestCacheKeyParts(tc.a...), buildModelRequestCacheKeyParts(tc.b...))
+		})
+	}
+}
+
+func TestModelRequestCacheKeyBuildersDistinguishDelimiterComponents(t *testing.T) {
+	body := []byte(`{"model":"gpt-4o"}`)
+
+	require.NotEqual(t,
+		buildModelRequestCacheKeyFromBody("POST", "/v1/chat/completions", "application/json", "1|m=POST", body),
+		buildModelRequestCacheKeyFromBody("POST", "/v1/chat/completions", "application/json", "1", body),
+	)
+	require.NotEqual(t,
+		buildModelRequestWarmCacheKeyForModel("POST", "/v1/chat/completions|wm=x", "1", "y"),
+		buildModelRequestWarmCacheKeyForModel("POST", "/v1/chat/completions", "1", "x|wm=y"),
+	)
+	require.NotEqual(t,
+		buildModelRequestPathCacheKey("GET", "/v1/models/a|p=b", "1"),
+		buildModelRequestPathCacheKey("GET|p=/v1/models/a", "b", "1"),
+	)
+	require.NotEqual(t,
+		buildModelRequestQueryCacheKey("GET", "/v1/models|ql=0", "1", ""),
+		buildModelRequestQueryCacheKey("GET", "/v1/models", "1", ""),
+	)
+
+	require.Equal(t,
+		buildModelRequestCacheKeyFromBody("POST", "/v1/embeddings", "application/json; charset=utf-8", "7", body),
+		buildModelRequestCacheKeyFromBody("POST", "/v1/embeddings", "Application/JSON", "7", body),
+	)
+}
+
+func TestDistributeRejectsOversizedRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, i18n.Init())
+	original := constant.MaxRequestBodyBytes
+	constant.MaxRequestBodyBytes = 32
+	t.Cleanup(func() { constant.MaxRequestBodyBytes = original })
+
+	newContext := func(path string, contentType string, body string) (*gin.Context, *httptest.ResponseRecorder) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", contentType)
+		return c, recorder
+	}
+	oversized := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+
+	c, recorder := newContext("/v1/chat/completions", "application/json", oversized)
+	Distribute()(c)
+	require.True(t, c.IsAborted())
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	// 未声明 Content-Length 时不预先读取，解析请求体时超限同样返回 413
+	c, recorder = newContext("/v1/chat/completions", "application/json", oversized)
+	c.Request.ContentLength = -1
+	require.False(t, limitRequestBody(c))
+	_, exists := c.Get(common.KeyBodyStorage)
+	require.False(t, exists)
+	Distribute()(c)
+	require.True(t, c.IsAborted())
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	c, _ = newContext("/v1/chat/completions", "application/json", `{"model":"gpt-4o"}`)
+	require.False(t, limitRequestBody(c))
+	_, err := common.GetBodyStorage(c)
+	require.NoError(t, err)
+
+	c, _ = newContext("/v1/audio/transcriptions", "multipart/form-data; boundary=x", oversized)
+	require.False(t, limitRequestBody(c))
+}
+
+func TestInvalidateModelRequestCacheForModel(t *testing.T) {
+	keys := map[string]string{
+		"invalidate-test-a":         "invalidate-target",
+		"invalidate-test-a-compact": ratio_setting.WithCompactModelSuffix("invalidate-target"),
+		"invalidate-test-b":         "invalidate-other",
+	}
+	for key, modelName := range keys {
+		setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: modelName}, ShouldSelectChannel: true})
+	}
+	t.Cleanup(func() {
+		for key := range keys {
+			deleteModelRequestCacheByKey(key)
+		}
+	})
+
+	require.Equal(t, 2, InvalidateModelRequestCacheForModel("invalidate-target"))
+	_, ok := getModelRequestCache("invalidate-test-a")
+	require.False(t, ok)
+	_, ok = getModelRequestCache("invalidate-test-a-compact")
+	require.False(t, ok)
+	_, ok = getModelRequestCache("invalidate-test-b")
+	require.True(t, ok)
+	require.Zero(t, InvalidateModelRequestCacheForModel(""))
+
+	require.GreaterOrEqual(t, FlushModelRequestCache(), 1)
+	_, ok = getModelRequestCache("invalidate-test-b")
+	require.False(t, ok)
+}
+
+func TestInvalidateModelRequestCacheForChannels(t *testing.T) {
+	keys := map[string]string{
+		"invalidate-channel-a": "invalidate-channel-model-a",
+		"invalidate-channel-b": "invalidate-channel-model-b",
+		"invalidate-channel-c": "invalidate-channel-model-c",
+	}
+	for key, modelName := range keys {
+		setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: modelName}, ShouldSelectChannel: true})
+	}
+	t.Cleanup(func() {
+		for key := range keys {
+			deleteModelRequestCacheByKey(key)
+		}
+	})
+
+	// 修改渠道时新旧模型均失效
+	origin := &model.Channel{Models: "invalidate-channel-model-a"}
+	updated := &model.Channel{Models: "invalidate-channel-model-a,invalidate-channel-model-b"}
+	InvalidateModelRequestCacheForChannels(origin, updated, nil)
+	_, ok := getModelRequestCache("invalidate-channel-a")
+	require.False(t, ok)
+	_, ok = getModelRequestCache("invalidate-channel-b")
+	require.False(t, ok)
+	_, ok = getModelRequestCache("invalidate-channel-c")
+	require.True(t, ok)
+}
+
+func TestModelRequestCacheConfigVersionInvalidatesEntries(t *testing.T) {
+	const key = "config-version-test"
+	setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: "config-version-model"}, TokenGroup: "vip", TokenGroupSet: true})
+	t.Cleanup(func() { deleteModelRequestCacheByKey(key) })
+
+	entry, ok := getModelRequestCache(key)
+	require.True(t, ok)
+	require.Equal(t, common.RoutingConfigVersion(), entry.ConfigVersion)
+
+	common.BumpRoutingConfigVersion()
+	_, ok = getModelRequestCache(key)
+	require.False(t, ok)
+
+	setModelRequestCache(key, &modelRequestCacheEntry{ModelRequest: ModelRequest{Model: "config-version-model"}})
+	_, ok = getModelRequestCache(key)
+	require.True(t, ok)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelRequestCacheDerivedScopePrefix 派生的令牌作用域统一带此前缀，不可能与纯数字的令牌 ID 作用域相同
+const modelRequestCacheDerivedScopePrefix = "auth:"
+
+var (
+	// modelRequestCacheAuthScopeEnabled 开启后，上下文中缺少令牌 ID 时从鉴权请求头派生稳定的缓存作用域，
+	// 使令牌 ID 较晚才可用的鉴权流程也能命中路由解析缓存
+	modelRequestCacheAuthScopeEnabled   = common.GetEnvOrDefaultBool("ROUTING_PARSE_CACHE_AUTH_SCOPE_ENABLED", false)
+	modelRequestCacheTokenScopeResolver = authorizationHeaderTokenScope
+)
+
+// SetModelRequestCacheTokenScopeResolver 替换缺少令牌 ID 时的作用域派生方式，传入 nil 恢复默认（鉴权请求头哈希）
+func SetModelRequestCacheTokenScopeResolver(resolver func(c *gin.Context) string) {
+	if resolver == nil {
+		resolver = authorizationHeaderTokenScope
+	}
+	modelRequestCacheTokenScopeResolver = resolver
+}
+
+// authorizationHeaderTokenScope 以鉴权请求头的 HMAC 作为作用域，缓存键中不会出现原始密钥
+func authorizationHeaderTokenScope(c *gin.Context) string {
+	for _, header := range []string{"Authorization", "x-api-key", "x-goog-api-key"} {
+		if value := strings.TrimSpace(c.GetHeader(header)); value != "" {
+			return common.GenerateHMAC(header + ":" + value)[:32]
+		}
+	}
+	return ""
+}
+
+// resolveModelRequestCacheDerivedTokenScope 在上下文缺少令牌 ID 时派生作用域，未开启或无法派生时返回空（不缓存）
+func resolveModelRequestCacheDerivedTokenScope(c *gin.Context) string {
+	if !modelRequestCacheAuthScopeEnabled || modelRequestCacheTokenScopeResolver == nil {
+		return ""
+	}
+	scope := modelRequestCacheTokenScopeResolver(c)
+	if scope == "" {
+		return ""
+	}
+	return modelRequestCacheDerivedScopePrefix + scope
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRequestCacheDerivedTokenScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := modelRequestCacheAuthScopeEnabled
+	t.Cleanup(func() {
+		modelRequestCacheAuthScopeEnabled = original
+		SetModelRequestCacheTokenScopeResolver(nil)
+	})
+	newContext := func(authorization string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if authorization != "" {
+			c.Request.Header.Set("Authorization", authorization)
+		}
+		return c
+	}
+
+	modelRequestCacheAuthScopeEnabled = false
+	require.Empty(t, getModelRequestCacheTokenScope(newContext("Bearer sk-a")))
+
+	modelRequestCacheAuthScopeEnabled = true
+	scopeA := getModelRequestCacheTokenScope(newContext("Bearer sk-a"))
+	require.True(t, strings.HasPrefix(scopeA, modelRequestCacheDerivedScopePrefix))
+	require.NotContains(t, scopeA, "sk-a")
+	require.Equal(t, scopeA, getModelRequestCacheTokenScope(newContext("Bearer sk-a")))
+	require.NotEqual(t, scopeA, getModelRequestCacheTokenScope(newContext("Bearer sk-b")))
+	require.Empty(t, getModelRequestCacheTokenScope(newContext("")))
+
+	// 上下文中已有令牌 ID 时仍使用令牌 ID
+	c := newContext("Bearer sk-a")
+	common.SetContextKey(c, constant.ContextKeyTokenId, 42)
+	require.Equal(t, "42", getModelRequestCacheTokenScope(c))
+
+	// 自定义解析器返回纯数字时也会带前缀，不会与令牌 ID 作用域冲突
+	SetModelRequestCacheTokenScopeResolver(func(c *gin.Context) string { return "42" })
+	require.Equal(t, modelRequestCacheDerivedScopePrefix+"42", getModelRequestCacheTokenScope(newContext("")))
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	modelRequestWarmSnapshotRedisKey = "routing_warm_cache_snapshot"
+	// modelRequestWarmHitMaxKeys 限制统计的 (path, model) 组合数量，避免随意的模型名占用过多内存
+	modelRequestWarmHitMaxKeys = 4096
+	// modelRequestWarmSnapshotMaxModelLen 快照中模型名的最大长度，过长的名称不统计也不恢复
+	modelRequestWarmSnapshotMaxModelLen = 256
+)
+
+var (
+	modelRequestWarmSnapshotEnabled  = common.GetEnvOrDefaultBool("SNAPSHOT_ROUTING_WARM_CACHE", false)
+	modelRequestWarmSnapshotInterval = time.Duration(common.GetEnvOrDefault("SNAPSHOT_ROUTING_WARM_CACHE_INTERVAL_SECONDS", 300)) * time.Second
+	modelRequestWarmSnapshotTopN     = common.GetEnvOrDefault("SNAPSHOT_ROUTING_WARM_CACHE_TOP_N", 50)
+	modelRequestWarmSnapshotFile     = common.GetEnvOrDefaultString("SNAPSHOT_ROUTING_WARM_CACHE_FILE", "routing_warm_cache.json")
+	modelRequestWarmHits             = sync.Map{}
+	modelRequestWarmHitKeyCount      = atomic.Int64{}
+	modelRequestWarmSnapshotOnce     sync.Once
+)
+
+// modelRequestWarmSnapshotItem 快照只保存 (path, model)，不包含请求体
+type modelRequestWarmSnapshotItem struct {
+	Path  string `json:"path"`
+	Model string `json:"model"`
+}
+
+// StartModelRequestWarmCacheSnapshotTask 在 SNAPSHOT_ROUTING_WARM_CACHE 开启时从快照恢复路由预热缓存，
+// 并按间隔把命中最多的 top-N 个 (path, model) 写入快照。启用 Redis 时快照保存在 Redis，否则写入本地文件。
+func StartModelRequestWarmCacheSnapshotTask() {
+	modelRequestWarmSnapshotOnce.Do(func() {
+		if !modelRequestCacheEnabled || !modelRequestWarmSnapshotEnabled {
+			return
+		}
+		if modelRequestWarmSnapshotInterval <= 0 {
+			modelRequestWarmSnapshotInterval = 300 * time.Second
+		}
+		if modelRequestWarmSnapshotTopN <= 0 {
+			modelRequestWarmSnapshotTopN = 50
+		}
+		ctx := context.Background()
+		items, err := loadModelRequestWarmSnapshot()
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("routing warm cache snapshot load failed: %v", err))
+		} else if restored := restoreModelRequestWarmSnapshot(items); restored > 0 {
+			logger.LogInfo(ctx, fmt.Sprintf("routing warm cache restored %d entries from snapshot", restored))
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(modelRequestWarmSnapshotInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				items := collectModelRequestWarmSnapshot(modelRequestWarmSnapshotTopN)
+				if len(items) == 0 {
+					continue
+				}
+				if err := saveModelRequestWarmSnapshot(items); err != nil {
+					logger.LogWarn(ctx, fmt.Sprintf("routing warm cache snapshot save failed: %v", err))
+				}
+			}
+		})
+	})
+}
+
+// recordModelRequestWarmHit 统计可预热路径上各模型的请求次数，供定期快照选取热门模型
+func recordModelRequestWarmHit(c *gin.Context, modelName string) {
+	if !modelRequestWarmSnapshotEnabled || c == nil || c.Request == nil || c.Request.Method != http.MethodPost {
+		return
+	}
+	path := c.Request.URL.Path
+	modelName = normalizeModelNameForModelWarmCache(modelName)
+	if !isModelRequestModelWarmPath(path) || modelName == "" || len(modelName) > modelRequestWarmSnapshotMaxModelLen {
+		return
+	}
+	key := modelRequestWarmSnapshotItem{Path: path, Model: modelName}
+	if counter, ok := modelRequestWarmHits.Load(key); ok {
+		counter.(*atomic.Int64).Add(1)
+		return
+	}
+	if modelRequestWarmHitKeyCount.Load() >= modelRequestWarmHitMaxKeys {
+		return
+	}
+	counter, loaded := modelRequestWarmHits.LoadOrStore(key, &atomic.Int64{})
+	if !loaded {
+		modelRequestWarmHitKeyCount.Add(1)
+	}
+	counter.(*atomic.Int64).Add(1)
+}
+
+// collectModelRequestWarmSnapshot 取出本周期命中最多的 topN 个组合并清空计数
+func collectModelRequestWarmSnapshot(topN int) []modelRequestWarmSnapshotItem {
+	type hit struct {
+		item  modelRequestWarmSnapshotItem
+		count int64
+	}
+	hits := make([]hit, 0)
+	modelRequestWarmHits.Range(func(key, value any) bool {
+		modelRequestWarmHits.Delete(key)
+		hits = append(hits, hit{item: key.(modelRequestWarmSnapshotItem), count: value.(*atomic.Int64).Load()})
+		return true
+	})
+	modelRequestWarmHitKeyCount.Store(0)
+	slices.SortFunc(hits, func(a, b hit) int {
+		if c := cmp.Compare(b.count, a.count); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.item.Path, b.item.Path); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.item.Model, b.item.Model)
+	})
+	if len(hits) > topN {
+		hits = hits[:topN]
+	}
+	items := make([]modelRequestWarmSnapshotItem, 0, len(hits))
+	for _, h := range hits {
+		items = append(items, h.item)
+	}
+	return items
+}
+
+// restoreModelRequestWarmSnapshot 将快照中的组合写入预热缓存，跳过不可预热的路径与异常模型名
+func restoreModelRequestWarmSnapshot(items []modelRequestWarmSnapshotItem) int {
+	restored := 0
+	for _, item := range items {
+		modelName := normalizeModelNameForModelWarmCache(item.Model)
+		if !isModelRequestModelWarmPath(item.Path) || modelName == "" || len(modelName) > modelRequestWarmSnapshotMaxModelLen {
+			continue
+		}
+		warmModelRequestCacheForPath(item.Path, modelName)
+		restored++
+	}
+	return restored
+}
+
+func loadModelRequestWarmSnapshot() ([]modelRequestWarmSnapshotItem, error) {
+	var raw []byte
+	if common.RedisEnabled && common.RDB != nil {
+		value, err := common.RedisGet(modelRequestWarmSnapshotRedisKey)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		raw = []byte(value)
+	} else {
+		data, err := os.ReadFile(modelRequestWarmSnapshotFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		raw = data
+	}
+	var items []modelRequestWarmSnapshotItem
+	if err := common.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func saveModelRequestWarmSnapshot(items []modelRequestWarmSnapshotItem) error {
+	data, err := common.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled && common.RDB != nil {
+		return common.RedisSet(modelRequestWarmSnapshotRedisKey, string(data), 0)
+	}
+	tmpFile := modelRequestWarmSnapshotFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, modelRequestWarmSnapshotFile)
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRequestWarmSnapshotRoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalEnabled, originalFile := modelRequestWarmSnapshotEnabled, modelRequestWarmSnapshotFile
+	modelRequestWarmSnapshotEnabled = true
+	modelRequestWarmSnapshotFile = filepath.Join(t.TempDir(), "routing_warm_cache.json")
+	t.Cleanup(func() {
+		modelRequestWarmSnapshotEnabled, modelRequestWarmSnapshotFile = originalEnabled, originalFile
+		collectModelRequestWarmSnapshot(0)
+	})
+
+	hit := func(method string, path string, modelName string, times int) {
+		for i := 0; i < times; i++ {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(method, path, nil)
+			recordModelRequestWarmHit(c, modelName)
+		}
+	}
+	hit(http.MethodPost, "/v1/chat/completions", "snapshot-hot", 3)
+	hit(http.MethodPost, "/v1/responses/compact", "snapshot-warm-compact", 2)
+	hit(http.MethodPost, "/v1/chat/completions", "snapshot-cold", 1)
+	hit(http.MethodPost, "/v1/images/generations", "snapshot-ignored-path", 5)
+	hit(http.MethodGet, "/v1/chat/completions", "snapshot-ignored-method", 5)
+
+	items := collectModelRequestWarmSnapshot(2)
+	require.Equal(t, []modelRequestWarmSnapshotItem{
+		{Path: "/v1/chat/completions", Model: "snapshot-hot"},
+		{Path: "/v1/responses/compact", Model: "snapshot-warm-compact"},
+	}, items)
+	require.Empty(t, collectModelRequestWarmSnapshot(2))
+
+	require.NoError(t, saveModelRequestWarmSnapshot(items))
+	loaded, err := loadModelRequestWarmSnapshot()
+	require.NoError(t, err)
+	require.Equal(t, items, loaded)
+
+	loaded = append(loaded, modelRequestWarmSnapshotItem{Path: "/v1/images/generations", Model: "snapshot-bad"})
+	require.Equal(t, 2, restoreModelRequestWarmSnapshot(loaded))
+
+	entry, ok := getModelRequestCache(buildModelRequestWarmCacheKeyForModel(http.MethodPost, "/v1/responses/compact", "", "snapshot-warm-compact"))
+	require.True(t, ok)
+	require.True(t, entry.ShouldSelectChannel)
+	require.NotEqual(t, "snapshot-warm-compact", entry.ModelRequest.Model)
+}
@@ -20,7 +20,7 @@ const (
 func redisEmailVerificationRateLimiter(c *gin.Context) {
 	ctx := context.Background()
 	rdb := common.RDB
-	key := "emailVerification:" + EmailVerificationRateLimitMark + ":" + c.ClientIP()
+	key := "emailVerification:" + EmailVerificationRateLimitMark + ":" + common.ResolveClientIP(c)
 
 	count, err := rdb.Incr(ctx, key).Result()
 	if err != nil {
@@ -55,7 +55,7 @@ func redisEmailVerificationRateLimiter(c *gin.Context) {
 }
 
 func memoryEmailVerificationRateLimiter(c *gin.Context) {
-	key := EmailVerificationRateLimitMark + ":" + c.ClientIP()
+	key := EmailVerificationRateLimitMark + ":" + common.ResolveClientIP(c)
 
 	if !inMemoryRateLimiter.Request(key, EmailVerificationMaxRequests, EmailVerificationDuration) {
 		c.JSON(http.StatusTooManyRequests, gin.H{
@@ -71,6 +71,10 @@ func memoryEmailVerificationRateLimiter(c *gin.Context) {
 
 func EmailVerificationRateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if rateLimitBypassed() {
+			c.Next()
+			return
+		}
 		if common.RedisEnabled {
 			redisEmailVerificationRateLimiter(c)
 		} else {
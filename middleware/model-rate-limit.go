@@ -11,6 +11,7 @@ import (
 	"github.com/QuantumNous/new-api/common/limiter"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -25,26 +26,24 @@ func newModelRateLimitRedisContext() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), common.RateLimitRedisOpTimeout)
 }
 
-func checkAndRecordSuccessRequest(rdb *redis.Client, key string, maxCount int, durationSeconds int64, durationMinutes int, entry string) (bool, error) {
+func checkAndRecordSuccessRequest(rdb *redis.Client, key string, maxCount int, durationSeconds int64, entry string) (bool, error) {
 	if maxCount == 0 {
 		return true, nil
 	}
 	ctx, cancel := newModelRateLimitRedisContext()
 	defer cancel()
 	lim := limiter.New(ctx, rdb)
-	expireSeconds := int64(time.Duration(durationMinutes) * time.Minute / time.Second)
-	return lim.SlidingWindowWithEntry(ctx, key, maxCount, durationSeconds, expireSeconds, limiter.SlidingWindowModeCheckAndRecord, entry)
+	return lim.SlidingWindowWithEntry(ctx, key, maxCount, durationSeconds, durationSeconds, limiter.SlidingWindowModeCheckAndRecord, entry)
 }
 
-func rollbackSuccessRequest(rdb *redis.Client, key string, durationMinutes int, entry string) error {
+func rollbackSuccessRequest(rdb *redis.Client, key string, durationSeconds int64, entry string) error {
 	if entry == "" {
 		return nil
 	}
 	ctx, cancel := newModelRateLimitRedisContext()
 	defer cancel()
 	lim := limiter.New(ctx, rdb)
-	expireSeconds := int64(time.Duration(durationMinutes) * time.Minute / time.Second)
-	_, err := lim.SlidingWindowWithEntry(ctx, key, 1, 1, expireSeconds, limiter.SlidingWindowModeRollback, entry)
+	_, err := lim.SlidingWindowWithEntry(ctx, key, 1, 1, durationSeconds, limiter.SlidingWindowModeRollback, entry)
 	if err != nil {
 		return err
 	}
@@ -52,11 +51,12 @@ func rollbackSuccessRequest(rdb *redis.Client, key string, durationMinutes int,
 	return nil
 }
 
-func rollbackSuccessRequestWithRetry(rdb *redis.Client, key string, durationMinutes int, entry string) {
-	if err := rollbackSuccessRequest(rdb, key, durationMinutes, entry); err != nil {
+func rollbackSuccessRequestWithRetry(rdb *redis.Client, key string, durationSeconds int64, entry string) {
+	if err := rollbackSuccessRequest(rdb, key, durationSeconds, entry); err != nil {
 		common.SysLog(fmt.Sprintf("rollback success request failed (first attempt), key=%s, entry=%s, err=%v", key, entry, err))
-		if retryErr := rollbackSuccessRequest(rdb, key, durationMinutes, entry); retryErr != nil {
+		if retryErr := rollbackSuccessRequest(rdb, key, durationSeconds, entry); retryErr != nil {
 			common.SysLog(fmt.Sprintf("rollback success request failed (retry), key=%s, entry=%s, err=%v", key, entry, retryErr))
+			recordRateLimitRollbackFailure(rdb, key, durationSeconds, entry)
 		}
 	}
 }
@@ -64,13 +64,32 @@ func rollbackSuccessRequestWithRetry(rdb *redis.Client, key string, durationMinu
 type modelRateLimitPolicy struct {
 	Identifier      string
 	DurationMinutes int
+	// DurationSeconds 大于 0 时优先于 DurationMinutes，用于表达“10 秒内最多 20 次”这类更细的窗口
+	DurationSeconds int
 	TotalMaxCount   int
 	SuccessMaxCount int
 }
 
+// windowSeconds 返回策略的窗口秒数，不大于 0 表示未配置窗口
+func (p modelRateLimitPolicy) windowSeconds() int64 {
+	if p.DurationSeconds > 0 {
+		return int64(p.DurationSeconds)
+	}
+	return int64(p.DurationMinutes) * 60
+}
+
+// windowText 返回用于提示信息的窗口描述，整分钟时按分钟显示
+func (p modelRateLimitPolicy) windowText() string {
+	seconds := p.windowSeconds()
+	if seconds%60 == 0 {
+		return fmt.Sprintf("%d分钟", seconds/60)
+	}
+	return fmt.Sprintf("%d秒", seconds)
+}
+
 type redisSuccessRecord struct {
 	successKey      string
-	durationMinutes int
+	durationSeconds int64
 	entrySuffix     string
 }
 
@@ -80,29 +99,42 @@ type memorySuccessRecord struct {
 	duration   int64
 }
 
+func modelRateLimitKey(mark string, identifier string) string {
+	shard := common.RateLimitKeyShard(identifier)
+	return fmt.Sprintf("rateLimit:model:%s:id:%s:%s", mark, identifier, shard)
+}
+
+// ModelRateLimitRedisKeys 返回模型请求限流在 Redis 中使用的全部键（总请求数与成功请求数），
+// identifier 与限流策略一致：令牌 ID、用户 ID，或 ip:u:<用户ID>:<IP> / ip:t:<令牌ID>:<IP> 等形式
+func ModelRateLimitRedisKeys(identifier string) []string {
+	return []string{
+		modelRateLimitKey(ModelRequestRateLimitCountMark, identifier),
+		modelRateLimitKey(ModelRequestRateLimitSuccessCountMark, identifier),
+	}
+}
+
 func checkSingleRedisRateLimit(rdb *redis.Client, policy modelRateLimitPolicy) (bool, string, *redisSuccessRecord, error) {
-	duration := int64(policy.DurationMinutes * 60)
+	duration := policy.windowSeconds()
 	if duration <= 0 {
 		return true, "", nil, nil
 	}
 
-	shard := common.HashShard(policy.Identifier, common.RateLimitKeyShardCount)
-	successKey := fmt.Sprintf("rateLimit:model:%s:id:%s:%s", ModelRequestRateLimitSuccessCountMark, policy.Identifier, shard)
+	successKey := modelRateLimitKey(ModelRequestRateLimitSuccessCountMark, policy.Identifier)
 	requestEntrySuffix := ""
 
 	if policy.SuccessMaxCount > 0 {
 		requestEntrySuffix = common.GetUUID()
-		allowed, err := checkAndRecordSuccessRequest(rdb, successKey, policy.SuccessMaxCount, duration, policy.DurationMinutes, requestEntrySuffix)
+		allowed, err := checkAndRecordSuccessRequest(rdb, successKey, policy.SuccessMaxCount, duration, requestEntrySuffix)
 		if err != nil {
 			return false, "", nil, err
 		}
 		if !allowed {
-			return false, fmt.Sprintf("您已达到请求数限制：%d分钟内最多请求%d次", policy.DurationMinutes, policy.SuccessMaxCount), nil, nil
+			return false, fmt.Sprintf("您已达到请求数限制：%s内最多请求%d次", policy.windowText(), policy.SuccessMaxCount), nil, nil
 		}
 	}
 
 	if policy.TotalMaxCount > 0 {
-		totalKey := fmt.Sprintf("rateLimit:model:%s:id:%s:%s", ModelRequestRateLimitCountMark, policy.Identifier, shard)
+		totalKey := modelRateLimitKey(ModelRequestRateLimitCountMark, policy.Identifier)
 		ctx, cancel := newModelRateLimitRedisContext()
 		tb := limiter.New(ctx, rdb)
 		allowed, err := tb.Allow(
@@ -116,22 +148,22 @@ func checkSingleRedisRateLimit(rdb *redis.Client, policy modelRateLimitPolicy) (
 		cancel()
 		if err != nil {
 			if requestEntrySuffix != "" {
-				rollbackSuccessRequestWithRetry(rdb, successKey, policy.DurationMinutes, requestEntrySuffix)
+				rollbackSuccessRequestWithRetry(rdb, successKey, duration, requestEntrySuffix)
 			}
 			return false, "", nil, err
 		}
 		if !allowed {
 			if requestEntrySuffix != "" {
-				rollbackSuccessRequestWithRetry(rdb, successKey, policy.DurationMinutes, requestEntrySuffix)
+				rollbackSuccessRequestWithRetry(rdb, successKey, duration, requestEntrySuffix)
 			}
-			return false, fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", policy.DurationMinutes, policy.TotalMaxCount), nil, nil
+			return false, fmt.Sprintf("您已达到总请求数限制：%s内最多请求%d次，包括失败次数，请检查您的请求是否正确", policy.windowText(), policy.TotalMaxCount), nil, nil
 		}
 	}
 
 	if requestEntrySuffix != "" {
 		return true, "", &redisSuccessRecord{
 			successKey:      successKey,
-			durationMinutes: policy.DurationMinutes,
+			durationSeconds: duration,
 			entrySuffix:     requestEntrySuffix,
 		}, nil
 	}
@@ -145,7 +177,7 @@ func enforceRedisModelRateLimit(c *gin.Context, policies []modelRateLimitPolicy)
 	rollbackAll := func() {
 		for i := range records {
 			record := records[i]
-			rollbackSuccessRequestWithRetry(rdb, record.successKey, record.durationMinutes, record.entrySuffix)
+			rollbackSuccessRequestWithRetry(rdb, record.successKey, record.durationSeconds, record.entrySuffix)
 		}
 	}
 
@@ -153,13 +185,23 @@ func enforceRedisModelRateLimit(c *gin.Context, policies []modelRateLimitPolicy)
 		allowed, msg, record, err := checkSingleRedisRateLimit(rdb, policies[i])
 		if err != nil {
 			rollbackAll()
+			if common.RateLimitFailOpen {
+				// fail-open：Redis 故障时优先保证可用性，按配置退回进程内限流或直接放行
+				common.SysError("model rate limit redis check failed, failing open: " + err.Error())
+				if common.RateLimitFailOpenMemoryFallback {
+					enforceMemoryModelRateLimit(c, policies)
+				} else {
+					c.Next()
+				}
+				return
+			}
 			fmt.Println("检查请求数限制失败:", err.Error())
-			abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed", types.ErrorCodeRateLimitInternalError)
 			return
 		}
 		if !allowed {
 			rollbackAll()
-			abortWithOpenAiMessage(c, http.StatusTooManyRequests, msg)
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, msg, types.ErrorCodeRateLimitExceeded)
 			return
 		}
 		if record != nil {
@@ -175,26 +217,25 @@ func enforceRedisModelRateLimit(c *gin.Context, policies []modelRateLimitPolicy)
 }
 
 func enforceMemoryModelRateLimit(c *gin.Context, policies []modelRateLimitPolicy) {
-	maxDurationMinutes := 1
+	maxDurationSeconds := int64(60)
 	for i := range policies {
-		if policies[i].DurationMinutes > maxDurationMinutes {
-			maxDurationMinutes = policies[i].DurationMinutes
+		if seconds := policies[i].windowSeconds(); seconds > maxDurationSeconds {
+			maxDurationSeconds = seconds
 		}
 	}
-	inMemoryRateLimiter.Init(time.Duration(maxDurationMinutes) * time.Minute)
+	inMemoryRateLimiter.Init(time.Duration(maxDurationSeconds) * time.Second)
 
 	successRecords := make([]memorySuccessRecord, 0)
 	for i := range policies {
 		policy := policies[i]
-		duration := int64(policy.DurationMinutes * 60)
+		duration := policy.windowSeconds()
 		if duration <= 0 {
 			continue
 		}
 		totalKey := ModelRequestRateLimitCountMark + policy.Identifier
 		successKey := ModelRequestRateLimitSuccessCountMark + policy.Identifier
 		if !inMemoryRateLimiter.AllowWithCheck(totalKey, policy.TotalMaxCount, successKey, policy.SuccessMaxCount, duration) {
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到请求数限制：%s内请求次数超出限制", policy.windowText()), types.ErrorCodeRateLimitExceeded)
 			return
 		}
 		if policy.SuccessMaxCount > 0 {
@@ -217,7 +258,7 @@ func enforceMemoryModelRateLimit(c *gin.Context, policies []modelRateLimitPolicy
 }
 
 func appendPolicyIfHasLimit(policies []modelRateLimitPolicy, policy modelRateLimitPolicy) []modelRateLimitPolicy {
-	if policy.DurationMinutes <= 0 {
+	if policy.windowSeconds() <= 0 {
 		return policies
 	}
 	if policy.TotalMaxCount <= 0 && policy.SuccessMaxCount <= 0 {
@@ -229,6 +270,10 @@ func appendPolicyIfHasLimit(policies []modelRateLimitPolicy, policy modelRateLim
 // ModelRequestRateLimit 模型请求限流中间件
 func ModelRequestRateLimit() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		if rateLimitBypassed() {
+			c.Next()
+			return
+		}
 		// 在每个请求时检查是否启用限流
 		systemEnabled := setting.ModelRequestRateLimitEnabled
 		tokenRateLimitEnabled := common.GetContextKeyBool(c, constant.ContextKeyTokenRateLimitEnabled)
@@ -237,6 +282,15 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 			c.Next()
 			return
 		}
+		// 豁免名单中的令牌/用户不构建任何策略（包括 IP 限流）
+		exemptUserId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+		if exemptUserId == 0 {
+			exemptUserId = c.GetInt("id")
+		}
+		if setting.IsRateLimitExempt(common.GetContextKeyInt(c, constant.ContextKeyTokenId), exemptUserId) {
+			c.Next()
+			return
+		}
 
 		// 获取用户分组与令牌分组（用于分组配置以及 IP-Group 限制）
 		tokenGroup := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
@@ -252,10 +306,12 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 		// 1) 现有模型请求限流（系统 + 令牌：取更严格限制）
 		// ------------------------------
 		systemDurationMinutes := 0
+		systemDurationSeconds := 0
 		systemTotalMaxCount := 0
 		systemSuccessMaxCount := 0
 		if systemEnabled {
 			systemDurationMinutes = setting.ModelRequestRateLimitDurationMinutes
+			systemDurationSeconds = setting.ModelRequestRateLimitDurationSeconds
 			systemTotalMaxCount = setting.ModelRequestRateLimitCount
 			systemSuccessMaxCount = setting.ModelRequestRateLimitSuccessCount
 			// 分组覆盖：优先新语法（用户分组->令牌分组），其次兼容旧语法（分组名）
@@ -273,15 +329,15 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 		tokenTotalMaxCount := common.GetContextKeyInt(c, constant.ContextKeyTokenRateLimitCount)
 		tokenSuccessMaxCount := common.GetContextKeyInt(c, constant.ContextKeyTokenRateLimitSuccessCount)
 
-		durationMinutes := systemDurationMinutes
+		durationSeconds := int(modelRateLimitPolicy{DurationMinutes: systemDurationMinutes, DurationSeconds: systemDurationSeconds}.windowSeconds())
 		totalMaxCount := systemTotalMaxCount
 		successMaxCount := systemSuccessMaxCount
 		hasBaseLimit := totalMaxCount > 0 || successMaxCount > 0
 
 		if tokenRateLimitEnabled {
 			// 时长取较小值（更严格），允许 tokenDurationMinutes 为 0 时仅采用系统配置
-			if tokenDurationMinutes > 0 && (durationMinutes == 0 || tokenDurationMinutes < durationMinutes) {
-				durationMinutes = tokenDurationMinutes
+			if tokenDurationSeconds := tokenDurationMinutes * 60; tokenDurationSeconds > 0 && (durationSeconds == 0 || tokenDurationSeconds < durationSeconds) {
+				durationSeconds = tokenDurationSeconds
 			}
 			// 计数取较小的正数（更严格），0 表示不限制
 			if tokenTotalMaxCount > 0 && (totalMaxCount == 0 || tokenTotalMaxCount < totalMaxCount) {
@@ -305,7 +361,7 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 		if hasBaseLimit {
 			policies = appendPolicyIfHasLimit(policies, modelRateLimitPolicy{
 				Identifier:      baseIdentifier,
-				DurationMinutes: durationMinutes,
+				DurationSeconds: durationSeconds,
 				TotalMaxCount:   totalMaxCount,
 				SuccessMaxCount: successMaxCount,
 			})
@@ -317,10 +373,11 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 		if ipEnabled {
 			clientIp := common.GetContextKeyString(c, constant.ContextKeyClientIP)
 			if clientIp == "" {
-				clientIp = c.ClientIP()
+				clientIp = common.ResolveClientIP(c)
 			}
 
 			ipDurationMinutes := setting.ModelRequestIPRateLimitDurationMinutes
+			ipDurationSeconds := setting.ModelRequestIPRateLimitDurationSeconds
 
 			// user + ip
 			userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
@@ -331,6 +388,7 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 				policies = appendPolicyIfHasLimit(policies, modelRateLimitPolicy{
 					Identifier:      fmt.Sprintf("ip:u:%d:%s", userId, clientIp),
 					DurationMinutes: ipDurationMinutes,
+					DurationSeconds: ipDurationSeconds,
 					TotalMaxCount:   setting.ModelRequestIPRateLimitUserCount,
 					SuccessMaxCount: setting.ModelRequestIPRateLimitUserSuccessCount,
 				})
@@ -358,6 +416,7 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 					policies = appendPolicyIfHasLimit(policies, modelRateLimitPolicy{
 						Identifier:      identifier,
 						DurationMinutes: ipDurationMinutes,
+						DurationSeconds: ipDurationSeconds,
 						TotalMaxCount:   groupTotalCount,
 						SuccessMaxCount: groupSuccessCount,
 					})
@@ -372,6 +431,7 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 				policies = appendPolicyIfHasLimit(policies, modelRateLimitPolicy{
 					Identifier:      fmt.Sprintf("ip:t:%d:%s", tokenId, clientIp),
 					DurationMinutes: ipDurationMinutes,
+					DurationSeconds: ipDurationSeconds,
 					TotalMaxCount:   tokenIPTotalMaxCount,
 					SuccessMaxCount: tokenIPSuccessMaxCount,
 				})
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	rateLimitRollbackQueueSize     = 1024
+	rateLimitRollbackRetryInterval = 10 * time.Second
+	rateLimitRollbackMaxAttempts   = 5
+)
+
+// pendingRateLimitRollback 为同步回滚失败后等待后台重试的成功计数条目
+type pendingRateLimitRollback struct {
+	rdb             *redis.Client
+	key             string
+	durationSeconds int64
+	entry           string
+	failedAt        time.Time
+	attempts        int
+}
+
+var (
+	rateLimitRollbackFailures   atomic.Int64
+	rateLimitRollbackQueue      = make(chan pendingRateLimitRollback, rateLimitRollbackQueueSize)
+	rateLimitRollbackWorkerOnce sync.Once
+)
+
+// RateLimitRollbackFailureCount 返回成功计数回滚失败（同步重试后仍失败）的累计次数，
+// 持续增长说明成功计数可能偏高，用户会被错误限流，可据此告警
+func RateLimitRollbackFailureCount() int64 {
+	return rateLimitRollbackFailures.Load()
+}
+
+// RateLimitRollbackPendingCount 返回等待后台重试的回滚条目数
+func RateLimitRollbackPendingCount() int {
+	return len(rateLimitRollbackQueue)
+}
+
+func recordRateLimitRollbackFailure(rdb *redis.Client, key string, durationSeconds int64, entry string) {
+	rateLimitRollbackFailures.Add(1)
+	enqueueRateLimitRollback(pendingRateLimitRollback{
+		rdb:             rdb,
+		key:             key,
+		durationSeconds: durationSeconds,
+		entry:           entry,
+		failedAt:        time.Now(),
+	})
+}
+
+func enqueueRateLimitRollback(item pendingRateLimitRollback) {
+	rateLimitRollbackWorkerOnce.Do(func() {
+		go runRateLimitRollbackWorker()
+	})
+	select {
+	case rateLimitRollbackQueue <- item:
+	default:
+		common.SysLog(fmt.Sprintf("rollback retry queue full, dropping key=%s, entry=%s", item.key, item.entry))
+	}
+}
+
+func runRateLimitRollbackWorker() {
+	ticker := time.NewTicker(rateLimitRollbackRetryInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		drainRateLimitRollbackQueue(time.Now())
+	}
+}
+
+// drainRateLimitRollbackQueue 重试当前队列中的全部条目：已滑出限流窗口的条目不再影响计数，直接丢弃；
+// 仍失败且未超过重试次数的条目重新入队，留待下一轮
+func drainRateLimitRollbackQueue(now time.Time) (succeeded int) {
+	pending := len(rateLimitRollbackQueue)
+	for i := 0; i < pending; i++ {
+		var item pendingRateLimitRollback
+		select {
+		case item = <-rateLimitRollbackQueue:
+		default:
+			return succeeded
+		}
+		if now.Sub(item.failedAt) >= time.Duration(item.durationSeconds)*time.Second {
+			continue
+		}
+		err := rollbackSuccessRequest(item.rdb, item.key, item.durationSeconds, item.entry)
+		if err == nil {
+			succeeded++
+			continue
+		}
+		item.attempts++
+		if item.attempts >= rateLimitRollbackMaxAttempts {
+			common.SysLog(fmt.Sprintf("rollback success request gave up after background retries, key=%s, entry=%s, err=%v", item.key, item.entry, err))
+			continue
+		}
+		enqueueRateLimitRollback(item)
+	}
+	return succeeded
+}
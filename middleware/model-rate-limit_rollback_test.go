@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitRollbackFailureIsCountedAndRetried(t *testing.T) {
+	// 指向无人监听的端口，使回滚必然失败
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { _ = rdb.Close() })
+	for len(rateLimitRollbackQueue) > 0 {
+		<-rateLimitRollbackQueue
+	}
+
+	before := RateLimitRollbackFailureCount()
+	rollbackSuccessRequestWithRetry(rdb, "rateLimit:model:MRRLS:id:1:0", 60, "entry-1")
+	require.Equal(t, before+1, RateLimitRollbackFailureCount())
+	require.Equal(t, 1, RateLimitRollbackPendingCount())
+
+	// 仍在窗口内：重试失败后重新入队
+	require.Zero(t, drainRateLimitRollbackQueue(time.Now()))
+	require.Equal(t, 1, RateLimitRollbackPendingCount())
+
+	// 条目已滑出窗口：不再需要回滚，直接丢弃
+	require.Zero(t, drainRateLimitRollbackQueue(time.Now().Add(2*time.Minute)))
+	require.Zero(t, RateLimitRollbackPendingCount())
+}
+
+func TestEnforceRedisModelRateLimitFailOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	originalRDB, originalFailOpen, originalFallback := common.RDB, common.RateLimitFailOpen, common.RateLimitFailOpenMemoryFallback
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		common.RDB, common.RateLimitFailOpen, common.RateLimitFailOpenMemoryFallback = originalRDB, originalFailOpen, originalFallback
+	})
+	common.RDB = rdb
+
+	newRequest := func(identifier string) func() int {
+		policies := []modelRateLimitPolicy{{Identifier: identifier, DurationSeconds: 60, TotalMaxCount: 1}}
+		router := gin.New()
+		router.GET("/", func(c *gin.Context) {
+			enforceRedisModelRateLimit(c, policies)
+		}, func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return func() int {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			return recorder.Code
+		}
+	}
+
+	common.RateLimitFailOpen = false
+	require.Equal(t, http.StatusInternalServerError, newRequest("fail-closed-test")())
+
+	// 放行且不退回进程内限流：不受限
+	common.RateLimitFailOpen = true
+	common.RateLimitFailOpenMemoryFallback = false
+	request := newRequest("fail-open-test")
+	require.Equal(t, http.StatusOK, request())
+	require.Equal(t, http.StatusOK, request())
+
+	// 退回进程内限流：超出上限后返回 429
+	common.RateLimitFailOpenMemoryFallback = true
+	request = newRequest("fail-open-memory-test")
+	require.Equal(t, http.StatusOK, request())
+	require.Equal(t, http.StatusTooManyRequests, request())
+}
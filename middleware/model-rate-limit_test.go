@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRateLimitPolicyWindow(t *testing.T) {
+	require.Equal(t, int64(120), modelRateLimitPolicy{DurationMinutes: 2}.windowSeconds())
+	require.Equal(t, int64(10), modelRateLimitPolicy{DurationMinutes: 2, DurationSeconds: 10}.windowSeconds())
+	require.Equal(t, "10秒", modelRateLimitPolicy{DurationSeconds: 10}.windowText())
+	require.Equal(t, "2分钟", modelRateLimitPolicy{DurationSeconds: 120}.windowText())
+
+	require.Empty(t, appendPolicyIfHasLimit(nil, modelRateLimitPolicy{TotalMaxCount: 1}))
+	require.Len(t, appendPolicyIfHasLimit(nil, modelRateLimitPolicy{DurationSeconds: 10, TotalMaxCount: 1}), 1)
+}
+
+func TestEnforceMemoryModelRateLimitWithSecondsWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policies := []modelRateLimitPolicy{{Identifier: "seconds-window-test", DurationSeconds: 10, TotalMaxCount: 2}}
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		enforceMemoryModelRateLimit(c, policies)
+	}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder
+	}
+
+	require.Equal(t, http.StatusOK, request().Code)
+	require.Equal(t, http.StatusOK, request().Code)
+	limited := request()
+	require.Equal(t, http.StatusTooManyRequests, limited.Code)
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, common.Unmarshal(limited.Body.Bytes(), &body))
+	require.Equal(t, string(types.ErrorCodeRateLimitExceeded), body.Error.Code)
+}
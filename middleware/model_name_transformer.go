@@ -0,0 +1,35 @@
+package middleware
+
+import "sync"
+
+// ModelNameTransformer 在分发阶段改写请求的模型名，path 为请求路径，返回改写后的模型名。
+// 可用于去除厂商前缀（openai/gpt-4o → gpt-4o）或全局替换已弃用的模型名。
+type ModelNameTransformer func(path, model string) string
+
+var (
+	modelNameTransformers   []ModelNameTransformer
+	modelNameTransformersMu sync.RWMutex
+)
+
+// RegisterModelNameTransformer 追加一个模型名改写器，按注册顺序依次执行，应在初始化阶段调用。
+// 改写结果会写入模型请求缓存并用于渠道选择。
+func RegisterModelNameTransformer(transformer ModelNameTransformer) {
+	if transformer == nil {
+		return
+	}
+	modelNameTransformersMu.Lock()
+	defer modelNameTransformersMu.Unlock()
+	modelNameTransformers = append(modelNameTransformers, transformer)
+}
+
+func applyModelNameTransformers(path string, model string) string {
+	if model == "" {
+		return model
+	}
+	modelNameTransformersMu.RLock()
+	defer modelNameTransformersMu.RUnlock()
+	for _, transformer := range modelNameTransformers {
+		model = transformer(path, model)
+	}
+	return model
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetModelRequest_AppliesModelNameTransformersInOrder(t *testing.T) {
+	old := modelNameTransformers
+	t.Cleanup(func() { modelNameTransformers = old })
+	modelNameTransformers = nil
+
+	RegisterModelNameTransformer(func(path, model string) string {
+		return strings.TrimPrefix(model, "openai/")
+	})
+	RegisterModelNameTransformer(func(path, model string) string {
+		if model == "gpt-4-legacy" {
+			return "gpt-4o"
+		}
+		return model
+	})
+
+	for body, want := range map[string]string{
+		`{"model":"openai/gpt-4o-mini"}`:  "gpt-4o-mini",
+		`{"model":"openai/gpt-4-legacy"}`: "gpt-4o",
+		`{"model":"claude-3-5-sonnet"}`:   "claude-3-5-sonnet",
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		modelRequest, shouldSelectChannel, err := getModelRequest(c)
+		require.NoError(t, err)
+		require.True(t, shouldSelectChannel)
+		require.Equal(t, want, modelRequest.Model)
+	}
+}
+
+func TestGetModelRequest_AppliesModelNameTransformersOnWarmCacheHit(t *testing.T) {
+	old := modelNameTransformers
+	t.Cleanup(func() { modelNameTransformers = old })
+	modelNameTransformers = nil
+
+	// 预热条目先于改写器注册写入
+	warmModelRequestCacheForPath("/v1/chat/completions", normalizeModelNameForModelWarmCache("openai/warm-transform-model"))
+	RegisterModelNameTransformer(func(path, model string) string {
+		return strings.TrimPrefix(model, "openai/")
+	})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"openai/warm-transform-model"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyTokenId, 9501)
+
+	modelRequest, shouldSelectChannel, err := getModelRequest(c)
+	require.NoError(t, err)
+	require.True(t, shouldSelectChannel)
+	require.Equal(t, "warm-transform-model", modelRequest.Model)
+}
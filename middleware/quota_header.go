@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	quotaRemainingHeader = "X-Quota-Remaining"
+	quotaWarningHeader   = "X-Quota-Warning"
+)
+
+// quotaHeaderLookup 读取用户缓存额度，测试中可替换
+var quotaHeaderLookup = model.GetUserQuotaFromCache
+
+// quotaHeaderWriter 在响应头真正写出前（非流式的首次写入、流式的首个事件）补充用户剩余额度头，
+// 额度取自用户缓存，流式响应中体现的是本次请求扣费前的值
+type quotaHeaderWriter struct {
+	gin.ResponseWriter
+	c    *gin.Context
+	once sync.Once
+}
+
+func (w *quotaHeaderWriter) setQuotaHeaders() {
+	w.once.Do(func() {
+		if w.ResponseWriter.Written() {
+			return
+		}
+		setQuotaHeaders(w.c, w.ResponseWriter)
+	})
+}
+
+func (w *quotaHeaderWriter) WriteHeaderNow() {
+	w.setQuotaHeaders()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *quotaHeaderWriter) Write(data []byte) (int, error) {
+	w.setQuotaHeaders()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *quotaHeaderWriter) WriteString(s string) (int, error) {
+	w.setQuotaHeaders()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *quotaHeaderWriter) Flush() {
+	w.setQuotaHeaders()
+	w.ResponseWriter.Flush()
+}
+
+func setQuotaHeaders(c *gin.Context, writer gin.ResponseWriter) {
+	userId := c.GetInt("id")
+	if userId == 0 {
+		return
+	}
+	quota, err := quotaHeaderLookup(userId)
+	if err != nil {
+		return
+	}
+	writer.Header().Set(quotaRemainingHeader, strconv.Itoa(quota))
+	threshold := operation_setting.GetQuotaSetting().QuotaHeaderLowThreshold
+	if threshold <= 0 {
+		threshold = common.QuotaRemindThreshold
+	}
+	if quota < threshold {
+		writer.Header().Set(quotaWarningHeader, "low")
+	}
+}
+
+// wrapQuotaHeaderWriter 开启 QuotaHeaderEnabled 时替换响应写入器，以便在响应头写出前附加额度头
+func wrapQuotaHeaderWriter(c *gin.Context) {
+	if !operation_setting.GetQuotaSetting().QuotaHeaderEnabled {
+		return
+	}
+	c.Writer = &quotaHeaderWriter{ResponseWriter: c.Writer, c: c}
+}
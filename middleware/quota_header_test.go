@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaHeaderWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setting := operation_setting.GetQuotaSetting()
+	originalEnabled, originalThreshold, originalLookup := setting.QuotaHeaderEnabled, setting.QuotaHeaderLowThreshold, quotaHeaderLookup
+	t.Cleanup(func() {
+		setting.QuotaHeaderEnabled, setting.QuotaHeaderLowThreshold, quotaHeaderLookup = originalEnabled, originalThreshold, originalLookup
+	})
+	quotas := map[int]int{1: 50, 2: 5000}
+	quotaHeaderLookup = func(userId int) (int, error) { return quotas[userId], nil }
+	setting.QuotaHeaderLowThreshold = 100
+
+	serve := func(userId int, stream bool) http.Header {
+		router := gin.New()
+		router.POST("/", func(c *gin.Context) {
+			c.Set("id", userId)
+			wrapQuotaHeaderWriter(c)
+			c.Next()
+		}, func(c *gin.Context) {
+			if stream {
+				c.Header("Content-Type", "text/event-stream")
+				_, _ = c.Writer.WriteString("data: {}\n\n")
+				c.Writer.Flush()
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+		return recorder.Header()
+	}
+
+	setting.QuotaHeaderEnabled = false
+	require.Empty(t, serve(1, false).Get(quotaRemainingHeader))
+
+	setting.QuotaHeaderEnabled = true
+	header := serve(1, false)
+	require.Equal(t, "50", header.Get(quotaRemainingHeader))
+	require.Equal(t, "low", header.Get(quotaWarningHeader))
+
+	header = serve(2, true)
+	require.Equal(t, "5000", header.Get(quotaRemainingHeader))
+	require.Empty(t, header.Get(quotaWarningHeader))
+}
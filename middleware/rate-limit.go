@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/common/limiter"
@@ -21,11 +24,16 @@ func newRateLimitRedisContext() (context.Context, context.CancelFunc) {
 }
 
 func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
+	if rateLimitBypassed() {
+		c.Next()
+		return
+	}
 	ctx, cancel := newRateLimitRedisContext()
 	defer cancel()
 	rdb := common.RDB
-	shard := common.HashShard(c.ClientIP(), common.RateLimitKeyShardCount)
-	key := fmt.Sprintf("rateLimit:global:%s:ip:%s:%s", mark, c.ClientIP(), shard)
+	clientKey := rateLimitClientKey(c)
+	shard := common.RateLimitKeyShard(clientKey)
+	key := fmt.Sprintf("rateLimit:global:%s:ip:%s:%s", mark, clientKey, shard)
 	lim := limiter.New(ctx, rdb)
 	expireSeconds := int64(common.RateLimitKeyExpirationDuration.Seconds())
 	allowed, err := lim.SlidingWindow(ctx, key, maxRequestNum, duration, expireSeconds, limiter.SlidingWindowModeCheckAndRecord)
@@ -43,7 +51,11 @@ func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark st
 }
 
 func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
-	key := fmt.Sprintf("global:%s:ip:%s", mark, c.ClientIP())
+	if rateLimitBypassed() {
+		c.Next()
+		return
+	}
+	key := fmt.Sprintf("global:%s:ip:%s", mark, rateLimitClientKey(c))
 	if !inMemoryRateLimiter.Request(key, maxRequestNum, duration) {
 		c.Status(http.StatusTooManyRequests)
 		c.Abort()
@@ -51,6 +63,24 @@ func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark s
 	}
 }
 
+// rateLimitClientKey 返回 IP 限流使用的客户端标识。配置了指纹请求头且请求直接来自可信代理时，
+// 在 IP 后追加指纹的哈希；否则（包括请求头缺失或来源不可信，避免伪造）仅使用客户端 IP。
+func rateLimitClientKey(c *gin.Context) string {
+	ip := common.ResolveClientIP(c)
+	if common.RateLimitFingerprintHeader == "" || len(common.RateLimitFingerprintTrustedProxies) == 0 {
+		return ip
+	}
+	fingerprint := strings.TrimSpace(c.GetHeader(common.RateLimitFingerprintHeader))
+	if fingerprint == "" {
+		return ip
+	}
+	remoteIP := net.ParseIP(c.RemoteIP())
+	if remoteIP == nil || !common.IsIpInCIDRList(remoteIP, common.RateLimitFingerprintTrustedProxies) {
+		return ip
+	}
+	return ip + ":fp:" + hex.EncodeToString(common.Sha256Raw([]byte(fingerprint)))[:16]
+}
+
 func rateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
 	if common.RedisEnabled {
 		return func(c *gin.Context) {
@@ -100,13 +130,17 @@ func UploadRateLimit() func(c *gin.Context) {
 func userRateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
 	if common.RedisEnabled {
 		return func(c *gin.Context) {
+			if rateLimitBypassed() {
+				c.Next()
+				return
+			}
 			userId := c.GetInt("id")
 			if userId == 0 {
 				c.Status(http.StatusUnauthorized)
 				c.Abort()
 				return
 			}
-			shard := common.HashShard(fmt.Sprintf("%d", userId), common.RateLimitKeyShardCount)
+			shard := common.RateLimitKeyShard(fmt.Sprintf("%d", userId))
 			key := fmt.Sprintf("rateLimit:user:%s:id:%d:%s", mark, userId, shard)
 			userRedisRateLimiter(c, maxRequestNum, duration, key)
 		}
@@ -114,6 +148,10 @@ func userRateLimitFactory(maxRequestNum int, duration int64, mark string) func(c
 	// It's safe to call multi times.
 	inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
 	return func(c *gin.Context) {
+		if rateLimitBypassed() {
+			c.Next()
+			return
+		}
 		userId := c.GetInt("id")
 		if userId == 0 {
 			c.Status(http.StatusUnauthorized)
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const rateLimitKillSwitchLogInterval = time.Minute
+
+var (
+	rateLimitGloballyDisabled     atomic.Bool
+	rateLimitKillSwitchLastLogged atomic.Int64
+)
+
+// SetRateLimitGloballyDisabled 应急开关：开启后所有限流中间件直接放行，无需保存设置或重启。
+// 仅作用于当前实例内存，重启后恢复；多实例部署需要逐个节点调用。
+func SetRateLimitGloballyDisabled(disabled bool) {
+	if rateLimitGloballyDisabled.Swap(disabled) == disabled {
+		return
+	}
+	if disabled {
+		common.SysError("rate limit kill switch ENABLED: all rate limiters are bypassed")
+	} else {
+		common.SysLog("rate limit kill switch disabled: rate limiters restored")
+	}
+}
+
+func IsRateLimitGloballyDisabled() bool {
+	return rateLimitGloballyDisabled.Load()
+}
+
+// rateLimitBypassed 在应急开关开启时返回 true，并至多每分钟输出一次告警，提醒开关仍处于开启状态
+func rateLimitBypassed() bool {
+	if !rateLimitGloballyDisabled.Load() {
+		return false
+	}
+	now := time.Now().UnixNano()
+	last := rateLimitKillSwitchLastLogged.Load()
+	if now-last >= int64(rateLimitKillSwitchLogInterval) && rateLimitKillSwitchLastLogged.CompareAndSwap(last, now) {
+		common.SysError("rate limit kill switch is active: requests are not being rate limited")
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitKeyTestContext(remoteAddr string, fingerprint string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = remoteAddr
+	if fingerprint != "" {
+		c.Request.Header.Set("X-Client-Fingerprint", fingerprint)
+	}
+	return c
+}
+
+func TestRateLimitClientKey_FingerprintOnlyFromTrustedProxy(t *testing.T) {
+	oldHeader, oldProxies := common.RateLimitFingerprintHeader, common.RateLimitFingerprintTrustedProxies
+	t.Cleanup(func() {
+		common.RateLimitFingerprintHeader, common.RateLimitFingerprintTrustedProxies = oldHeader, oldProxies
+	})
+	common.RateLimitFingerprintHeader = "X-Client-Fingerprint"
+	common.RateLimitFingerprintTrustedProxies = []string{"10.0.0.0/8"}
+
+	trustedA := rateLimitClientKey(newRateLimitKeyTestContext("10.1.1.1:1234", "device-a"))
+	trustedB := rateLimitClientKey(newRateLimitKeyTestContext("10.1.1.1:1234", "device-b"))
+	require.NotEqual(t, trustedA, trustedB)
+	require.Contains(t, trustedA, ":fp:")
+	require.NotContains(t, trustedA, "device-a")
+
+	// 缺少请求头时退回 IP
+	require.Equal(t, "10.1.1.1", rateLimitClientKey(newRateLimitKeyTestContext("10.1.1.1:1234", "")))
+	// 非可信来源携带的请求头不被信任
+	require.Equal(t, "203.0.113.5", rateLimitClientKey(newRateLimitKeyTestContext("203.0.113.5:1234", "device-a")))
+}
+
+func TestRateLimitKillSwitchBypassesLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { SetRateLimitGloballyDisabled(false) })
+	inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		memoryRateLimiter(c, 1, 60, "KS")
+	}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func() int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "198.51.100.20:1234"
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	require.Equal(t, http.StatusOK, request())
+	require.Equal(t, http.StatusTooManyRequests, request())
+
+	SetRateLimitGloballyDisabled(true)
+	require.True(t, IsRateLimitGloballyDisabled())
+	require.Equal(t, http.StatusOK, request())
+
+	SetRateLimitGloballyDisabled(false)
+	require.Equal(t, http.StatusTooManyRequests, request())
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyTokenModelMapping 按令牌级模型映射改写请求模型，并在上下文中记录原始与映射后的模型。
+// 模型请求缓存（包括不区分令牌的预热条目）只保存映射前的结果，映射在每次取得结果后执行，
+// 因此不同令牌之间不会互相读到对方映射后的模型。
+func applyTokenModelMapping(c *gin.Context, modelRequest *ModelRequest) {
+	if modelRequest == nil || modelRequest.Model == "" {
+		return
+	}
+	raw, ok := common.GetContextKey(c, constant.ContextKeyTokenModelMapping)
+	if !ok {
+		return
+	}
+	mapping, ok := raw.(map[string]string)
+	if !ok {
+		return
+	}
+	mapped, ok := mapping[modelRequest.Model]
+	if !ok || mapped == "" || mapped == modelRequest.Model {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyTokenRequestedModel, modelRequest.Model)
+	common.SetContextKey(c, constant.ContextKeyTokenMappedModel, mapped)
+	modelRequest.Model = mapped
+}
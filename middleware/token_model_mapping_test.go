@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenModelMappingTestContext(tokenId int, mapping map[string]string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyTokenId, tokenId)
+	if mapping != nil {
+		common.SetContextKey(c, constant.ContextKeyTokenModelMapping, mapping)
+	}
+	return c
+}
+
+func TestGetModelRequest_AppliesTokenModelMapping(t *testing.T) {
+	c := newTokenModelMappingTestContext(501, map[string]string{"gpt-4o": "gpt-4o-mini"})
+	modelRequest, _, err := getModelRequest(c)
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o-mini", modelRequest.Model)
+	require.Equal(t, "gpt-4o", common.GetContextKeyString(c, constant.ContextKeyTokenRequestedModel))
+	require.Equal(t, "gpt-4o-mini", common.GetContextKeyString(c, constant.ContextKeyTokenMappedModel))
+
+	// 其他令牌的相同请求不受影响，即使命中模型请求缓存
+	other := newTokenModelMappingTestContext(502, nil)
+	modelRequest, _, err = getModelRequest(other)
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o", modelRequest.Model)
+	require.Empty(t, common.GetContextKeyString(other, constant.ContextKeyTokenRequestedModel))
+
+	// 同一令牌再次请求时（可能命中缓存）仍然生效
+	again := newTokenModelMappingTestContext(501, map[string]string{"gpt-4o": "gpt-4o-mini"})
+	modelRequest, _, err = getModelRequest(again)
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o-mini", modelRequest.Model)
+}
@@ -35,7 +35,7 @@ func TurnstileCheck() gin.HandlerFunc {
 			rawRes, err := http.PostForm("https://challenges.cloudflare.com/turnstile/v0/siteverify", url.Values{
 				"secret":   {common.TurnstileSecretKey},
 				"response": {response},
-				"remoteip": {c.ClientIP()},
+				"remoteip": {common.ResolveClientIP(c)},
 			})
 			if err != nil {
 				common.SysLog(err.Error())
@@ -197,7 +197,7 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 			weightSum += ability_.Weight + 10
 		}
 		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
+		weight := channelSelectIntn(int(weightSum))
 		for _, ability_ := range abilities {
 			weight -= int(ability_.Weight) + 10
 			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
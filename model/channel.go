@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -683,6 +684,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			common.SysLog(fmt.Sprintf("failed to update channel status: channel_id=%d, status=%d, error=%v", channel.Id, status, err))
 			return false
 		}
+		notifyChannelStatusChanged(channel)
 	}
 	return true
 }
@@ -1009,14 +1011,32 @@ func (channel *Channel) SetOtherSettings(setting dto.ChannelOtherSettings) {
 	channel.OtherSettings = string(settingBytes)
 }
 
+// paramOverrideMapCache 按配置版本缓存解析后的参数覆盖，返回的 map 在请求间共享，调用方只能读取
+var paramOverrideMapCache = common.NewTTLCacheFromEnv[string, map[string]interface{}]("param_override", 1024, 10*time.Minute)
+
+// GetParamOverrideVersion 返回参数覆盖原始配置的哈希，配置为空时返回空字符串
+func (channel *Channel) GetParamOverrideVersion() string {
+	if channel.ParamOverride == nil || *channel.ParamOverride == "" {
+		return ""
+	}
+	return common.Sha1([]byte(*channel.ParamOverride))
+}
+
+// GetParamOverride 返回解析后的参数覆盖配置，结果按版本缓存，调用方不得修改
 func (channel *Channel) GetParamOverride() map[string]interface{} {
+	version := channel.GetParamOverrideVersion()
+	if version == "" {
+		return make(map[string]interface{})
+	}
+	if paramOverride, ok := paramOverrideMapCache.Get(version); ok {
+		return paramOverride
+	}
 	paramOverride := make(map[string]interface{})
-	if channel.ParamOverride != nil && *channel.ParamOverride != "" {
-		err := common.Unmarshal([]byte(*channel.ParamOverride), &paramOverride)
-		if err != nil {
-			common.SysLog(fmt.Sprintf("failed to unmarshal param override: channel_id=%d, error=%v", channel.Id, err))
-		}
+	err := common.Unmarshal([]byte(*channel.ParamOverride), &paramOverride)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to unmarshal param override: channel_id=%d, error=%v", channel.Id, err))
 	}
+	paramOverrideMapCache.Set(version, paramOverride)
 	return paramOverride
 }
 
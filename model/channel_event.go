@@ -0,0 +1,37 @@
+package model
+
+import (
+	"sync"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+var (
+	channelStatusChangedCallbacksLock sync.RWMutex
+	channelStatusChangedCallbacks     []func(channel *Channel)
+)
+
+// OnChannelStatusChanged 注册 UpdateChannelStatus 成功修改渠道状态（含自动禁用/启用）后的回调，回调异步执行
+func OnChannelStatusChanged(callback func(channel *Channel)) {
+	if callback == nil {
+		return
+	}
+	channelStatusChangedCallbacksLock.Lock()
+	defer channelStatusChangedCallbacksLock.Unlock()
+	channelStatusChangedCallbacks = append(channelStatusChangedCallbacks, callback)
+}
+
+func notifyChannelStatusChanged(channel *Channel) {
+	if channel == nil {
+		return
+	}
+	channelStatusChangedCallbacksLock.RLock()
+	callbacks := append([]func(channel *Channel){}, channelStatusChangedCallbacks...)
+	channelStatusChangedCallbacksLock.RUnlock()
+	for _, callback := range callbacks {
+		callback := callback
+		gopool.Go(func() {
+			callback(channel)
+		})
+	}
+}
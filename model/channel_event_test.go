@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateChannelStatusNotifiesCallbacks(t *testing.T) {
+	truncateTables(t)
+	originalMemoryCache := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	t.Cleanup(func() { common.MemoryCacheEnabled = originalMemoryCache })
+
+	channel := &Channel{Name: "status-event", Key: "sk-status-event", Status: common.ChannelStatusEnabled, Models: "gpt-4o"}
+	require.NoError(t, DB.Create(channel).Error)
+
+	notified := make(chan *Channel, 4)
+	OnChannelStatusChanged(func(changed *Channel) {
+		if changed.Id == channel.Id {
+			notified <- changed
+		}
+	})
+
+	require.True(t, UpdateChannelStatus(channel.Id, "", common.ChannelStatusAutoDisabled, "test"))
+	select {
+	case changed := <-notified:
+		require.Equal(t, common.ChannelStatusAutoDisabled, changed.Status)
+		require.Equal(t, []string{"gpt-4o"}, changed.GetModels())
+	case <-time.After(time.Second):
+		t.Fatal("channel status callback was not invoked")
+	}
+
+	// 状态未变化时不触发回调
+	require.False(t, UpdateChannelStatus(channel.Id, "", common.ChannelStatusAutoDisabled, "test"))
+	select {
+	case <-notified:
+		t.Fatal("unexpected callback for unchanged status")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// channelSelectRand 为渠道加权随机选择使用的随机源，为 nil 时使用全局 rand。
+// 仅在测试（SetChannelSelectRandSource）或调试模式下的 CHANNEL_SELECT_SEED 中设置，使选择结果可复现；
+// 未设置时选择路径只有一次原子读取，不持有任何锁。
+var (
+	channelSelectRand     atomic.Pointer[lockedChannelSelectRand]
+	channelSelectSeedOnce sync.Once
+)
+
+// lockedChannelSelectRand 为固定种子的随机源加锁，rand.Rand 本身不是并发安全的
+type lockedChannelSelectRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedChannelSelectRand(src rand.Source) *lockedChannelSelectRand {
+	return &lockedChannelSelectRand{r: rand.New(src)}
+}
+
+func (l *lockedChannelSelectRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+// SetChannelSelectRandSource 将渠道选择的随机源替换为 src（nil 表示恢复全局随机），返回恢复原随机源的函数
+func SetChannelSelectRandSource(src rand.Source) (restore func()) {
+	// 显式设置的随机源优先于 CHANNEL_SELECT_SEED
+	channelSelectSeedOnce.Do(func() {})
+	var next *lockedChannelSelectRand
+	if src != nil {
+		next = newLockedChannelSelectRand(src)
+	}
+	prev := channelSelectRand.Swap(next)
+	return func() {
+		channelSelectRand.Store(prev)
+	}
+}
+
+func initChannelSelectSeed() {
+	raw := os.Getenv("CHANNEL_SELECT_SEED")
+	if raw == "" || !common.DebugEnabled {
+		return
+	}
+	seed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to parse CHANNEL_SELECT_SEED: %s", err.Error()))
+		return
+	}
+	common.SysLog(fmt.Sprintf("channel selection uses fixed seed %d (debug only)", seed))
+	channelSelectRand.Store(newLockedChannelSelectRand(rand.NewSource(seed)))
+}
+
+// channelSelectIntn 返回 [0, n) 内的随机数
+func channelSelectIntn(n int) int {
+	channelSelectSeedOnce.Do(initChannelSelectSeed)
+	if r := channelSelectRand.Load(); r != nil {
+		return r.Intn(n)
+	}
+	return rand.Intn(n)
+}
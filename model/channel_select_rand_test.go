@@ -0,0 +1,56 @@
+package model
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRandomSatisfiedChannel_ReproducibleWithSeededSource(t *testing.T) {
+	oldEnabled, oldGroups, oldChannels := common.MemoryCacheEnabled, group2model2channels, channelsIDM
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled, group2model2channels, channelsIDM = oldEnabled, oldGroups, oldChannels
+	})
+	common.MemoryCacheEnabled = true
+	weight := uint(10)
+	channelsIDM = map[int]*Channel{}
+	for id := 1; id <= 4; id++ {
+		channelsIDM[id] = &Channel{Id: id, Weight: &weight}
+	}
+	group2model2channels = map[string]map[string][]int{"default": {"gpt-test": {1, 2, 3, 4}}}
+
+	pick := func() []int {
+		restore := SetChannelSelectRandSource(rand.NewSource(42))
+		defer restore()
+		ids := make([]int, 0, 20)
+		for i := 0; i < 20; i++ {
+			channel, err := GetRandomSatisfiedChannel("default", "gpt-test", 0)
+			require.NoError(t, err)
+			ids = append(ids, channel.Id)
+		}
+		return ids
+	}
+	require.Equal(t, pick(), pick())
+}
+
+func TestChannelSelectIntn_ConcurrentWithSeededSource(t *testing.T) {
+	restore := SetChannelSelectRandSource(rand.NewSource(7))
+	defer restore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				v := channelSelectIntn(10)
+				require.GreaterOrEqual(t, v, 0)
+				require.Less(t, v, 10)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,19 +1,27 @@
 package model
 
-import "github.com/QuantumNous/new-api/common"
+import (
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
 
 // GetDBTimestamp returns a UNIX timestamp from database time.
 // Falls back to application time on error.
 func GetDBTimestamp() int64 {
+	return getDBTimestampTx(DB)
+}
+
+// getDBTimestampTx 与 GetDBTimestamp 相同，但在给定事务内查询，避免事务内再占用一个连接
+func getDBTimestampTx(tx *gorm.DB) int64 {
 	var ts int64
 	var err error
 	switch {
 	case common.UsingPostgreSQL:
-		err = DB.Raw("SELECT EXTRACT(EPOCH FROM NOW())::bigint").Scan(&ts).Error
+		err = tx.Raw("SELECT EXTRACT(EPOCH FROM NOW())::bigint").Scan(&ts).Error
 	case common.UsingSQLite:
-		err = DB.Raw("SELECT strftime('%s','now')").Scan(&ts).Error
+		err = tx.Raw("SELECT strftime('%s','now')").Scan(&ts).Error
 	default:
-		err = DB.Raw("SELECT UNIX_TIMESTAMP()").Scan(&ts).Error
+		err = tx.Raw("SELECT UNIX_TIMESTAMP()").Scan(&ts).Error
 	}
 	if err != nil || ts <= 0 {
 		return common.GetTimestamp()
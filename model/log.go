@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/types"
 
@@ -173,7 +174,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 		Group:            group,
 		Ip: func() string {
 			if needRecordIp {
-				return c.ClientIP()
+				return common.ResolveClientIP(c)
 			}
 			return ""
 		}(),
@@ -202,9 +203,19 @@ type RecordConsumeLogParams struct {
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	common.SetContextKey(c, constant.ContextKeyConsumeLogParams, params)
 	if !common.LogConsumeEnabled {
 		return
 	}
+	// auto 分组请求按实际选中的分组计费，日志分组记录实际分组，并在 other 中保留原始请求的 auto 以便区分
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		params.Group = autoGroup
+		if params.Other == nil {
+			params.Other = make(map[string]interface{})
+		}
+		params.Other["requested_group"] = "auto"
+		params.Other["auto_group"] = autoGroup
+	}
 	logger.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, params=%s", userId, common.GetJsonString(params)))
 	username := c.GetString("username")
 	requestId := c.GetString(common.RequestIdKey)
@@ -234,7 +245,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		Group:            params.Group,
 		Ip: func() string {
 			if needRecordIp {
-				return c.ClientIP()
+				return common.ResolveClientIP(c)
 			}
 			return ""
 		}(),
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordConsumeLog_AutoGroupRecordsResolvedGroup(t *testing.T) {
+	truncateTables(t)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	common.SetContextKey(c, constant.ContextKeyAutoGroup, "vip")
+
+	RecordConsumeLog(c, 1, RecordConsumeLogParams{
+		ModelName: "gpt-4o",
+		Quota:     100,
+		Group:     "auto",
+		Other:     map[string]interface{}{"group_ratio": 1.5},
+	})
+
+	var log Log
+	require.NoError(t, LOG_DB.Where("user_id = ?", 1).First(&log).Error)
+	assert.Equal(t, "vip", log.Group)
+
+	other, err := common.StrToMap(log.Other)
+	require.NoError(t, err)
+	assert.Equal(t, "auto", other["requested_group"])
+	assert.Equal(t, "vip", other["auto_group"])
+	assert.Equal(t, 1.5, other["group_ratio"])
+}
+
+func TestRecordConsumeLog_NonAutoGroupUnchanged(t *testing.T) {
+	truncateTables(t)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+
+	RecordConsumeLog(c, 2, RecordConsumeLogParams{ModelName: "gpt-4o", Group: "default"})
+
+	var log Log
+	require.NoError(t, LOG_DB.Where("user_id = ?", 2).First(&log).Error)
+	assert.Equal(t, "default", log.Group)
+	assert.NotContains(t, log.Other, "requested_group")
+}
@@ -406,6 +406,7 @@ func migrateDB() error {
 		&SubscriptionOrder{},
 		&UserSubscription{},
 		&SubscriptionPreConsumeRecord{},
+		&QuotaRefundRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
 	)
@@ -421,6 +422,9 @@ func migrateDB() error {
 			return err
 		}
 	}
+	if err := ensureRedemptionKeyUniqueIndex(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -455,6 +459,7 @@ func migrateDBFast() error {
 		{&SubscriptionOrder{}, "SubscriptionOrder"},
 		{&UserSubscription{}, "UserSubscription"},
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
+		{&QuotaRefundRecord{}, "QuotaRefundRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
 	}
@@ -490,6 +495,9 @@ func migrateDBFast() error {
 			return err
 		}
 	}
+	if err := ensureRedemptionKeyUniqueIndex(); err != nil {
+		return err
+	}
 	common.SysLog("database migrated")
 	return nil
 }
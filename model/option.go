@@ -139,8 +139,12 @@ func InitOptionMap() {
 	common.OptionMap["PreConsumedQuota"] = strconv.Itoa(common.PreConsumedQuota)
 	common.OptionMap["ModelRequestRateLimitCount"] = strconv.Itoa(setting.ModelRequestRateLimitCount)
 	common.OptionMap["ModelRequestRateLimitDurationMinutes"] = strconv.Itoa(setting.ModelRequestRateLimitDurationMinutes)
+	common.OptionMap["ModelRequestRateLimitDurationSeconds"] = strconv.Itoa(setting.ModelRequestRateLimitDurationSeconds)
+	common.OptionMap["ModelRequestIPRateLimitDurationSeconds"] = strconv.Itoa(setting.ModelRequestIPRateLimitDurationSeconds)
 	common.OptionMap["ModelRequestRateLimitSuccessCount"] = strconv.Itoa(setting.ModelRequestRateLimitSuccessCount)
 	common.OptionMap["ModelRequestRateLimitGroup"] = setting.ModelRequestRateLimitGroup2JSONString()
+	common.OptionMap["RateLimitExemptTokenIds"] = setting.RateLimitExemptTokenIds2JSONString()
+	common.OptionMap["RateLimitExemptUserIds"] = setting.RateLimitExemptUserIds2JSONString()
 	common.OptionMap["ModelRatio"] = ratio_setting.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = ratio_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = ratio_setting.CacheRatio2JSONString()
@@ -222,10 +226,29 @@ func UpdateOption(key string, value string) error {
 	return updateOptionMap(key, value)
 }
 
+// routingConfigOptions 会影响路由解析缓存中分组信息的配置项，变更时递增路由配置版本号
+var routingConfigOptions = map[string]struct{}{
+	"AutoGroups":          {},
+	"DefaultUseAutoGroup": {},
+	"GroupRatio":          {},
+	"GroupGroupRatio":     {},
+	"UserUsableGroups":    {},
+}
+
+func isRoutingConfigOption(key string) bool {
+	_, ok := routingConfigOptions[key]
+	return ok
+}
+
 func updateOptionMap(key string, value string) (err error) {
 	common.OptionMapRWMutex.Lock()
 	defer common.OptionMapRWMutex.Unlock()
+	previous, existed := common.OptionMap[key]
 	common.OptionMap[key] = value
+	if isRoutingConfigOption(key) && (!existed || previous != value) {
+		// 在下方各分支写入新值之后再递增版本号，避免并发请求按旧配置解析的结果被标记为新版本
+		defer common.BumpRoutingConfigVersion()
+	}
 
 	// 检查是否是模型配置 - 使用更规范的方式处理
 	if handleConfigUpdate(key, value) {
@@ -489,10 +512,18 @@ func updateOptionMap(key string, value string) (err error) {
 		setting.ModelRequestRateLimitCount, _ = strconv.Atoi(value)
 	case "ModelRequestRateLimitDurationMinutes":
 		setting.ModelRequestRateLimitDurationMinutes, _ = strconv.Atoi(value)
+	case "ModelRequestRateLimitDurationSeconds":
+		setting.ModelRequestRateLimitDurationSeconds, _ = strconv.Atoi(value)
+	case "ModelRequestIPRateLimitDurationSeconds":
+		setting.ModelRequestIPRateLimitDurationSeconds, _ = strconv.Atoi(value)
 	case "ModelRequestRateLimitSuccessCount":
 		setting.ModelRequestRateLimitSuccessCount, _ = strconv.Atoi(value)
 	case "ModelRequestRateLimitGroup":
 		err = setting.UpdateModelRequestRateLimitGroupByJSONString(value)
+	case "RateLimitExemptTokenIds":
+		err = setting.UpdateRateLimitExemptTokenIdsByJSONString(value)
+	case "RateLimitExemptUserIds":
+		err = setting.UpdateRateLimitExemptUserIdsByJSONString(value)
 	case "RetryTimes":
 		common.RetryTimes, _ = strconv.Atoi(value)
 	case "DataExportInterval":
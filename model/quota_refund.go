@@ -0,0 +1,101 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuotaRefundRecord 记录按请求 ID 退还的用户额度，用于保证同一请求只退款一次
+type QuotaRefundRecord struct {
+	Id        int    `json:"id"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Amount    int    `json:"amount"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (r *QuotaRefundRecord) BeforeCreate(tx *gorm.DB) error {
+	r.CreatedAt = common.GetTimestamp()
+	return nil
+}
+
+// RefundQuota 按 requestId 幂等地向用户退还额度。
+// 去重记录与额度增加在同一事务内写入数据库（不经过批量更新），保证二者同时生效；
+// 同一 requestId 重复调用直接返回 nil，因此可配合 refundWithRetry 安全重试。
+func RefundQuota(requestId string, userId int, amount int) error {
+	requestId = strings.TrimSpace(requestId)
+	if requestId == "" {
+		return errors.New("requestId is empty")
+	}
+	if userId <= 0 {
+		return errors.New("invalid userId")
+	}
+	if amount < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	if amount == 0 {
+		return nil
+	}
+	done := beginUserQuotaMutation(userId, 1)
+	applied := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		record := &QuotaRefundRecord{
+			RequestId: requestId,
+			UserId:    userId,
+			Amount:    amount,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		applied = true
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", amount)).Error
+	})
+	if err != nil || !applied {
+		done()
+		return err
+	}
+	gopool.Go(func() {
+		defer done()
+		if err := cacheIncrUserQuota(userId, int64(amount)); err != nil {
+			common.SysLog("failed to increase user quota: " + err.Error())
+		}
+	})
+	return nil
+}
+
+// DeleteQuotaRefundRecordsBefore 分批删除创建时间早于 before 的退款去重记录，返回删除的行数
+func DeleteQuotaRefundRecordsBefore(ctx context.Context, before int64, limit int) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		var ids []int
+		if err := DB.Model(&QuotaRefundRecord{}).Where("created_at < ?", before).
+			Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := DB.Where("id IN ?", ids).Delete(&QuotaRefundRecord{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < limit {
+			return total, nil
+		}
+	}
+}
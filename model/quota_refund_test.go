@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundQuota_IdempotentByRequestId(t *testing.T) {
+	truncateTables(t)
+
+	user := &User{Username: "refund_u1", AffCode: "refund_aff_1", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+
+	require.NoError(t, RefundQuota("req-refund-1", user.Id, 30))
+	require.NoError(t, RefundQuota("req-refund-1", user.Id, 30))
+	require.NoError(t, RefundQuota("req-refund-2", user.Id, 5))
+	require.NoError(t, RefundQuota("req-refund-3", user.Id, 0))
+
+	var got User
+	require.NoError(t, DB.First(&got, user.Id).Error)
+	require.Equal(t, 135, got.Quota)
+
+	var count int64
+	require.NoError(t, DB.Model(&QuotaRefundRecord{}).Where("user_id = ?", user.Id).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+
+	require.Error(t, RefundQuota("", user.Id, 1))
+	require.Error(t, RefundQuota("req-refund-4", user.Id, -1))
+}
+
+func TestRefundQuota_WritesThroughWhenBatchUpdateEnabled(t *testing.T) {
+	truncateTables(t)
+	oldBatch := common.BatchUpdateEnabled
+	t.Cleanup(func() { common.BatchUpdateEnabled = oldBatch })
+	common.BatchUpdateEnabled = true
+
+	user := &User{Username: "refund_u2", AffCode: "refund_aff_2", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+
+	require.NoError(t, RefundQuota("req-refund-batch", user.Id, 40))
+	require.NoError(t, RefundQuota("req-refund-batch", user.Id, 40))
+
+	// 去重记录与额度在同一事务内落库，不依赖批量更新刷新
+	var got User
+	require.NoError(t, DB.First(&got, user.Id).Error)
+	require.Equal(t, 140, got.Quota)
+	require.Zero(t, pendingUserQuotaDelta(user.Id))
+}
+
+func TestDeleteQuotaRefundRecordsBefore(t *testing.T) {
+	truncateTables(t)
+
+	now := common.GetTimestamp()
+	for i, createdAt := range []int64{now - 100, now - 50, now} {
+		record := &QuotaRefundRecord{RequestId: fmt.Sprintf("req-cleanup-%d", i), UserId: 1, Amount: 1}
+		require.NoError(t, DB.Create(record).Error)
+		require.NoError(t, DB.Model(record).Update("created_at", createdAt).Error)
+	}
+
+	deleted, err := DeleteQuotaRefundRecordsBefore(context.Background(), now-10, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), deleted)
+
+	var remaining []QuotaRefundRecord
+	require.NoError(t, DB.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	require.Equal(t, "req-cleanup-2", remaining[0].RequestId)
+}
@@ -1,21 +1,28 @@
 package model
 
 import (
+	"context"
+	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
 type Redemption struct {
 	Id            int            `json:"id"`
 	UserId        int            `json:"user_id"`
-	Key           string         `json:"key" gorm:"type:char(32);uniqueIndex"`
+	Key           string         `json:"key" gorm:"type:varchar(32)"` // 唯一索引由 ensureRedemptionKeyUniqueIndex 维护
 	Status        int            `json:"status" gorm:"default:1"`
 	Name          string         `json:"name" gorm:"index"`
 	Quota         int            `json:"quota" gorm:"default:100"`
@@ -23,11 +30,22 @@ type Redemption struct {
 	UsedCount     int            `json:"used_count" gorm:"default:0"`
 	CreatedTime   int64          `json:"created_time" gorm:"bigint"`
 	RedeemedTime  int64          `json:"redeemed_time" gorm:"bigint"`
-	Count         int            `json:"count" gorm:"-:all"` // only for api request
+	Count         int            `json:"count" gorm:"-:all"`  // only for api request
+	Prefix        string         `json:"prefix" gorm:"-:all"` // only for api request
 	UsedUserId    int            `json:"used_user_id"`
 	DeletedAt     gorm.DeletedAt `gorm:"index"`
 	ExpiredTime   int64          `json:"expired_time" gorm:"bigint"` // 过期时间，0 表示不过期
 	RemainingUses int            `json:"remaining_uses" gorm:"-:all"`
+	PlanId        int            `json:"plan_id" gorm:"default:0"` // 兑换时开通的订阅套餐，0 表示仅充值额度
+	// 以展示货币填写的金额及货币（USD / CNY / CUSTOM），大于 0 时按汇率换算为 Quota，并保留原始金额用于审计
+	DisplayAmount   float64 `json:"display_amount" gorm:"default:0"`
+	DisplayCurrency string  `json:"display_currency" gorm:"type:varchar(16);default:''"`
+}
+
+// AfterFind 去除旧版 char(32) 列在 PostgreSQL 上为短兑换码补齐的尾部空格
+func (redemption *Redemption) AfterFind(tx *gorm.DB) error {
+	redemption.Key = strings.TrimRight(redemption.Key, " ")
+	return nil
 }
 
 type RedemptionUsage struct {
@@ -152,6 +170,34 @@ func GetRedemptionById(id int) (*Redemption, error) {
 	return &redemption, err
 }
 
+// GetRedemptionUsageCounts 以一次分组查询返回各兑换码的实际使用记录数（redemption id -> 次数），
+// 用于校验 UsedCount 是否与使用记录一致；没有使用记录的 id 也会以 0 返回
+func GetRedemptionUsageCounts(ids []int) (map[int]int, error) {
+	counts := make(map[int]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	for _, id := range ids {
+		counts[id] = 0
+	}
+	var rows []struct {
+		RedemptionId int
+		UsageCount   int
+	}
+	err := DB.Model(&RedemptionUsage{}).
+		Select("redemption_id, count(*) as usage_count").
+		Where("redemption_id IN ?", ids).
+		Group("redemption_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.RedemptionId] = row.UsageCount
+	}
+	return counts, nil
+}
+
 func Redeem(key string, userId int) (quota int, err error) {
 	if key == "" {
 		return 0, errors.New(i18n.MsgRedemptionNotProvided)
@@ -160,14 +206,31 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return 0, errors.New(i18n.MsgInvalidParams)
 	}
 	redemption := &Redemption{}
+	var plan *SubscriptionPlan
+	var planErr error
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
+	// 按当前格式规范化输入，同时保留原始输入以匹配按旧格式（含分隔符）存储的兑换码
+	keys := []string{key}
+	if normalized := redemptionKeyFormatFromSetting("").NormalizeKey(key); normalized != "" && normalized != key {
+		keys = append(keys, normalized)
+	}
+	// 兑换频率限制：优先使用 Redis 滑动窗口预占名额，不可用时在事务内按兑换记录计数
+	velocityLimit := operation_setting.GetMaxRedemptionsPerHour()
+	velocityEntry := ""
+	velocityUseDB := false
+	if velocityLimit > 0 {
+		velocityEntry, velocityUseDB, err = reserveRedemptionVelocity(userId, velocityLimit)
+		if err != nil {
+			return 0, err
+		}
+	}
 	common.RandomSleep()
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" IN ?", keys).First(redemption).Error
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return errors.New(i18n.MsgRedemptionInvalid)
@@ -195,6 +258,23 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if usageCount > 0 {
 			return errors.New(i18n.MsgRedemptionUsed)
 		}
+		if velocityUseDB {
+			if err = checkRedemptionVelocityTx(tx, userId, velocityLimit); err != nil {
+				return err
+			}
+		}
+
+		if redemption.PlanId > 0 {
+			plan, err = getSubscriptionPlanByIdTx(tx, redemption.PlanId)
+			if err != nil || plan == nil || !plan.Enabled {
+				return errors.New(i18n.MsgRedemptionPlanUnavailable)
+			}
+			if _, err = CreateUserSubscriptionFromPlanTx(tx, userId, plan, "redemption"); err != nil {
+				// 购买上限、互斥套餐等资格校验失败时原样返回给用户
+				planErr = err
+				return err
+			}
+		}
 
 		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
 		if err != nil {
@@ -223,20 +303,399 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return err
 	})
 	if err != nil {
-		if err.Error() == i18n.MsgRedemptionInvalid || err.Error() == i18n.MsgRedemptionUsed || err.Error() == i18n.MsgRedemptionExpired || err.Error() == i18n.MsgRedemptionNotProvided {
+		rollbackRedemptionVelocity(userId, velocityEntry)
+		if err.Error() == i18n.MsgRedemptionInvalid || err.Error() == i18n.MsgRedemptionUsed || err.Error() == i18n.MsgRedemptionExpired || err.Error() == i18n.MsgRedemptionNotProvided || err.Error() == i18n.MsgRedemptionPlanUnavailable || err.Error() == i18n.MsgRedemptionVelocityExceeded {
+			return 0, err
+		}
+		if planErr != nil && errors.Is(err, planErr) {
 			return 0, err
 		}
 		common.SysError("redemption failed: " + err.Error())
 		return 0, ErrRedeemFailed
 	}
+	if plan != nil {
+		if upgradeGroup := strings.TrimSpace(plan.UpgradeGroup); upgradeGroup != "" {
+			_ = UpdateUserGroupCache(userId, upgradeGroup)
+		}
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码开通订阅套餐 %s，充值 %s，兑换码ID %d", plan.Title, logger.LogQuota(redemption.Quota), redemption.Id))
+		return redemption.Quota, nil
+	}
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
 	return redemption.Quota, nil
 }
 
+const (
+	redemptionKeyLength             = 32
+	RedemptionKeyMaxPrefixLength    = 16 // 保证随机部分至少 16 位
+	redemptionBatchInsertSize       = 500
+	redemptionKeyMaxGenerateRounds  = 5
+	redemptionKeyExistenceQuerySize = 500
+)
+
+// ErrRedemptionInvalidDisplayAmount 展示金额无法换算为额度，属于请求参数错误
+var ErrRedemptionInvalidDisplayAmount = errors.New("invalid redemption display amount")
+
+func redemptionKeyColumn() string {
+	if common.UsingPostgreSQL {
+		return `"key"`
+	}
+	return "`key`"
+}
+
+// BatchCreateRedemptions 按模板批量生成兑换码，在同一事务中批量插入并返回创建的记录。
+// prefix 用于活动追踪，随机部分会相应截短以保持 32 位长度；与已有兑换码冲突的 key 会重新生成。
+func BatchCreateRedemptions(template Redemption, count int, prefix string) ([]*Redemption, error) {
+	if count <= 0 {
+		return nil, errors.New("count must be positive")
+	}
+	prefix = strings.TrimSpace(prefix)
+	keyFormat := redemptionKeyFormatFromSetting(prefix)
+	if err := keyFormat.Validate(); err != nil {
+		return nil, err
+	}
+	maxUses := template.MaxUses
+	if maxUses <= 0 {
+		maxUses = 1
+	}
+	if err := template.ApplyDisplayAmount(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRedemptionInvalidDisplayAmount, err)
+	}
+	now := common.GetTimestamp()
+	redemptions := make([]*Redemption, 0, count)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		keys, err := generateUniqueRedemptionKeysTx(tx, count, keyFormat)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			redemptions = append(redemptions, &Redemption{
+				UserId:      template.UserId,
+				Name:        template.Name,
+				Key:         key,
+				Status:      common.RedemptionCodeStatusEnabled,
+				Quota:       template.Quota,
+				MaxUses:     maxUses,
+				CreatedTime: now,
+				ExpiredTime: template.ExpiredTime,
+				PlanId:      template.PlanId,
+				// 展示金额仅用于审计，额度已由 ApplyDisplayAmount 换算到模板
+				DisplayAmount:   template.DisplayAmount,
+				DisplayCurrency: template.DisplayCurrency,
+			})
+		}
+		return tx.CreateInBatches(redemptions, redemptionBatchInsertSize).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	normalizeRedemptionList(redemptions)
+	return redemptions, nil
+}
+
+// RedemptionKeyCharsetHumanFriendly 便于人工输入的字符集：大写字母与数字，排除易混淆的 O/0/I/1
+const RedemptionKeyCharsetHumanFriendly = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// redemptionKeyMinRandomLength 自定义字符集时随机部分的最少字符数
+const redemptionKeyMinRandomLength = 8
+
+// redemptionKeyMinEntropyBits 自定义格式下随机部分的最低熵（位），即 n·log2(字符集大小) 的下限
+const redemptionKeyMinEntropyBits = 64
+
+// KeyFormatOptions 兑换码格式。Charset 为空时沿用 32 位十六进制格式；
+// 兑换码按 NormalizeKey 的规范形式存储，分组形式仅用于展示，其长度同样不超过 32 位
+type KeyFormatOptions struct {
+	Prefix    string
+	Charset   string
+	Length    int // 随机部分字符数，<=0 表示在 32 位内尽量填满
+	GroupSize int // 每隔多少个随机字符插入分隔符，<=0 表示不分组
+	Separator string
+}
+
+func (opts KeyFormatOptions) separator() string {
+	if opts.Separator == "" {
+		return "-"
+	}
+	return opts.Separator
+}
+
+// formattedLength 返回随机部分为 n 个字符时兑换码的总长度
+func (opts KeyFormatOptions) formattedLength(n int) int {
+	total := len(opts.Prefix) + n
+	if opts.GroupSize > 0 && n > 0 {
+		total += (n - 1) / opts.GroupSize * len(opts.separator())
+	}
+	return total
+}
+
+// randomLength 返回随机部分的字符数，未指定时取不超过 32 位的最大值
+func (opts KeyFormatOptions) randomLength() int {
+	if opts.Length > 0 {
+		return opts.Length
+	}
+	n := redemptionKeyLength - len(opts.Prefix)
+	for n > 0 && opts.formattedLength(n) > redemptionKeyLength {
+		n--
+	}
+	return n
+}
+
+// Validate 校验字符集、分隔符与长度，确保随机部分不低于 64 位熵且生成的兑换码能存入 varchar(32) 列
+func (opts KeyFormatOptions) Validate() error {
+	if len(opts.Prefix) > RedemptionKeyMaxPrefixLength {
+		return fmt.Errorf("prefix length must not exceed %d", RedemptionKeyMaxPrefixLength)
+	}
+	if opts.Charset == "" {
+		return nil
+	}
+	seen := make(map[rune]struct{}, len(opts.Charset))
+	for _, ch := range opts.Charset {
+		if !isRedemptionKeyPrintable(ch) {
+			return errors.New("redemption key charset must contain printable ASCII characters only")
+		}
+		seen[ch] = struct{}{}
+	}
+	if len(seen) < 2 {
+		return errors.New("redemption key charset must contain at least 2 distinct characters")
+	}
+	if opts.GroupSize > 0 {
+		for _, ch := range opts.separator() {
+			if !isRedemptionKeyPrintable(ch) {
+				return errors.New("redemption key separator must contain printable ASCII characters only")
+			}
+			if _, ok := seen[ch]; ok {
+				return errors.New("redemption key charset must not contain the separator")
+			}
+		}
+	}
+	n := opts.randomLength()
+	if n < redemptionKeyMinRandomLength {
+		return fmt.Errorf("redemption key random part must have at least %d characters", redemptionKeyMinRandomLength)
+	}
+	if bits := float64(n) * math.Log2(float64(len(seen))); bits < redemptionKeyMinEntropyBits {
+		return fmt.Errorf("redemption key random part has %.1f bits of entropy, at least %d required; use a longer key or a larger charset",
+			bits, redemptionKeyMinEntropyBits)
+	}
+	if total := opts.formattedLength(n); total > redemptionKeyLength {
+		return fmt.Errorf("redemption key length %d exceeds %d", total, redemptionKeyLength)
+	}
+	return nil
+}
+
+// upperCaseOnly 判断字符集中的字母是否全部为大写
+func (opts KeyFormatOptions) upperCaseOnly() bool {
+	return strings.ToUpper(opts.Charset) == opts.Charset && strings.ToLower(opts.Charset) != opts.Charset
+}
+
+// NormalizeKey 返回兑换码的规范形式：去除首尾空白与分组分隔符，字符集仅含大写字母时统一转为大写。
+// 生成的兑换码按此形式存储，兑换时对用户输入做同样处理，使未分组或小写的输入也能匹配
+func (opts KeyFormatOptions) NormalizeKey(key string) string {
+	key = strings.TrimSpace(key)
+	if opts.Charset == "" {
+		return key
+	}
+	if opts.GroupSize > 0 {
+		key = strings.ReplaceAll(key, opts.separator(), "")
+	}
+	if opts.upperCaseOnly() {
+		key = strings.ToUpper(key)
+	}
+	return key
+}
+
+// FormatKey 将规范形式的兑换码还原为带前缀与分组的展示形式，key 不以 opts.Prefix 的规范形式开头时原样返回
+func (opts KeyFormatOptions) FormatKey(key string) string {
+	if opts.Charset == "" || opts.GroupSize <= 0 {
+		return key
+	}
+	prefix := opts.NormalizeKey(opts.Prefix)
+	if !strings.HasPrefix(key, prefix) {
+		return key
+	}
+	randomPart := key[len(prefix):]
+	var b strings.Builder
+	b.Grow(opts.formattedLength(len(randomPart)))
+	b.WriteString(opts.Prefix)
+	for i := 0; i < len(randomPart); i++ {
+		if i > 0 && i%opts.GroupSize == 0 {
+			b.WriteString(opts.separator())
+		}
+		b.WriteByte(randomPart[i])
+	}
+	return b.String()
+}
+
+// isRedemptionKeyPrintable 判断字符是否为不含空格的可打印 ASCII 字符
+func isRedemptionKeyPrintable(ch rune) bool {
+	return ch > ' ' && ch <= '~'
+}
+
+// GenerateRedemptionKey 按 opts 生成兑换码，opts 需先通过 Validate 校验
+func GenerateRedemptionKey(opts KeyFormatOptions) string {
+	if opts.Charset == "" {
+		randomPart := common.GetUUID()
+		return opts.Prefix + randomPart[:redemptionKeyLength-len(opts.Prefix)]
+	}
+	charset := []byte(opts.Charset)
+	n := opts.randomLength()
+	maxIndex := big.NewInt(int64(len(charset)))
+	var b strings.Builder
+	b.Grow(opts.formattedLength(n))
+	b.WriteString(opts.Prefix)
+	for i := 0; i < n; i++ {
+		if opts.GroupSize > 0 && i > 0 && i%opts.GroupSize == 0 {
+			b.WriteString(opts.separator())
+		}
+		index, err := crand.Int(crand.Reader, maxIndex)
+		if err != nil {
+			// 系统随机源不可用时无法安全生成，直接终止
+			panic(fmt.Sprintf("failed to read random bytes: %v", err))
+		}
+		b.WriteByte(charset[index.Int64()])
+	}
+	return b.String()
+}
+
+// FormatRedemptionKey 按当前兑换码配置将存储的兑换码还原为展示形式，prefix 为生成时使用的前缀
+func FormatRedemptionKey(key string, prefix string) string {
+	return redemptionKeyFormatFromSetting(strings.TrimSpace(prefix)).FormatKey(key)
+}
+
+// redemptionKeyFormatFromSetting 按兑换码配置构造生成格式
+func redemptionKeyFormatFromSetting(prefix string) KeyFormatOptions {
+	setting := operation_setting.GetRedemptionSetting()
+	return KeyFormatOptions{
+		Prefix:    prefix,
+		Charset:   setting.KeyCharset,
+		Length:    setting.KeyLength,
+		GroupSize: setting.KeyGroupSize,
+		Separator: setting.KeySeparator,
+	}
+}
+
+// generateUniqueRedemptionKeysTx 生成 count 个互不重复且数据库中不存在（含已软删除）的兑换码，返回规范形式
+func generateUniqueRedemptionKeysTx(tx *gorm.DB, count int, keyFormat KeyFormatOptions) ([]string, error) {
+	seen := make(map[string]struct{}, count)
+	keys := make([]string, 0, count)
+	for round := 0; len(keys) < count; round++ {
+		if round >= redemptionKeyMaxGenerateRounds {
+			return nil, errors.New("failed to generate unique redemption keys")
+		}
+		candidates := make([]string, 0, count-len(keys))
+		for len(candidates) < count-len(keys) {
+			key := keyFormat.NormalizeKey(GenerateRedemptionKey(keyFormat))
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			candidates = append(candidates, key)
+		}
+		existing := make(map[string]struct{})
+		for start := 0; start < len(candidates); start += redemptionKeyExistenceQuerySize {
+			end := min(start+redemptionKeyExistenceQuerySize, len(candidates))
+			var found []string
+			// 同时避开已删除兑换码的 key，避免已作废的兑换码被重新生成后再次生效
+			err := tx.Unscoped().Model(&Redemption{}).
+				Where(redemptionKeyColumn()+" IN ?", candidates[start:end]).
+				Pluck("key", &found).Error
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range found {
+				existing[key] = struct{}{}
+			}
+		}
+		for _, key := range candidates {
+			if _, ok := existing[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// ApplyDisplayAmount 在设置了 DisplayAmount 时按展示货币汇率换算 Quota，取整方式与余额支付一致；
+// 未设置时清空展示货币。汇率未配置或换算结果为 0 时返回错误
+func (redemption *Redemption) ApplyDisplayAmount() error {
+	if redemption.DisplayAmount < 0 {
+		return errors.New("display amount must not be negative")
+	}
+	if redemption.DisplayAmount == 0 {
+		redemption.DisplayCurrency = ""
+		return nil
+	}
+	currency := strings.ToUpper(strings.TrimSpace(redemption.DisplayCurrency))
+	if currency == "" {
+		currency = operation_setting.GetGeneralSetting().QuotaDisplayType
+	}
+	rate, err := operation_setting.GetCurrencyDisplayRate(currency)
+	if err != nil {
+		return err
+	}
+	if common.QuotaPerUnit <= 0 {
+		return errors.New("quota per unit is not configured")
+	}
+	quota := decimal.NewFromFloat(redemption.DisplayAmount).
+		Div(decimal.NewFromFloat(rate)).
+		Mul(decimal.NewFromFloat(common.QuotaPerUnit))
+	quota = operation_setting.RoundQuotaDecimal(quota, 0, operation_setting.GetWalletQuotaRoundingMode())
+	if !quota.IsPositive() {
+		return errors.New("display amount converts to zero quota")
+	}
+	redemption.Quota = int(quota.IntPart())
+	redemption.DisplayCurrency = currency
+	return nil
+}
+
 func (redemption *Redemption) Insert() error {
-	var err error
-	err = DB.Create(redemption).Error
-	return err
+	if err := redemption.ApplyDisplayAmount(); err != nil {
+		return err
+	}
+	if redemption.Key == "" {
+		keyFormat := redemptionKeyFormatFromSetting("")
+		if err := keyFormat.Validate(); err != nil {
+			return err
+		}
+		redemption.Key = keyFormat.NormalizeKey(GenerateRedemptionKey(keyFormat))
+	}
+	return DB.Create(redemption).Error
+}
+
+// ensureRedemptionKeyUniqueIndex 维护兑换码 key 的唯一索引，使其仅约束未删除记录，可重复执行：
+//   - PostgreSQL / SQLite：创建部分唯一索引 idx_redemptions_key_active（WHERE deleted_at IS NULL）
+//   - MySQL：不支持部分索引，增加生成列 key_active = IF(deleted_at IS NULL, key, NULL)，
+//     并在其上创建唯一索引 idx_redemptions_key_active（NULL 不参与唯一约束）
+//
+// 新索引创建成功后删除旧版本的全局唯一索引 idx_redemptions_key，已删除的兑换码及其使用记录均保留。
+// 迁移说明见 docs/redemption-key-index.md
+func ensureRedemptionKeyUniqueIndex() error {
+	const legacyIndex = "idx_redemptions_key"
+	const activeIndex = "idx_redemptions_key_active"
+	migrator := DB.Migrator()
+	if common.UsingMySQL {
+		if !migrator.HasColumn(&Redemption{}, "key_active") {
+			err := DB.Exec("ALTER TABLE redemptions ADD COLUMN key_active varchar(32) " +
+				"GENERATED ALWAYS AS (IF(deleted_at IS NULL, `key`, NULL)) STORED").Error
+			if err != nil {
+				return err
+			}
+		}
+		if !migrator.HasIndex(&Redemption{}, activeIndex) {
+			if err := DB.Exec("CREATE UNIQUE INDEX " + activeIndex + " ON redemptions (key_active)").Error; err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + activeIndex + " ON redemptions (" + redemptionKeyColumn() + ") WHERE deleted_at IS NULL").Error; err != nil {
+			return err
+		}
+	}
+	if migrator.HasIndex(&Redemption{}, legacyIndex) {
+		if err := migrator.DropIndex(&Redemption{}, legacyIndex); err != nil {
+			return err
+		}
+		common.SysLog("migrated redemptions.key unique index to exclude soft-deleted rows")
+	}
+	return nil
 }
 
 func (redemption *Redemption) SelectUpdate() error {
@@ -244,11 +703,38 @@ func (redemption *Redemption) SelectUpdate() error {
 	return DB.Model(redemption).Select("redeemed_time", "status").Updates(redemption).Error
 }
 
+// reconcileDisplayAmount 按数据库中的原值协调额度与展示金额：展示金额或货币变化时按当前汇率重新换算；
+// 展示金额未变时保留原换算结果；直接修改额度时清除展示金额，避免审计信息与额度不一致
+func (redemption *Redemption) reconcileDisplayAmount(stored *Redemption) error {
+	if redemption.DisplayAmount > 0 {
+		displayChanged := redemption.DisplayAmount != stored.DisplayAmount ||
+			!strings.EqualFold(strings.TrimSpace(redemption.DisplayCurrency), stored.DisplayCurrency)
+		if displayChanged {
+			return redemption.ApplyDisplayAmount()
+		}
+		if redemption.Quota == stored.Quota {
+			redemption.DisplayCurrency = stored.DisplayCurrency
+			return nil
+		}
+	}
+	if redemption.DisplayAmount < 0 {
+		return errors.New("display amount must not be negative")
+	}
+	redemption.DisplayAmount = 0
+	redemption.DisplayCurrency = ""
+	return nil
+}
+
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
-	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "max_uses", "redeemed_time", "expired_time").Updates(redemption).Error
-	return err
+	stored := &Redemption{}
+	if err := DB.Select("id", "quota", "display_amount", "display_currency").First(stored, "id = ?", redemption.Id).Error; err != nil {
+		return err
+	}
+	if err := redemption.reconcileDisplayAmount(stored); err != nil {
+		return err
+	}
+	return DB.Model(redemption).Select("name", "status", "quota", "max_uses", "redeemed_time", "expired_time", "plan_id", "display_amount", "display_currency").Updates(redemption).Error
 }
 
 func (redemption *Redemption) Delete() error {
@@ -294,6 +780,46 @@ func BatchDeleteRedemptions(ids []int) (int64, error) {
 	return rowsAffected, nil
 }
 
+// PurgeInvalidRedemptions 供后台清理任务使用：按 id 分批物理删除已使用、已禁用或已过期的兑换码
+// （包括此前已软删除的）及其使用记录，每批在一个事务内先删使用记录再删兑换码。
+// 返回删除的兑换码数与使用记录数
+func PurgeInvalidRedemptions(ctx context.Context, limit int) (redemptions int64, usages int64, err error) {
+	now := common.GetTimestamp()
+	for {
+		if err = ctx.Err(); err != nil {
+			return redemptions, usages, err
+		}
+		var ids []int
+		if err = DB.Unscoped().Model(&Redemption{}).
+			Where("status IN ? OR (status = ? AND expired_time != 0 AND expired_time < ?)", []int{common.RedemptionCodeStatusUsed, common.RedemptionCodeStatusDisabled}, common.RedemptionCodeStatusEnabled, now).
+			Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return redemptions, usages, err
+		}
+		if len(ids) == 0 {
+			return redemptions, usages, nil
+		}
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			usageResult := tx.Unscoped().Where("redemption_id IN ?", ids).Delete(&RedemptionUsage{})
+			if usageResult.Error != nil {
+				return usageResult.Error
+			}
+			result := tx.Unscoped().Where("id IN ?", ids).Delete(&Redemption{})
+			if result.Error != nil {
+				return result.Error
+			}
+			usages += usageResult.RowsAffected
+			redemptions += result.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return redemptions, usages, err
+		}
+		if len(ids) < limit {
+			return redemptions, usages, nil
+		}
+	}
+}
+
 func DeleteInvalidRedemptions() (int64, error) {
 	now := common.GetTimestamp()
 	var rowsAffected int64
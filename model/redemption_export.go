@@ -0,0 +1,74 @@
+package model
+
+// redemptionUsageExportBatchSize 导出兑换记录时每批读取的行数
+const redemptionUsageExportBatchSize = 1000
+
+// RedemptionUsageExport 兑换记录审计导出行，关联兑换码与用户信息
+type RedemptionUsageExport struct {
+	UsageId        int    `json:"usage_id"`
+	RedemptionId   int    `json:"redemption_id"`
+	RedemptionName string `json:"redemption_name"`
+	Quota          int    `json:"quota"`
+	PlanId         int    `json:"plan_id"`
+	UserId         int    `json:"user_id"`
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	RedeemedTime   int64  `json:"redeemed_time"`
+	// 兑换码已被软删除
+	Deleted bool `json:"deleted"`
+}
+
+// ExportRedemptionUsages 返回时间范围内的全部兑换记录，startTime/endTime 为 0 表示不限制。
+// 大范围导出请使用 StreamRedemptionUsages 分批处理
+func ExportRedemptionUsages(startTime, endTime int64) ([]RedemptionUsageExport, error) {
+	rows := make([]RedemptionUsageExport, 0)
+	err := StreamRedemptionUsages(startTime, endTime, redemptionUsageExportBatchSize, func(batch []RedemptionUsageExport) error {
+		rows = append(rows, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// StreamRedemptionUsages 按使用记录 id 升序分批读取时间范围内的兑换记录并交给 fn 处理，fn 返回错误时停止。
+// 审计需要完整历史，因此包含兑换码已软删除的记录，并通过 Deleted 标记
+func StreamRedemptionUsages(startTime, endTime int64, batchSize int, fn func(batch []RedemptionUsageExport) error) error {
+	if batchSize <= 0 {
+		batchSize = redemptionUsageExportBatchSize
+	}
+	lastId := 0
+	for {
+		query := DB.Table("redemption_usages").
+			Select("redemption_usages.id AS usage_id, redemption_usages.redemption_id, "+
+				"COALESCE(redemptions.name, '') AS redemption_name, COALESCE(redemptions.quota, 0) AS quota, "+
+				"COALESCE(redemptions.plan_id, 0) AS plan_id, redemption_usages.user_id, "+
+				"COALESCE(users.username, '') AS username, COALESCE(users.email, '') AS email, "+
+				"redemption_usages.redeemed_time, "+
+				"CASE WHEN redemptions.deleted_at IS NOT NULL THEN 1 ELSE 0 END AS deleted").
+			Joins("LEFT JOIN redemptions ON redemptions.id = redemption_usages.redemption_id").
+			Joins("LEFT JOIN users ON users.id = redemption_usages.user_id").
+			Where("redemption_usages.id > ?", lastId)
+		if startTime > 0 {
+			query = query.Where("redemption_usages.redeemed_time >= ?", startTime)
+		}
+		if endTime > 0 {
+			query = query.Where("redemption_usages.redeemed_time <= ?", endTime)
+		}
+		var batch []RedemptionUsageExport
+		if err := query.Order("redemption_usages.id").Limit(batchSize).Scan(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastId = batch[len(batch)-1].UsageId
+	}
+}
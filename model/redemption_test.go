@@ -0,0 +1,520 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertRedemptionForTest(t *testing.T, key string, quota int, planId int) *Redemption {
+	t.Helper()
+	redemption := &Redemption{
+		Name:        "test",
+		Key:         key,
+		Status:      common.RedemptionCodeStatusEnabled,
+		Quota:       quota,
+		MaxUses:     1,
+		CreatedTime: common.GetTimestamp(),
+		PlanId:      planId,
+	}
+	require.NoError(t, redemption.Insert())
+	return redemption
+}
+
+func TestRedeem_DisabledPlanRejectedAndCodeNotConsumed(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 302, 0)
+	plan := insertSubscriptionPlanForPaymentGuardTest(t, 3021)
+	require.NoError(t, DB.Model(plan).Update("enabled", false).Error)
+	redemption := insertRedemptionForTest(t, "plan-redemption-key-302", 100, plan.Id)
+
+	_, err := Redeem("plan-redemption-key-302", 302)
+	require.Error(t, err)
+	assert.Equal(t, i18n.MsgRedemptionPlanUnavailable, err.Error())
+
+	reloaded, err := GetRedemptionById(redemption.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reloaded.UsedCount)
+	var user User
+	require.NoError(t, DB.First(&user, 302).Error)
+	assert.Equal(t, 0, user.Quota)
+}
+
+func TestRedeem_WithPlanActivatesSubscription(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 304, 10)
+	plan := insertSubscriptionPlanForPaymentGuardTest(t, 3041)
+	redemption := insertRedemptionForTest(t, "plan-redemption-key-304", 200, plan.Id)
+
+	quota, err := Redeem("plan-redemption-key-304", 304)
+	require.NoError(t, err)
+	assert.Equal(t, 200, quota)
+
+	var user User
+	require.NoError(t, DB.First(&user, 304).Error)
+	assert.Equal(t, 210, user.Quota)
+	var subs []UserSubscription
+	require.NoError(t, DB.Where("user_id = ?", 304).Find(&subs).Error)
+	require.Len(t, subs, 1)
+	assert.Equal(t, plan.Id, subs[0].PlanId)
+	assert.Equal(t, "redemption", subs[0].Source)
+	assert.Equal(t, "active", subs[0].Status)
+	assert.Equal(t, int64(1000), subs[0].AmountTotal)
+
+	reloaded, err := GetRedemptionById(redemption.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reloaded.UsedCount)
+	assert.Equal(t, common.RedemptionCodeStatusUsed, reloaded.Status)
+}
+
+func TestRedeem_WithoutPlanAddsQuotaOnly(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 303, 10)
+	insertRedemptionForTest(t, "quota-redemption-key-303", 500, 0)
+
+	quota, err := Redeem("quota-redemption-key-303", 303)
+	require.NoError(t, err)
+	assert.Equal(t, 500, quota)
+
+	var user User
+	require.NoError(t, DB.First(&user, 303).Error)
+	assert.Equal(t, 510, user.Quota)
+	var count int64
+	require.NoError(t, DB.Model(&UserSubscription{}).Where("user_id = ?", 303).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestBatchCreateRedemptions_PrefixAndUniqueness(t *testing.T) {
+	truncateTables(t)
+	template := Redemption{UserId: 1, Name: "spring", Quota: 300, MaxUses: 2, ExpiredTime: 0}
+
+	created, err := BatchCreateRedemptions(template, 200, "SPRING24")
+	require.NoError(t, err)
+	require.Len(t, created, 200)
+
+	seen := make(map[string]struct{}, len(created))
+	for _, r := range created {
+		assert.Len(t, r.Key, redemptionKeyLength)
+		assert.True(t, strings.HasPrefix(r.Key, "SPRING24"))
+		assert.Equal(t, 300, r.Quota)
+		assert.Equal(t, 2, r.MaxUses)
+		assert.Equal(t, 2, r.RemainingUses)
+		assert.NotZero(t, r.Id)
+		seen[r.Key] = struct{}{}
+	}
+	assert.Len(t, seen, 200)
+
+	var count int64
+	require.NoError(t, DB.Model(&Redemption{}).Where("name = ?", "spring").Count(&count).Error)
+	assert.Equal(t, int64(200), count)
+}
+
+func TestBatchCreateRedemptions_InvalidInput(t *testing.T) {
+	_, err := BatchCreateRedemptions(Redemption{Name: "x"}, 0, "")
+	assert.Error(t, err)
+	_, err = BatchCreateRedemptions(Redemption{Name: "x"}, 1, strings.Repeat("p", RedemptionKeyMaxPrefixLength+1))
+	assert.Error(t, err)
+}
+
+func TestRedeem_VelocityLimitUsesRecentUsages(t *testing.T) {
+	truncateTables(t)
+	setting := operation_setting.GetRedemptionSetting()
+	oldLimit := setting.MaxRedemptionsPerHour
+	setting.MaxRedemptionsPerHour = 1
+	t.Cleanup(func() { setting.MaxRedemptionsPerHour = oldLimit })
+
+	insertUserForPaymentGuardTest(t, 305, 0)
+	used := insertRedemptionForTest(t, "velocity-redemption-used-305", 100, 0)
+	redemption := insertRedemptionForTest(t, "velocity-redemption-key-305", 100, 0)
+	require.NoError(t, DB.Create(&RedemptionUsage{
+		RedemptionId: used.Id,
+		UserId:       305,
+		RedeemedTime: common.GetTimestamp() - 60,
+	}).Error)
+
+	_, err := Redeem("velocity-redemption-key-305", 305)
+	require.Error(t, err)
+	assert.Equal(t, i18n.MsgRedemptionVelocityExceeded, err.Error())
+
+	reloaded, err := GetRedemptionById(redemption.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reloaded.UsedCount)
+
+	// 兑换记录被软删除后仍计入频率限制
+	require.NoError(t, DB.Where("user_id = ?", 305).Delete(&RedemptionUsage{}).Error)
+	_, err = Redeem("velocity-redemption-key-305", 305)
+	require.Error(t, err)
+	assert.Equal(t, i18n.MsgRedemptionVelocityExceeded, err.Error())
+
+	// 超出滚动窗口的兑换记录不再计数
+	require.NoError(t, DB.Unscoped().Model(&RedemptionUsage{}).Where("user_id = ?", 305).Update("redeemed_time", common.GetTimestamp()-redemptionVelocityWindowSeconds-1).Error)
+	quota, err := Redeem("velocity-redemption-key-305", 305)
+	require.NoError(t, err)
+	assert.Equal(t, 100, quota)
+}
+
+func TestGetRedemptionUsageCounts(t *testing.T) {
+	truncateTables(t)
+	first := insertRedemptionForTest(t, "usage-count-key-1", 100, 0)
+	second := insertRedemptionForTest(t, "usage-count-key-2", 100, 0)
+	now := common.GetTimestamp()
+	require.NoError(t, DB.Create(&[]RedemptionUsage{
+		{RedemptionId: first.Id, UserId: 401, RedeemedTime: now},
+		{RedemptionId: first.Id, UserId: 402, RedeemedTime: now},
+		{RedemptionId: first.Id, UserId: 403, RedeemedTime: now},
+	}).Error)
+	// 软删除的使用记录不计入
+	require.NoError(t, DB.Where("redemption_id = ? AND user_id = ?", first.Id, 403).Delete(&RedemptionUsage{}).Error)
+
+	counts, err := GetRedemptionUsageCounts([]int{first.Id, second.Id})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{first.Id: 2, second.Id: 0}, counts)
+
+	counts, err = GetRedemptionUsageCounts(nil)
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestRedemptionKeyReusableAfterSoftDelete(t *testing.T) {
+	truncateTables(t)
+	// 模拟旧版本的全局唯一索引，迁移后应替换为仅约束未删除记录的部分索引
+	require.NoError(t, DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_redemptions_key ON redemptions (`key`)").Error)
+	require.NoError(t, ensureRedemptionKeyUniqueIndex())
+	require.NoError(t, ensureRedemptionKeyUniqueIndex())
+	assert.False(t, DB.Migrator().HasIndex(&Redemption{}, "idx_redemptions_key"))
+	assert.True(t, DB.Migrator().HasIndex(&Redemption{}, "idx_redemptions_key_active"))
+
+	first := insertRedemptionForTest(t, "reusable-redemption-key", 100, 0)
+	duplicate := &Redemption{Name: "dup", Key: "reusable-redemption-key", Status: common.RedemptionCodeStatusEnabled}
+	require.Error(t, duplicate.Insert())
+
+	require.NoError(t, DeleteRedemptionById(first.Id))
+	second := insertRedemptionForTest(t, "reusable-redemption-key", 200, 0)
+	assert.NotEqual(t, first.Id, second.Id)
+	var total int64
+	require.NoError(t, DB.Unscoped().Model(&Redemption{}).Where("`key` = ?", "reusable-redemption-key").Count(&total).Error)
+	assert.Equal(t, int64(2), total)
+
+	// 再次删除并复用时，已删除的旧记录均保留
+	require.NoError(t, DeleteRedemptionById(second.Id))
+	third := insertRedemptionForTest(t, "reusable-redemption-key", 300, 0)
+	require.NoError(t, DB.Unscoped().Model(&Redemption{}).Where("`key` = ?", "reusable-redemption-key").Count(&total).Error)
+	assert.Equal(t, int64(3), total)
+	reloaded, err := GetRedemptionById(third.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 300, reloaded.Quota)
+}
+
+func TestStreamRedemptionUsages(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 501, 0)
+	require.NoError(t, DB.Create(&User{Id: 502, Username: "export_user", Email: "export@example.com", AffCode: "export-502", Status: common.UserStatusEnabled}).Error)
+	redemption := insertRedemptionForTest(t, "export-redemption-key", 100, 0)
+	require.NoError(t, DB.Create(&[]RedemptionUsage{
+		{RedemptionId: redemption.Id, UserId: 501, RedeemedTime: 1000},
+		{RedemptionId: redemption.Id, UserId: 502, RedeemedTime: 2000},
+		{RedemptionId: redemption.Id + 1000, UserId: 503, RedeemedTime: 3000},
+	}).Error)
+	deleted := insertRedemptionForTest(t, "export-deleted-key", 200, 0)
+	require.NoError(t, DB.Create(&RedemptionUsage{RedemptionId: deleted.Id, UserId: 501, RedeemedTime: 4000}).Error)
+	require.NoError(t, DB.Delete(deleted).Error)
+
+	var batches int
+	var rows []RedemptionUsageExport
+	require.NoError(t, StreamRedemptionUsages(0, 0, 2, func(batch []RedemptionUsageExport) error {
+		batches++
+		rows = append(rows, batch...)
+		return nil
+	}))
+	assert.Equal(t, 2, batches)
+	require.Len(t, rows, 4)
+	assert.False(t, rows[0].Deleted)
+	assert.Equal(t, "test", rows[0].RedemptionName)
+	assert.Equal(t, 100, rows[0].Quota)
+	assert.Equal(t, 501, rows[0].UserId)
+	assert.NotEmpty(t, rows[0].Username)
+	// 兑换码或用户不存在时保留记录，关联字段为空
+	assert.Equal(t, "", rows[2].RedemptionName)
+	assert.Equal(t, "", rows[2].Username)
+	assert.False(t, rows[2].Deleted)
+	// 兑换码已软删除时保留记录并标记 deleted
+	assert.Equal(t, 200, rows[3].Quota)
+	assert.True(t, rows[3].Deleted)
+
+	rows, err := ExportRedemptionUsages(1500, 2500)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, 502, rows[0].UserId)
+	assert.Equal(t, "export_user", rows[0].Username)
+	assert.Equal(t, "export@example.com", rows[0].Email)
+	assert.Equal(t, int64(2000), rows[0].RedeemedTime)
+}
+
+func TestRedemptionApplyDisplayAmount(t *testing.T) {
+	truncateTables(t)
+	generalSetting := operation_setting.GetGeneralSetting()
+	originalDisplay, originalCustomRate := generalSetting.QuotaDisplayType, generalSetting.CustomCurrencyExchangeRate
+	originalUSDRate, originalQuotaPerUnit := operation_setting.USDExchangeRate, common.QuotaPerUnit
+	t.Cleanup(func() {
+		generalSetting.QuotaDisplayType, generalSetting.CustomCurrencyExchangeRate = originalDisplay, originalCustomRate
+		operation_setting.USDExchangeRate, common.QuotaPerUnit = originalUSDRate, originalQuotaPerUnit
+	})
+	generalSetting.QuotaDisplayType = operation_setting.QuotaDisplayTypeCNY
+	operation_setting.USDExchangeRate = 7
+	common.QuotaPerUnit = 500000
+
+	// 未指定货币时使用当前展示类型：70 CNY = 10 USD
+	redemption := &Redemption{Name: "cny", Key: "display-amount-key-1", DisplayAmount: 70, Quota: 1}
+	require.NoError(t, redemption.Insert())
+	reloaded, err := GetRedemptionById(redemption.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 5000000, reloaded.Quota)
+	assert.Equal(t, float64(70), reloaded.DisplayAmount)
+	assert.Equal(t, operation_setting.QuotaDisplayTypeCNY, reloaded.DisplayCurrency)
+
+	usd := &Redemption{DisplayAmount: 2.5, DisplayCurrency: "usd"}
+	require.NoError(t, usd.ApplyDisplayAmount())
+	assert.Equal(t, 1250000, usd.Quota)
+	assert.Equal(t, operation_setting.QuotaDisplayTypeUSD, usd.DisplayCurrency)
+
+	// 汇率未配置、货币无法换算或换算结果为 0 时拒绝
+	generalSetting.CustomCurrencyExchangeRate = 0
+	require.Error(t, (&Redemption{DisplayAmount: 1, DisplayCurrency: operation_setting.QuotaDisplayTypeCustom}).ApplyDisplayAmount())
+	require.Error(t, (&Redemption{DisplayAmount: 1, DisplayCurrency: operation_setting.QuotaDisplayTypeTokens}).ApplyDisplayAmount())
+	require.Error(t, (&Redemption{DisplayAmount: 0.0000001, DisplayCurrency: "USD"}).ApplyDisplayAmount())
+	require.Error(t, (&Redemption{DisplayAmount: -1}).ApplyDisplayAmount())
+
+	plain := &Redemption{Quota: 100, DisplayCurrency: "USD"}
+	require.NoError(t, plain.ApplyDisplayAmount())
+	assert.Equal(t, 100, plain.Quota)
+	assert.Empty(t, plain.DisplayCurrency)
+
+	// 批量创建时的换算错误可与数据库错误区分
+	_, err = BatchCreateRedemptions(Redemption{Name: "invalid", DisplayAmount: -1}, 1, "")
+	require.ErrorIs(t, err, ErrRedemptionInvalidDisplayAmount)
+}
+
+func TestRedemptionUpdate_ReconcilesDisplayAmount(t *testing.T) {
+	truncateTables(t)
+	generalSetting := operation_setting.GetGeneralSetting()
+	originalDisplay := generalSetting.QuotaDisplayType
+	originalUSDRate, originalQuotaPerUnit := operation_setting.USDExchangeRate, common.QuotaPerUnit
+	t.Cleanup(func() {
+		generalSetting.QuotaDisplayType = originalDisplay
+		operation_setting.USDExchangeRate, common.QuotaPerUnit = originalUSDRate, originalQuotaPerUnit
+	})
+	generalSetting.QuotaDisplayType = operation_setting.QuotaDisplayTypeCNY
+	operation_setting.USDExchangeRate = 7
+	common.QuotaPerUnit = 500000
+
+	redemption := &Redemption{Name: "update", Key: "display-update-key", DisplayAmount: 70, MaxUses: 1}
+	require.NoError(t, redemption.Insert())
+	reload := func() *Redemption {
+		reloaded, err := GetRedemptionById(redemption.Id)
+		require.NoError(t, err)
+		return reloaded
+	}
+
+	// 展示金额变化时按汇率重新换算额度，忽略传入的额度
+	update := reload()
+	update.DisplayAmount = 140
+	update.Quota = 1
+	require.NoError(t, update.Update())
+	assert.Equal(t, 10000000, reload().Quota)
+	assert.Equal(t, float64(140), reload().DisplayAmount)
+
+	// 展示金额与额度均未变时保留原换算结果
+	update = reload()
+	update.DisplayCurrency = "cny"
+	update.Name = "renamed"
+	require.NoError(t, update.Update())
+	assert.Equal(t, 10000000, reload().Quota)
+	assert.Equal(t, operation_setting.QuotaDisplayTypeCNY, reload().DisplayCurrency)
+
+	// 直接修改额度时清除展示金额
+	update = reload()
+	update.Quota = 300
+	require.NoError(t, update.Update())
+	reloaded := reload()
+	assert.Equal(t, 300, reloaded.Quota)
+	assert.Zero(t, reloaded.DisplayAmount)
+	assert.Empty(t, reloaded.DisplayCurrency)
+
+	update = reload()
+	update.DisplayAmount = -1
+	require.Error(t, update.Update())
+}
+
+func TestGenerateRedemptionKey_CharsetAndGrouping(t *testing.T) {
+	opts := KeyFormatOptions{Prefix: "VIP-", Charset: RedemptionKeyCharsetHumanFriendly, GroupSize: 4}
+	require.NoError(t, opts.Validate())
+
+	const total = 5000
+	seen := make(map[string]struct{}, total)
+	counts := make(map[rune]int)
+	chars := 0
+	for i := 0; i < total; i++ {
+		key := GenerateRedemptionKey(opts)
+		require.LessOrEqual(t, len(key), redemptionKeyLength)
+		require.True(t, strings.HasPrefix(key, "VIP-"))
+		groups := strings.Split(strings.TrimPrefix(key, "VIP-"), "-")
+		for j, group := range groups {
+			if j < len(groups)-1 {
+				require.Len(t, group, 4, key)
+			}
+			for _, ch := range group {
+				require.True(t, strings.ContainsRune(RedemptionKeyCharsetHumanFriendly, ch), key)
+				counts[ch]++
+				chars++
+			}
+		}
+		seen[key] = struct{}{}
+	}
+	assert.Len(t, seen, total)
+
+	// 每个字符出现频率应接近均匀分布
+	expected := float64(chars) / float64(len(RedemptionKeyCharsetHumanFriendly))
+	assert.Len(t, counts, len(RedemptionKeyCharsetHumanFriendly))
+	for ch, n := range counts {
+		assert.InDelta(t, expected, float64(n), expected*0.15, "char %q", ch)
+	}
+}
+
+func TestGenerateRedemptionKey_DefaultFormat(t *testing.T) {
+	key := GenerateRedemptionKey(KeyFormatOptions{Prefix: "AB"})
+	assert.Len(t, key, redemptionKeyLength)
+	assert.True(t, strings.HasPrefix(key, "AB"))
+
+	key = GenerateRedemptionKey(KeyFormatOptions{Charset: "ABC", Length: 12, GroupSize: 4, Separator: "_"})
+	assert.Len(t, key, 14)
+	assert.Equal(t, 2, strings.Count(key, "_"))
+}
+
+func TestKeyFormatOptionsValidate(t *testing.T) {
+	assert.NoError(t, KeyFormatOptions{}.Validate())
+	assert.NoError(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, Length: 32}.Validate())
+	// 分隔符计入长度：28 个字符按 4 分组需 6 个分隔符，共 34 位
+	assert.Error(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, Length: 28, GroupSize: 4}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: "A"}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: "AAAA"}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: "AB-", GroupSize: 4}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: "AB C"}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, Length: 4}.Validate())
+	assert.Error(t, KeyFormatOptions{Prefix: strings.Repeat("p", 20), Charset: RedemptionKeyCharsetHumanFriendly}.Validate())
+	// 随机部分熵不足 64 位：12 × log2(32) = 60，32 × log2(2) = 32
+	assert.Error(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, Length: 12}.Validate())
+	assert.NoError(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, Length: 13}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: "AB", Length: 32}.Validate())
+	// 分隔符需为不含空格的可打印 ASCII，且不能出现在字符集中
+	assert.Error(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, GroupSize: 4, Separator: " "}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, GroupSize: 4, Separator: "\t"}.Validate())
+	assert.Error(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, GroupSize: 4, Separator: "A"}.Validate())
+	assert.NoError(t, KeyFormatOptions{Charset: RedemptionKeyCharsetHumanFriendly, GroupSize: 4, Separator: "_"}.Validate())
+}
+
+func TestRedemptionKeyTrimmedOnRead(t *testing.T) {
+	truncateTables(t)
+	redemption := insertRedemptionForTest(t, "SHORT-KEY", 100, 0)
+	// 模拟 PostgreSQL char(32) 列为短兑换码补齐的尾部空格
+	require.NoError(t, DB.Model(&Redemption{}).Where("id = ?", redemption.Id).
+		UpdateColumn("key", "SHORT-KEY"+strings.Repeat(" ", 23)).Error)
+
+	reloaded, err := GetRedemptionById(redemption.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "SHORT-KEY", reloaded.Key)
+}
+
+func TestBatchCreateRedemptions_UsesKeyFormatSetting(t *testing.T) {
+	truncateTables(t)
+	setting := operation_setting.GetRedemptionSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.KeyCharset = RedemptionKeyCharsetHumanFriendly
+	setting.KeyLength = 16
+	setting.KeyGroupSize = 4
+	setting.KeySeparator = "-"
+
+	created, err := BatchCreateRedemptions(Redemption{Name: "fmt", Quota: 1, MaxUses: 1}, 20, "")
+	require.NoError(t, err)
+	for _, r := range created {
+		// 存储规范形式，展示时按配置分组
+		assert.Len(t, r.Key, 16)
+		assert.NotContains(t, r.Key, "-")
+		display := FormatRedemptionKey(r.Key, "")
+		assert.Len(t, display, 19)
+		assert.Len(t, strings.Split(display, "-"), 4)
+	}
+	insertUserForPaymentGuardTest(t, 1, 0)
+	quota, err := Redeem(FormatRedemptionKey(created[0].Key, ""), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, quota)
+
+	setting.KeyLength = 30
+	_, err = BatchCreateRedemptions(Redemption{Name: "fmt", Quota: 1, MaxUses: 1}, 1, "")
+	assert.Error(t, err)
+}
+
+func TestRedeem_NormalizesKeyInput(t *testing.T) {
+	truncateTables(t)
+	setting := operation_setting.GetRedemptionSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.KeyCharset = RedemptionKeyCharsetHumanFriendly
+	setting.KeyLength = 16
+	setting.KeyGroupSize = 4
+	setting.KeySeparator = "-"
+
+	created, err := BatchCreateRedemptions(Redemption{Name: "normalize", Quota: 10, MaxUses: 1}, 2, "vip-")
+	require.NoError(t, err)
+	for _, r := range created {
+		assert.True(t, strings.HasPrefix(r.Key, "VIP"), r.Key)
+	}
+	display := FormatRedemptionKey(created[1].Key, "vip-")
+	assert.True(t, strings.HasPrefix(display, "vip-"), display)
+
+	// 小写且未分组的输入
+	insertUserForPaymentGuardTest(t, 501, 0)
+	quota, err := Redeem(strings.ToLower(created[0].Key), 501)
+	require.NoError(t, err)
+	assert.Equal(t, 10, quota)
+
+	// 带分组与首尾空白的展示形式
+	quota, err = Redeem(" "+display+" ", 501)
+	require.NoError(t, err)
+	assert.Equal(t, 10, quota)
+
+	// 按旧格式含分隔符存储的兑换码仍可按原样兑换
+	insertRedemptionForTest(t, "LEGACY-ABCD-EFGH", 20, 0)
+	quota, err = Redeem("LEGACY-ABCD-EFGH", 501)
+	require.NoError(t, err)
+	assert.Equal(t, 20, quota)
+}
+
+func TestPurgeInvalidRedemptions_DeletesInBatches(t *testing.T) {
+	truncateTables(t)
+	now := common.GetTimestamp()
+	for i := 0; i < 5; i++ {
+		r := &Redemption{Key: fmt.Sprintf("purge-used-%d", i), Status: common.RedemptionCodeStatusUsed, CreatedTime: now}
+		require.NoError(t, DB.Create(r).Error)
+		require.NoError(t, DB.Create(&RedemptionUsage{RedemptionId: r.Id, UserId: 1, RedeemedTime: now}).Error)
+	}
+	require.NoError(t, DB.Create(&Redemption{Key: "purge-valid", Status: common.RedemptionCodeStatusEnabled, CreatedTime: now}).Error)
+
+	redemptions, usages, err := PurgeInvalidRedemptions(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), redemptions)
+	assert.Equal(t, int64(5), usages)
+
+	var remaining int64
+	require.NoError(t, DB.Unscoped().Model(&Redemption{}).Count(&remaining).Error)
+	assert.Equal(t, int64(1), remaining)
+	require.NoError(t, DB.Unscoped().Model(&RedemptionUsage{}).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+}
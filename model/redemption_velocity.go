@@ -0,0 +1,66 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/i18n"
+
+	"gorm.io/gorm"
+)
+
+const redemptionVelocityWindowSeconds int64 = 3600
+
+func redemptionVelocityKey(userId int) string {
+	return fmt.Sprintf("redemption_velocity:%d", userId)
+}
+
+// reserveRedemptionVelocity 在 Redis 滑动窗口中为本次兑换预占一个名额。
+// 返回的 entry 用于兑换失败时回滚；useDB 为 true 表示需要改用数据库计数校验。
+func reserveRedemptionVelocity(userId int, limit int) (entry string, useDB bool, err error) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return "", true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), common.RateLimitRedisOpTimeout)
+	defer cancel()
+	entry = common.GetUUID()
+	lim := limiter.New(ctx, common.RDB)
+	allowed, err := lim.SlidingWindowWithEntry(ctx, redemptionVelocityKey(userId), limit, redemptionVelocityWindowSeconds, redemptionVelocityWindowSeconds, limiter.SlidingWindowModeCheckAndRecord, entry)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("redemption velocity check via redis failed, falling back to db: user_id=%d, error=%v", userId, err))
+		return "", true, nil
+	}
+	if !allowed {
+		return "", false, errors.New(i18n.MsgRedemptionVelocityExceeded)
+	}
+	return entry, false, nil
+}
+
+func rollbackRedemptionVelocity(userId int, entry string) {
+	if entry == "" || common.RDB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), common.RateLimitRedisOpTimeout)
+	defer cancel()
+	lim := limiter.New(ctx, common.RDB)
+	if _, err := lim.SlidingWindowWithEntry(ctx, redemptionVelocityKey(userId), 1, 1, redemptionVelocityWindowSeconds, limiter.SlidingWindowModeRollback, entry); err != nil {
+		common.SysLog(fmt.Sprintf("rollback redemption velocity failed: user_id=%d, error=%v", userId, err))
+	}
+}
+
+// checkRedemptionVelocityTx 按 RedemptionUsage.RedeemedTime 统计用户最近一小时的成功兑换次数，软删除的记录同样计入
+func checkRedemptionVelocityTx(tx *gorm.DB, userId int, limit int) error {
+	var count int64
+	since := common.GetTimestamp() - redemptionVelocityWindowSeconds
+	err := tx.Unscoped().Model(&RedemptionUsage{}).Where("user_id = ? AND redeemed_time > ?", userId, since).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return errors.New(i18n.MsgRedemptionVelocityExceeded)
+	}
+	return nil
+}
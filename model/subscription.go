@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/pkg/cachex"
 	"github.com/samber/hot"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -175,6 +176,9 @@ type SubscriptionPlan struct {
 	// Allow paying this plan with wallet balance
 	AllowWalletPay bool `json:"allow_wallet_pay" gorm:"default:true"`
 
+	// Credit unused time of active exclusive plans when upgrading via wallet
+	AllowProration bool `json:"allow_proration" gorm:"default:false"`
+
 	// Upgrade user group after purchase (empty = no change)
 	UpgradeGroup string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
 
@@ -254,6 +258,8 @@ type UserSubscription struct {
 	Status    string `json:"status" gorm:"type:varchar(32);index;index:idx_user_sub_active,priority:2"` // active/expired/cancelled
 
 	Source string `json:"source" gorm:"type:varchar(32);default:'order'"` // order/admin
+	// OrderTradeNo 通过订单购买时对应的订单号，其他来源为空
+	OrderTradeNo string `json:"order_trade_no" gorm:"type:varchar(255);index;default:''"`
 
 	LastResetTime int64 `json:"last_reset_time" gorm:"type:bigint;default:0"`
 	NextResetTime int64 `json:"next_reset_time" gorm:"type:bigint;default:0;index"`
@@ -261,6 +267,14 @@ type UserSubscription struct {
 	UpgradeGroup  string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
 	PrevUserGroup string `json:"prev_user_group" gorm:"type:varchar(64);default:''"`
 
+	// AutoRenew 到期前由后台任务使用钱包余额自动续购同一套餐，续费成功后该标记转移到新订阅
+	AutoRenew bool `json:"auto_renew" gorm:"default:false;index"`
+
+	// PaidQuota 购买该订阅实际支付金额折算的额度，升级折算抵扣以此为上限
+	PaidQuota int64 `json:"paid_quota" gorm:"type:bigint;not null;default:0"`
+	// Prorated 通过折算升级购买的订阅不再参与后续折算，避免反复升级叠加抵扣
+	Prorated bool `json:"prorated" gorm:"default:false"`
+
 	CreatedAt int64 `json:"created_at" gorm:"bigint"`
 	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
 }
@@ -437,11 +451,28 @@ func CountUserSubscriptionsByPlan(userId int, planId int) (int64, error) {
 	return count, nil
 }
 
+// ErrSubscriptionPurchaseLimitReached 用户已达到套餐的单用户购买上限
+var ErrSubscriptionPurchaseLimitReached = errors.New("已达到该套餐购买上限")
+
+// SubscriptionBalanceShortError 余额支付时事务内锁定的用户余额不足，Shortfall 为差额
+type SubscriptionBalanceShortError struct {
+	Shortfall int
+}
+
+func (e *SubscriptionBalanceShortError) Error() string {
+	return "余额不足"
+}
+
 func CheckSubscriptionPurchaseEligibility(userId int, plan *SubscriptionPlan) error {
 	return CheckSubscriptionPurchaseEligibilityTx(nil, userId, plan)
 }
 
 func CheckSubscriptionPurchaseEligibilityTx(tx *gorm.DB, userId int, plan *SubscriptionPlan) error {
+	return checkSubscriptionPurchaseEligibilityTx(tx, userId, plan, nil)
+}
+
+// checkSubscriptionPurchaseEligibilityTx 校验购买资格，replacedIds 中的订阅将在本次购买中被替换，不计入互斥冲突
+func checkSubscriptionPurchaseEligibilityTx(tx *gorm.DB, userId int, plan *SubscriptionPlan, replacedIds []int) error {
 	if userId <= 0 {
 		return errors.New("invalid user id")
 	}
@@ -459,10 +490,10 @@ func CheckSubscriptionPurchaseEligibilityTx(tx *gorm.DB, userId int, plan *Subsc
 			return err
 		}
 		if count >= int64(plan.MaxPurchasePerUser) {
-			return errors.New("已达到该套餐购买上限")
+			return ErrSubscriptionPurchaseLimitReached
 		}
 	}
-	now := GetDBTimestamp()
+	now := getDBTimestampTx(tx)
 	if plan.DisallowStack {
 		var activeCount int64
 		if err := tx.Model(&UserSubscription{}).
@@ -478,7 +509,11 @@ func CheckSubscriptionPurchaseEligibilityTx(tx *gorm.DB, userId int, plan *Subsc
 		return err
 	} else if len(ids) > 0 {
 		var conflict UserSubscription
-		query := tx.Where("user_id = ? AND plan_id IN ? AND status = ? AND end_time > ?", userId, ids, "active", now).
+		query := tx.Where("user_id = ? AND plan_id IN ? AND status = ? AND end_time > ?", userId, ids, "active", now)
+		if len(replacedIds) > 0 {
+			query = query.Where("id NOT IN ?", replacedIds)
+		}
+		query = query.
 			Order("end_time desc, id desc").
 			Limit(1).
 			Find(&conflict)
@@ -554,7 +589,7 @@ func CreateUserSubscriptionFromPlanTx(tx *gorm.DB, userId int, plan *Subscriptio
 	if err := CheckSubscriptionPurchaseEligibilityTx(tx, userId, plan); err != nil {
 		return nil, err
 	}
-	nowUnix := GetDBTimestamp()
+	nowUnix := getDBTimestampTx(tx)
 	now := time.Unix(nowUnix, 0)
 	endUnix, err := calcPlanEndTime(now, plan)
 	if err != nil {
@@ -641,10 +676,17 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string, expectedP
 			// still allow completion for already purchased orders
 		}
 		upgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
-		_, err = CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
+		sub, err := CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
 		if err != nil {
 			return err
 		}
+		paidQuota := decimal.NewFromFloat(order.Money).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).IntPart()
+		if err := tx.Model(sub).Updates(map[string]interface{}{
+			"paid_quota":     paidQuota,
+			"order_trade_no": order.TradeNo,
+		}).Error; err != nil {
+			return err
+		}
 		if err := upsertSubscriptionTopUpTx(tx, &order); err != nil {
 			return err
 		}
@@ -679,7 +721,10 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string, expectedP
 }
 
 // CompleteWalletSubscriptionOrder creates and completes a subscription order paid by wallet balance.
-func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *SubscriptionPlan, paymentMethod string, quotaCost int, providerPayload string) error {
+// proration (optional) lists active subscriptions replaced by this purchase; quotaCost is expected to already include its credit.
+// The credit is recomputed from the locked subscriptions inside the transaction, and the purchase fails if that would
+// cost more than the quoted quotaCost.
+func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *SubscriptionPlan, paymentMethod string, quotaCost int, providerPayload string, proration *SubscriptionProration) error {
 	if strings.TrimSpace(tradeNo) == "" {
 		return errors.New("tradeNo is empty")
 	}
@@ -701,6 +746,7 @@ func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *Subscript
 	var logMoney float64
 	var logPaymentMethod string
 	var upgradeGroup string
+	var downgradeGroup string
 	var shouldSyncQuota bool
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
@@ -708,8 +754,22 @@ func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *Subscript
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", userId).First(&user).Error; err != nil {
 			return err
 		}
+		// 先锁定并终止被替换的订阅，按锁定后的使用情况重新计算抵扣，使新订阅记录的原分组为回退后的分组
+		target, credit, err := replaceProratedSubscriptionsTx(tx, userId, plan, proration)
+		if err != nil {
+			return err
+		}
+		downgradeGroup = target
+		if !proration.IsEmpty() {
+			recomputed, _, _ := CalcSubscriptionWalletQuota(plan, credit)
+			if recomputed > quotaCost {
+				return errors.New("订阅抵扣额度已变化，请重试")
+			}
+			quotaCost = recomputed
+			proration.Credit = credit
+		}
 		if quotaCost > 0 && user.Quota < quotaCost {
-			return errors.New("余额不足")
+			return &SubscriptionBalanceShortError{Shortfall: quotaCost - user.Quota}
 		}
 
 		order := &SubscriptionOrder{
@@ -734,7 +794,15 @@ func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *Subscript
 		}
 
 		upgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
-		if _, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "order"); err != nil {
+		sub, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "order")
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(sub).Updates(map[string]interface{}{
+			"paid_quota":     quotaCost,
+			"prorated":       !proration.IsEmpty(),
+			"order_trade_no": tradeNo,
+		}).Error; err != nil {
 			return err
 		}
 		if err := upsertSubscriptionTopUpTx(tx, order); err != nil {
@@ -762,6 +830,8 @@ func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *Subscript
 
 	if upgradeGroup != "" && logUserId > 0 {
 		_ = UpdateUserGroupCache(logUserId, upgradeGroup)
+	} else if downgradeGroup != "" && logUserId > 0 {
+		_ = UpdateUserGroupCache(logUserId, downgradeGroup)
 	}
 	if shouldSyncQuota && logUserId > 0 {
 		go func() {
@@ -770,6 +840,11 @@ func CompleteWalletSubscriptionOrder(tradeNo string, userId int, plan *Subscript
 	}
 	if logUserId > 0 {
 		msg := fmt.Sprintf("订阅购买成功，套餐: %s，支付金额: %.2f，支付方式: %s", logPlanTitle, logMoney, logPaymentMethod)
+		if audit := formatProrationAudit(proration); audit != "" {
+			msg += audit
+			common.SysLog(fmt.Sprintf("subscription proration applied: trade_no=%s, user_id=%d, plan_id=%d, replaced=%v, credit=%d, quota_cost=%d",
+				tradeNo, logUserId, plan.Id, proration.ReplacedSubscriptionIds, proration.Credit, quotaCost))
+		}
 		RecordLog(logUserId, LogTypeTopup, msg)
 	}
 	return nil
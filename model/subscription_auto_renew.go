@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+// SetUserSubscriptionAutoRenew 开启或关闭用户自己订阅的自动续费，已作废的订阅不可开启
+func SetUserSubscriptionAutoRenew(userId int, subscriptionId int, enabled bool) (*UserSubscription, error) {
+	if userId <= 0 || subscriptionId <= 0 {
+		return nil, errors.New("invalid subscription")
+	}
+	var sub UserSubscription
+	if err := DB.Where("id = ? AND user_id = ?", subscriptionId, userId).First(&sub).Error; err != nil {
+		return nil, err
+	}
+	if enabled && sub.Status == "cancelled" {
+		return nil, errors.New("订阅已作废，无法开启自动续费")
+	}
+	if enabled {
+		plan, err := GetSubscriptionPlanById(sub.PlanId)
+		if err != nil {
+			return nil, err
+		}
+		if !plan.AllowWalletPay {
+			return nil, errors.New("该套餐不支持余额支付，无法开启自动续费")
+		}
+	}
+	if err := DB.Model(&UserSubscription{}).Where("id = ?", sub.Id).
+		Updates(map[string]interface{}{
+			"auto_renew": enabled,
+			"updated_at": common.GetTimestamp(),
+		}).Error; err != nil {
+		return nil, err
+	}
+	sub.AutoRenew = enabled
+	return &sub, nil
+}
+
+// GetAutoRenewDueSubscriptions 查询开启自动续费且即将到期（end_time <= now+lead）或到期不超过 grace 秒的订阅
+func GetAutoRenewDueSubscriptions(now int64, leadSeconds int64, graceSeconds int64, limit int) ([]UserSubscription, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	var subs []UserSubscription
+	err := DB.Where("auto_renew = ? AND status IN ? AND end_time > 0 AND end_time <= ? AND end_time > ?",
+		true, []string{"active", "expired"}, now+leadSeconds, now-graceSeconds).
+		Order("end_time asc, id asc").
+		Limit(limit).
+		Find(&subs).Error
+	return subs, err
+}
+
+// SubscriptionAutoRenewTradeNo 按订阅及其到期时间生成确定性的续费订单号，
+// 同一续费周期内的重复执行会因订单号唯一约束而无法重复扣费
+func SubscriptionAutoRenewTradeNo(sub *UserSubscription) string {
+	return fmt.Sprintf("SUBRENEW%dS%dE%d", sub.UserId, sub.Id, sub.EndTime)
+}
+
+// FinishSubscriptionAutoRenew 续费成功后关闭原订阅的自动续费，并将标记转移到续费订单
+// （SubscriptionAutoRenewTradeNo）生成的订阅，不受用户同期手动购买同一套餐的影响
+func FinishSubscriptionAutoRenew(sub *UserSubscription) error {
+	if sub == nil || sub.Id <= 0 {
+		return errors.New("invalid subscription")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		now := common.GetTimestamp()
+		if err := tx.Model(&UserSubscription{}).Where("id = ?", sub.Id).
+			Updates(map[string]interface{}{"auto_renew": false, "updated_at": now}).Error; err != nil {
+			return err
+		}
+		var renewed UserSubscription
+		err := tx.Where("user_id = ? AND order_trade_no = ?", sub.UserId, SubscriptionAutoRenewTradeNo(sub)).
+			First(&renewed).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&UserSubscription{}).Where("id = ?", renewed.Id).
+			Updates(map[string]interface{}{"auto_renew": true, "updated_at": now}).Error
+	})
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// SubscriptionProration 描述余额升级套餐时被替换的生效订阅及其未使用时长折算的抵扣额度
+type SubscriptionProration struct {
+	ReplacedSubscriptionIds []int
+	Credit                  int
+}
+
+func (p *SubscriptionProration) IsEmpty() bool {
+	return p == nil || len(p.ReplacedSubscriptionIds) == 0
+}
+
+// GetSubscriptionProration 计算购买 plan 时可获得的折算抵扣。
+// 同一系列指 plan 的互斥套餐（ExclusivePlanIds）：用户名下生效中的互斥订阅将被本次购买替换，
+// 其中通过订单购买的订阅按实付额度 × min(剩余时长占比, 剩余额度占比) 折算抵扣，抵扣总额不超过新套餐价格。
+// 本身由折算升级购买的订阅不参与抵扣。plan 未开启 AllowProration 或没有可替换的订阅时返回 nil。
+// 该结果仅用于报价，实际抵扣在购买事务内按锁定后的订阅重新计算。
+func GetSubscriptionProration(userId int, plan *SubscriptionPlan) (*SubscriptionProration, error) {
+	if plan == nil || !plan.AllowProration || userId <= 0 {
+		return nil, nil
+	}
+	ids, err := ParsePlanIDList(plan.ExclusivePlanIds)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	now := GetDBTimestamp()
+	var subs []UserSubscription
+	if err := DB.Where("user_id = ? AND plan_id IN ? AND status = ? AND end_time > ?", userId, ids, "active", now).
+		Order("id asc").
+		Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return nil, nil
+	}
+	proration := &SubscriptionProration{ReplacedSubscriptionIds: make([]int, 0, len(subs))}
+	credit := decimal.Zero
+	for i := range subs {
+		proration.ReplacedSubscriptionIds = append(proration.ReplacedSubscriptionIds, subs[i].Id)
+		credit = credit.Add(subscriptionProrationCredit(&subs[i], now))
+	}
+	proration.Credit = capSubscriptionProrationCredit(plan, credit)
+	return proration, nil
+}
+
+// subscriptionProrationCredit 返回单个订阅可折算的抵扣额度：实付额度 × min(剩余时长占比, 剩余额度占比)。
+// 非订单购买、由折算升级购买或未记录实付额度的订阅不产生抵扣
+func subscriptionProrationCredit(sub *UserSubscription, now int64) decimal.Decimal {
+	if sub.Source != "order" || sub.Prorated || sub.PaidQuota <= 0 || sub.EndTime <= sub.StartTime || sub.EndTime <= now {
+		return decimal.Zero
+	}
+	ratio := decimal.NewFromInt(sub.EndTime - now).Div(decimal.NewFromInt(sub.EndTime - sub.StartTime))
+	if sub.AmountTotal > 0 {
+		quotaRatio := decimal.NewFromInt(sub.AmountTotal - sub.AmountUsed).Div(decimal.NewFromInt(sub.AmountTotal))
+		ratio = decimal.Min(ratio, decimal.Max(quotaRatio, decimal.Zero))
+	}
+	if ratio.GreaterThan(decimal.NewFromInt(1)) {
+		ratio = decimal.NewFromInt(1)
+	}
+	return decimal.NewFromInt(sub.PaidQuota).Mul(ratio)
+}
+
+func capSubscriptionProrationCredit(plan *SubscriptionPlan, credit decimal.Decimal) int {
+	if maxCredit := subscriptionPlanQuota(plan); credit.GreaterThan(maxCredit) {
+		credit = maxCredit
+	}
+	return int(credit.IntPart())
+}
+
+func subscriptionPlanQuota(plan *SubscriptionPlan) decimal.Decimal {
+	return decimal.NewFromFloat(plan.PriceAmount).Mul(decimal.NewFromFloat(common.QuotaPerUnit))
+}
+
+// CheckSubscriptionUpgradeEligibility 与 CheckSubscriptionPurchaseEligibility 相同，但忽略将被 proration 替换的订阅
+func CheckSubscriptionUpgradeEligibility(userId int, plan *SubscriptionPlan, proration *SubscriptionProration) error {
+	if proration.IsEmpty() {
+		return CheckSubscriptionPurchaseEligibility(userId, plan)
+	}
+	return checkSubscriptionPurchaseEligibilityTx(DB, userId, plan, proration.ReplacedSubscriptionIds)
+}
+
+// replaceProratedSubscriptionsTx 在购买事务内锁定并终止被替换的订阅，回退其升级的用户分组，
+// 并按锁定后的订阅重新计算抵扣额度。任一订阅已不再生效时返回错误，避免按过期的抵扣额度扣费。
+// 返回最后一次回退到的分组（可能为空）与重新计算的抵扣额度。
+func replaceProratedSubscriptionsTx(tx *gorm.DB, userId int, plan *SubscriptionPlan, proration *SubscriptionProration) (string, int, error) {
+	if proration.IsEmpty() {
+		return "", 0, nil
+	}
+	now := getDBTimestampTx(tx)
+	downgradeGroup := ""
+	credit := decimal.Zero
+	for _, id := range proration.ReplacedSubscriptionIds {
+		var sub UserSubscription
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ?", id).First(&sub).Error; err != nil {
+			return "", 0, err
+		}
+		if sub.UserId != userId || sub.Status != "active" || sub.EndTime <= now {
+			return "", 0, errors.New("待抵扣的订阅状态已变化，请重试")
+		}
+		credit = credit.Add(subscriptionProrationCredit(&sub, now))
+		if err := tx.Model(&sub).Updates(map[string]interface{}{
+			"status":     "cancelled",
+			"end_time":   now,
+			"updated_at": now,
+		}).Error; err != nil {
+			return "", 0, err
+		}
+		target, err := downgradeUserGroupForSubscriptionTx(tx, &sub, now)
+		if err != nil {
+			return "", 0, err
+		}
+		if target != "" {
+			downgradeGroup = target
+		}
+	}
+	return downgradeGroup, capSubscriptionProrationCredit(plan, credit), nil
+}
+
+// CalcSubscriptionWalletQuota 计算余额支付所需额度及展示金额，credit 为折算抵扣额度
+func CalcSubscriptionWalletQuota(plan *SubscriptionPlan, credit int) (int, float64, float64) {
+	rate := operation_setting.GetQuotaDisplayRate()
+	if rate <= 0 {
+		rate = 1
+	}
+	dRate := decimal.NewFromFloat(rate)
+	dPrice := decimal.NewFromFloat(plan.PriceAmount)
+	dDisplay := dPrice.Mul(dRate)
+
+	usdAmount := dPrice
+	if !dRate.IsZero() {
+		usdAmount = dDisplay.Div(dRate)
+	}
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	quota := usdAmount.Mul(dQuotaPerUnit)
+	if credit > 0 {
+		quota = decimal.Max(quota.Sub(decimal.NewFromInt(int64(credit))), decimal.Zero)
+	}
+	mode := operation_setting.GetWalletQuotaRoundingMode()
+	quota = operation_setting.RoundQuotaDecimal(quota, 0, mode)
+	// 展示金额由实际扣费额度反算，保证与扣费一致
+	if !dQuotaPerUnit.IsZero() {
+		dDisplay = operation_setting.RoundQuotaDecimal(quota.Div(dQuotaPerUnit).Mul(dRate), subscriptionWalletDisplayPlaces, mode)
+	}
+	return int(quota.IntPart()), dDisplay.InexactFloat64(), rate
+}
+
+// subscriptionWalletDisplayPlaces 展示金额保留的小数位数，与 logger.FormatQuota 一致
+const subscriptionWalletDisplayPlaces = 6
+
+func formatProrationAudit(proration *SubscriptionProration) string {
+	if proration.IsEmpty() {
+		return ""
+	}
+	ids := make([]string, 0, len(proration.ReplacedSubscriptionIds))
+	for _, id := range proration.ReplacedSubscriptionIds {
+		ids = append(ids, fmt.Sprintf("%d", id))
+	}
+	return fmt.Sprintf("，替换订阅: %s，折算抵扣: %s", strings.Join(ids, ","), logger.LogQuota(proration.Credit))
+}
@@ -43,6 +43,9 @@ func TestMain(m *testing.M) {
 		&SubscriptionPlan{},
 		&SubscriptionOrder{},
 		&UserSubscription{},
+		&Redemption{},
+		&RedemptionUsage{},
+		&QuotaRefundRecord{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -62,6 +65,9 @@ func truncateTables(t *testing.T) {
 		DB.Exec("DELETE FROM subscription_orders")
 		DB.Exec("DELETE FROM subscription_plans")
 		DB.Exec("DELETE FROM user_subscriptions")
+		DB.Exec("DELETE FROM redemptions")
+		DB.Exec("DELETE FROM redemption_usages")
+		DB.Exec("DELETE FROM quota_refund_records")
 	})
 }
 
@@ -35,6 +35,7 @@ type Token struct {
 	RateLimitSuccessCount   int            `json:"rate_limit_success_count" gorm:"default:1000"`
 	IPRateLimitCount        int            `json:"ip_rate_limit_count" gorm:"default:0"`
 	IPRateLimitSuccessCount int            `json:"ip_rate_limit_success_count" gorm:"default:0"`
+	ModelMapping            string         `json:"model_mapping" gorm:"type:text"` // JSON 对象，渠道选择前将请求模型改写为目标模型
 }
 
 func (token *Token) Clean() {
@@ -301,7 +302,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "rate_limit_enabled", "rate_limit_duration_minutes", "rate_limit_count", "rate_limit_success_count", "ip_rate_limit_count", "ip_rate_limit_success_count", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "rate_limit_enabled", "rate_limit_duration_minutes", "rate_limit_count", "rate_limit_success_count", "ip_rate_limit_count", "ip_rate_limit_success_count", "model_mapping", "group", "cross_group_retry").Updates(token).Error
 	return err
 }
 
@@ -355,6 +356,18 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+// GetModelMappingMap 解析令牌级模型映射，未配置或格式错误时返回 nil
+func (token *Token) GetModelMappingMap() map[string]string {
+	if strings.TrimSpace(token.ModelMapping) == "" {
+		return nil
+	}
+	var mapping map[string]string
+	if err := common.UnmarshalJsonStr(token.ModelMapping, &mapping); err != nil || len(mapping) == 0 {
+		return nil
+	}
+	return mapping
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 
@@ -880,11 +881,19 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
+// IncreaseUserQuota 增加用户额度，db=true 表示需立即落库（充值、兑换等），否则在启用批量更新时延迟写库。
+// 开启 QUOTA_WRITE_THROUGH 后 db=true 的调用会同步写库并同步更新缓存
 func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	if db && constant.QuotaWriteThroughEnabled {
+		return cacheIncrUserQuotaWriteThrough(id, int64(quota))
+	}
+	// 缓存更新与写库（或加入批量更新）并发进行，两者都完成前校正会跳过该用户
+	done := beginUserQuotaMutation(id, 2)
 	gopool.Go(func() {
+		defer done()
 		err := cacheIncrUserQuota(id, int64(quota))
 		if err != nil {
 			common.SysLog("failed to increase user quota: " + err.Error())
@@ -892,8 +901,10 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 	})
 	if !db && common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
+		done()
 		return nil
 	}
+	defer done()
 	return increaseUserQuota(id, quota)
 }
 
@@ -905,11 +916,18 @@ func increaseUserQuota(id int, quota int) (err error) {
 	return err
 }
 
+// DecreaseUserQuota 扣减用户额度，db 参数含义同 IncreaseUserQuota
 func DecreaseUserQuota(id int, quota int, db bool) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	if db && constant.QuotaWriteThroughEnabled {
+		return cacheIncrUserQuotaWriteThrough(id, -int64(quota))
+	}
+	// 缓存更新与写库（或加入批量更新）并发进行，两者都完成前校正会跳过该用户
+	done := beginUserQuotaMutation(id, 2)
 	gopool.Go(func() {
+		defer done()
 		err := cacheDecrUserQuota(id, int64(quota))
 		if err != nil {
 			common.SysLog("failed to decrease user quota: " + err.Error())
@@ -917,8 +935,10 @@ func DecreaseUserQuota(id int, quota int, db bool) (err error) {
 	})
 	if !db && common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+		done()
 		return nil
 	}
+	defer done()
 	return decreaseUserQuota(id, quota)
 }
 
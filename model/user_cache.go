@@ -1,8 +1,10 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -12,6 +14,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
 )
 
 // UserBase struct remains the same as it represents the cached data structure
@@ -30,28 +33,88 @@ type userBaseLocalCacheEntry struct {
 	ExpireAtUnixNano int64
 }
 
-const userBaseLocalLockShardCount = 256
+const (
+	defaultUserBaseLocalLockShardCount = 256
+	maxUserBaseLocalLockShardCount     = 1 << 16
+)
 
 var (
-	userBaseLocalCache                sync.Map // map[int]userBaseLocalCacheEntry
-	userBaseLocalCacheTTL             = time.Duration(common.GetEnvOrDefault("USER_BASE_LOCAL_CACHE_TTL_SECONDS", 5)) * time.Second
-	userBaseLocalCacheCleanupInterval = time.Duration(common.GetEnvOrDefault("USER_BASE_LOCAL_CACHE_CLEANUP_SECONDS", 60)) * time.Second
-	userBaseLocalLocks                [userBaseLocalLockShardCount]sync.Mutex
-	userBaseLocalJanitorStartOnce     sync.Once
-	userBaseLocalJanitorStopOnce      sync.Once
-	userBaseLocalJanitorStopCh        = make(chan struct{})
+	// userBaseLocalCache 用户信息本地缓存，容量与默认 TTL 由 USER_BASE_LOCAL_CACHE_MAX_ENTRIES / USER_BASE_LOCAL_CACHE_TTL_SECONDS 配置，满时按 LRU 淘汰
+	userBaseLocalCache                = common.NewTTLCacheFromEnv[int, userBaseLocalCacheEntry]("user_base_local", 100000, 5*time.Second)
+	userBaseLocalCacheTTL             atomic.Int64
+	userBaseLocalCacheCleanupInterval atomic.Int64
+	// userBaseLocalLocks 按用户 ID 分片的写锁，分片数为 2 的幂，使用 userBaseLocalLockMask 掩码取分片
+	userBaseLocalLocks    []sync.Mutex
+	userBaseLocalLockMask uint
+	// 清理协程支持停止后重新启动：每次启动创建新的 stop/done 通道，由 userBaseLocalJanitorMu 保护
+	userBaseLocalJanitorMu      sync.Mutex
+	userBaseLocalJanitorRunning atomic.Bool
+	userBaseLocalJanitorStopCh  chan struct{}
+	userBaseLocalJanitorDoneCh  chan struct{}
 )
 
+// userBaseNegativeCache 记录数据库中不存在的用户 ID，窗口期内直接返回未找到，避免对已删除/无效 ID 的请求反复查库。
+// 与 UserBase 缓存分开存放，TTL 可通过 USER_BASE_NEGATIVE_CACHE_TTL_SECONDS 单独配置；创建用户时清除对应条目
+var userBaseNegativeCache = common.NewTTLCacheFromEnv[int, struct{}]("user_base_negative", 10000, 2*time.Second)
+
 func init() {
-	if userBaseLocalCacheTTL <= 0 {
-		userBaseLocalCacheTTL = 5 * time.Second
+	ttl := userBaseLocalCache.TTL()
+	interval := time.Duration(common.GetEnvOrDefault("USER_BASE_LOCAL_CACHE_CLEANUP_SECONDS", 60)) * time.Second
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+	userBaseLocalCacheTTL.Store(int64(ttl))
+	userBaseLocalCacheCleanupInterval.Store(int64(interval))
+	initUserBaseLocalLocks(common.GetEnvOrDefault("USER_BASE_LOCAL_LOCK_SHARDS", defaultUserBaseLocalLockShardCount))
+}
+
+// normalizeUserBaseLocalLockShardCount 将分片数规整为 [1, 65536] 内不小于 n 的 2 的幂，非正数使用默认值
+func normalizeUserBaseLocalLockShardCount(n int) int {
+	if n <= 0 {
+		return defaultUserBaseLocalLockShardCount
+	}
+	if n > maxUserBaseLocalLockShardCount {
+		return maxUserBaseLocalLockShardCount
+	}
+	count := 1
+	for count < n {
+		count <<= 1
+	}
+	return count
+}
+
+// initUserBaseLocalLocks 初始化分片锁，只能在没有并发访问时调用（init 或测试）
+func initUserBaseLocalLocks(n int) {
+	count := normalizeUserBaseLocalLockShardCount(n)
+	userBaseLocalLocks = make([]sync.Mutex, count)
+	userBaseLocalLockMask = uint(count - 1)
+}
+
+// SetUserBaseLocalCacheTTL 运行时调整用户本地缓存的过期时间，仅影响之后写入的条目
+func SetUserBaseLocalCacheTTL(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("user base local cache ttl must be positive, got %s", d)
 	}
-	if userBaseLocalCacheCleanupInterval <= 0 {
-		userBaseLocalCacheCleanupInterval = 60 * time.Second
+	userBaseLocalCacheTTL.Store(int64(d))
+	return nil
+}
+
+// SetUserBaseLocalCacheCleanupInterval 运行时调整过期条目的清理间隔，清理协程在下一次触发后切换到新间隔
+func SetUserBaseLocalCacheCleanupInterval(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("user base local cache cleanup interval must be positive, got %s", d)
 	}
-	if userBaseLocalCacheCleanupInterval > userBaseLocalCacheTTL {
-		userBaseLocalCacheCleanupInterval = userBaseLocalCacheTTL
+	userBaseLocalCacheCleanupInterval.Store(int64(d))
+	return nil
+}
+
+// getUserBaseLocalCacheCleanupInterval 返回实际清理间隔，不超过 TTL，避免过期条目长时间滞留
+func getUserBaseLocalCacheCleanupInterval() time.Duration {
+	interval := time.Duration(userBaseLocalCacheCleanupInterval.Load())
+	if ttl := time.Duration(userBaseLocalCacheTTL.Load()); interval > ttl {
+		return ttl
 	}
+	return interval
 }
 
 func ensureUserBaseLocalCacheJanitor() {
@@ -62,44 +125,73 @@ func ensureUserBaseLocalCacheJanitor() {
 }
 
 func startUserBaseLocalCacheJanitor() {
-	userBaseLocalJanitorStartOnce.Do(func() {
-		ticker := time.NewTicker(userBaseLocalCacheCleanupInterval)
-		go func() {
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					cleanupExpiredUserBaseLocalCache(time.Now().UnixNano())
-				case <-userBaseLocalJanitorStopCh:
-					return
+	if userBaseLocalJanitorRunning.Load() {
+		return
+	}
+	userBaseLocalJanitorMu.Lock()
+	defer userBaseLocalJanitorMu.Unlock()
+	if userBaseLocalJanitorRunning.Load() {
+		return
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	userBaseLocalJanitorStopCh = stopCh
+	userBaseLocalJanitorDoneCh = doneCh
+	userBaseLocalJanitorRunning.Store(true)
+
+	interval := getUserBaseLocalCacheCleanupInterval()
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(doneCh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				userBaseLocalCache.CleanupExpired()
+				if next := getUserBaseLocalCacheCleanupInterval(); next != interval {
+					interval = next
+					ticker.Reset(interval)
 				}
+			case <-stopCh:
+				return
 			}
-		}()
-	})
+		}
+	}()
 }
 
+// stopUserBaseLocalCacheJanitor 停止清理协程并等待其退出，之后可再次启动
 func stopUserBaseLocalCacheJanitor() {
-	userBaseLocalJanitorStopOnce.Do(func() {
-		close(userBaseLocalJanitorStopCh)
-	})
+	userBaseLocalJanitorMu.Lock()
+	defer userBaseLocalJanitorMu.Unlock()
+	if !userBaseLocalJanitorRunning.Load() {
+		return
+	}
+	close(userBaseLocalJanitorStopCh)
+	<-userBaseLocalJanitorDoneCh
+	userBaseLocalJanitorStopCh = nil
+	userBaseLocalJanitorDoneCh = nil
+	userBaseLocalJanitorRunning.Store(false)
 }
 
-func cleanupExpiredUserBaseLocalCache(nowUnixNano int64) {
-	userBaseLocalCache.Range(func(key, value any) bool {
-		entry, ok := value.(userBaseLocalCacheEntry)
-		if !ok || nowUnixNano > entry.ExpireAtUnixNano {
-			userBaseLocalCache.Delete(key)
-		}
-		return true
-	})
+// ResetUserBaseLocalCacheForTest 停止清理协程并清空用户本地缓存，仅供测试在切换内存缓存开关时隔离状态
+func ResetUserBaseLocalCacheForTest() {
+	stopUserBaseLocalCacheJanitor()
+	userBaseLocalCache.Purge()
 }
 
-func getUserBaseShardLock(userId int) *sync.Mutex {
-	idx := userId % userBaseLocalLockShardCount
-	if idx < 0 {
-		idx = -idx
+// storeUserBaseLocalCacheEntry 更新已缓存的条目并保留其原过期时间，已过期时直接删除
+func storeUserBaseLocalCacheEntry(userId int, entry userBaseLocalCacheEntry) {
+	remaining := time.Until(time.Unix(0, entry.ExpireAtUnixNano))
+	if remaining <= 0 {
+		userBaseLocalCache.Delete(userId)
+		return
 	}
-	return &userBaseLocalLocks[idx]
+	userBaseLocalCache.SetWithTTL(userId, entry, remaining)
+}
+
+func getUserBaseShardLock(userId int) *sync.Mutex {
+	// 转为无符号后再取掩码，负数 ID 同样落在合法分片内
+	return &userBaseLocalLocks[uint(userId)&userBaseLocalLockMask]
 }
 
 func getUserBaseFromLocalCache(userId int) (*UserBase, bool) {
@@ -107,17 +199,8 @@ func getUserBaseFromLocalCache(userId int) (*UserBase, bool) {
 		return nil, false
 	}
 	ensureUserBaseLocalCacheJanitor()
-	raw, ok := userBaseLocalCache.Load(userId)
-	if !ok {
-		return nil, false
-	}
-	entry, ok := raw.(userBaseLocalCacheEntry)
+	entry, ok := userBaseLocalCache.Get(userId)
 	if !ok {
-		userBaseLocalCache.Delete(userId)
-		return nil, false
-	}
-	if time.Now().UnixNano() > entry.ExpireAtUnixNano {
-		userBaseLocalCache.Delete(userId)
 		return nil, false
 	}
 	cached := entry.Value
@@ -125,14 +208,14 @@ func getUserBaseFromLocalCache(userId int) (*UserBase, bool) {
 }
 
 func setUserBaseLocalCacheNoLock(userCache *UserBase) {
-	ttl := userBaseLocalCacheTTL
+	ttl := time.Duration(userBaseLocalCacheTTL.Load())
 	if ttl <= 0 {
 		ttl = 5 * time.Second
 	}
-	userBaseLocalCache.Store(userCache.Id, userBaseLocalCacheEntry{
+	userBaseLocalCache.SetWithTTL(userCache.Id, userBaseLocalCacheEntry{
 		Value:            *userCache,
 		ExpireAtUnixNano: time.Now().Add(ttl).UnixNano(),
-	})
+	}, ttl)
 }
 
 func setUserBaseLocalCache(userCache *UserBase) {
@@ -160,28 +243,26 @@ func mutateUserBaseLocalCache(userId int, mutate func(*UserBase)) {
 	if !common.MemoryCacheEnabled || userId <= 0 || mutate == nil {
 		return
 	}
-	ensureUserBaseLocalCacheJanitor()
 	lock := getUserBaseShardLock(userId)
 	lock.Lock()
 	defer lock.Unlock()
+	mutateUserBaseLocalCacheNoLock(userId, mutate)
+}
 
-	raw, ok := userBaseLocalCache.Load(userId)
-	if !ok {
+// mutateUserBaseLocalCacheNoLock 同 mutateUserBaseLocalCache，调用方需持有该用户的分片锁
+func mutateUserBaseLocalCacheNoLock(userId int, mutate func(*UserBase)) {
+	if !common.MemoryCacheEnabled || userId <= 0 || mutate == nil {
 		return
 	}
-	entry, ok := raw.(userBaseLocalCacheEntry)
+	ensureUserBaseLocalCacheJanitor()
+	entry, ok := userBaseLocalCache.Get(userId)
 	if !ok {
-		userBaseLocalCache.Delete(userId)
-		return
-	}
-	if time.Now().UnixNano() > entry.ExpireAtUnixNano {
-		userBaseLocalCache.Delete(userId)
 		return
 	}
 	next := entry.Value
 	mutate(&next)
 	entry.Value = next
-	userBaseLocalCache.Store(userId, entry)
+	storeUserBaseLocalCacheEntry(userId, entry)
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -212,12 +293,19 @@ func getUserCacheKey(userId int) string {
 // invalidateUserCache clears user cache
 func invalidateUserCache(userId int) error {
 	deleteUserBaseLocalCache(userId)
+	userBaseNegativeCache.Delete(userId)
 	if !common.RedisEnabled {
 		return nil
 	}
 	return common.RedisDelKey(getUserCacheKey(userId))
 }
 
+// AfterCreate 清除新用户 ID 的负缓存，使该 ID 在创建后立即可被查询到
+func (user *User) AfterCreate(tx *gorm.DB) error {
+	userBaseNegativeCache.Delete(user.Id)
+	return nil
+}
+
 // InvalidateUserCache is the exported version of invalidateUserCache.
 // 供 controller 等上层包在用户状态变更（如禁用、删除、角色变更）后主动清理缓存。
 func InvalidateUserCache(userId int) error {
@@ -239,6 +327,43 @@ func updateUserCache(user User) error {
 	)
 }
 
+// UserCacheStats GetUserCache 各层命中统计，用于评估本地/Redis 缓存 TTL 是否合理
+type UserCacheStats struct {
+	// 本地内存缓存命中次数
+	LocalHits int64 `json:"local_hits"`
+	// Redis 缓存命中次数
+	RedisHits int64 `json:"redis_hits"`
+	// 回源数据库成功加载次数
+	DBLoads int64 `json:"db_loads"`
+	// 回源数据库失败次数（含用户不存在）
+	Errors int64 `json:"errors"`
+}
+
+var userCacheStats struct {
+	localHits atomic.Int64
+	redisHits atomic.Int64
+	dbLoads   atomic.Int64
+	errors    atomic.Int64
+}
+
+// GetUserCacheStats 返回用户缓存各层命中统计
+func GetUserCacheStats() UserCacheStats {
+	return UserCacheStats{
+		LocalHits: userCacheStats.localHits.Load(),
+		RedisHits: userCacheStats.redisHits.Load(),
+		DBLoads:   userCacheStats.dbLoads.Load(),
+		Errors:    userCacheStats.errors.Load(),
+	}
+}
+
+// ResetUserCacheStats 重置用户缓存命中统计
+func ResetUserCacheStats() {
+	userCacheStats.localHits.Store(0)
+	userCacheStats.redisHits.Store(0)
+	userCacheStats.dbLoads.Store(0)
+	userCacheStats.errors.Store(0)
+}
+
 // GetUserCache gets complete user cache from memory -> redis -> db.
 func GetUserCache(userId int) (userCache *UserBase, err error) {
 	if userId <= 0 {
@@ -247,9 +372,13 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 
 	if common.MemoryCacheEnabled {
 		if cached, ok := getUserBaseFromLocalCache(userId); ok {
+			userCacheStats.localHits.Add(1)
 			return cached, nil
 		}
 	}
+	if _, ok := userBaseNegativeCache.Get(userId); ok {
+		return nil, gorm.ErrRecordNotFound
+	}
 
 	var user *User
 	var fromDB bool
@@ -267,6 +396,7 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 	if common.RedisEnabled {
 		userCache, err = cacheGetUserBase(userId)
 		if err == nil {
+			userCacheStats.redisHits.Add(1)
 			setUserBaseLocalCache(userCache)
 			return userCache, nil
 		}
@@ -275,9 +405,14 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 	fromDB = true
 	user, err = GetUserById(userId, false)
 	if err != nil {
+		userCacheStats.errors.Add(1)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			userBaseNegativeCache.Set(userId, struct{}{})
+		}
 		return nil, err
 	}
 
+	userCacheStats.dbLoads.Add(1)
 	userCache = &UserBase{
 		Id:       user.Id,
 		Group:    user.Group,
@@ -305,26 +440,61 @@ func cacheGetUserBase(userId int) (*UserBase, error) {
 }
 
 // Add atomic quota operations using hash fields
-func incrUserBaseLocalQuotaCache(userId int, delta int) {
+// incrUserBaseLocalQuotaCache 修改本地缓存额度，返回修改前后的额度；缓存未命中时 ok 为 false。调用方需持有该用户的分片锁
+func incrUserBaseLocalQuotaCache(userId int, delta int) (before int, after int, ok bool) {
 	if delta == 0 {
-		return
+		return 0, 0, false
 	}
-	mutateUserBaseLocalCache(userId, func(cache *UserBase) {
+	mutateUserBaseLocalCacheNoLock(userId, func(cache *UserBase) {
+		before = cache.Quota
 		cache.Quota += delta
+		after = cache.Quota
+		ok = true
 	})
+	return before, after, ok
 }
 
+// cacheIncrUserQuota 在用户分片锁内同时修改 Redis 与本地缓存额度，与 RecomputeUserQuota 的校正互斥
 func cacheIncrUserQuota(userId int, delta int64) error {
 	if delta == 0 {
 		return nil
 	}
+	lock := getUserBaseShardLock(userId)
+	lock.Lock()
+	defer lock.Unlock()
+	redisApplied := false
 	if common.RedisEnabled {
-		if err := common.RedisHIncrBy(getUserCacheKey(userId), "Quota", delta); err != nil {
-			deleteUserBaseLocalCache(userId)
+		value, applied, err := common.RedisHIncrByWithResult(getUserCacheKey(userId), "Quota", delta)
+		if err != nil {
+			userBaseLocalCache.Delete(userId)
 			return err
 		}
+		if applied {
+			redisApplied = true
+			trackUserQuotaCrossing(userId, value-delta, value)
+		}
+	}
+	before, after, ok := incrUserBaseLocalQuotaCache(userId, int(delta))
+	if ok && !redisApplied {
+		trackUserQuotaCrossing(userId, int64(before), int64(after))
+	}
+	return nil
+}
+
+// cacheIncrUserQuotaWriteThrough 在同一调用内先写库再更新 Redis/本地缓存，避免进程在批量刷新前崩溃丢失余额变更。
+// 落库成功后缓存更新失败只记录日志，调用方不应重试以免重复增减
+func cacheIncrUserQuotaWriteThrough(userId int, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	done := beginUserQuotaMutation(userId, 1)
+	defer done()
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", delta)).Error; err != nil {
+		return err
+	}
+	if err := cacheIncrUserQuota(userId, delta); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update user %d quota cache after write-through: %s", userId, err.Error()))
 	}
-	incrUserBaseLocalQuotaCache(userId, int(delta))
 	return nil
 }
 
@@ -349,6 +519,12 @@ func getUserQuotaCache(userId int) (int, error) {
 	return cache.Quota, nil
 }
 
+// GetUserQuotaFromCache 读取用户缓存中的额度（本地缓存/Redis，未命中时回源数据库），
+// 仅用于展示类场景，数值可能略滞后于实际扣费
+func GetUserQuotaFromCache(userId int) (int, error) {
+	return getUserQuotaCache(userId)
+}
+
 func getUserStatusCache(userId int) (int, error) {
 	cache, err := GetUserCache(userId)
 	if err != nil {
@@ -0,0 +1,220 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSetUserBaseLocalCacheTTLAndCleanupInterval(t *testing.T) {
+	originalTTL, originalInterval := userBaseLocalCacheTTL.Load(), userBaseLocalCacheCleanupInterval.Load()
+	originalMemoryCache := common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		userBaseLocalCacheTTL.Store(originalTTL)
+		userBaseLocalCacheCleanupInterval.Store(originalInterval)
+		common.MemoryCacheEnabled = originalMemoryCache
+		deleteUserBaseLocalCache(987654)
+	})
+
+	require.Error(t, SetUserBaseLocalCacheTTL(0))
+	require.Error(t, SetUserBaseLocalCacheCleanupInterval(-time.Second))
+
+	require.NoError(t, SetUserBaseLocalCacheTTL(time.Minute))
+	require.NoError(t, SetUserBaseLocalCacheCleanupInterval(30*time.Second))
+	require.Equal(t, 30*time.Second, getUserBaseLocalCacheCleanupInterval())
+	// 清理间隔不超过 TTL
+	require.NoError(t, SetUserBaseLocalCacheTTL(10*time.Second))
+	require.Equal(t, 10*time.Second, getUserBaseLocalCacheCleanupInterval())
+
+	common.MemoryCacheEnabled = true
+	require.NoError(t, SetUserBaseLocalCacheTTL(time.Millisecond))
+	setUserBaseLocalCache(&UserBase{Id: 987654, Quota: 1})
+	time.Sleep(5 * time.Millisecond)
+	_, ok := getUserBaseFromLocalCache(987654)
+	require.False(t, ok)
+
+	require.NoError(t, SetUserBaseLocalCacheTTL(time.Minute))
+	setUserBaseLocalCache(&UserBase{Id: 987654, Quota: 2})
+	cached, ok := getUserBaseFromLocalCache(987654)
+	require.True(t, ok)
+	require.Equal(t, 2, cached.Quota)
+}
+
+func TestGetUserCacheNegativeCaching(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() {
+		userBaseNegativeCache.Delete(555)
+		userBaseNegativeCache.Delete(556)
+		deleteUserBaseLocalCache(555)
+		deleteUserBaseLocalCache(556)
+	})
+
+	_, err := GetUserCache(555)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// 跳过钩子直接写库：窗口期内仍由负缓存返回未找到，不再查库
+	require.NoError(t, DB.Session(&gorm.Session{SkipHooks: true}).Create(&User{Id: 555, Username: "negative-cache-a", AffCode: "nega"}).Error)
+	_, err = GetUserCache(555)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	require.NoError(t, InvalidateUserCache(555))
+	cached, err := GetUserCache(555)
+	require.NoError(t, err)
+	require.Equal(t, "negative-cache-a", cached.Username)
+
+	// 正常创建用户时清除负缓存
+	_, err = GetUserCache(556)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	require.NoError(t, DB.Create(&User{Id: 556, Username: "negative-cache-b", AffCode: "negb"}).Error)
+	cached, err = GetUserCache(556)
+	require.NoError(t, err)
+	require.Equal(t, "negative-cache-b", cached.Username)
+}
+
+func TestUserBaseLocalCacheJanitorRestart(t *testing.T) {
+	originalMemoryCache := common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = originalMemoryCache
+		ResetUserBaseLocalCacheForTest()
+	})
+
+	common.MemoryCacheEnabled = true
+	for i := 0; i < 3; i++ {
+		setUserBaseLocalCache(&UserBase{Id: 987655, Quota: i})
+		_, ok := getUserBaseFromLocalCache(987655)
+		require.True(t, ok)
+		require.True(t, userBaseLocalJanitorRunning.Load())
+
+		ResetUserBaseLocalCacheForTest()
+		require.False(t, userBaseLocalJanitorRunning.Load())
+		_, ok = userBaseLocalCache.Get(987655)
+		require.False(t, ok)
+	}
+	// 重复停止不会 panic
+	stopUserBaseLocalCacheJanitor()
+}
+
+func TestUserBaseLocalLockShards(t *testing.T) {
+	originalLocks, originalMask := userBaseLocalLocks, userBaseLocalLockMask
+	t.Cleanup(func() { userBaseLocalLocks, userBaseLocalLockMask = originalLocks, originalMask })
+
+	require.Equal(t, defaultUserBaseLocalLockShardCount, normalizeUserBaseLocalLockShardCount(0))
+	require.Equal(t, defaultUserBaseLocalLockShardCount, normalizeUserBaseLocalLockShardCount(-8))
+	require.Equal(t, 1, normalizeUserBaseLocalLockShardCount(1))
+	require.Equal(t, 128, normalizeUserBaseLocalLockShardCount(100))
+	require.Equal(t, 1024, normalizeUserBaseLocalLockShardCount(1024))
+	require.Equal(t, maxUserBaseLocalLockShardCount, normalizeUserBaseLocalLockShardCount(1<<20))
+
+	initUserBaseLocalLocks(100)
+	require.Len(t, userBaseLocalLocks, 128)
+	require.Same(t, getUserBaseShardLock(5), getUserBaseShardLock(5+128))
+	require.NotSame(t, getUserBaseShardLock(5), getUserBaseShardLock(6))
+	for _, id := range []int{-1, -128, -129, math.MinInt} {
+		require.NotPanics(t, func() { getUserBaseShardLock(id) })
+	}
+}
+
+// BenchmarkUserBaseShardLock 对比不同分片数在并发按用户加锁时的表现，用于确定默认分片数
+func BenchmarkUserBaseShardLock(b *testing.B) {
+	originalLocks, originalMask := userBaseLocalLocks, userBaseLocalLockMask
+	b.Cleanup(func() { userBaseLocalLocks, userBaseLocalLockMask = originalLocks, originalMask })
+
+	for _, shards := range []int{16, 64, 256, 1024} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			initUserBaseLocalLocks(shards)
+			var seq atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				userId := int(seq.Add(7919))
+				for pb.Next() {
+					lock := getUserBaseShardLock(userId)
+					lock.Lock()
+					lock.Unlock()
+					userId += 31
+				}
+			})
+		})
+	}
+}
+
+func TestGetUserCacheStats(t *testing.T) {
+	truncateTables(t)
+	originalMemoryCache, originalRedis := common.MemoryCacheEnabled, common.RedisEnabled
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled, common.RedisEnabled = originalMemoryCache, originalRedis
+		ResetUserBaseLocalCacheForTest()
+		ResetUserCacheStats()
+	})
+	common.MemoryCacheEnabled = true
+	common.RedisEnabled = false
+	ResetUserCacheStats()
+
+	require.NoError(t, DB.Create(&User{Id: 557, Username: "stats-user", AffCode: "stats"}).Error)
+	deleteUserBaseLocalCache(557)
+	require.NoError(t, InvalidateUserCache(558))
+
+	_, err := GetUserCache(557)
+	require.NoError(t, err)
+	_, err = GetUserCache(557)
+	require.NoError(t, err)
+	_, err = GetUserCache(558)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	// 负缓存命中不计入回源
+	_, err = GetUserCache(558)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.Equal(t, UserCacheStats{LocalHits: 1, DBLoads: 1, Errors: 1}, GetUserCacheStats())
+	ResetUserCacheStats()
+	require.Equal(t, UserCacheStats{}, GetUserCacheStats())
+}
+
+func TestIncreaseUserQuotaWriteThrough(t *testing.T) {
+	truncateTables(t)
+	originalMemoryCache, originalBatch, originalWriteThrough := common.MemoryCacheEnabled, common.BatchUpdateEnabled, constant.QuotaWriteThroughEnabled
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled, common.BatchUpdateEnabled, constant.QuotaWriteThroughEnabled = originalMemoryCache, originalBatch, originalWriteThrough
+		FlushBatchUpdates()
+		ResetUserBaseLocalCacheForTest()
+	})
+	common.MemoryCacheEnabled = true
+	common.BatchUpdateEnabled = true
+	constant.QuotaWriteThroughEnabled = true
+
+	user := &User{Username: "write-through", AffCode: "wt", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+	setUserBaseLocalCache(&UserBase{Id: user.Id, Quota: 100})
+
+	quota := func() int {
+		var got User
+		require.NoError(t, DB.First(&got, user.Id).Error)
+		return got.Quota
+	}
+
+	// db=true 同一调用内写库并更新本地缓存
+	require.NoError(t, IncreaseUserQuota(user.Id, 50, true))
+	require.Equal(t, 150, quota())
+	cached, ok := getUserBaseFromLocalCache(user.Id)
+	require.True(t, ok)
+	require.Equal(t, 150, cached.Quota)
+
+	require.NoError(t, DecreaseUserQuota(user.Id, 20, true))
+	require.Equal(t, 130, quota())
+	cached, ok = getUserBaseFromLocalCache(user.Id)
+	require.True(t, ok)
+	require.Equal(t, 130, cached.Quota)
+
+	// db=false 仍走批量更新
+	require.NoError(t, IncreaseUserQuota(user.Id, 10, false))
+	require.Equal(t, 130, quota())
+	require.Eventually(t, func() bool {
+		cached, ok := getUserBaseFromLocalCache(user.Id)
+		return ok && cached.Quota == 140
+	}, time.Second, 5*time.Millisecond)
+	FlushBatchUpdates()
+	require.Equal(t, 140, quota())
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"sync"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+var (
+	userQuotaDepletedCallbacksLock sync.RWMutex
+	userQuotaDepletedCallbacks     []func(userId int)
+)
+
+// OnUserQuotaDepleted 注册用户缓存额度由正数变为非正数时的回调，回调异步执行，
+// 每次耗尽只触发一次，额度保持非正数期间的后续扣减不会重复触发
+func OnUserQuotaDepleted(callback func(userId int)) {
+	if callback == nil {
+		return
+	}
+	userQuotaDepletedCallbacksLock.Lock()
+	defer userQuotaDepletedCallbacksLock.Unlock()
+	userQuotaDepletedCallbacks = append(userQuotaDepletedCallbacks, callback)
+}
+
+// trackUserQuotaCrossing 根据单次原子修改的前后值判断额度是否由正数跨越到非正数，
+// 已为非正数时的继续扣减不满足 before > 0，因此同一次耗尽只会触发一次
+func trackUserQuotaCrossing(userId int, before int64, after int64) {
+	if before <= 0 || after > 0 {
+		return
+	}
+	userQuotaDepletedCallbacksLock.RLock()
+	callbacks := append([]func(userId int){}, userQuotaDepletedCallbacks...)
+	userQuotaDepletedCallbacksLock.RUnlock()
+	for _, callback := range callbacks {
+		callback := callback
+		gopool.Go(func() {
+			callback(userId)
+		})
+	}
+}
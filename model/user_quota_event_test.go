@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnUserQuotaDepletedFiresOncePerCrossing(t *testing.T) {
+	originalCallbacks, originalMemoryCache := userQuotaDepletedCallbacks, common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		userQuotaDepletedCallbacks, common.MemoryCacheEnabled = originalCallbacks, originalMemoryCache
+		deleteUserBaseLocalCache(777)
+	})
+	userQuotaDepletedCallbacks = nil
+	common.MemoryCacheEnabled = true
+
+	fired := make(chan int, 4)
+	OnUserQuotaDepleted(func(userId int) { fired <- userId })
+	setUserBaseLocalCache(&UserBase{Id: 777, Quota: 100})
+
+	require.NoError(t, cacheDecrUserQuota(777, 60))
+	require.NoError(t, cacheDecrUserQuota(777, 60))
+	// 已为负数时继续扣减不再触发
+	require.NoError(t, cacheDecrUserQuota(777, 10))
+	require.Equal(t, 777, <-fired)
+
+	// 额度恢复后再次耗尽会重新触发
+	require.NoError(t, cacheIncrUserQuota(777, 50))
+	require.NoError(t, cacheDecrUserQuota(777, 30))
+	require.Equal(t, 777, <-fired)
+
+	select {
+	case <-fired:
+		t.Fatal("callback fired more than once per depletion")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
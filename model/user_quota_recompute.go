@@ -0,0 +1,177 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const recomputeUserQuotaBatchSize = 500
+
+// ErrUserQuotaMutationInFlight 用户存在尚未完成的额度变更，或缓存在校正期间被其他实例修改，本次未校正
+var ErrUserQuotaMutationInFlight = errors.New("user quota is being modified, retry later")
+
+// userQuotaMutationsInFlight 记录已开始但写库与缓存更新尚未全部完成的额度变更数（userId -> int），
+// 计数只在该用户的分片锁内修改；校正时跳过存在进行中变更的用户，避免覆盖或重复计入这些增量
+var userQuotaMutationsInFlight sync.Map
+
+// beginUserQuotaMutation 在写库（或加入批量更新）与更新缓存之前调用，parts 为需要完成的步骤数，
+// 返回的 done 需在每个步骤完成后各调用一次
+func beginUserQuotaMutation(userId int, parts int) (done func()) {
+	lock := getUserBaseShardLock(userId)
+	lock.Lock()
+	count := parts
+	if raw, ok := userQuotaMutationsInFlight.Load(userId); ok {
+		count += raw.(int)
+	}
+	userQuotaMutationsInFlight.Store(userId, count)
+	lock.Unlock()
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		raw, ok := userQuotaMutationsInFlight.Load(userId)
+		if !ok {
+			return
+		}
+		if remaining := raw.(int) - 1; remaining > 0 {
+			userQuotaMutationsInFlight.Store(userId, remaining)
+		} else {
+			userQuotaMutationsInFlight.Delete(userId)
+		}
+	}
+}
+
+// userQuotaCompareAndSetScript 仅当 Redis 中的额度仍为校正前读取的值时才覆盖，避免吞掉其他实例并发写入的增量
+var userQuotaCompareAndSetScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'Quota')
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'Quota', ARGV[2])
+return 1
+`)
+
+// RecomputeUserQuota 以数据库额度（加上批量更新中尚未落库的增量）为准，校正该用户的 Redis 与本地缓存额度。
+// 缓存与数据库不一致时记录差值日志，缓存不存在时不做处理；存在进行中的额度变更时返回 ErrUserQuotaMutationInFlight
+func RecomputeUserQuota(userId int) error {
+	if userId <= 0 {
+		return errors.New("invalid user id")
+	}
+	// 持有批量更新运行锁，避免读取数据库与待写入增量之间发生刷新导致重复或遗漏
+	batchUpdateRunLock.Lock()
+	defer batchUpdateRunLock.Unlock()
+
+	_, err := reconcileUserQuotaCache(userId)
+	return err
+}
+
+// RecomputeAllUserQuotas 先刷新批量更新，再按批次校正所有用户的缓存额度，返回被修正的用户数
+func RecomputeAllUserQuotas() (int, error) {
+	FlushBatchUpdates()
+	fixed := 0
+	skipped := 0
+	lastId := 0
+	for {
+		var ids []int
+		if err := DB.Model(&User{}).Where("id > ?", lastId).Order("id").Limit(recomputeUserQuotaBatchSize).Pluck("id", &ids).Error; err != nil {
+			return fixed, err
+		}
+		batchUpdateRunLock.Lock()
+		for _, id := range ids {
+			corrected, err := reconcileUserQuotaCache(id)
+			if errors.Is(err, ErrUserQuotaMutationInFlight) {
+				skipped++
+				continue
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to recompute quota cache for user %d: %s", id, err.Error()))
+				continue
+			}
+			if corrected {
+				fixed++
+			}
+		}
+		batchUpdateRunLock.Unlock()
+		if len(ids) < recomputeUserQuotaBatchSize {
+			break
+		}
+		lastId = ids[len(ids)-1]
+	}
+	common.SysLog(fmt.Sprintf("recompute user quotas finished, %d users corrected, %d users skipped due to in-flight changes", fixed, skipped))
+	return fixed, nil
+}
+
+// pendingUserQuotaDelta 返回批量更新队列中该用户尚未落库的额度增量
+func pendingUserQuotaDelta(userId int) int {
+	batchUpdateLocks[BatchUpdateTypeUserQuota].Lock()
+	defer batchUpdateLocks[BatchUpdateTypeUserQuota].Unlock()
+	return batchUpdateStores[BatchUpdateTypeUserQuota][userId]
+}
+
+// reconcileUserQuotaCache 持有用户分片锁（阻塞本实例的缓存额度变更），依次读取缓存、数据库与待写入增量，
+// 确认没有进行中的变更后将本地缓存覆盖为实际额度，并以比较并设置的方式覆盖 Redis，返回是否存在偏差
+func reconcileUserQuotaCache(userId int) (bool, error) {
+	lock := getUserBaseShardLock(userId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 先读取缓存再读取数据库：读取之后开始的变更要么尚未写库，要么被进行中计数拦截
+	redisQuota, redisCached, err := getUserQuotaRedisField(userId)
+	if err != nil {
+		return false, err
+	}
+	var user User
+	if err := DB.Select("id", "quota").Where("id = ?", userId).First(&user).Error; err != nil {
+		return false, err
+	}
+	quota := user.Quota + pendingUserQuotaDelta(userId)
+	if _, ok := userQuotaMutationsInFlight.Load(userId); ok {
+		return false, ErrUserQuotaMutationInFlight
+	}
+
+	corrected := false
+	if entry, ok := userBaseLocalCache.Get(userId); ok && entry.Value.Quota != quota {
+		common.SysLog(fmt.Sprintf("user %d local quota cache drift: cached=%d, actual=%d, delta=%d",
+			userId, entry.Value.Quota, quota, quota-entry.Value.Quota))
+		entry.Value.Quota = quota
+		storeUserBaseLocalCacheEntry(userId, entry)
+		corrected = true
+	}
+	// Redis 中没有缓存时下次读取会回源数据库，无需处理
+	if !redisCached || redisQuota == strconv.Itoa(quota) {
+		return corrected, nil
+	}
+	cachedQuota, _ := strconv.Atoi(redisQuota)
+	swapped, err := userQuotaCompareAndSetScript.Run(context.Background(), common.RDB,
+		[]string{getUserCacheKey(userId)}, redisQuota, strconv.Itoa(quota)).Int()
+	if err != nil {
+		return corrected, err
+	}
+	if swapped == 0 {
+		return corrected, ErrUserQuotaMutationInFlight
+	}
+	common.SysLog(fmt.Sprintf("user %d redis quota cache drift: cached=%d, actual=%d, delta=%d",
+		userId, cachedQuota, quota, quota-cachedQuota))
+	return true, nil
+}
+
+// getUserQuotaRedisField 读取 Redis 中缓存的额度原始值，未启用 Redis 或缓存不存在时 cached 为 false
+func getUserQuotaRedisField(userId int) (value string, cached bool, err error) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return "", false, nil
+	}
+	value, err = common.RDB.HGet(context.Background(), getUserCacheKey(userId), "Quota").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
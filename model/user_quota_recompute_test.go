@@ -0,0 +1,121 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecomputeUserQuota(t *testing.T) {
+	truncateTables(t)
+	originalMemoryCache := common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = originalMemoryCache
+		batchUpdateLocks[BatchUpdateTypeUserQuota].Lock()
+		batchUpdateStores[BatchUpdateTypeUserQuota] = make(map[int]int)
+		batchUpdateLocks[BatchUpdateTypeUserQuota].Unlock()
+		ResetUserBaseLocalCacheForTest()
+	})
+	common.MemoryCacheEnabled = true
+
+	user := &User{Username: "recompute", AffCode: "recompute", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+	setUserBaseLocalCache(&UserBase{Id: user.Id, Quota: 70})
+	// 尚未落库的批量增量计入实际额度
+	addNewRecord(BatchUpdateTypeUserQuota, user.Id, 5)
+
+	require.NoError(t, RecomputeUserQuota(user.Id))
+	cached, ok := getUserBaseFromLocalCache(user.Id)
+	require.True(t, ok)
+	require.Equal(t, 105, cached.Quota)
+
+	require.Error(t, RecomputeUserQuota(0))
+	require.Error(t, RecomputeUserQuota(user.Id+1000))
+}
+
+func TestRecomputeAllUserQuotas(t *testing.T) {
+	truncateTables(t)
+	originalMemoryCache := common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = originalMemoryCache
+		ResetUserBaseLocalCacheForTest()
+	})
+	common.MemoryCacheEnabled = true
+
+	drifted := &User{Username: "recompute-a", AffCode: "recompute-a", Quota: 10}
+	synced := &User{Username: "recompute-b", AffCode: "recompute-b", Quota: 20}
+	require.NoError(t, DB.Create(drifted).Error)
+	require.NoError(t, DB.Create(synced).Error)
+	setUserBaseLocalCache(&UserBase{Id: drifted.Id, Quota: 999})
+	setUserBaseLocalCache(&UserBase{Id: synced.Id, Quota: 20})
+	addNewRecord(BatchUpdateTypeUserQuota, synced.Id, 3)
+
+	fixed, err := RecomputeAllUserQuotas()
+	require.NoError(t, err)
+	// 直接写入批量队列不经过缓存，刷新落库后 synced 的缓存同样落后于数据库
+	require.Equal(t, 2, fixed)
+
+	cached, ok := getUserBaseFromLocalCache(drifted.Id)
+	require.True(t, ok)
+	require.Equal(t, 10, cached.Quota)
+	cached, ok = getUserBaseFromLocalCache(synced.Id)
+	require.True(t, ok)
+	require.Equal(t, 23, cached.Quota)
+}
+
+func TestRecomputeUserQuota_SkipsInFlightMutations(t *testing.T) {
+	truncateTables(t)
+	originalMemoryCache := common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = originalMemoryCache
+		ResetUserBaseLocalCacheForTest()
+	})
+	common.MemoryCacheEnabled = true
+
+	user := &User{Username: "recompute-inflight", AffCode: "recompute-inflight", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+	// 已写库但缓存尚未更新的变更：校正不能把缓存覆盖为已包含该增量的数据库值
+	setUserBaseLocalCache(&UserBase{Id: user.Id, Quota: 90})
+	done := beginUserQuotaMutation(user.Id, 1)
+	require.ErrorIs(t, RecomputeUserQuota(user.Id), ErrUserQuotaMutationInFlight)
+	cached, ok := getUserBaseFromLocalCache(user.Id)
+	require.True(t, ok)
+	require.Equal(t, 90, cached.Quota)
+
+	done()
+	require.NoError(t, RecomputeUserQuota(user.Id))
+	cached, ok = getUserBaseFromLocalCache(user.Id)
+	require.True(t, ok)
+	require.Equal(t, 100, cached.Quota)
+}
+
+func TestRecomputeUserQuota_RedisCompareAndSet(t *testing.T) {
+	truncateTables(t)
+	server := miniredis.RunT(t)
+	originalRDB, originalRedisEnabled := common.RDB, common.RedisEnabled
+	common.RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		_ = common.RDB.Close()
+		common.RDB, common.RedisEnabled = originalRDB, originalRedisEnabled
+	})
+
+	user := &User{Username: "recompute-redis", AffCode: "recompute-redis", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+	key := getUserCacheKey(user.Id)
+	server.HSet(key, "Quota", "40")
+
+	require.NoError(t, RecomputeUserQuota(user.Id))
+	require.Equal(t, "100", server.HGet(key, "Quota"))
+
+	// 期望值与当前值不一致（其他实例已修改）时不覆盖
+	swapped, err := userQuotaCompareAndSetScript.Run(context.Background(), common.RDB, []string{key}, "40", "70").Int()
+	require.NoError(t, err)
+	require.Zero(t, swapped)
+	require.Equal(t, "100", server.HGet(key, "Quota"))
+}
@@ -25,6 +25,12 @@ const (
 var batchUpdateStores []map[int]int
 var batchUpdateLocks []sync.Mutex
 
+// batchUpdateQueueWarned 记录各类型在本轮刷新前是否已输出过积压告警，避免每次写入都打印
+var batchUpdateQueueWarned [BatchUpdateTypeCount]bool
+
+// batchUpdateRunLock 保证同一时间只有一次刷新在执行，FlushBatchUpdates 会等待进行中的后台刷新完成
+var batchUpdateRunLock sync.Mutex
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int))
@@ -41,6 +47,19 @@ func InitBatchUpdater() {
 	})
 }
 
+// FlushBatchUpdates 立即将所有待写入的批量更新落库，用于优雅退出时避免丢失额度变更。
+// 可与后台刷新并发调用，会等待进行中的刷新结束后再处理剩余数据。
+func FlushBatchUpdates() {
+	batchUpdate()
+	pending := 0
+	for _, depth := range BatchUpdateQueueDepths() {
+		pending += depth
+	}
+	if pending > 0 {
+		common.SysError(fmt.Sprintf("batch update flush finished with %d records still pending", pending))
+	}
+}
+
 func addNewRecord(type_ int, id int, value int) {
 	batchUpdateLocks[type_].Lock()
 	defer batchUpdateLocks[type_].Unlock()
@@ -49,6 +68,21 @@ func addNewRecord(type_ int, id int, value int) {
 	} else {
 		batchUpdateStores[type_][id] += value
 	}
+	if warnSize := common.BatchUpdateQueueWarnSize; warnSize > 0 && len(batchUpdateStores[type_]) > warnSize && !batchUpdateQueueWarned[type_] {
+		batchUpdateQueueWarned[type_] = true
+		common.SysError(fmt.Sprintf("batch update queue backlog: type=%d, pending=%d exceeds warn size %d", type_, len(batchUpdateStores[type_]), warnSize))
+	}
+}
+
+// BatchUpdateQueueDepths 返回各类型当前待写入的记录数，可用于监控数据库写入积压
+func BatchUpdateQueueDepths() [BatchUpdateTypeCount]int {
+	var depths [BatchUpdateTypeCount]int
+	for i := 0; i < BatchUpdateTypeCount; i++ {
+		batchUpdateLocks[i].Lock()
+		depths[i] = len(batchUpdateStores[i])
+		batchUpdateLocks[i].Unlock()
+	}
+	return depths
 }
 
 func addNewUserUsedQuotaAndRequestCountRecord(id int, quota int, count int) {
@@ -89,15 +123,30 @@ func getBatchUpdateWorkerCount(total int) int {
 	return workerCount
 }
 
+// batchUpdateSemaphore 限制一次刷新中所有类型共享的工作协程总数，避免并发刷新耗尽数据库连接
+type batchUpdateSemaphore chan struct{}
+
+func newBatchUpdateSemaphore() batchUpdateSemaphore {
+	size := common.BatchUpdateConcurrencyMax
+	if size < 1 {
+		size = 1
+	}
+	return make(batchUpdateSemaphore, size)
+}
+
+func (s batchUpdateSemaphore) acquire() {
+	s <- struct{}{}
+}
+
+func (s batchUpdateSemaphore) release() {
+	<-s
+}
+
 func batchShardIndex(key int, workerCount int) int {
 	if workerCount <= 1 {
 		return 0
 	}
-	hash := uint64(uint(key))
-	hash ^= hash >> 33
-	hash *= 0xff51afd7ed558ccd
-	hash ^= hash >> 33
-	return int(hash % uint64(workerCount))
+	return int(common.Fmix64(uint64(uint(key))) % uint64(workerCount))
 }
 
 const batchUpdateRetryMaxAttempts = 3
@@ -164,7 +213,7 @@ func processSingleUserUsedQuotaAndRequestCountRecord(record batchUsedQuotaAndReq
 	addNewUserUsedQuotaAndRequestCountRecord(record.key, record.quota, record.count)
 }
 
-func processBatchUserUsedQuotaAndRequestCountStore(usedQuotaStore map[int]int, requestCountStore map[int]int) {
+func processBatchUserUsedQuotaAndRequestCountStore(usedQuotaStore map[int]int, requestCountStore map[int]int, sem batchUpdateSemaphore) {
 	if len(usedQuotaStore) == 0 && len(requestCountStore) == 0 {
 		return
 	}
@@ -180,6 +229,8 @@ func processBatchUserUsedQuotaAndRequestCountStore(usedQuotaStore map[int]int, r
 
 	workerCount := getBatchUpdateWorkerCount(len(records))
 	if workerCount <= 1 {
+		sem.acquire()
+		defer sem.release()
 		for _, record := range records {
 			processSingleUserUsedQuotaAndRequestCountRecord(record)
 		}
@@ -198,6 +249,8 @@ func processBatchUserUsedQuotaAndRequestCountStore(usedQuotaStore map[int]int, r
 		records := shards[i]
 		go func(records []batchUsedQuotaAndRequestCountRecord) {
 			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
 			for _, record := range records {
 				processSingleUserUsedQuotaAndRequestCountRecord(record)
 			}
@@ -206,13 +259,15 @@ func processBatchUserUsedQuotaAndRequestCountStore(usedQuotaStore map[int]int, r
 	wg.Wait()
 }
 
-func processBatchStore(type_ int, store map[int]int) {
+func processBatchStore(type_ int, store map[int]int, sem batchUpdateSemaphore) {
 	if len(store) == 0 {
 		return
 	}
 
 	workerCount := getBatchUpdateWorkerCount(len(store))
 	if workerCount <= 1 {
+		sem.acquire()
+		defer sem.release()
 		for key, value := range store {
 			processSingleBatchRecord(type_, key, value)
 		}
@@ -231,6 +286,8 @@ func processBatchStore(type_ int, store map[int]int) {
 		records := shards[i]
 		go func(records []batchUpdateRecord) {
 			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
 			for _, record := range records {
 				processSingleBatchRecord(type_, record.key, record.value)
 			}
@@ -240,6 +297,9 @@ func processBatchStore(type_ int, store map[int]int) {
 }
 
 func batchUpdate() {
+	batchUpdateRunLock.Lock()
+	defer batchUpdateRunLock.Unlock()
+
 	// check if there's any data to update
 	hasData := false
 	for i := 0; i < BatchUpdateTypeCount; i++ {
@@ -257,26 +317,55 @@ func batchUpdate() {
 	}
 
 	common.SysLog("batch update started")
-	var usedQuotaStore map[int]int
-	var requestCountStore map[int]int
+	stores := make([]map[int]int, BatchUpdateTypeCount)
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
-		store := batchUpdateStores[i]
+		stores[i] = batchUpdateStores[i]
 		batchUpdateStores[i] = make(map[int]int)
+		batchUpdateQueueWarned[i] = false
 		batchUpdateLocks[i].Unlock()
+	}
+
+	// 各类型相互独立，可并发刷新；已用额度与请求次数合并为同一组更新
+	sem := newBatchUpdateSemaphore()
+	tasks := make([]func(), 0, BatchUpdateTypeCount)
+	for i := 0; i < BatchUpdateTypeCount; i++ {
 		switch i {
 		case BatchUpdateTypeUsedQuota:
-			usedQuotaStore = store
+			tasks = append(tasks, func() {
+				processBatchUserUsedQuotaAndRequestCountStore(stores[BatchUpdateTypeUsedQuota], stores[BatchUpdateTypeRequestCount], sem)
+			})
 		case BatchUpdateTypeRequestCount:
-			requestCountStore = store
 		default:
-			processBatchStore(i, store)
+			type_ := i
+			tasks = append(tasks, func() {
+				processBatchStore(type_, stores[type_], sem)
+			})
 		}
 	}
-	processBatchUserUsedQuotaAndRequestCountStore(usedQuotaStore, requestCountStore)
+	runBatchUpdateTasks(tasks)
 	common.SysLog("batch update finished")
 }
 
+// runBatchUpdateTasks 并发执行各类型的刷新任务，SQLite 不支持并发写入，仍按顺序执行
+func runBatchUpdateTasks(tasks []func()) {
+	if common.UsingSQLite {
+		for _, task := range tasks {
+			task()
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(tasks))
+	for _, task := range tasks {
+		go func(task func()) {
+			defer wg.Done()
+			task()
+		}(task)
+	}
+	wg.Wait()
+}
+
 func RecordExist(err error) (bool, error) {
 	if err == nil {
 		return true, nil
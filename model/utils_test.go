@@ -0,0 +1,138 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchUpdate_FlushesAllTypesConcurrently(t *testing.T) {
+	truncateTables(t)
+
+	oldSQLite := common.UsingSQLite
+	oldConcurrency := common.BatchUpdateConcurrency
+	oldMax := common.BatchUpdateConcurrencyMax
+	t.Cleanup(func() {
+		common.UsingSQLite = oldSQLite
+		common.BatchUpdateConcurrency = oldConcurrency
+		common.BatchUpdateConcurrencyMax = oldMax
+	})
+	common.UsingSQLite = false
+	common.BatchUpdateConcurrency = 4
+	common.BatchUpdateConcurrencyMax = 2
+
+	users := []*User{{Username: "batch_u1", AffCode: "batch_aff_1", Quota: 100}, {Username: "batch_u2", AffCode: "batch_aff_2", Quota: 100}}
+	for _, user := range users {
+		require.NoError(t, DB.Create(user).Error)
+	}
+	token := &Token{UserId: users[0].Id, Key: "batch-token-key", RemainQuota: 50}
+	require.NoError(t, DB.Create(token).Error)
+	channel := &Channel{Name: "batch-channel"}
+	require.NoError(t, DB.Create(channel).Error)
+
+	for _, user := range users {
+		addNewRecord(BatchUpdateTypeUserQuota, user.Id, 10)
+		addNewUserUsedQuotaAndRequestCountRecord(user.Id, 7, 1)
+	}
+	addNewRecord(BatchUpdateTypeTokenQuota, token.Id, -20)
+	addNewRecord(BatchUpdateTypeChannelUsedQuota, channel.Id, 30)
+
+	batchUpdate()
+
+	for _, user := range users {
+		var got User
+		require.NoError(t, DB.First(&got, user.Id).Error)
+		require.Equal(t, 110, got.Quota)
+		require.Equal(t, 7, got.UsedQuota)
+		require.Equal(t, 1, got.RequestCount)
+	}
+	var gotToken Token
+	require.NoError(t, DB.First(&gotToken, token.Id).Error)
+	require.Equal(t, 30, gotToken.RemainQuota)
+	var gotChannel Channel
+	require.NoError(t, DB.First(&gotChannel, channel.Id).Error)
+	require.EqualValues(t, 30, gotChannel.UsedQuota)
+}
+
+func TestBatchUpdateSemaphore_CapsConcurrentWorkers(t *testing.T) {
+	oldMax := common.BatchUpdateConcurrencyMax
+	t.Cleanup(func() { common.BatchUpdateConcurrencyMax = oldMax })
+	common.BatchUpdateConcurrencyMax = 2
+
+	sem := newBatchUpdateSemaphore()
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestFlushBatchUpdates_DrainsPendingRecords(t *testing.T) {
+	truncateTables(t)
+
+	user := &User{Username: "flush_u1", AffCode: "flush_aff_1", Quota: 100}
+	require.NoError(t, DB.Create(user).Error)
+
+	addNewRecord(BatchUpdateTypeUserQuota, user.Id, 25)
+
+	// 与后台刷新并发调用时不会重复或遗漏写入
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		batchUpdate()
+	}()
+	go func() {
+		defer wg.Done()
+		FlushBatchUpdates()
+	}()
+	wg.Wait()
+
+	var got User
+	require.NoError(t, DB.First(&got, user.Id).Error)
+	require.Equal(t, 125, got.Quota)
+	for i := 0; i < BatchUpdateTypeCount; i++ {
+		require.Empty(t, batchUpdateStores[i])
+	}
+}
+
+func TestBatchUpdateQueueDepths_ReportsPendingAndWarnsOnce(t *testing.T) {
+	truncateTables(t)
+
+	oldWarnSize := common.BatchUpdateQueueWarnSize
+	t.Cleanup(func() { common.BatchUpdateQueueWarnSize = oldWarnSize })
+	common.BatchUpdateQueueWarnSize = 1
+
+	addNewRecord(BatchUpdateTypeChannelUsedQuota, 1001, 1)
+	require.False(t, batchUpdateQueueWarned[BatchUpdateTypeChannelUsedQuota])
+	addNewRecord(BatchUpdateTypeChannelUsedQuota, 1002, 1)
+	addNewRecord(BatchUpdateTypeChannelUsedQuota, 1002, 1)
+	require.True(t, batchUpdateQueueWarned[BatchUpdateTypeChannelUsedQuota])
+
+	depths := BatchUpdateQueueDepths()
+	require.Equal(t, 2, depths[BatchUpdateTypeChannelUsedQuota])
+	require.Equal(t, 0, depths[BatchUpdateTypeUserQuota])
+
+	batchUpdate()
+	require.Equal(t, 0, BatchUpdateQueueDepths()[BatchUpdateTypeChannelUsedQuota])
+	require.False(t, batchUpdateQueueWarned[BatchUpdateTypeChannelUsedQuota])
+}
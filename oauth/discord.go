@@ -159,7 +159,7 @@ func (p *DiscordProvider) GetUserInfo(ctx context.Context, token *OAuthToken) (*
 		return nil, NewOAuthError(i18n.MsgOAuthDiscordGuildConfigInvalid, nil)
 	}
 	if !rule.IsEmpty() {
-		if err := verifyDiscordGuildMembership(ctx, &client, token.AccessToken, rule); err != nil {
+		if err := verifyDiscordGuildMembership(ctx, &client, token.AccessToken, discordUser.UID, rule); err != nil {
 			return nil, err
 		}
 	}
@@ -173,7 +173,7 @@ func (p *DiscordProvider) GetUserInfo(ctx context.Context, token *OAuthToken) (*
 	}, nil
 }
 
-func verifyDiscordGuildMembership(ctx context.Context, client *http.Client, accessToken string, rule *system_setting.DiscordGuildRule) error {
+func verifyDiscordGuildMembership(ctx context.Context, client *http.Client, accessToken string, userID string, rule *system_setting.DiscordGuildRule) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", "https://discord.com/api/v10/users/@me/guilds", nil)
 	if err != nil {
 		return err
@@ -208,26 +208,22 @@ func verifyDiscordGuildMembership(ctx context.Context, client *http.Client, acce
 		}
 	}
 
-	guildRoleSetCache := make(map[string]map[string]struct{})
-	roleProvider := func(guildID string) (map[string]struct{}, error) {
-		if roleSet, exists := guildRoleSetCache[guildID]; exists {
-			return roleSet, nil
-		}
-		roleSet, getErr := getDiscordGuildRoleSet(ctx, client, accessToken, guildID)
-		if getErr != nil {
-			return nil, getErr
-		}
-		guildRoleSetCache[guildID] = roleSet
-		return roleSet, nil
-	}
+	// 配置了缓存时长时身份组查询与判定结果按用户缓存，未配置时每次登录都实时查询
+	cacheTTL := time.Duration(system_setting.GetDiscordSettings().RuleCacheSeconds) * time.Second
+	roleProvider := system_setting.NewCachedDiscordRoleProvider(userID, func(guildID string) (map[string]struct{}, error) {
+		return getDiscordGuildRoleSet(ctx, client, accessToken, guildID)
+	}, cacheTTL)
 
-	matched, evalErr := rule.Evaluate(guildSet, roleProvider)
+	matched, reason, evalErr := rule.EvaluateCached(userID, guildSet, roleProvider, cacheTTL)
 	if evalErr != nil {
 		logger.LogError(ctx, fmt.Sprintf("[OAuth-Discord] Guild rule evaluate error: %s", evalErr.Error()))
 		return NewOAuthErrorWithRaw(i18n.MsgOAuthDiscordGuildCheckFailed, nil, evalErr.Error())
 	}
 	if !matched {
-		logger.LogDebug(ctx, "[OAuth-Discord] Guild requirement failed")
+		logger.LogDebug(ctx, "[OAuth-Discord] Guild requirement failed: %s", reason)
+		if reason != "" {
+			return NewOAuthError(i18n.MsgOAuthDiscordGuildDenied, map[string]any{"Reason": reason})
+		}
 		return NewOAuthError(i18n.MsgOAuthDiscordGuildRequired, nil)
 	}
 
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	common2 "github.com/QuantumNous/new-api/common"
+	constant2 "github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
@@ -456,7 +458,11 @@ func sendPingData(c *gin.Context, mutex *sync.Mutex) error {
 		mutex.Lock()
 		defer mutex.Unlock()
 
-		err := helper.PingData(c)
+		pingFormat := dto.PingFormatComment
+		if channelSetting, ok := common2.GetContextKeyType[dto.ChannelSettings](c, constant2.ContextKeyChannelSetting); ok && channelSetting.PingFormat != "" {
+			pingFormat = channelSetting.PingFormat
+		}
+		err := helper.PingDataWithFormat(c, pingFormat)
 		if err != nil {
 			logger.LogError(c, "SSE ping error: "+err.Error())
 			done <- err
@@ -515,20 +521,53 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	// 客户端设置了请求预算时，上游请求（含响应体读取）受同一截止时间约束
+	var cancelDeadline context.CancelFunc
+	if !info.RequestDeadline.IsZero() {
+		var ctx context.Context
+		ctx, cancelDeadline = info.WithRequestDeadline(req.Context())
+		req = req.WithContext(ctx)
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
+		if cancelDeadline != nil {
+			cancelDeadline()
+		}
+		if errors.Is(err, context.DeadlineExceeded) && info.RequestBudgetExceeded() {
+			logger.LogWarn(c, "request budget exceeded before upstream responded")
+			return nil, types.NewErrorWithStatusCode(fmt.Errorf("request budget exceeded: %w", err), types.ErrorCodeRequestBudgetExceeded, http.StatusGatewayTimeout, types.ErrOptionWithSkipRetry())
+		}
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
+		if cancelDeadline != nil {
+			cancelDeadline()
+		}
 		return nil, errors.New("resp is nil")
 	}
+	if cancelDeadline != nil {
+		resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancelDeadline}
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
 }
 
+// cancelOnCloseBody 在响应体关闭时释放请求预算上下文
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
 func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.BuildRequestURL(info)
 	if err != nil {
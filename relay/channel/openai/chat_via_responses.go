@@ -38,6 +38,31 @@ func stringDeltaFromPrefix(prev string, next string) string {
 	return next
 }
 
+// responsesToolCallState 记录 Responses 流中单个 function_call 的转换状态
+type responsesToolCallState struct {
+	callID   string
+	name     string
+	args     string // 已收到的完整参数
+	sentArgs string // 已下发给客户端的参数前缀
+	index    int    // chat tool_calls 中的索引，尚未下发时为 -1
+}
+
+// mergeFullArguments 用 output_item / arguments.done 中的完整参数补齐缺失的片段。
+// 已下发的内容无法撤回，完整参数与已下发前缀不一致时保留已下发内容，避免客户端拼出非法 JSON
+func (s *responsesToolCallState) mergeFullArguments(full string) {
+	if full == "" || !strings.HasPrefix(full, s.sentArgs) {
+		return
+	}
+	s.args = full
+}
+
+// shouldPassThroughResponsesReasoning 按渠道设置与模型规则判断非流式响应是否以 reasoning_content 返回推理摘要，
+// 流式响应始终以 reasoning_content 返回推理摘要
+func shouldPassThroughResponsesReasoning(info *relaycommon.RelayInfo) bool {
+	channelEnabled := info.ChannelMeta != nil && info.ChannelSetting.ResponsesReasoningContent
+	return service.ShouldPassThroughResponsesReasoningGlobal(channelEnabled, info.OriginModelName)
+}
+
 func OaiResponsesToChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
 	if resp == nil || resp.Body == nil {
 		return nil, types.NewOpenAIError(fmt.Errorf("invalid response"), types.ErrorCodeBadResponse, http.StatusInternalServerError)
@@ -60,10 +85,16 @@ func OaiResponsesToChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 	}
 
 	chatId := helper.GetResponseID(c)
+	if info.UseUpstreamResponseID && responsesResp.ID != "" {
+		chatId = responsesResp.ID
+	}
 	chatResp, usage, err := service.ResponsesResponseToChatCompletionsResponse(&responsesResp, chatId)
 	if err != nil {
 		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
 	}
+	if shouldPassThroughResponsesReasoning(info) && len(chatResp.Choices) > 0 {
+		chatResp.Choices[0].Message.ReasoningContent = service.ExtractReasoningSummaryFromResponses(&responsesResp)
+	}
 
 	if usage == nil || usage.TotalTokens == 0 {
 		text := service.ExtractOutputTextFromResponses(&responsesResp)
@@ -109,13 +140,15 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		sentStop    bool
 		sawToolCall bool
 		streamErr   *types.NewAPIError
+		// upstreamErr 标记 streamErr 来自上游的 response.error / response.failed 事件，
+		// 而非本地写入或解析失败
+		upstreamErr bool
 	)
 
-	toolCallIndexByID := make(map[string]int)
-	toolCallNameByID := make(map[string]string)
-	toolCallArgsByID := make(map[string]string)
-	toolCallNameSent := make(map[string]bool)
-	toolCallCanonicalIDByItemID := make(map[string]string)
+	// 工具调用按 item_id 聚合，参数片段在获得调用 ID 与函数名之前先缓存，保证首个 chunk 带齐 id/name 且索引稳定
+	toolCallByItemID := make(map[string]*responsesToolCallState)
+	toolCallOrder := make([]*responsesToolCallState, 0)
+	nextToolCallIndex := 0
 	hasSentReasoningSummary := false
 	needsReasoningSummarySeparator := false
 	//reasoningSummaryTextByKey := make(map[string]string)
@@ -230,42 +263,50 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		return true
 	}
 
-	sendToolCallDelta := func(callID string, name string, argsDelta string) bool {
-		if callID == "" {
+	getToolCallState := func(itemID string) *responsesToolCallState {
+		state, ok := toolCallByItemID[itemID]
+		if !ok {
+			state = &responsesToolCallState{index: -1}
+			toolCallByItemID[itemID] = state
+			toolCallOrder = append(toolCallOrder, state)
+		}
+		return state
+	}
+
+	// flushToolCall 下发该工具调用尚未发送的参数片段；force 为 true 时即使缺少函数名也下发（流结束时）
+	flushToolCall := func(state *responsesToolCallState, force bool) bool {
+		if state == nil || state.callID == "" {
+			return true
+		}
+		if state.name == "" && !force {
 			return true
 		}
 		if outputText.Len() > 0 {
 			// Prefer streaming assistant text over tool calls to match non-stream behavior.
 			return true
 		}
+		argsDelta := state.args[len(state.sentArgs):]
+		if state.index >= 0 && argsDelta == "" {
+			return true
+		}
 		if !sendStartIfNeeded() {
 			return false
 		}
 
-		idx, ok := toolCallIndexByID[callID]
-		if !ok {
-			idx = len(toolCallIndexByID)
-			toolCallIndexByID[callID] = idx
-		}
-		if name != "" {
-			toolCallNameByID[callID] = name
-		}
-		if toolCallNameByID[callID] != "" {
-			name = toolCallNameByID[callID]
-		}
-
 		tool := dto.ToolCallResponse{
-			ID:   callID,
 			Type: "function",
 			Function: dto.FunctionResponse{
 				Arguments: argsDelta,
 			},
 		}
-		tool.SetIndex(idx)
-		if name != "" && !toolCallNameSent[callID] {
-			tool.Function.Name = name
-			toolCallNameSent[callID] = true
+		if state.index < 0 {
+			state.index = nextToolCallIndex
+			nextToolCallIndex++
+			// 只有首个 chunk 携带 id 与函数名，客户端按 index 拼接后续参数片段
+			tool.ID = state.callID
+			tool.Function.Name = state.name
 		}
+		tool.SetIndex(state.index)
 
 		chunk := &dto.ChatCompletionsStreamResponse{
 			Id:      responseId,
@@ -284,6 +325,7 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		if !sendChatChunk(chunk) {
 			return false
 		}
+		state.sentArgs = state.args
 		sawToolCall = true
 
 		// Include tool call data in the local builder for fallback token estimation.
@@ -296,6 +338,15 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		return true
 	}
 
+	flushAllToolCalls := func() bool {
+		for _, state := range toolCallOrder {
+			if !flushToolCall(state, true) {
+				return false
+			}
+		}
+		return true
+	}
+
 	helper.StreamScannerHandler(c, resp, info, func(data string, sr *helper.StreamResult) {
 		if streamErr != nil {
 			sr.Stop(streamErr)
@@ -312,6 +363,9 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		switch streamResp.Type {
 		case "response.created":
 			if streamResp.Response != nil {
+				if info.UseUpstreamResponseID && streamResp.Response.ID != "" && !sentStart {
+					responseId = streamResp.Response.ID
+				}
 				if streamResp.Response.Model != "" {
 					model = streamResp.Response.Model
 				}
@@ -397,50 +451,51 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 
 			itemID := strings.TrimSpace(streamResp.Item.ID)
 			callID := strings.TrimSpace(streamResp.Item.CallId)
-			if callID == "" {
-				callID = itemID
+			if itemID == "" {
+				itemID = callID
 			}
-			if itemID != "" && callID != "" {
-				toolCallCanonicalIDByItemID[itemID] = callID
+			if itemID == "" {
+				break
 			}
-			name := strings.TrimSpace(streamResp.Item.Name)
-			if name != "" {
-				toolCallNameByID[callID] = name
+			state := getToolCallState(itemID)
+			if callID != "" {
+				state.callID = callID
+			} else if state.callID == "" {
+				state.callID = itemID
 			}
-
-			newArgs := streamResp.Item.Arguments
-			prevArgs := toolCallArgsByID[callID]
-			argsDelta := ""
-			if newArgs != "" {
-				if strings.HasPrefix(newArgs, prevArgs) {
-					argsDelta = newArgs[len(prevArgs):]
-				} else {
-					argsDelta = newArgs
-				}
-				toolCallArgsByID[callID] = newArgs
+			if name := strings.TrimSpace(streamResp.Item.Name); name != "" {
+				state.name = name
 			}
+			state.mergeFullArguments(streamResp.Item.Arguments)
 
-			if !sendToolCallDelta(callID, name, argsDelta) {
+			if !flushToolCall(state, streamResp.Type == "response.output_item.done") {
 				sr.Stop(streamErr)
 				return
 			}
 
 		case "response.function_call_arguments.delta":
 			itemID := strings.TrimSpace(streamResp.ItemID)
-			callID := toolCallCanonicalIDByItemID[itemID]
-			if callID == "" {
-				callID = itemID
-			}
-			if callID == "" {
+			if itemID == "" {
 				break
 			}
-			toolCallArgsByID[callID] += streamResp.Delta
-			if !sendToolCallDelta(callID, "", streamResp.Delta) {
+			state := getToolCallState(itemID)
+			state.args += streamResp.Delta
+			if !flushToolCall(state, false) {
 				sr.Stop(streamErr)
 				return
 			}
 
 		case "response.function_call_arguments.done":
+			itemID := strings.TrimSpace(streamResp.ItemID)
+			if itemID == "" {
+				break
+			}
+			state := getToolCallState(itemID)
+			state.mergeFullArguments(streamResp.Arguments)
+			if !flushToolCall(state, false) {
+				sr.Stop(streamErr)
+				return
+			}
 
 		case "response.completed":
 			if streamResp.Response != nil {
@@ -475,7 +530,7 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 				}
 			}
 
-			if !sendStartIfNeeded() {
+			if !sendStartIfNeeded() || !flushAllToolCalls() {
 				sr.Stop(streamErr)
 				return
 			}
@@ -499,11 +554,13 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 			if streamResp.Response != nil {
 				if oaiErr := streamResp.Response.GetOpenAIError(); oaiErr != nil && oaiErr.Type != "" {
 					streamErr = types.WithOpenAIError(*oaiErr, http.StatusInternalServerError)
+					upstreamErr = true
 					sr.Stop(streamErr)
 					return
 				}
 			}
 			streamErr = types.NewOpenAIError(fmt.Errorf("responses stream error: %s", streamResp.Type), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+			upstreamErr = true
 			sr.Stop(streamErr)
 			return
 
@@ -511,8 +568,15 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		}
 	})
 
+	stoppedByError := false
 	if streamErr != nil {
-		return nil, streamErr
+		// 上游在已输出部分内容后报错时，可按配置以 finish_reason=error 结束流，保留已下发内容并按其计费
+		if !upstreamErr || !info.PreservePartialOnStreamError || usageText.Len() == 0 || sentStop {
+			return nil, streamErr
+		}
+		logger.LogWarn(c, fmt.Sprintf("responses stream interrupted by upstream error, preserving partial output: %s", streamErr.Error()))
+		stoppedByError = true
+		usage = &dto.Usage{}
 	}
 
 	if usage.TotalTokens == 0 {
@@ -523,13 +587,19 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		if !sendChatChunk(helper.GenerateStartEmptyResponse(responseId, createAt, model, nil)) {
 			return nil, streamErr
 		}
+		sentStart = true
+	}
+	if !sentStop && !flushAllToolCalls() {
+		return nil, streamErr
 	}
 	if !sentStop {
 		if info.RelayFormat == types.RelayFormatClaude && info.ClaudeConvertInfo != nil {
 			info.ClaudeConvertInfo.Usage = usage
 		}
 		finishReason := "stop"
-		if sawToolCall && outputText.Len() == 0 {
+		if stoppedByError {
+			finishReason = "error"
+		} else if sawToolCall && outputText.Len() == 0 {
 			finishReason = "tool_calls"
 		}
 		stop := helper.GenerateStopResponse(responseId, createAt, model, finishReason)
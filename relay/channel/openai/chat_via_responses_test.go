@@ -0,0 +1,243 @@
+package openai
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const responsesStreamWithMidError = "data: {\"type\":\"response.created\",\"response\":{\"model\":\"gpt-test\"}}\n" +
+	"data: {\"type\":\"response.output_text.delta\",\"delta\":\"hello world\"}\n" +
+	"data: {\"type\":\"response.failed\"}\n"
+
+func runResponsesToChatStream(t *testing.T, body string, preserve bool) (*httptest.ResponseRecorder, *relaycommon.RelayInfo, func() (int, *types.NewAPIError)) {
+	t.Helper()
+
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 30
+	t.Cleanup(func() { constant.StreamingTimeout = oldTimeout })
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:                  types.RelayFormatOpenAI,
+		PreservePartialOnStreamError: preserve,
+		ChannelMeta:                  &relaycommon.ChannelMeta{UpstreamModelName: "gpt-test"},
+	}
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+
+	return recorder, info, func() (int, *types.NewAPIError) {
+		usage, err := OaiResponsesToChatStreamHandler(c, info, resp)
+		if usage == nil {
+			return 0, err
+		}
+		return usage.CompletionTokens, err
+	}
+}
+
+func TestOaiResponsesToChatStreamHandler_MidStreamErrorFailsByDefault(t *testing.T) {
+	_, _, run := runResponsesToChatStream(t, responsesStreamWithMidError, false)
+
+	_, err := run()
+	require.NotNil(t, err)
+}
+
+func TestOaiResponsesToChatStreamHandler_PreservePartialOnStreamError(t *testing.T) {
+	recorder, _, run := runResponsesToChatStream(t, responsesStreamWithMidError, true)
+
+	completionTokens, err := run()
+	require.Nil(t, err)
+	require.Greater(t, completionTokens, 0)
+
+	body := recorder.Body.String()
+	require.Contains(t, body, "hello world")
+	require.Contains(t, body, `"finish_reason":"error"`)
+	require.Contains(t, body, "[DONE]")
+}
+
+func TestOaiResponsesToChatStreamHandler_PreserveSkipsErrorBeforeOutput(t *testing.T) {
+	body := "data: {\"type\":\"response.created\",\"response\":{\"model\":\"gpt-test\"}}\n" +
+		"data: {\"type\":\"response.failed\"}\n"
+	_, _, run := runResponsesToChatStream(t, body, true)
+
+	// 尚未输出任何内容时仍按错误返回，便于重试其他渠道
+	_, err := run()
+	require.NotNil(t, err)
+}
+
+func TestOaiResponsesToChatHandler_UsesUpstreamResponseIDWhenStateful(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:           types.RelayFormatOpenAI,
+		UseUpstreamResponseID: true,
+		ChannelMeta:           &relaycommon.ChannelMeta{UpstreamModelName: "gpt-test"},
+	}
+	body := `{"id":"resp_456","object":"response","model":"gpt-test","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hi"}]}],"usage":{"input_tokens":3,"output_tokens":1,"total_tokens":4}}`
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+
+	_, err := OaiResponsesToChatHandler(c, info, resp)
+	require.Nil(t, err)
+	require.Contains(t, recorder.Body.String(), `"id":"resp_456"`)
+}
+
+func TestOaiResponsesToChatStreamHandler_UsesUpstreamResponseIDWhenStateful(t *testing.T) {
+	body := "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_789\",\"model\":\"gpt-test\"}}\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_789\",\"model\":\"gpt-test\"}}\n"
+	recorder, info, run := runResponsesToChatStream(t, body, false)
+	info.UseUpstreamResponseID = true
+
+	_, err := run()
+	require.Nil(t, err)
+	require.Contains(t, recorder.Body.String(), `"id":"resp_789"`)
+	require.NotContains(t, recorder.Body.String(), "chatcmpl-")
+}
+
+func TestOaiResponsesToChatStreamHandler_StreamsMultipleToolCalls(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","response":{"model":"gpt-test"}}`,
+		`{"type":"response.output_item.added","output_index":0,"item":{"type":"function_call","id":"fc_1","call_id":"call_weather","name":"get_weather","arguments":""}}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":0,"delta":"{\"city\":"}`,
+		// 第二个调用的参数片段先于 output_item.added 到达，需要缓存到拿到 call_id 与函数名之后再下发
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_2","output_index":1,"delta":"{\"query\":\"new"}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":0,"delta":"\"Paris\""}`,
+		`{"type":"response.output_item.added","output_index":1,"item":{"type":"function_call","id":"fc_2","call_id":"call_search","name":"search","arguments":""}}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_2","output_index":1,"delta":"s\"}"}`,
+		// done 事件补齐缺失的结尾片段
+		`{"type":"response.function_call_arguments.done","item_id":"fc_1","output_index":0,"arguments":"{\"city\":\"Paris\"}"}`,
+		`{"type":"response.output_item.done","output_index":0,"item":{"type":"function_call","id":"fc_1","call_id":"call_weather","name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}`,
+		`{"type":"response.output_item.done","output_index":1,"item":{"type":"function_call","id":"fc_2","call_id":"call_search","name":"search","arguments":"{\"query\":\"news\"}"}}`,
+		`{"type":"response.completed","response":{"model":"gpt-test"}}`,
+	}
+	var body strings.Builder
+	for _, event := range events {
+		body.WriteString("data: " + event + "\n")
+	}
+	recorder, _, run := runResponsesToChatStream(t, body.String(), false)
+
+	_, err := run()
+	require.Nil(t, err)
+
+	type reconstructed struct {
+		ids  []string
+		name string
+		args string
+	}
+	calls := make(map[int]*reconstructed)
+	finishReason := ""
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		payload, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok || payload == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(payload, &chunk))
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+			for _, tool := range choice.Delta.ToolCalls {
+				require.NotNil(t, tool.Index)
+				call, ok := calls[*tool.Index]
+				if !ok {
+					call = &reconstructed{}
+					calls[*tool.Index] = call
+				}
+				if tool.ID != "" {
+					call.ids = append(call.ids, tool.ID)
+				}
+				call.name += tool.Function.Name
+				call.args += tool.Function.Arguments
+			}
+		}
+	}
+
+	require.Equal(t, "tool_calls", finishReason)
+	require.Len(t, calls, 2)
+	expected := []struct {
+		id   string
+		name string
+		args map[string]any
+	}{
+		{id: "call_weather", name: "get_weather", args: map[string]any{"city": "Paris"}},
+		{id: "call_search", name: "search", args: map[string]any{"query": "news"}},
+	}
+	for idx, want := range expected {
+		call := calls[idx]
+		require.NotNil(t, call)
+		// id 与函数名只在首个 chunk 中出现，客户端拼接后仍然正确
+		require.Equal(t, []string{want.id}, call.ids)
+		require.Equal(t, want.name, call.name)
+		var args map[string]any
+		require.NoError(t, common.UnmarshalJsonStr(call.args, &args), call.args)
+		require.Equal(t, want.args, args)
+	}
+}
+
+func TestOaiResponsesToChatHandler_ReasoningContentPassThrough(t *testing.T) {
+	body := `{"id":"resp_1","object":"response","model":"gpt-test","output":[` +
+		`{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"step one"},{"type":"summary_text","text":"step two"}]},` +
+		`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"answer"}]}],` +
+		`"usage":{"input_tokens":3,"output_tokens":1,"total_tokens":4}}`
+
+	for _, enabled := range []bool{false, true} {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		info := &relaycommon.RelayInfo{
+			RelayFormat: types.RelayFormatOpenAI,
+			ChannelMeta: &relaycommon.ChannelMeta{
+				UpstreamModelName: "gpt-test",
+				ChannelSetting:    dto.ChannelSettings{ResponsesReasoningContent: enabled},
+			},
+		}
+		resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+
+		_, err := OaiResponsesToChatHandler(c, info, resp)
+		require.Nil(t, err)
+
+		var chatResp dto.OpenAITextResponse
+		require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &chatResp))
+		require.Len(t, chatResp.Choices, 1)
+		require.Equal(t, "answer", chatResp.Choices[0].Message.StringContent())
+		if enabled {
+			require.Equal(t, "step one\n\nstep two", chatResp.Choices[0].Message.ReasoningContent)
+		} else {
+			require.Empty(t, chatResp.Choices[0].Message.ReasoningContent)
+		}
+	}
+}
+
+func TestOaiResponsesToChatStreamHandler_ReasoningContentAlwaysStreamed(t *testing.T) {
+	body := "data: {\"type\":\"response.created\",\"response\":{\"model\":\"gpt-test\"}}\n" +
+		"data: {\"type\":\"response.reasoning_summary_text.delta\",\"item_id\":\"rs_1\",\"delta\":\"thinking\"}\n" +
+		"data: {\"type\":\"response.reasoning_summary_text.done\",\"item_id\":\"rs_1\"}\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"answer\"}\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"model\":\"gpt-test\"}}\n"
+
+	// 流式响应不受渠道与模型设置影响，始终返回推理摘要
+	for _, enabled := range []bool{false, true} {
+		recorder, info, run := runResponsesToChatStream(t, body, false)
+		info.ChannelSetting.ResponsesReasoningContent = enabled
+		_, err := run()
+		require.Nil(t, err)
+		require.Contains(t, recorder.Body.String(), "answer")
+		require.Contains(t, recorder.Body.String(), `"reasoning_content":"thinking"`)
+	}
+}
@@ -476,8 +476,6 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 			taskResult.Reason = aliResp.Message
 		} else if aliResp.Output.Message != "" {
 			taskResult.Reason = fmt.Sprintf("task failed, code: %s , message: %s", aliResp.Output.Code, aliResp.Output.Message)
-		} else {
-			taskResult.Reason = "task failed"
 		}
 	default:
 		taskResult.Status = model.TaskStatusQueued
@@ -212,9 +212,6 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	case TaskStatusFailed:
 		taskResult.Status = model.TaskStatusFailure
 		taskResult.Progress = "100%"
-		if taskResult.Reason == "" {
-			taskResult.Reason = "task failed"
-		}
 	default:
 		taskResult.Status = model.TaskStatusInProgress
 		taskResult.Progress = "30%"
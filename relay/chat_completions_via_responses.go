@@ -2,6 +2,8 @@ package relay
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -70,13 +72,55 @@ func applySystemPromptIfNeeded(c *gin.Context, info *relaycommon.RelayInfo, requ
 	}
 }
 
+// checkConvertedRequestSize 在发送前校验转换后的请求体大小，转换可能使请求体明显膨胀，
+// 超限时直接返回明确错误，而不是交给上游返回难以定位的拒绝
+func checkConvertedRequestSize(originalSize int, convertedSize int) *types.NewAPIError {
+	limit := constant.ConvertedRequestMaxBodyKB << 10
+	if limit <= 0 || convertedSize <= limit {
+		return nil
+	}
+	return types.NewErrorWithStatusCode(
+		fmt.Errorf("converted request body too large: original %d bytes, converted %d bytes, limit %d bytes", originalSize, convertedSize, limit),
+		types.ErrorCodeConvertedRequestTooLarge,
+		http.StatusRequestEntityTooLarge,
+		types.ErrOptionWithSkipRetry(),
+	)
+}
+
+// responsesConversionError 标记 Chat → Responses 请求转换阶段的失败。
+// 此时尚未向上游发送请求，可按渠道设置安全地回退到原生 Chat 接口
+type responsesConversionError struct {
+	err error
+}
+
+func (e *responsesConversionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responsesConversionError) Unwrap() error {
+	return e.err
+}
+
+// shouldFallbackToNativeChat 判断是否应在 Responses 转换失败后回退到原生 Chat 接口
+func shouldFallbackToNativeChat(info *relaycommon.RelayInfo, apiErr *types.NewAPIError) bool {
+	if info == nil || apiErr == nil || !info.ChannelSetting.FallbackToNativeChatOnResponsesError {
+		return false
+	}
+	var convErr *responsesConversionError
+	return errors.As(apiErr, &convErr)
+}
+
 func chatCompletionsViaResponses(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.GeneralOpenAIRequest) (*dto.Usage, *types.NewAPIError) {
+	// 每次尝试按当前渠道设置重新赋值，避免重试到其他渠道时沿用上一渠道开启的状态
+	info.PreservePartialOnStreamError = info.ChannelOtherSettings.PreservePartialOnStreamError
+
 	chatJSON, err := common.Marshal(request)
 	if err != nil {
 		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 
-	chatJSON, err = relaycommon.RemoveDisabledFields(chatJSON, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	// 转换前后各移除一次，覆盖客户端原样发送及转换后新增的字段
+	chatJSON, err = relaycommon.RemoveDisabledFields(chatJSON, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled, info.OriginModelName, info.UpstreamModelName)
 	if err != nil {
 		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
@@ -88,15 +132,23 @@ func chatCompletionsViaResponses(c *gin.Context, info *relaycommon.RelayInfo, ad
 		}
 	}
 
-	var overriddenChatReq dto.GeneralOpenAIRequest
-	if err := common.Unmarshal(chatJSON, &overriddenChatReq); err != nil {
-		return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
-	}
+	// 重试到其他渠道时，若应用渠道设置后的请求体未变化，直接复用上次的转换结果
+	responsesReq, cached := info.GetCachedResponsesConversion(chatJSON)
+	if !cached {
+		var overriddenChatReq dto.GeneralOpenAIRequest
+		if err := common.Unmarshal(chatJSON, &overriddenChatReq); err != nil {
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+		}
 
-	responsesReq, err := service.ChatCompletionsRequestToResponsesRequest(&overriddenChatReq)
-	if err != nil {
-		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		responsesReq, err = service.ChatCompletionsRequestToResponsesRequest(&overriddenChatReq)
+		if err != nil {
+			return nil, types.NewErrorWithStatusCode(&responsesConversionError{err: err}, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		info.SetCachedResponsesConversion(chatJSON, responsesReq)
 	}
+	savedUseUpstreamResponseID := info.UseUpstreamResponseID
+	savedConversionChain := append([]types.RelayFormat(nil), info.RequestConversionChain...)
+	info.UseUpstreamResponseID = responsesReq.IsStateful()
 	info.AppendRequestConversion(types.RelayFormatOpenAIResponses)
 
 	savedRelayMode := info.RelayMode
@@ -111,7 +163,10 @@ func chatCompletionsViaResponses(c *gin.Context, info *relaycommon.RelayInfo, ad
 
 	convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, info, *responsesReq)
 	if err != nil {
-		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		// 转换失败时还原转换链等状态，便于回退到原生 Chat 接口
+		info.UseUpstreamResponseID = savedUseUpstreamResponseID
+		info.RequestConversionChain = savedConversionChain
+		return nil, types.NewError(&responsesConversionError{err: err}, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
 
@@ -120,11 +175,15 @@ func chatCompletionsViaResponses(c *gin.Context, info *relaycommon.RelayInfo, ad
 		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 
-	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled, info.OriginModelName, info.UpstreamModelName)
 	if err != nil {
 		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 
+	if apiErr := checkConvertedRequestSize(len(chatJSON), len(jsonData)); apiErr != nil {
+		return nil, apiErr
+	}
+
 	var requestBody io.Reader = bytes.NewBuffer(jsonData)
 
 	var httpResp *http.Response
@@ -151,15 +210,17 @@ func chatCompletionsViaResponses(c *gin.Context, info *relaycommon.RelayInfo, ad
 	// Some upstreams may return SSE even when the request didn't declare `stream=true`.
 	// In such cases, acquire SSE concurrency slot here to avoid bypassing limits.
 	if info.IsStream && !wasStream {
-		releaseSSESlot, acquireErr := service.AcquireSSEConcurrencySlot(info.UserId, info.TokenId)
+		releaseSSESlot, acquireErr := service.AcquireSSEConcurrencySlotFor(c.Request.Context(), service.SSEConcurrencyIdentity{
+			UserID:   info.UserId,
+			TokenID:  info.TokenId,
+			Group:    info.UserGroup,
+			ClientIP: common.ResolveClientIP(c),
+		})
 		if acquireErr != nil {
 			if httpResp != nil && httpResp.Body != nil {
 				_ = httpResp.Body.Close()
 			}
-			return nil, types.NewOpenAIError(acquireErr, types.ErrorCodeSSEConcurrencyLimitExceeded, http.StatusTooManyRequests,
-				types.ErrOptionWithSkipRetry(),
-				types.ErrOptionWithNoRecordErrorLog(),
-			)
+			return nil, service.NewSSEConcurrencyLimitAPIError(c, acquireErr)
 		}
 		defer releaseSSESlot()
 	}
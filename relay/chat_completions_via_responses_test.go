@@ -0,0 +1,44 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldFallbackToNativeChat(t *testing.T) {
+	convErr := types.NewErrorWithStatusCode(&responsesConversionError{err: errors.New("unsupported content")}, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	otherErr := types.NewError(errors.New("marshal failed"), types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+
+	disabled := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+	require.False(t, shouldFallbackToNativeChat(disabled, convErr))
+
+	enabled := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+	enabled.ChannelSetting = dto.ChannelSettings{FallbackToNativeChatOnResponsesError: true}
+	require.True(t, shouldFallbackToNativeChat(enabled, convErr))
+	require.False(t, shouldFallbackToNativeChat(enabled, otherErr))
+	require.False(t, shouldFallbackToNativeChat(enabled, nil))
+	require.Equal(t, "unsupported content", convErr.Error())
+}
+
+func TestChatCompletionsViaResponses_ResetsPreservePartialPerAttempt(t *testing.T) {
+	// 上一次尝试的渠道开启了保留部分输出，本次尝试的渠道未开启
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}, PreservePartialOnStreamError: true}
+	// 无效的 RawMessage 使请求序列化失败，在转发前返回
+	request := &dto.GeneralOpenAIRequest{Functions: json.RawMessage("{")}
+
+	_, apiErr := chatCompletionsViaResponses(nil, info, nil, request)
+	require.NotNil(t, apiErr)
+	require.False(t, info.PreservePartialOnStreamError)
+
+	info.ChannelOtherSettings.PreservePartialOnStreamError = true
+	_, apiErr = chatCompletionsViaResponses(nil, info, nil, request)
+	require.NotNil(t, apiErr)
+	require.True(t, info.PreservePartialOnStreamError)
+}
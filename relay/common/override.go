@@ -132,27 +132,7 @@ func ApplyParamOverride(jsonData []byte, paramOverride map[string]interface{}, c
 	if len(paramOverride) == 0 {
 		return jsonData, nil
 	}
-	auditRecorder := getParamOverrideAuditRecorder(conditionContext)
-
-	// 尝试断言为操作格式
-	if operations, ok := tryParseOperations(paramOverride); ok {
-		legacyOverride := buildLegacyParamOverride(paramOverride)
-		workingJSON := jsonData
-		var err error
-		if len(legacyOverride) > 0 {
-			workingJSON, err = applyOperationsLegacy(workingJSON, legacyOverride, auditRecorder)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		// 使用新方法
-		result, err := applyOperations(string(workingJSON), operations, conditionContext)
-		return []byte(result), err
-	}
-
-	// 直接使用旧方法
-	return applyOperationsLegacy(jsonData, paramOverride, auditRecorder)
+	return CompileParamOverride(paramOverride).Apply(jsonData, conditionContext)
 }
 
 func buildLegacyParamOverride(paramOverride map[string]interface{}) map[string]interface{} {
@@ -181,7 +161,7 @@ func ApplyParamOverrideWithRelayInfo(jsonData []byte, info *RelayInfo) ([]byte,
 		recorder = &paramOverrideAuditRecorder{}
 		overrideCtx[paramOverrideContextAuditRecorder] = recorder
 	}
-	result, err := ApplyParamOverride(jsonData, paramOverride, overrideCtx)
+	result, err := getCompiledParamOverride(info, paramOverride).Apply(jsonData, overrideCtx)
 	if err != nil {
 		return nil, err
 	}
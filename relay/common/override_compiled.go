@@ -0,0 +1,118 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// compiledParamOverrideCache 按参数覆盖配置的版本（原始 JSON 的哈希）缓存编译结果，
+// 配置变更后版本随之变化，旧条目自然过期
+var compiledParamOverrideCache = common.NewTTLCacheFromEnv[string, *CompiledParamOverride]("param_override_compiled", 1024, 10*time.Minute)
+
+// CompiledParamOverride 是预先拆分好旧格式键与 operations 的参数覆盖规则，
+// 编译结果在请求间共享，应用时不会修改其内容
+type CompiledParamOverride struct {
+	raw        map[string]interface{}
+	legacy     map[string]interface{}
+	operations []ParamOperation
+	useOps     bool
+}
+
+// CompileParamOverride 解析参数覆盖配置，结果与 ApplyParamOverride 的逐次解析等价
+func CompileParamOverride(paramOverride map[string]interface{}) *CompiledParamOverride {
+	compiled := &CompiledParamOverride{raw: paramOverride}
+	if len(paramOverride) == 0 {
+		return compiled
+	}
+	if operations, ok := tryParseOperations(paramOverride); ok {
+		compiled.operations = operations
+		compiled.legacy = buildLegacyParamOverride(paramOverride)
+		compiled.useOps = true
+	}
+	return compiled
+}
+
+func (p *CompiledParamOverride) Apply(jsonData []byte, conditionContext map[string]interface{}) ([]byte, error) {
+	if p == nil || len(p.raw) == 0 {
+		return jsonData, nil
+	}
+	auditRecorder := getParamOverrideAuditRecorder(conditionContext)
+	if !p.useOps {
+		// 直接使用旧方法
+		return applyOperationsLegacy(jsonData, p.raw, auditRecorder)
+	}
+
+	workingJSON := jsonData
+	var err error
+	if len(p.legacy) > 0 {
+		workingJSON, err = applyOperationsLegacy(workingJSON, p.legacy, auditRecorder)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result, err := applyOperations(string(workingJSON), p.operations, conditionContext)
+	return []byte(result), err
+}
+
+// getCompiledParamOverride 在渠道提供了配置版本时复用缓存的编译结果，否则即时编译
+func getCompiledParamOverride(info *RelayInfo, paramOverride map[string]interface{}) *CompiledParamOverride {
+	version := ""
+	if info != nil && info.ChannelMeta != nil {
+		version = info.ChannelMeta.ParamOverrideVersion
+	}
+	if version == "" {
+		return CompileParamOverride(paramOverride)
+	}
+	if compiled, ok := compiledParamOverrideCache.Get(version); ok {
+		return compiled
+	}
+	compiled := CompileParamOverride(paramOverride)
+	compiledParamOverrideCache.Set(version, compiled)
+	return compiled
+}
+
+// CountParamOverrideOperations 统计参数覆盖配置中的操作数：旧格式每个键计一次，operations 中每项计一次
+func CountParamOverrideOperations(paramOverride map[string]interface{}) int {
+	count := 0
+	for key, value := range paramOverride {
+		if !strings.EqualFold(strings.TrimSpace(key), "operations") {
+			count++
+			continue
+		}
+		switch ops := value.(type) {
+		case []interface{}:
+			count += len(ops)
+		case []map[string]interface{}:
+			count += len(ops)
+		default:
+			count++
+		}
+	}
+	return count
+}
+
+// ValidateParamOverrideSpec 在保存渠道时校验参数覆盖配置，JSON 非法或操作数超过
+// PARAM_OVERRIDE_MAX_OPERATIONS 时返回错误，空配置视为合法
+func ValidateParamOverrideSpec(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	paramOverride := make(map[string]interface{})
+	if err := common.Unmarshal([]byte(raw), &paramOverride); err != nil {
+		return errors.New("参数覆盖必须是合法的 JSON 格式")
+	}
+	limit := constant.ParamOverrideMaxOperations
+	if limit <= 0 {
+		return nil
+	}
+	if count := CountParamOverrideOperations(paramOverride); count > limit {
+		return fmt.Errorf("参数覆盖操作数 %d 超过上限 %d", count, limit)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+func buildBenchmarkParamOverrideJSON(operationCount int) []byte {
+	ops := make([]string, 0, operationCount)
+	for i := 0; i < operationCount; i++ {
+		ops = append(ops, fmt.Sprintf(`{"path":"metadata.k%d","mode":"set","value":"v%d","conditions":[{"path":"model","mode":"prefix","value":"gpt"}]}`, i, i))
+	}
+	return []byte(`{"temperature":0.2,"operations":[` + strings.Join(ops, ",") + `]}`)
+}
+
+func TestCountParamOverrideOperations(t *testing.T) {
+	override := map[string]interface{}{
+		"temperature": 0.1,
+		"top_p":       0.9,
+		"operations": []interface{}{
+			map[string]interface{}{"path": "model", "mode": "trim_prefix", "value": "openai/"},
+			map[string]interface{}{"path": "stream", "mode": "delete"},
+		},
+	}
+	if got := CountParamOverrideOperations(override); got != 4 {
+		t.Fatalf("expected 4 operations, got %d", got)
+	}
+	if got := CountParamOverrideOperations(nil); got != 0 {
+		t.Fatalf("expected 0 operations, got %d", got)
+	}
+}
+
+func TestValidateParamOverrideSpec(t *testing.T) {
+	old := constant.ParamOverrideMaxOperations
+	t.Cleanup(func() { constant.ParamOverrideMaxOperations = old })
+	constant.ParamOverrideMaxOperations = 2
+
+	if err := ValidateParamOverrideSpec(""); err != nil {
+		t.Fatalf("empty spec should be valid: %v", err)
+	}
+	if err := ValidateParamOverrideSpec(`{"temperature":0.1,"top_p":0.9}`); err != nil {
+		t.Fatalf("spec within limit should be valid: %v", err)
+	}
+	if err := ValidateParamOverrideSpec(`{"temperature":0.1,"operations":[{"path":"a","mode":"delete"},{"path":"b","mode":"delete"}]}`); err == nil {
+		t.Fatalf("expected spec exceeding limit to be rejected")
+	}
+	if err := ValidateParamOverrideSpec(`{not json}`); err == nil {
+		t.Fatalf("expected invalid JSON to be rejected")
+	}
+
+	constant.ParamOverrideMaxOperations = 0
+	if err := ValidateParamOverrideSpec(`{"temperature":0.1,"operations":[{"path":"a","mode":"delete"},{"path":"b","mode":"delete"}]}`); err != nil {
+		t.Fatalf("limit 0 should disable the check: %v", err)
+	}
+}
+
+func TestApplyParamOverrideWithRelayInfoUsesCompiledCache(t *testing.T) {
+	version := "test-compiled-cache-version"
+	t.Cleanup(func() { compiledParamOverrideCache.Delete(version) })
+
+	info := &RelayInfo{
+		ChannelMeta: &ChannelMeta{
+			ParamOverride: map[string]interface{}{
+				"temperature": 0.3,
+				"operations": []interface{}{
+					map[string]interface{}{"path": "model", "mode": "trim_prefix", "value": "openai/"},
+				},
+			},
+			ParamOverrideVersion: version,
+		},
+	}
+	out, err := ApplyParamOverrideWithRelayInfo([]byte(`{"model":"openai/gpt-4"}`), info)
+	if err != nil {
+		t.Fatalf("ApplyParamOverrideWithRelayInfo returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-4","temperature":0.3}`, string(out))
+
+	cached, ok := compiledParamOverrideCache.Get(version)
+	if !ok || !cached.useOps || len(cached.operations) != 1 {
+		t.Fatalf("expected compiled override to be cached, got %+v", cached)
+	}
+
+	// 同一版本再次应用时复用缓存结果，与直接应用一致
+	out, err = ApplyParamOverrideWithRelayInfo([]byte(`{"model":"openai/gpt-4o"}`), info)
+	if err != nil {
+		t.Fatalf("ApplyParamOverrideWithRelayInfo returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"gpt-4o","temperature":0.3}`, string(out))
+}
+
+// BenchmarkApplyParamOverride_Uncached 模拟缓存前每个请求都从 JSON 解析配置再应用
+func BenchmarkApplyParamOverride_Uncached(b *testing.B) {
+	raw := buildBenchmarkParamOverrideJSON(50)
+	input := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		override := make(map[string]interface{})
+		if err := common2.Unmarshal(raw, &override); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ApplyParamOverride(input, override, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkApplyParamOverride_Compiled 复用按版本缓存的编译结果
+func BenchmarkApplyParamOverride_Compiled(b *testing.B) {
+	override := make(map[string]interface{})
+	if err := common2.Unmarshal(buildBenchmarkParamOverrideJSON(50), &override); err != nil {
+		b.Fatal(err)
+	}
+	compiled := CompileParamOverride(override)
+	input := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := compiled.Apply(input, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -71,6 +74,8 @@ type ChannelMeta struct {
 	Organization         string
 	ChannelCreateTime    int64
 	ParamOverride        map[string]interface{}
+	// ParamOverrideVersion 渠道原始参数覆盖配置的哈希，非空时复用缓存的编译结果
+	ParamOverrideVersion string
 	HeadersOverride      map[string]interface{}
 	ChannelSetting       dto.ChannelSettings
 	ChannelOtherSettings dto.ChannelOtherSettings
@@ -120,7 +125,13 @@ type RelayInfo struct {
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
 	ReceivedResponseCount  int
-	FinalPreConsumedQuota  int // 最终预消耗的配额
+	// DataEventCount 上游发来的 data 事件数（不含 [DONE]，含被预处理器丢弃的数据块）
+	DataEventCount int
+	// ActivityLineCount 上游发来的非 data 行数（注释/保活、event: 等），用于诊断上游以保活为主的"慢"流
+	ActivityLineCount int
+	// PingSentCount 向下游发送的保活 ping 次数（含空闲心跳）
+	PingSentCount         int
+	FinalPreConsumedQuota int // 最终预消耗的配额
 	// ForcePreConsume 为 true 时禁用 BillingSession 的信任额度旁路，
 	// 强制预扣全额。用于异步任务（视频/音乐生成等），因为请求返回后任务仍在运行，
 	// 必须在提交前锁定全额。
@@ -151,6 +162,17 @@ type RelayInfo struct {
 	LastError                             *types.NewAPIError
 	RuntimeHeadersOverride                map[string]interface{}
 	UseRuntimeHeadersOverride             bool
+	// PreservePartialOnStreamError 为 true 时，流式响应中途遇到上游错误不再整体失败，
+	// 而是以 finish_reason=error 结束流，并按已下发内容计费
+	PreservePartialOnStreamError bool
+	// UseUpstreamResponseID 为 true 时，chat → responses 转换的响应使用上游 response id 作为 chat id，
+	// 客户端可将其作为 previous_response_id 续接有状态会话
+	UseUpstreamResponseID bool
+	// RequestDeadline 客户端通过 X-Request-Timeout-Ms 请求头设置的请求截止时间，零值表示不限制。
+	// 上游请求与流式读取都受该截止时间约束
+	RequestDeadline time.Time
+	// responsesConversion 缓存本次请求 chat → responses 的转换结果，跨渠道重试时复用
+	responsesConversion *chatResponsesConversion
 
 	PriceData types.PriceData
 
@@ -199,6 +221,7 @@ func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 		Organization:         c.GetString("channel_organization"),
 		ChannelCreateTime:    c.GetInt64("channel_create_time"),
 		ParamOverride:        paramOverride,
+		ParamOverrideVersion: common.GetContextKeyString(c, constant.ContextKeyChannelParamOverrideVersion),
 		HeadersOverride:      headerOverride,
 		UpstreamModelName:    common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
 		IsModelMapped:        false,
@@ -479,6 +502,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 
 		StartTime:         startTime,
 		FirstResponseTime: startTime.Add(-time.Second),
+		RequestDeadline:   parseRequestDeadline(c, startTime),
 		ThinkingContentInfo: ThinkingContentInfo{
 			IsFirstThinkingContent:  true,
 			SendLastThinkingContent: false,
@@ -507,6 +531,58 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 	return info
 }
 
+// RequestTimeoutHeader 客户端设置请求预算（毫秒）的请求头
+const RequestTimeoutHeader = "X-Request-Timeout-Ms"
+
+// parseRequestDeadline 解析 X-Request-Timeout-Ms，预算以 MaxClientRequestTimeoutMs 为上限，
+// 未设置、非法或服务端未开启时返回零值
+func parseRequestDeadline(c *gin.Context, startTime time.Time) time.Time {
+	maxMs := operation_setting.GetGeneralSetting().MaxClientRequestTimeoutMs
+	if maxMs <= 0 || c == nil || c.Request == nil {
+		return time.Time{}
+	}
+	raw := strings.TrimSpace(c.GetHeader(RequestTimeoutHeader))
+	if raw == "" {
+		return time.Time{}
+	}
+	timeoutMs, err := strconv.Atoi(raw)
+	if err != nil || timeoutMs <= 0 {
+		return time.Time{}
+	}
+	return startTime.Add(time.Duration(min(timeoutMs, maxMs)) * time.Millisecond)
+}
+
+// RequestBudgetExceeded 判断是否已超过客户端设置的请求预算
+func (info *RelayInfo) RequestBudgetExceeded() bool {
+	return info != nil && !info.RequestDeadline.IsZero() && !time.Now().Before(info.RequestDeadline)
+}
+
+// NormalizeRequestBudgetError 非流式请求在读取上游响应体时触发请求预算截止，
+// 将读取失败映射为 504 request_budget_exceeded，且不再重试其他渠道
+func (info *RelayInfo) NormalizeRequestBudgetError(apiErr *types.NewAPIError) *types.NewAPIError {
+	if apiErr == nil || info.IsStream || !info.RequestBudgetExceeded() {
+		return apiErr
+	}
+	switch apiErr.GetErrorCode() {
+	case types.ErrorCodeRequestBudgetExceeded:
+		return apiErr
+	case types.ErrorCodeReadResponseBodyFailed:
+	default:
+		if !errors.Is(apiErr, context.DeadlineExceeded) {
+			return apiErr
+		}
+	}
+	return types.NewErrorWithStatusCode(fmt.Errorf("request budget exceeded: %w", apiErr.Unwrap()), types.ErrorCodeRequestBudgetExceeded, http.StatusGatewayTimeout, types.ErrOptionWithSkipRetry())
+}
+
+// WithRequestDeadline 基于 parent 派生带请求预算截止时间的上下文，未设置预算时仅可取消
+func (info *RelayInfo) WithRequestDeadline(parent context.Context) (context.Context, context.CancelFunc) {
+	if info == nil || info.RequestDeadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, info.RequestDeadline)
+}
+
 func cloneRequestHeaders(c *gin.Context) map[string]string {
 	if c == nil || c.Request == nil {
 		return nil
@@ -660,6 +736,22 @@ func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
 
+// GetStreamingTimeout 解析本次请求的流式超时：模型配置 > 渠道设置 > 全局 STREAMING_TIMEOUT
+func (info *RelayInfo) GetStreamingTimeout() time.Duration {
+	if seconds := operation_setting.GetModelStreamingTimeoutSeconds(info.OriginModelName); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if info.ChannelMeta != nil {
+		if seconds := operation_setting.GetModelStreamingTimeoutSeconds(info.UpstreamModelName); seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if info.ChannelSetting.StreamingTimeout > 0 {
+			return time.Duration(info.ChannelSetting.StreamingTimeout) * time.Second
+		}
+	}
+	return time.Duration(constant.StreamingTimeout) * time.Second
+}
+
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
@@ -783,7 +875,8 @@ func FailTaskInfo(reason string) *TaskInfo {
 // store: 数据存储授权字段，涉及用户隐私（仅 OpenAI、Responses API 支持，默认允许透传，禁用后可能导致 Codex 无法使用）
 // safety_identifier: 安全标识符，用于向 OpenAI 报告违规用户（仅 OpenAI 支持，涉及用户隐私）
 // stream_options.include_obfuscation: 响应流混淆控制字段（仅 OpenAI Responses API 支持）
-func RemoveDisabledFields(jsonData []byte, channelOtherSettings dto.ChannelOtherSettings, channelPassThroughEnabled bool) ([]byte, error) {
+// 此外移除渠道配置的 DisabledFields 及 modelNames 对应的 ModelDisabledFields（均为顶层字段）
+func RemoveDisabledFields(jsonData []byte, channelOtherSettings dto.ChannelOtherSettings, channelPassThroughEnabled bool, modelNames ...string) ([]byte, error) {
 	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || channelPassThroughEnabled {
 		return jsonData, nil
 	}
@@ -845,6 +938,11 @@ func RemoveDisabledFields(jsonData []byte, channelOtherSettings dto.ChannelOther
 		}
 	}
 
+	// 渠道级与模型级配置的移除字段
+	for _, field := range channelOtherSettings.GetDisabledFields(modelNames...) {
+		delete(data, field)
+	}
+
 	jsonDataAfter, err := common.Marshal(data)
 	if err != nil {
 		common.SysError("RemoveDisabledFields Marshal error :" + err.Error())
@@ -1,9 +1,18 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 )
 
@@ -38,3 +47,114 @@ func TestRelayInfoGetFinalRequestRelayFormatNilReceiver(t *testing.T) {
 	var info *RelayInfo
 	require.Equal(t, types.RelayFormat(""), info.GetFinalRequestRelayFormat())
 }
+
+func TestRelayInfoGetStreamingTimeoutResolution(t *testing.T) {
+	generalSetting := operation_setting.GetGeneralSetting()
+	originalModels, originalTimeout := generalSetting.ModelStreamingTimeoutSeconds, constant.StreamingTimeout
+	t.Cleanup(func() {
+		generalSetting.ModelStreamingTimeoutSeconds, constant.StreamingTimeout = originalModels, originalTimeout
+	})
+	constant.StreamingTimeout = 300
+	generalSetting.ModelStreamingTimeoutSeconds = map[string]int{"slow-reasoner": 900, "upstream-slow": 600, "disabled": 0}
+
+	info := &RelayInfo{OriginModelName: "gpt-4o"}
+	require.Equal(t, 300*time.Second, info.GetStreamingTimeout())
+
+	info.ChannelMeta = &ChannelMeta{ChannelSetting: dto.ChannelSettings{StreamingTimeout: 120}}
+	require.Equal(t, 120*time.Second, info.GetStreamingTimeout())
+
+	info.UpstreamModelName = "upstream-slow"
+	require.Equal(t, 600*time.Second, info.GetStreamingTimeout())
+
+	info.OriginModelName = "slow-reasoner"
+	require.Equal(t, 900*time.Second, info.GetStreamingTimeout())
+
+	info.OriginModelName, info.UpstreamModelName = "disabled", "disabled"
+	require.Equal(t, 120*time.Second, info.GetStreamingTimeout())
+}
+
+func TestRemoveDisabledFieldsMergesChannelAndModelFields(t *testing.T) {
+	settings := dto.ChannelOtherSettings{
+		DisabledFields: []string{"logit_bias", " ", "user"},
+		ModelDisabledFields: map[string][]string{
+			"gpt-5":      {"vendor_param"},
+			"gpt-5-2025": {"top_logprobs"},
+			"gpt-4o":     {"temperature"},
+		},
+	}
+	input := []byte(`{"model":"gpt-5","logit_bias":{"1":2},"user":"u","vendor_param":true,"top_logprobs":2,"temperature":0.5,"input":"hi"}`)
+
+	// 渠道级字段与原始、上游模型的字段取并集
+	out, err := RemoveDisabledFields(input, settings, false, "gpt-5", "gpt-5-2025")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt-5","temperature":0.5,"input":"hi"}`, string(out))
+
+	out, err = RemoveDisabledFields(input, settings, false, "gpt-4o")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt-5","vendor_param":true,"top_logprobs":2,"input":"hi"}`, string(out))
+
+	// 未传模型名时仅移除渠道级字段
+	out, err = RemoveDisabledFields(input, settings, false)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt-5","vendor_param":true,"top_logprobs":2,"temperature":0.5,"input":"hi"}`, string(out))
+
+	// 渠道开启透传时保持原样
+	out, err = RemoveDisabledFields(input, settings, true, "gpt-5")
+	require.NoError(t, err)
+	require.Equal(t, string(input), string(out))
+}
+
+func TestParseRequestDeadline(t *testing.T) {
+	setting := operation_setting.GetGeneralSetting()
+	oldMax := setting.MaxClientRequestTimeoutMs
+	t.Cleanup(func() { setting.MaxClientRequestTimeoutMs = oldMax })
+	setting.MaxClientRequestTimeoutMs = 5000
+
+	start := time.Now()
+	newContext := func(header string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if header != "" {
+			c.Request.Header.Set(RequestTimeoutHeader, header)
+		}
+		return c
+	}
+
+	require.True(t, parseRequestDeadline(newContext(""), start).IsZero())
+	require.True(t, parseRequestDeadline(newContext("abc"), start).IsZero())
+	require.True(t, parseRequestDeadline(newContext("-1"), start).IsZero())
+	require.Equal(t, start.Add(1500*time.Millisecond), parseRequestDeadline(newContext("1500"), start))
+	// 超出服务端上限时按上限截断
+	require.Equal(t, start.Add(5*time.Second), parseRequestDeadline(newContext("60000"), start))
+
+	setting.MaxClientRequestTimeoutMs = 0
+	require.True(t, parseRequestDeadline(newContext("1500"), start).IsZero())
+
+	info := &RelayInfo{}
+	require.False(t, info.RequestBudgetExceeded())
+	info.RequestDeadline = time.Now().Add(-time.Millisecond)
+	require.True(t, info.RequestBudgetExceeded())
+	ctx, cancel := info.WithRequestDeadline(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestRelayInfoNormalizeRequestBudgetError(t *testing.T) {
+	info := &RelayInfo{RequestDeadline: time.Now().Add(-time.Millisecond)}
+
+	readErr := types.NewOpenAIError(context.DeadlineExceeded, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	mapped := info.NormalizeRequestBudgetError(readErr)
+	require.Equal(t, types.ErrorCodeRequestBudgetExceeded, mapped.GetErrorCode())
+	require.Equal(t, http.StatusGatewayTimeout, mapped.StatusCode)
+	require.True(t, types.IsSkipRetryError(mapped))
+
+	// 与预算无关的错误保持不变
+	badRequest := types.NewError(errors.New("bad request"), types.ErrorCodeInvalidRequest)
+	require.Same(t, badRequest, info.NormalizeRequestBudgetError(badRequest))
+
+	// 预算未超出或流式请求时不映射
+	require.Same(t, readErr, (&RelayInfo{}).NormalizeRequestBudgetError(readErr))
+	info.IsStream = true
+	require.Same(t, readErr, info.NormalizeRequestBudgetError(readErr))
+}
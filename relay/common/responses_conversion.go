@@ -0,0 +1,48 @@
+package common
+
+import (
+	"bytes"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// chatResponsesConversion 记录一次 chat → responses 转换的输入与结果。
+// 输入为已应用渠道设置（字段过滤、参数覆盖）后的 chat 请求体，重试到其他渠道时
+// 若该请求体不变，即可跳过反序列化与转换。
+type chatResponsesConversion struct {
+	chatJSON []byte
+	request  *dto.OpenAIResponsesRequest
+}
+
+// GetCachedResponsesConversion 返回与 chatJSON 对应的已缓存转换结果的深拷贝，
+// 调用方可以自由修改返回值而不影响缓存。
+func (info *RelayInfo) GetCachedResponsesConversion(chatJSON []byte) (*dto.OpenAIResponsesRequest, bool) {
+	if info == nil || info.responsesConversion == nil {
+		return nil, false
+	}
+	if !bytes.Equal(info.responsesConversion.chatJSON, chatJSON) {
+		return nil, false
+	}
+	request, err := common.DeepCopy(info.responsesConversion.request)
+	if err != nil {
+		return nil, false
+	}
+	return request, true
+}
+
+// SetCachedResponsesConversion 缓存 chatJSON 的转换结果，仅在本次请求内有效。
+// 缓存保存的是 request 的深拷贝，之后对 request 的修改不会影响缓存。
+func (info *RelayInfo) SetCachedResponsesConversion(chatJSON []byte, request *dto.OpenAIResponsesRequest) {
+	if info == nil || request == nil {
+		return
+	}
+	cached, err := common.DeepCopy(request)
+	if err != nil {
+		return
+	}
+	info.responsesConversion = &chatResponsesConversion{
+		chatJSON: bytes.Clone(chatJSON),
+		request:  cached,
+	}
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedResponsesConversion(t *testing.T) {
+	info := &RelayInfo{}
+	chatJSON := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+
+	_, ok := info.GetCachedResponsesConversion(chatJSON)
+	require.False(t, ok)
+
+	temperature := 0.5
+	original := &dto.OpenAIResponsesRequest{
+		Model:       "gpt-4o",
+		Input:       json.RawMessage(`[{"role":"user","content":"hi"}]`),
+		Temperature: &temperature,
+	}
+	info.SetCachedResponsesConversion(chatJSON, original)
+
+	// 缓存后修改原对象不影响缓存
+	original.Model = "mutated"
+	original.Input[2] = 'X'
+
+	got, ok := info.GetCachedResponsesConversion(chatJSON)
+	require.True(t, ok)
+	require.Equal(t, "gpt-4o", got.Model)
+	require.JSONEq(t, `[{"role":"user","content":"hi"}]`, string(got.Input))
+	require.Equal(t, 0.5, *got.Temperature)
+
+	// 每次取出的都是独立副本，按渠道修改不会污染后续重试
+	got.Model = "channel-specific"
+	*got.Temperature = 1
+	again, ok := info.GetCachedResponsesConversion(chatJSON)
+	require.True(t, ok)
+	require.Equal(t, "gpt-4o", again.Model)
+	require.Equal(t, 0.5, *again.Temperature)
+
+	_, ok = info.GetCachedResponsesConversion([]byte(`{"model":"gpt-4o-mini"}`))
+	require.False(t, ok)
+}
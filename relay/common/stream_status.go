@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,6 +20,12 @@ const (
 	StreamEndReasonEOF         StreamEndReason = "eof"
 	StreamEndReasonPanic       StreamEndReason = "panic"
 	StreamEndReasonPingFail    StreamEndReason = "ping_fail"
+	// StreamEndReasonClientBackpressure 客户端连接仍在但长时间不读取，写队列持续满载
+	StreamEndReasonClientBackpressure StreamEndReason = "client_backpressure"
+	// StreamEndReasonMaxDuration 流总时长超过 MaxStreamDurationSeconds，与最近是否有数据无关
+	StreamEndReasonMaxDuration StreamEndReason = "max_duration"
+	// StreamEndReasonRequestBudget 超过客户端通过 X-Request-Timeout-Ms 设置的请求预算
+	StreamEndReasonRequestBudget StreamEndReason = "request_budget"
 )
 
 const maxStreamErrorEntries = 20
@@ -110,3 +117,32 @@ func (s *StreamStatus) Summary() string {
 	s.mu.Unlock()
 	return b.String()
 }
+
+var streamEndReasonCounters sync.Map // map[StreamEndReason]*atomic.Uint64
+
+// RecordStreamEndReason 按结束原因累计流式请求数，用于区分客户端断开、不读取等异常
+func RecordStreamEndReason(reason StreamEndReason) {
+	if reason == StreamEndReasonNone {
+		return
+	}
+	counter, _ := streamEndReasonCounters.LoadOrStore(reason, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// GetStreamEndReasonStats 返回各结束原因的累计次数
+func GetStreamEndReasonStats() map[string]uint64 {
+	stats := make(map[string]uint64)
+	streamEndReasonCounters.Range(func(key, value any) bool {
+		stats[string(key.(StreamEndReason))] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return stats
+}
+
+// ResetStreamEndReasonStats 清空结束原因统计
+func ResetStreamEndReasonStats() {
+	streamEndReasonCounters.Range(func(key, _ any) bool {
+		streamEndReasonCounters.Delete(key)
+		return true
+	})
+}
@@ -58,7 +58,7 @@ func ClaudeData(c *gin.Context, resp dto.ClaudeResponse) error {
 	jsonData, err := common.Marshal(resp)
 	if err != nil {
 		common.SysError("error marshalling stream response: " + err.Error())
-	} else {
+	} else if !renderTrackedStreamEvent(c, resp.Type, string(jsonData)) {
 		c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
 		c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonData)})
 	}
@@ -67,12 +67,20 @@ func ClaudeData(c *gin.Context, resp dto.ClaudeResponse) error {
 }
 
 func ClaudeChunkData(c *gin.Context, resp dto.ClaudeResponse, data string) {
+	if renderTrackedStreamEvent(c, resp.Type, data) {
+		_ = FlushWriter(c)
+		return
+	}
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s\n", data)})
 	_ = FlushWriter(c)
 }
 
 func ResponseChunkData(c *gin.Context, resp dto.ResponsesStreamResponse, data string) {
+	if renderTrackedStreamEvent(c, resp.Type, data) {
+		_ = FlushWriter(c)
+		return
+	}
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s", data)})
 	_ = FlushWriter(c)
@@ -87,11 +95,18 @@ func StringData(c *gin.Context, str string) error {
 		return fmt.Errorf("request context done: %w", c.Request.Context().Err())
 	}
 
-	c.Render(-1, common.CustomEvent{Data: "data: " + str})
+	if !renderTrackedStreamEvent(c, "", str) {
+		c.Render(-1, common.CustomEvent{Data: "data: " + str})
+	}
 	return FlushWriter(c)
 }
 
 func PingData(c *gin.Context) error {
+	return PingDataWithFormat(c, dto.PingFormatComment)
+}
+
+// PingDataWithFormat 按渠道配置的格式发送保活 ping，未知格式按注释行处理
+func PingDataWithFormat(c *gin.Context, format string) error {
 	if c == nil || c.Writer == nil {
 		return errors.New("context or writer is nil")
 	}
@@ -100,7 +115,11 @@ func PingData(c *gin.Context) error {
 		return fmt.Errorf("request context done: %w", c.Request.Context().Err())
 	}
 
-	if _, err := c.Writer.Write([]byte(": PING\n\n")); err != nil {
+	payload := ": PING\n\n"
+	if format == dto.PingFormatData {
+		payload = "data: {}\n\n"
+	}
+	if _, err := c.Writer.Write([]byte(payload)); err != nil {
 		return fmt.Errorf("write ping data failed: %w", err)
 	}
 	return FlushWriter(c)
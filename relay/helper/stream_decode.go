@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// lazyStreamBodyReader 在首次读取时才探测编码，避免在扫描协程启动前阻塞等待上游首字节
+type lazyStreamBodyReader struct {
+	resp   *http.Response
+	reader io.Reader
+}
+
+func newStreamBodyReader(resp *http.Response) io.Reader {
+	return &lazyStreamBodyReader{resp: resp}
+}
+
+func (r *lazyStreamBodyReader) Read(p []byte) (int, error) {
+	if r.reader == nil {
+		r.reader = decodeStreamBody(r.resp)
+	}
+	return r.reader.Read(p)
+}
+
+// decodeStreamBody 按响应的 Content-Encoding 为流式响应体包装解压读取器。
+// 部分代理会声明压缩但实际返回明文，此时根据首部字节判断并回退为直接读取。
+func decodeStreamBody(resp *http.Response) io.Reader {
+	if resp.Header == nil {
+		return resp.Body
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return resp.Body
+	}
+	br := bufio.NewReader(resp.Body)
+	head, _ := br.Peek(2)
+	if len(head) == 0 {
+		return br
+	}
+	switch encoding {
+	case "gzip", "x-gzip":
+		if len(head) < 2 || head[0] != 0x1f || head[1] != 0x8b {
+			return br
+		}
+		reader, err := gzip.NewReader(br)
+		if err != nil {
+			return br
+		}
+		return reader
+	case "deflate":
+		if isZlibHeader(head) {
+			if reader, err := zlib.NewReader(br); err == nil {
+				return reader
+			}
+			return br
+		}
+		if looksLikePlainStream(head) {
+			return br
+		}
+		return flate.NewReader(br)
+	case "br":
+		if looksLikePlainStream(head) {
+			return br
+		}
+		return brotli.NewReader(br)
+	default:
+		return br
+	}
+}
+
+func isZlibHeader(head []byte) bool {
+	return len(head) >= 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0
+}
+
+// looksLikePlainStream 判断首部是否为 SSE 文本（data:/event:/id:/retry:/注释行或空行）
+func looksLikePlainStream(head []byte) bool {
+	switch head[0] {
+	case 'd', 'e', 'i', 'r', ':', '\n', '\r', '{', '[':
+		return true
+	}
+	return false
+}
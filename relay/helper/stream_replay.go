@@ -0,0 +1,338 @@
+package helper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+const streamEventTrackerContextKey = "stream_event_tracker"
+
+type streamReplayEvent struct {
+	Seq     int64
+	Payload string
+}
+
+// StreamReplayBuffer 按流保存最近发送的 SSE 事件，供客户端携带 Last-Event-ID 重连时重放。
+// 事件数与总字节数均有上限，超出时淘汰最旧的事件。
+type StreamReplayBuffer struct {
+	mu        sync.Mutex
+	owner     string
+	events    []streamReplayEvent
+	head      int
+	count     int
+	bytes     int
+	maxBytes  int
+	lastSeq   int64
+	expiresAt time.Time
+	closed    bool
+	// updated 在每次追加事件或关闭时被关闭并替换，用于唤醒正在跟随该流的重连请求
+	updated chan struct{}
+}
+
+func NewStreamReplayBuffer(size int, maxBytes int) *StreamReplayBuffer {
+	if size <= 0 {
+		size = 1
+	}
+	return &StreamReplayBuffer{
+		events:   make([]streamReplayEvent, size),
+		maxBytes: maxBytes,
+		updated:  make(chan struct{}),
+	}
+}
+
+func (b *StreamReplayBuffer) notifyLocked() {
+	close(b.updated)
+	b.updated = make(chan struct{})
+}
+
+// Close 标记原始流已结束，跟随该流的重连请求在重放完剩余事件后返回
+func (b *StreamReplayBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.notifyLocked()
+}
+
+// follow 返回序号大于 seq 的已缓存事件、当前最大序号、原始流是否已结束，以及下一次更新的通知通道
+func (b *StreamReplayBuffer) follow(seq int64) (payloads []string, lastSeq int64, closed bool, updated <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < b.count; i++ {
+		event := b.events[(b.head+i)%len(b.events)]
+		if event.Seq > seq {
+			payloads = append(payloads, event.Payload)
+		}
+	}
+	return payloads, b.lastSeq, b.closed, b.updated
+}
+
+// Append 记录一个已发送的事件，单个事件超过字节上限时只推进序号不保存内容
+func (b *StreamReplayBuffer) Append(seq int64, payload string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	defer b.notifyLocked()
+	if seq > b.lastSeq {
+		b.lastSeq = seq
+	}
+	if b.maxBytes > 0 && len(payload) > b.maxBytes {
+		return
+	}
+	for b.count > 0 && (b.count == len(b.events) || (b.maxBytes > 0 && b.bytes+len(payload) > b.maxBytes)) {
+		b.evictOldestLocked()
+	}
+	tail := (b.head + b.count) % len(b.events)
+	b.events[tail] = streamReplayEvent{Seq: seq, Payload: payload}
+	b.count++
+	b.bytes += len(payload)
+}
+
+func (b *StreamReplayBuffer) evictOldestLocked() {
+	b.bytes -= len(b.events[b.head].Payload)
+	b.events[b.head] = streamReplayEvent{}
+	b.head = (b.head + 1) % len(b.events)
+	b.count--
+}
+
+// After 返回序号大于 seq 的已缓存事件，按发送顺序排列
+func (b *StreamReplayBuffer) After(seq int64) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payloads := make([]string, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		event := b.events[(b.head+i)%len(b.events)]
+		if event.Seq > seq {
+			payloads = append(payloads, event.Payload)
+		}
+	}
+	return payloads
+}
+
+// LastSeq 返回该流已分配的最大事件序号
+func (b *StreamReplayBuffer) LastSeq() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastSeq
+}
+
+// Len 返回当前缓存的事件数和字节数
+func (b *StreamReplayBuffer) Len() (events int, bytes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count, b.bytes
+}
+
+func (b *StreamReplayBuffer) touch(ttl time.Duration) {
+	b.mu.Lock()
+	b.expiresAt = time.Now().Add(ttl)
+	b.mu.Unlock()
+}
+
+func (b *StreamReplayBuffer) expired(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.After(b.expiresAt)
+}
+
+var (
+	streamReplayBuffersMu sync.Mutex
+	streamReplayBuffers   = make(map[string]*StreamReplayBuffer)
+)
+
+func streamReplayTTL() time.Duration {
+	if constant.StreamReplayTTLSeconds <= 0 {
+		return 300 * time.Second
+	}
+	return time.Duration(constant.StreamReplayTTLSeconds) * time.Second
+}
+
+// streamReplayOwner 返回当前请求的用户与令牌标识，重放缓冲只允许同一用户的同一令牌访问
+func streamReplayOwner(c *gin.Context) string {
+	return fmt.Sprintf("%d:%d", common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		common.GetContextKeyInt(c, constant.ContextKeyTokenId))
+}
+
+// acquireStreamReplayBuffer 获取属于 owner 的流缓冲，不存在时在容量允许的情况下新建；
+// 缓冲属于其他用户或令牌时返回 nil
+func acquireStreamReplayBuffer(streamId string, owner string, create bool) *StreamReplayBuffer {
+	if constant.StreamReplayBufferSize <= 0 || streamId == "" {
+		return nil
+	}
+	streamReplayBuffersMu.Lock()
+	defer streamReplayBuffersMu.Unlock()
+
+	now := time.Now()
+	if buf, ok := streamReplayBuffers[streamId]; ok {
+		if !buf.expired(now) {
+			if buf.owner != owner {
+				return nil
+			}
+			buf.touch(streamReplayTTL())
+			return buf
+		}
+		delete(streamReplayBuffers, streamId)
+	}
+	if !create {
+		return nil
+	}
+	maxStreams := constant.StreamReplayMaxStreams
+	if maxStreams > 0 && len(streamReplayBuffers) >= maxStreams {
+		for id, buf := range streamReplayBuffers {
+			if buf.expired(now) {
+				delete(streamReplayBuffers, id)
+			}
+		}
+		if len(streamReplayBuffers) >= maxStreams {
+			return nil
+		}
+	}
+	buf := NewStreamReplayBuffer(constant.StreamReplayBufferSize, constant.StreamReplayBufferMaxKB<<10)
+	buf.owner = owner
+	buf.touch(streamReplayTTL())
+	streamReplayBuffers[streamId] = buf
+	return buf
+}
+
+// streamEventTracker 为单个下游流分配递增的事件 ID，并在启用时写入重放缓冲
+type streamEventTracker struct {
+	streamId string
+	seq      int64
+	buffer   *StreamReplayBuffer
+}
+
+func (t *streamEventTracker) next(payloadBuilder func(id string) string) string {
+	t.seq++
+	id := t.streamId + ":" + strconv.FormatInt(t.seq, 10)
+	payload := payloadBuilder(id)
+	if t.buffer != nil {
+		t.buffer.Append(t.seq, payload)
+	}
+	return payload
+}
+
+func parseStreamEventId(lastEventId string) (string, int64, bool) {
+	idx := strings.LastIndex(lastEventId, ":")
+	if idx <= 0 || idx == len(lastEventId)-1 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseInt(lastEventId[idx+1:], 10, 64)
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return lastEventId[:idx], seq, true
+}
+
+// setupStreamEventTracker 在启用事件 ID 时为当前请求创建 tracker，同一请求的重试沿用已有 tracker 以保持序号递增。
+// Last-Event-ID 重连由 ServeStreamReplay 在转发上游之前处理。
+func setupStreamEventTracker(c *gin.Context) *streamEventTracker {
+	if c == nil || !constant.StreamEventIdEnabled {
+		return nil
+	}
+	if tracker := getStreamEventTracker(c); tracker != nil {
+		return tracker
+	}
+	tracker := &streamEventTracker{streamId: c.GetString(common.RequestIdKey)}
+	if tracker.streamId == "" {
+		tracker.streamId = common.GetUUID()
+	}
+	tracker.buffer = acquireStreamReplayBuffer(tracker.streamId, streamReplayOwner(c), true)
+	c.Set(streamEventTrackerContextKey, tracker)
+	return tracker
+}
+
+// CloseStreamEventTracker 在请求结束时标记重放缓冲已完成，使跟随该流的重连请求及时返回
+func CloseStreamEventTracker(c *gin.Context) {
+	if tracker := getStreamEventTracker(c); tracker != nil && tracker.buffer != nil {
+		tracker.buffer.Close()
+	}
+}
+
+// ServeStreamReplay 处理携带 Last-Event-ID 的重连请求：缓冲存在且属于当前用户与令牌时，
+// 重放之后的事件并继续跟随原始流直到其结束，不会再次请求上游。返回 true 表示请求已处理。
+func ServeStreamReplay(c *gin.Context) bool {
+	if c == nil || c.Request == nil || !constant.StreamEventIdEnabled {
+		return false
+	}
+	streamId, seq, ok := parseStreamEventId(strings.TrimSpace(c.Request.Header.Get("Last-Event-ID")))
+	if !ok {
+		return false
+	}
+	buf := acquireStreamReplayBuffer(streamId, streamReplayOwner(c), false)
+	if buf == nil {
+		return false
+	}
+	SetEventStreamHeaders(c)
+	ctx := c.Request.Context()
+	idle := time.NewTimer(streamReplayTTL())
+	defer idle.Stop()
+	for {
+		payloads, lastSeq, closed, updated := buf.follow(seq)
+		for _, payload := range payloads {
+			c.Render(-1, common.CustomEvent{Data: payload})
+		}
+		if len(payloads) > 0 {
+			if err := FlushWriter(c); err != nil {
+				return true
+			}
+		}
+		seq = lastSeq
+		if closed {
+			return true
+		}
+		select {
+		case <-updated:
+			// 原始流仍在产生事件时重置空闲计时
+			idle.Reset(streamReplayTTL())
+		case <-ctx.Done():
+			return true
+		case <-idle.C:
+			return true
+		}
+	}
+}
+
+func getStreamEventTracker(c *gin.Context) *streamEventTracker {
+	if c == nil {
+		return nil
+	}
+	raw, ok := c.Get(streamEventTrackerContextKey)
+	if !ok {
+		return nil
+	}
+	tracker, _ := raw.(*streamEventTracker)
+	return tracker
+}
+
+// renderTrackedStreamEvent 在存在 tracker 时以带 id 行的形式写出事件，返回是否已写出
+func renderTrackedStreamEvent(c *gin.Context, eventType string, data string) bool {
+	tracker := getStreamEventTracker(c)
+	if tracker == nil {
+		return false
+	}
+	payload := tracker.next(func(id string) string {
+		var b strings.Builder
+		if eventType != "" {
+			b.WriteString("event: ")
+			b.WriteString(eventType)
+			b.WriteString("\n")
+		}
+		b.WriteString("id: ")
+		b.WriteString(id)
+		b.WriteString("\ndata: ")
+		b.WriteString(strings.TrimRight(data, "\n"))
+		b.WriteString("\n\n")
+		return b.String()
+	})
+	c.Render(-1, common.CustomEvent{Data: payload})
+	return true
+}
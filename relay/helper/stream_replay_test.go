@@ -0,0 +1,173 @@
+package helper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamReplayBuffer_BoundedByCount(t *testing.T) {
+	t.Parallel()
+
+	buf := NewStreamReplayBuffer(3, 0)
+	for i := int64(1); i <= 5; i++ {
+		buf.Append(i, "e"+string(rune('0'+i)))
+	}
+	events, _ := buf.Len()
+	assert.Equal(t, 3, events)
+	assert.Equal(t, []string{"e3", "e4", "e5"}, buf.After(0))
+	assert.Equal(t, []string{"e5"}, buf.After(4))
+	assert.Empty(t, buf.After(5))
+	assert.Equal(t, int64(5), buf.LastSeq())
+}
+
+func TestStreamReplayBuffer_BoundedByBytes(t *testing.T) {
+	t.Parallel()
+
+	buf := NewStreamReplayBuffer(100, 10)
+	buf.Append(1, "aaaa")
+	buf.Append(2, "bbbb")
+	buf.Append(3, "cccc")
+	events, bytes := buf.Len()
+	assert.Equal(t, 2, events)
+	assert.LessOrEqual(t, bytes, 10)
+	assert.Equal(t, []string{"bbbb", "cccc"}, buf.After(0))
+
+	// 超过单流上限的事件不缓存，但序号仍然推进
+	buf.Append(4, strings.Repeat("x", 11))
+	assert.Equal(t, int64(4), buf.LastSeq())
+	assert.Equal(t, []string{"bbbb", "cccc"}, buf.After(0))
+}
+
+func TestParseStreamEventId(t *testing.T) {
+	t.Parallel()
+
+	streamId, seq, ok := parseStreamEventId("abc:12")
+	require.True(t, ok)
+	assert.Equal(t, "abc", streamId)
+	assert.Equal(t, int64(12), seq)
+
+	for _, invalid := range []string{"", "abc", ":1", "abc:", "abc:x", "abc:-1"} {
+		_, _, ok := parseStreamEventId(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func newStreamReplayTestContext(lastEventId string) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if lastEventId != "" {
+		c.Request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	common.SetContextKey(c, constant.ContextKeyUserId, 1)
+	common.SetContextKey(c, constant.ContextKeyTokenId, 10)
+	return c, recorder
+}
+
+func runStreamReplayTest(c *gin.Context, body string) *relaycommon.RelayInfo {
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		_ = StringData(c, data)
+	})
+	return info
+}
+
+func TestStreamScannerHandler_EventIdAndReplay(t *testing.T) {
+	oldTimeout := constant.StreamingTimeout
+	oldEnabled, oldSize, oldKB := constant.StreamEventIdEnabled, constant.StreamReplayBufferSize, constant.StreamReplayBufferMaxKB
+	constant.StreamingTimeout = 30
+	constant.StreamEventIdEnabled = true
+	constant.StreamReplayBufferSize = 16
+	constant.StreamReplayBufferMaxKB = 64
+	t.Cleanup(func() {
+		constant.StreamingTimeout = oldTimeout
+		constant.StreamEventIdEnabled, constant.StreamReplayBufferSize, constant.StreamReplayBufferMaxKB = oldEnabled, oldSize, oldKB
+	})
+
+	c, recorder := newStreamReplayTestContext("")
+	c.Set(common.RequestIdKey, "replay-test-stream")
+	runStreamReplayTest(c, buildSSEBody(3))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, "id: replay-test-stream:1\ndata: {\"id\":0")
+	assert.Contains(t, body, "id: replay-test-stream:3\ndata: {\"id\":2")
+
+	CloseStreamEventTracker(c)
+
+	// 其他令牌携带同一 Last-Event-ID 不能读取该流
+	other, otherRecorder := newStreamReplayTestContext("replay-test-stream:1")
+	common.SetContextKey(other, constant.ContextKeyTokenId, 11)
+	assert.False(t, ServeStreamReplay(other))
+	assert.Empty(t, otherRecorder.Body.String())
+
+	// 同一令牌重连时只重放之后的事件，不再经过上游
+	reconnect, reconnectRecorder := newStreamReplayTestContext("replay-test-stream:1")
+	require.True(t, ServeStreamReplay(reconnect))
+
+	replayed := reconnectRecorder.Body.String()
+	assert.NotContains(t, replayed, "id: replay-test-stream:1\n")
+	idx2 := strings.Index(replayed, "id: replay-test-stream:2\n")
+	idx3 := strings.Index(replayed, "id: replay-test-stream:3\n")
+	require.GreaterOrEqual(t, idx2, 0)
+	require.Greater(t, idx3, idx2)
+}
+
+func TestServeStreamReplay_FollowsLiveStream(t *testing.T) {
+	oldEnabled, oldSize, oldKB := constant.StreamEventIdEnabled, constant.StreamReplayBufferSize, constant.StreamReplayBufferMaxKB
+	constant.StreamEventIdEnabled = true
+	constant.StreamReplayBufferSize = 16
+	constant.StreamReplayBufferMaxKB = 64
+	t.Cleanup(func() {
+		constant.StreamEventIdEnabled, constant.StreamReplayBufferSize, constant.StreamReplayBufferMaxKB = oldEnabled, oldSize, oldKB
+	})
+
+	origin, _ := newStreamReplayTestContext("")
+	origin.Set(common.RequestIdKey, "replay-live-stream")
+	tracker := setupStreamEventTracker(origin)
+	require.NotNil(t, tracker)
+	require.Same(t, tracker, setupStreamEventTracker(origin))
+	renderTrackedStreamEvent(origin, "", "first")
+
+	reconnect, recorder := newStreamReplayTestContext("replay-live-stream:0")
+	done := make(chan bool)
+	go func() {
+		done <- ServeStreamReplay(reconnect)
+	}()
+
+	renderTrackedStreamEvent(origin, "", "second")
+	CloseStreamEventTracker(origin)
+
+	select {
+	case handled := <-done:
+		assert.True(t, handled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not finish after the origin stream closed")
+	}
+	body := recorder.Body.String()
+	assert.Contains(t, body, "id: replay-live-stream:1\ndata: first")
+	assert.Contains(t, body, "id: replay-live-stream:2\ndata: second")
+}
+
+func TestStreamScannerHandler_NoEventIdByDefault(t *testing.T) {
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 30
+	t.Cleanup(func() {
+		constant.StreamingTimeout = oldTimeout
+	})
+
+	c, recorder := newStreamReplayTestContext("")
+	runStreamReplayTest(c, buildSSEBody(2))
+	assert.NotContains(t, recorder.Body.String(), "id: ")
+}
@@ -3,18 +3,22 @@ package helper
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 
@@ -25,8 +29,12 @@ const (
 	InitialScannerBufferSize    = 64 << 10 // 64KB (64*1024)
 	DefaultMaxScannerBufferSize = 64 << 20 // 64MB (64*1024*1024) default SSE buffer size
 	DefaultPingInterval         = 10 * time.Second
+	DefaultHardStreamTimeout    = 600 * time.Second
 )
 
+// pingWriteTimeout 单次 ping 写入的等待上限，超时后该写入仍在后台阻塞，下一次 tick 不再发起新的写入
+var pingWriteTimeout = 10 * time.Second
+
 func getScannerBufferSize() int {
 	if constant.StreamScannerMaxBufferMB > 0 {
 		return constant.StreamScannerMaxBufferMB << 20
@@ -34,6 +42,22 @@ func getScannerBufferSize() int {
 	return DefaultMaxScannerBufferSize
 }
 
+// streamCounters 由扫描、写出与心跳 goroutine 并发累加的流统计，结束时再汇总到 RelayInfo
+type streamCounters struct {
+	received      atomic.Int64
+	dataEvents    atomic.Int64
+	activityLines atomic.Int64
+	pingsSent     atomic.Int64
+}
+
+// flushTo 将计数累加到 info，调用方需保证此后不再有 goroutine 读写 info 的对应字段
+func (s *streamCounters) flushTo(info *relaycommon.RelayInfo) {
+	info.ReceivedResponseCount += int(s.received.Load())
+	info.DataEventCount += int(s.dataEvents.Load())
+	info.ActivityLineCount += int(s.activityLines.Load())
+	info.PingSentCount += int(s.pingsSent.Load())
+}
+
 func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, dataHandler func(data string, sr *StreamResult)) {
 
 	if resp == nil || dataHandler == nil {
@@ -50,11 +74,12 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		}
 	}()
 
-	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
+	streamingTimeout := info.GetStreamingTimeout()
 
+	var counters streamCounters
 	var (
 		stopChan   = make(chan bool, 3) // 增加缓冲区避免阻塞
-		scanner    = bufio.NewScanner(resp.Body)
+		scanner    = bufio.NewScanner(newStreamBodyReader(resp))
 		ticker     = time.NewTicker(streamingTimeout)
 		pingTicker *time.Ticker
 		writeMutex sync.Mutex     // Mutex to protect concurrent writes
@@ -67,10 +92,32 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	if pingInterval <= 0 {
 		pingInterval = DefaultPingInterval
 	}
+	// ping 写失败可能只是客户端短暂背压，允许连续失败若干次；数据写失败仍由 dataHandler 立即终止
+	pingMaxFailures := generalSettings.PingMaxConsecutiveFailures
+	if pingMaxFailures <= 0 {
+		pingMaxFailures = 1
+	}
+
+	backpressureWindow := time.Duration(generalSettings.StreamBackpressureTimeoutSeconds) * time.Second
+
+	// 空闲心跳：上游静默时由我们发送保活并重置流式超时，上游静默超过 hardStreamTimeout 仍按超时结束
+	idleHeartbeat := time.Duration(generalSettings.IdleHeartbeatSeconds) * time.Second
+	hardStreamTimeout := time.Duration(generalSettings.HardStreamTimeoutSeconds) * time.Second
+	if hardStreamTimeout <= 0 {
+		hardStreamTimeout = DefaultHardStreamTimeout
+	}
+	// 流总时长上限，从流开始计时且从不重置，防止上游慢速滴漏长期占用连接与 SSE 并发名额
+	maxStreamDuration := time.Duration(generalSettings.MaxStreamDurationSeconds) * time.Second
+	var lastUpstreamActivity atomic.Int64
+	lastUpstreamActivity.Store(time.Now().UnixNano())
 
 	if pingEnabled {
 		pingTicker = time.NewTicker(pingInterval)
 	}
+	pingFormat := dto.PingFormatComment
+	if info.ChannelMeta != nil && info.ChannelSetting.PingFormat != "" {
+		pingFormat = info.ChannelSetting.PingFormat
+	}
 
 	if common.DebugEnabled {
 		// print timeout and ping interval for debugging
@@ -103,16 +150,25 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		case <-time.After(5 * time.Second):
 			logger.LogError(c, "timeout waiting for goroutines to exit")
 		}
+		counters.flushTo(info)
 
 		close(stopChan)
 	}()
 
-	scanner.Buffer(make([]byte, InitialScannerBufferSize), getScannerBufferSize())
+	maxLineSize := getScannerBufferSize()
+	var scannerLineTooLong atomic.Bool
+	scanner.Buffer(make([]byte, InitialScannerBufferSize), maxLineSize)
 	scanner.Split(bufio.ScanLines)
 	SetEventStreamHeaders(c)
+	setupStreamEventTracker(c)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// 客户端设置了请求预算时，流式读取在截止时间到达后终止
+	ctx, cancel := info.WithRequestDeadline(context.Background())
 	defer cancel()
+	setRequestBudgetEndReason := func() {
+		info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonRequestBudget,
+			fmt.Errorf("request budget exceeded after %s", time.Since(info.StartTime).Truncate(time.Millisecond)))
+	}
 
 	ctx = context.WithValue(ctx, "stop_chan", stopChan)
 
@@ -137,28 +193,63 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			pingTimeout := time.NewTimer(maxPingDuration)
 			defer pingTimeout.Stop()
 
+			consecutivePingFailures := 0
+			// pendingPing 为上一次超时后仍未返回的 ping 写入
+			var pendingPing chan error
 			for {
 				select {
 				case <-pingTicker.C:
+					if pendingPing != nil {
+						select {
+						case <-pendingPing:
+							pendingPing = nil
+						default:
+							// 上一次写入仍阻塞，跳过本次 tick，避免阻塞的 goroutine 堆积
+							consecutivePingFailures++
+							if consecutivePingFailures < pingMaxFailures {
+								logger.LogWarn(c, fmt.Sprintf("ping data still blocked (%d/%d)", consecutivePingFailures, pingMaxFailures))
+								continue
+							}
+							logger.LogError(c, "ping data send timeout")
+							info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonPingFail, fmt.Errorf("ping send timeout"))
+							return
+						}
+					}
 					// 使用超时机制防止写操作阻塞
 					done := make(chan error, 1)
 					gopool.Go(func() {
 						writeMutex.Lock()
 						defer writeMutex.Unlock()
-						done <- PingData(c)
+						err := PingDataWithFormat(c, pingFormat)
+						if err == nil {
+							counters.pingsSent.Add(1)
+						}
+						done <- err
 					})
 
 					select {
 					case err := <-done:
 						if err != nil {
+							consecutivePingFailures++
+							if consecutivePingFailures < pingMaxFailures {
+								logger.LogWarn(c, fmt.Sprintf("ping data error (%d/%d): %s", consecutivePingFailures, pingMaxFailures, err.Error()))
+								continue
+							}
 							logger.LogError(c, "ping data error: "+err.Error())
 							info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonPingFail, err)
 							return
 						}
+						consecutivePingFailures = 0
 						if common.DebugEnabled {
 							println("ping data sent")
 						}
-					case <-time.After(10 * time.Second):
+					case <-time.After(pingWriteTimeout):
+						pendingPing = done
+						consecutivePingFailures++
+						if consecutivePingFailures < pingMaxFailures {
+							logger.LogWarn(c, fmt.Sprintf("ping data send timeout (%d/%d)", consecutivePingFailures, pingMaxFailures))
+							continue
+						}
 						logger.LogError(c, "ping data send timeout")
 						info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonPingFail, fmt.Errorf("ping send timeout"))
 						return
@@ -196,6 +287,11 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		}()
 		sr := newStreamResult(info.StreamStatus)
 		for data := range dataChan {
+			data, keep := applyStreamDataTransformers(data)
+			if !keep {
+				continue
+			}
+			counters.received.Add(1)
 			sr.reset()
 			writeMutex.Lock()
 			dataHandler(data, sr)
@@ -204,6 +300,14 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 				return
 			}
 		}
+		// 扫描器因单行过长退出时，在已转发数据之后补发一个明确的错误事件，避免客户端只看到流静默结束
+		if scannerLineTooLong.Load() {
+			writeMutex.Lock()
+			if err := writeScannerLineTooLongError(c, maxLineSize); err != nil {
+				logger.LogError(c, "failed to write line too long error: "+err.Error())
+			}
+			writeMutex.Unlock()
+		}
 	})
 
 	// Scanner goroutine with improved error handling
@@ -228,6 +332,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			case <-stopChan:
 				return
 			case <-ctx.Done():
+				if info.RequestBudgetExceeded() {
+					setRequestBudgetEndReason()
+				}
 				return
 			case <-c.Request.Context().Done():
 				info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonClientGone, c.Request.Context().Err())
@@ -236,31 +343,38 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			}
 
 			ticker.Reset(streamingTimeout)
+			lastUpstreamActivity.Store(time.Now().UnixNano())
 			data := scanner.Text()
 			if common.DebugEnabled {
 				println(data)
 			}
 
 			if len(data) < 6 {
+				if strings.TrimSpace(data) != "" {
+					counters.activityLines.Add(1)
+				}
 				continue
 			}
 			if data[:5] != "data:" && data[:6] != "[DONE]" {
+				counters.activityLines.Add(1)
 				continue
 			}
 			data = data[5:]
 			data = strings.TrimSpace(data)
 			if data == "" {
+				counters.activityLines.Add(1)
 				continue
 			}
 			if !strings.HasPrefix(data, "[DONE]") {
+				counters.dataEvents.Add(1)
 				info.SetFirstResponseTime()
-				info.ReceivedResponseCount++
 
-				select {
-				case dataChan <- data:
-				case <-ctx.Done():
+				switch enqueueStreamData(ctx, stopChan, dataChan, data, backpressureWindow) {
+				case streamEnqueueStopped:
 					return
-				case <-stopChan:
+				case streamEnqueueBackpressure:
+					logger.LogWarn(c, fmt.Sprintf("client stopped consuming stream: write queue full for %s, received=%d", backpressureWindow, counters.received.Load()))
+					info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonClientBackpressure, fmt.Errorf("write queue full for %s", backpressureWindow))
 					return
 				}
 			} else {
@@ -273,7 +387,14 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		}
 
 		if err := scanner.Err(); err != nil {
-			if err != io.EOF {
+			if info.RequestBudgetExceeded() {
+				// 上游响应体读取同样受请求预算约束，截止后读取失败归因于预算耗尽
+				setRequestBudgetEndReason()
+			} else if errors.Is(err, bufio.ErrTooLong) {
+				logger.LogError(c, fmt.Sprintf("scanner error: upstream SSE line exceeded max buffer size of %d bytes", maxLineSize))
+				info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonScannerErr, err)
+				scannerLineTooLong.Store(true)
+			} else if err != io.EOF {
 				logger.LogError(c, "scanner error: "+err.Error())
 				info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonScannerErr, err)
 			}
@@ -281,19 +402,146 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonEOF, nil)
 	})
 
+	var heartbeatC <-chan time.Time
+	if idleHeartbeat > 0 {
+		heartbeatTicker := time.NewTicker(idleHeartbeat / 2)
+		defer heartbeatTicker.Stop()
+		heartbeatC = heartbeatTicker.C
+	}
+	var heartbeatWriting atomic.Bool
+
+	var maxDurationC <-chan time.Time
+	if maxStreamDuration > 0 {
+		maxDurationTimer := time.NewTimer(maxStreamDuration)
+		defer maxDurationTimer.Stop()
+		maxDurationC = maxDurationTimer.C
+	}
+
 	// 主循环等待完成或超时
-	select {
-	case <-ticker.C:
-		info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonTimeout, nil)
-	case <-stopChan:
-		// EndReason already set by the goroutine that triggered stopChan
-	case <-c.Request.Context().Done():
-		info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonClientGone, c.Request.Context().Err())
+waitLoop:
+	for {
+		select {
+		case <-ticker.C:
+			info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonTimeout, nil)
+			break waitLoop
+		case <-maxDurationC:
+			logger.LogWarn(c, fmt.Sprintf("stream exceeded max duration %s, received=%d, data_events=%d, pings_sent=%d",
+				maxStreamDuration, counters.received.Load(), counters.dataEvents.Load(), counters.pingsSent.Load()))
+			info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonMaxDuration, fmt.Errorf("stream exceeded max duration %s", maxStreamDuration))
+			break waitLoop
+		case <-heartbeatC:
+			idle := time.Since(time.Unix(0, lastUpstreamActivity.Load()))
+			if idle >= hardStreamTimeout {
+				info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonTimeout, fmt.Errorf("no upstream data for %s", idle.Truncate(time.Second)))
+				break waitLoop
+			}
+			if idle < idleHeartbeat {
+				continue
+			}
+			// 心跳只说明我们仍在保活，不计入上游数据，也不更新 lastUpstreamActivity
+			ticker.Reset(streamingTimeout)
+			if !heartbeatWriting.CompareAndSwap(false, true) {
+				continue
+			}
+			wg.Add(1)
+			gopool.Go(func() {
+				defer wg.Done()
+				defer heartbeatWriting.Store(false)
+				writeMutex.Lock()
+				defer writeMutex.Unlock()
+				if err := PingDataWithFormat(c, pingFormat); err != nil {
+					logger.LogWarn(c, "idle heartbeat ping error: "+err.Error())
+					return
+				}
+				counters.pingsSent.Add(1)
+			})
+		case <-stopChan:
+			// EndReason already set by the goroutine that triggered stopChan
+			break waitLoop
+		case <-c.Request.Context().Done():
+			info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonClientGone, c.Request.Context().Err())
+			break waitLoop
+		case <-ctx.Done():
+			// 循环期间 ctx 只会因请求预算到期而结束
+			setRequestBudgetEndReason()
+			break waitLoop
+		}
+	}
+
+	if info.StreamStatus.EndReason == relaycommon.StreamEndReasonRequestBudget {
+		writeMutex.Lock()
+		if err := writeRequestBudgetExceededError(c); err != nil {
+			logger.LogError(c, "failed to write request budget exceeded error: "+err.Error())
+		}
+		writeMutex.Unlock()
 	}
 
+	relaycommon.RecordStreamEndReason(info.StreamStatus.EndReason)
 	if info.StreamStatus.IsNormalEnd() && !info.StreamStatus.HasErrors() {
 		logger.LogInfo(c, fmt.Sprintf("stream ended: %s", info.StreamStatus.Summary()))
 	} else {
-		logger.LogError(c, fmt.Sprintf("stream ended: %s, received=%d", info.StreamStatus.Summary(), info.ReceivedResponseCount))
+		logger.LogError(c, fmt.Sprintf("stream ended: %s, received=%d, data_events=%d, activity_lines=%d, pings_sent=%d",
+			info.StreamStatus.Summary(), counters.received.Load(), counters.dataEvents.Load(), counters.activityLines.Load(), counters.pingsSent.Load()))
+	}
+}
+
+type streamEnqueueResult int
+
+const (
+	streamEnqueueOK streamEnqueueResult = iota
+	streamEnqueueStopped
+	streamEnqueueBackpressure
+)
+
+// enqueueStreamData 将上游数据放入写队列。队列满说明下游写入阻塞，
+// 持续满载超过 backpressureWindow 时判定客户端连接未断开但已不再读取
+func enqueueStreamData(ctx context.Context, stopChan chan bool, dataChan chan string, data string, backpressureWindow time.Duration) streamEnqueueResult {
+	select {
+	case dataChan <- data:
+		return streamEnqueueOK
+	default:
+	}
+	var backpressure <-chan time.Time
+	if backpressureWindow > 0 {
+		timer := time.NewTimer(backpressureWindow)
+		defer timer.Stop()
+		backpressure = timer.C
+	}
+	select {
+	case dataChan <- data:
+		return streamEnqueueOK
+	case <-backpressure:
+		return streamEnqueueBackpressure
+	case <-ctx.Done():
+		return streamEnqueueStopped
+	case <-stopChan:
+		return streamEnqueueStopped
+	}
+}
+
+// writeRequestBudgetExceededError 向客户端补发请求预算耗尽的错误事件，语义等同 504
+func writeRequestBudgetExceededError(c *gin.Context) error {
+	payload, err := common.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": "request budget exceeded, upstream did not finish in time",
+			"type":    "new_api_error",
+			"code":    types.ErrorCodeRequestBudgetExceeded,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return StringData(c, string(payload))
+}
+
+func writeScannerLineTooLongError(c *gin.Context, maxLineSize int) error {
+	payload, err := common.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": fmt.Sprintf("upstream line exceeded %d bytes", maxLineSize),
+		},
+	})
+	if err != nil {
+		return err
 	}
+	return StringData(c, string(payload))
 }
@@ -1,6 +1,10 @@
 package helper
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +16,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
@@ -313,6 +318,40 @@ func TestStreamScannerHandler_SlowUpstreamFastHandler(t *testing.T) {
 	t.Logf("slow upstream (%d chunks, 2ms/read): %v", numChunks, elapsed)
 }
 
+func TestStreamScannerHandler_LineTooLongSendsErrorEvent(t *testing.T) {
+	oldBufferMB := constant.StreamScannerMaxBufferMB
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamScannerMaxBufferMB = 1
+	constant.StreamingTimeout = 30
+	t.Cleanup(func() {
+		constant.StreamScannerMaxBufferMB = oldBufferMB
+		constant.StreamingTimeout = oldTimeout
+	})
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	body := "data: {\"id\":0}\n" + "data: " + strings.Repeat("x", 2<<20) + "\n" + "data: [DONE]\n"
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+
+	var count atomic.Int64
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		count.Add(1)
+		_ = StringData(c, data)
+	})
+
+	assert.Equal(t, int64(1), count.Load())
+	assert.Equal(t, relaycommon.StreamEndReasonScannerErr, info.StreamStatus.EndReason)
+
+	out := recorder.Body.String()
+	errorEvent := fmt.Sprintf("data: {\"error\":{\"message\":\"upstream line exceeded %d bytes\"}}\n\n", 1<<20)
+	require.Contains(t, out, errorEvent)
+	assert.Less(t, strings.Index(out, "data: {\"id\":0}"), strings.Index(out, errorEvent),
+		"error event should follow already forwarded data")
+}
+
 // ---------- Ping tests ----------
 
 func TestStreamScannerHandler_PingSentDuringSlowUpstream(t *testing.T) {
@@ -436,6 +475,295 @@ func TestStreamScannerHandler_PingDisabledByRelayInfo(t *testing.T) {
 	assert.Equal(t, 0, pingCount, "pings should be disabled when DisablePing=true")
 }
 
+func TestStreamScannerHandler_PingDataFrameFormat(t *testing.T) {
+	t.Parallel()
+
+	setting := operation_setting.GetGeneralSetting()
+	oldEnabled := setting.PingIntervalEnabled
+	oldSeconds := setting.PingIntervalSeconds
+	setting.PingIntervalEnabled = true
+	setting.PingIntervalSeconds = 1
+	t.Cleanup(func() {
+		setting.PingIntervalEnabled = oldEnabled
+		setting.PingIntervalSeconds = oldSeconds
+	})
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(pw, "data: chunk_%d\n", i)
+			time.Sleep(500 * time.Millisecond)
+		}
+		fmt.Fprint(pw, "data: [DONE]\n")
+	}()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 30
+	t.Cleanup(func() {
+		constant.StreamingTimeout = oldTimeout
+	})
+
+	resp := &http.Response{Body: pr}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{
+		ChannelSetting: dto.ChannelSettings{PingFormat: dto.PingFormatData},
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	body := recorder.Body.String()
+	assert.Equal(t, 0, strings.Count(body, ": PING"), "comment pings should not be sent with data ping format")
+	assert.GreaterOrEqual(t, strings.Count(body, "data: {}\n\n"), 1)
+}
+
+// flakyPingWriter 让前 failPings 次 ping 写入失败，用于模拟客户端短暂背压
+type flakyPingWriter struct {
+	gin.ResponseWriter
+	failPings int
+	pingCalls atomic.Int64
+}
+
+func (w *flakyPingWriter) Write(b []byte) (int, error) {
+	if strings.HasPrefix(string(b), ": PING") && w.pingCalls.Add(1) <= int64(w.failPings) {
+		return 0, fmt.Errorf("simulated ping write failure")
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func runPingFailureStream(t *testing.T, failPings int, maxFailures int) (*relaycommon.RelayInfo, string, int64) {
+	t.Helper()
+
+	setting := operation_setting.GetGeneralSetting()
+	oldEnabled := setting.PingIntervalEnabled
+	oldSeconds := setting.PingIntervalSeconds
+	oldMaxFailures := setting.PingMaxConsecutiveFailures
+	setting.PingIntervalEnabled = true
+	setting.PingIntervalSeconds = 1
+	setting.PingMaxConsecutiveFailures = maxFailures
+	t.Cleanup(func() {
+		setting.PingIntervalEnabled = oldEnabled
+		setting.PingIntervalSeconds = oldSeconds
+		setting.PingMaxConsecutiveFailures = oldMaxFailures
+	})
+
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 30
+	t.Cleanup(func() {
+		constant.StreamingTimeout = oldTimeout
+	})
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		for i := 0; i < 9; i++ {
+			fmt.Fprintf(pw, "data: chunk_%d\n", i)
+			time.Sleep(500 * time.Millisecond)
+		}
+		fmt.Fprint(pw, "data: [DONE]\n")
+	}()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	writer := &flakyPingWriter{ResponseWriter: c.Writer, failPings: failPings}
+	c.Writer = writer
+
+	resp := &http.Response{Body: pr}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+
+	done := make(chan struct{})
+	go func() {
+		StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("timed out")
+	}
+	return info, recorder.Body.String(), writer.pingCalls.Load()
+}
+
+func TestStreamScannerHandler_PingFailureTolerated(t *testing.T) {
+	info, body, pingCalls := runPingFailureStream(t, 2, 3)
+
+	assert.Equal(t, relaycommon.StreamEndReasonDone, info.StreamStatus.EndReason)
+	assert.Greater(t, pingCalls, int64(2), "pinging should continue after transient failures")
+	assert.GreaterOrEqual(t, strings.Count(body, ": PING"), 1)
+}
+
+func TestStreamScannerHandler_PingFailureExceedsTolerance(t *testing.T) {
+	info, body, pingCalls := runPingFailureStream(t, 100, 2)
+
+	assert.Equal(t, relaycommon.StreamEndReasonPingFail, info.StreamStatus.EndReason)
+	assert.Equal(t, int64(2), pingCalls, "pinging should stop after reaching the tolerance")
+	assert.Equal(t, 0, strings.Count(body, ": PING"))
+}
+
+// stalledClientWriter 模拟连接仍在但不读取的客户端：首次写入阻塞 stall 时长，
+// 之后的写入直接失败
+type stalledClientWriter struct {
+	gin.ResponseWriter
+	stall  time.Duration
+	writes atomic.Int64
+}
+
+func (w *stalledClientWriter) Write(b []byte) (int, error) {
+	if w.writes.Add(1) == 1 {
+		time.Sleep(w.stall)
+	}
+	return 0, fmt.Errorf("simulated stalled client")
+}
+
+func TestStreamScannerHandler_ClientBackpressureDetected(t *testing.T) {
+	setting := operation_setting.GetGeneralSetting()
+	oldWindow := setting.StreamBackpressureTimeoutSeconds
+	setting.StreamBackpressureTimeoutSeconds = 1
+	t.Cleanup(func() {
+		setting.StreamBackpressureTimeoutSeconds = oldWindow
+	})
+	before := relaycommon.GetStreamEndReasonStats()[string(relaycommon.StreamEndReasonClientBackpressure)]
+
+	c, resp, info := setupStreamTest(t, strings.NewReader(buildSSEBody(100)))
+	writer := &stalledClientWriter{ResponseWriter: c.Writer, stall: 2 * time.Second}
+	c.Writer = writer
+
+	var handled atomic.Int64
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+			handled.Add(1)
+			_ = StringData(c, data)
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for backpressure detection")
+	}
+
+	require.NotNil(t, info.StreamStatus)
+	assert.Equal(t, relaycommon.StreamEndReasonClientBackpressure, info.StreamStatus.EndReason)
+	assert.False(t, info.StreamStatus.IsNormalEnd())
+	assert.Less(t, handled.Load(), int64(100))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	after := relaycommon.GetStreamEndReasonStats()[string(relaycommon.StreamEndReasonClientBackpressure)]
+	assert.Equal(t, before+1, after)
+}
+
+func TestStreamScannerHandler_BackpressureDisabledByDefault(t *testing.T) {
+	c, resp, info := setupStreamTest(t, strings.NewReader(buildSSEBody(30)))
+	writer := &stalledClientWriter{ResponseWriter: c.Writer, stall: 1500 * time.Millisecond}
+	c.Writer = writer
+
+	done := make(chan struct{})
+	go func() {
+		StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+			_ = StringData(c, data)
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	// 未配置检测窗口时，慢客户端只会拖慢写入，流仍按上游结束
+	assert.Equal(t, relaycommon.StreamEndReasonDone, info.StreamStatus.EndReason)
+}
+
+// blockingPingWriter 让第一次 ping 写入阻塞 blockFor 后失败，用于模拟客户端停止读取
+type blockingPingWriter struct {
+	gin.ResponseWriter
+	blockFor  time.Duration
+	pingCalls atomic.Int64
+}
+
+func (w *blockingPingWriter) Write(b []byte) (int, error) {
+	if strings.HasPrefix(string(b), ": PING") {
+		if w.pingCalls.Add(1) == 1 {
+			time.Sleep(w.blockFor)
+		}
+		return 0, fmt.Errorf("simulated blocked ping write")
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func TestStreamScannerHandler_BlockedPingSkipsTicks(t *testing.T) {
+	setting := operation_setting.GetGeneralSetting()
+	oldEnabled := setting.PingIntervalEnabled
+	oldSeconds := setting.PingIntervalSeconds
+	oldMaxFailures := setting.PingMaxConsecutiveFailures
+	setting.PingIntervalEnabled = true
+	setting.PingIntervalSeconds = 1
+	setting.PingMaxConsecutiveFailures = 3
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 30
+	oldWriteTimeout := pingWriteTimeout
+	pingWriteTimeout = 200 * time.Millisecond
+	t.Cleanup(func() {
+		setting.PingIntervalEnabled = oldEnabled
+		setting.PingIntervalSeconds = oldSeconds
+		setting.PingMaxConsecutiveFailures = oldMaxFailures
+		constant.StreamingTimeout = oldTimeout
+		pingWriteTimeout = oldWriteTimeout
+	})
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(pw, "data: chunk_%d\n", i)
+			time.Sleep(500 * time.Millisecond)
+		}
+		fmt.Fprint(pw, "data: [DONE]\n")
+	}()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	writer := &blockingPingWriter{ResponseWriter: c.Writer, blockFor: 4 * time.Second}
+	c.Writer = writer
+
+	resp := &http.Response{Body: pr}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+
+	done := make(chan struct{})
+	go func() {
+		StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	assert.Equal(t, relaycommon.StreamEndReasonPingFail, info.StreamStatus.EndReason)
+	// 阻塞期间的 tick 被跳过，不会在写锁上堆积新的 ping 写入
+	assert.Equal(t, int64(1), writer.pingCalls.Load())
+}
+
 // ---------- StreamStatus integration ----------
 
 func TestStreamScannerHandler_StreamStatus_DoneReason(t *testing.T) {
@@ -688,3 +1016,236 @@ func TestStreamScannerHandler_PingInterleavesWithSlowUpstream(t *testing.T) {
 	assert.GreaterOrEqual(t, pingCount, 3,
 		"expected at least 3 pings during 5s stream with 1s ping interval; got %d", pingCount)
 }
+
+func TestStreamScannerHandler_CountsDataAndActivityLines(t *testing.T) {
+	t.Parallel()
+	body := ": keepalive\n\n" +
+		"event: message\n" +
+		"data: {\"id\":1}\n\n" +
+		": keepalive\n" +
+		"data: \n" +
+		"data: {\"id\":2}\n" +
+		"data: [DONE]\n"
+	c, resp, info := setupStreamTest(t, strings.NewReader(body))
+
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {})
+	assert.Equal(t, 2, info.DataEventCount)
+	assert.Equal(t, 2, info.ReceivedResponseCount)
+	assert.Equal(t, 4, info.ActivityLineCount)
+	assert.Zero(t, info.PingSentCount)
+}
+
+// ---------- Idle heartbeat ----------
+
+func withIdleHeartbeat(t *testing.T, idleSeconds int, hardSeconds int, streamingTimeout int) {
+	t.Helper()
+	setting := operation_setting.GetGeneralSetting()
+	oldIdle, oldHard := setting.IdleHeartbeatSeconds, setting.HardStreamTimeoutSeconds
+	setting.IdleHeartbeatSeconds = idleSeconds
+	setting.HardStreamTimeoutSeconds = hardSeconds
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = streamingTimeout
+	t.Cleanup(func() {
+		setting.IdleHeartbeatSeconds, setting.HardStreamTimeoutSeconds = oldIdle, oldHard
+		constant.StreamingTimeout = oldTimeout
+	})
+}
+
+func runIdleHeartbeatStream(t *testing.T, body io.Reader) (*relaycommon.RelayInfo, string, int64) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+
+	var count atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		StreamScannerHandler(c, &http.Response{Body: io.NopCloser(body)}, info, func(data string, sr *StreamResult) {
+			count.Add(1)
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("timed out waiting for stream to finish")
+	}
+	return info, recorder.Body.String(), count.Load()
+}
+
+func TestStreamScannerHandler_IdleHeartbeatKeepsSilentUpstreamAlive(t *testing.T) {
+	withIdleHeartbeat(t, 1, 10, 2)
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		fmt.Fprint(pw, "data: before\n")
+		// 静默时间超过流式超时，依靠空闲心跳保活
+		time.Sleep(3500 * time.Millisecond)
+		fmt.Fprint(pw, "data: after\n")
+		fmt.Fprint(pw, "data: [DONE]\n")
+	}()
+
+	info, body, count := runIdleHeartbeatStream(t, pr)
+	assert.Equal(t, relaycommon.StreamEndReasonDone, info.StreamStatus.EndReason)
+	assert.Equal(t, int64(2), count)
+	assert.GreaterOrEqual(t, strings.Count(body, ": PING"), 1)
+	assert.Equal(t, strings.Count(body, ": PING"), info.PingSentCount)
+}
+
+func TestStreamScannerHandler_IdleHeartbeatHardTimeout(t *testing.T) {
+	withIdleHeartbeat(t, 1, 2, 30)
+
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { _ = pw.Close() })
+	go fmt.Fprint(pw, "data: only\n")
+
+	start := time.Now()
+	info, _, count := runIdleHeartbeatStream(t, pr)
+	assert.Equal(t, relaycommon.StreamEndReasonTimeout, info.StreamStatus.EndReason)
+	assert.Equal(t, int64(1), count)
+	// 流式超时为 30 秒，能提前结束说明由硬超时触发（清理时最多再等待 5 秒阻塞的读取）
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestStreamScannerHandler_MaxStreamDuration(t *testing.T) {
+	withIdleHeartbeat(t, 0, 0, 30)
+	setting := operation_setting.GetGeneralSetting()
+	oldMax := setting.MaxStreamDurationSeconds
+	setting.MaxStreamDurationSeconds = 2
+	t.Cleanup(func() { setting.MaxStreamDurationSeconds = oldMax })
+
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { _ = pw.Close() })
+	go func() {
+		// 上游持续滴漏数据，流式超时不断被重置，只能由总时长上限结束
+		for i := 0; i < 20; i++ {
+			if _, err := fmt.Fprintf(pw, "data: chunk-%d\n", i); err != nil {
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	info, _, count := runIdleHeartbeatStream(t, pr)
+	assert.Equal(t, relaycommon.StreamEndReasonMaxDuration, info.StreamStatus.EndReason)
+	assert.False(t, info.StreamStatus.IsNormalEnd())
+	assert.GreaterOrEqual(t, count, int64(3))
+	assert.Less(t, time.Since(start), 8*time.Second)
+}
+
+// ---------- Content-Encoding ----------
+
+func runEncodedStream(t *testing.T, encoding string, body []byte) []string {
+	t.Helper()
+	c, resp, info := setupStreamTest(t, bytes.NewReader(body))
+	resp.Header = http.Header{}
+	resp.Header.Set("Content-Encoding", encoding)
+
+	var got []string
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		got = append(got, data)
+	})
+	assert.Equal(t, relaycommon.StreamEndReasonDone, info.StreamStatus.EndReason)
+	return got
+}
+
+func TestStreamScannerHandler_GzipEncodedBody(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write([]byte(buildSSEBody(5)))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	got := runEncodedStream(t, "gzip", buf.Bytes())
+	require.Len(t, got, 5)
+	assert.Contains(t, got[4], "token_4")
+}
+
+func TestStreamScannerHandler_DeflateEncodedBody(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write([]byte(buildSSEBody(3)))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	got := runEncodedStream(t, "deflate", buf.Bytes())
+	require.Len(t, got, 3)
+}
+
+func TestStreamScannerHandler_EncodingHeaderWithPlainBody(t *testing.T) {
+	got := runEncodedStream(t, "gzip", []byte(buildSSEBody(4)))
+	require.Len(t, got, 4)
+
+	got = runEncodedStream(t, "br", []byte(buildSSEBody(2)))
+	require.Len(t, got, 2)
+}
+
+// ---------- Data transformer ----------
+
+func TestStreamScannerHandler_DataTransformerRewritesAndDrops(t *testing.T) {
+	streamDataTransformersMu.Lock()
+	oldTransformers := streamDataTransformers
+	streamDataTransformers = nil
+	streamDataTransformersMu.Unlock()
+	t.Cleanup(func() {
+		streamDataTransformersMu.Lock()
+		streamDataTransformers = oldTransformers
+		streamDataTransformersMu.Unlock()
+	})
+	RegisterStreamDataTransformer(func(data string) (string, bool) {
+		return data, !strings.Contains(data, "vendor_noise")
+	})
+	RegisterStreamDataTransformer(func(data string) (string, bool) {
+		return strings.ReplaceAll(data, "secret", "***"), true
+	})
+
+	body := "data: {\"content\":\"secret-1\"}\n" +
+		"data: {\"vendor_noise\":true}\n" +
+		"data: {\"content\":\"plain\"}\n" +
+		"data: [DONE]\n"
+	c, resp, info := setupStreamTest(t, strings.NewReader(body))
+
+	var got []string
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		got = append(got, data)
+	})
+	assert.Equal(t, []string{`{"content":"***-1"}`, `{"content":"plain"}`}, got)
+	assert.Equal(t, 2, info.ReceivedResponseCount)
+	assert.Equal(t, relaycommon.StreamEndReasonDone, info.StreamStatus.EndReason)
+}
+
+func TestStreamScannerHandler_RequestBudgetExceeded(t *testing.T) {
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { _ = pw.Close() })
+	go func() {
+		_, _ = fmt.Fprint(pw, "data: chunk-0\n")
+	}()
+	// 模拟上游响应体随请求预算一同被取消
+	time.AfterFunc(600*time.Millisecond, func() { _ = pw.CloseWithError(context.DeadlineExceeded) })
+
+	oldTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 30
+	t.Cleanup(func() { constant.StreamingTimeout = oldTimeout })
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	resp := &http.Response{Body: pr}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+	info.StartTime = time.Now()
+	info.RequestDeadline = info.StartTime.Add(300 * time.Millisecond)
+
+	var received int
+	start := time.Now()
+	StreamScannerHandler(c, resp, info, func(data string, sr *StreamResult) {
+		received++
+	})
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, 1, received)
+	assert.Equal(t, relaycommon.StreamEndReasonRequestBudget, info.StreamStatus.EndReason)
+	assert.False(t, info.StreamStatus.IsNormalEnd())
+	assert.Contains(t, recorder.Body.String(), "request_budget_exceeded")
+}
@@ -0,0 +1,37 @@
+package helper
+
+import "sync"
+
+// StreamDataTransformer 在 dataHandler 之前处理单个 SSE 数据块（已去除 "data:" 前缀），
+// 可改写内容；返回 false 表示丢弃该数据块，既不交给 dataHandler 也不计入 ReceivedResponseCount
+type StreamDataTransformer func(data string) (string, bool)
+
+var (
+	streamDataTransformersMu sync.RWMutex
+	streamDataTransformers   []StreamDataTransformer
+)
+
+// RegisterStreamDataTransformer 注册全局流式数据预处理器，按注册顺序依次执行
+func RegisterStreamDataTransformer(transformer StreamDataTransformer) {
+	if transformer == nil {
+		return
+	}
+	streamDataTransformersMu.Lock()
+	defer streamDataTransformersMu.Unlock()
+	streamDataTransformers = append(streamDataTransformers, transformer)
+}
+
+// applyStreamDataTransformers 依次执行已注册的预处理器，任一返回 false 即丢弃
+func applyStreamDataTransformers(data string) (string, bool) {
+	streamDataTransformersMu.RLock()
+	transformers := streamDataTransformers
+	streamDataTransformersMu.RUnlock()
+	for _, transformer := range transformers {
+		var keep bool
+		data, keep = transformer(data)
+		if !keep {
+			return "", false
+		}
+	}
+	return data, true
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/pkg/cachex"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -25,8 +26,12 @@ const (
 	ginKeyChannelAffinityMeta       = "channel_affinity_meta"
 	ginKeyChannelAffinityLogInfo    = "channel_affinity_log_info"
 	ginKeyChannelAffinitySkipRetry  = "channel_affinity_skip_retry_on_failure"
+	ginKeyChannelAffinityDecayed    = "channel_affinity_decayed_channel_id"
+	// ginKeyChannelAffinityConversation 首次出现的会话，请求成功后才记录为已出现
+	ginKeyChannelAffinityConversation = "channel_affinity_pending_conversation"
 
 	channelAffinityCacheNamespace           = "new-api:channel_affinity:v1"
+	channelAffinityConversationNamespace    = "new-api:channel_affinity_conversation:v1"
 	channelAffinityUsageCacheStatsNamespace = "new-api:channel_affinity_usage_cache_stats:v1"
 )
 
@@ -34,6 +39,9 @@ var (
 	channelAffinityCacheOnce sync.Once
 	channelAffinityCache     *cachex.HybridCache[int]
 
+	channelAffinityConversationCacheOnce sync.Once
+	channelAffinityConversationCache     *cachex.HybridCache[int]
+
 	channelAffinityUsageCacheStatsOnce  sync.Once
 	channelAffinityUsageCacheStatsCache *cachex.HybridCache[ChannelAffinityUsageCacheCounters]
 
@@ -115,6 +123,96 @@ func getChannelAffinityCache() *cachex.HybridCache[int] {
 	return channelAffinityCache
 }
 
+func getChannelAffinityConversationCache() *cachex.HybridCache[int] {
+	channelAffinityConversationCacheOnce.Do(func() {
+		setting := operation_setting.GetChannelAffinitySetting()
+		capacity := setting.MaxEntries
+		if capacity <= 0 {
+			capacity = 100_000
+		}
+		defaultTTLSeconds := setting.DefaultTTLSeconds
+		if defaultTTLSeconds <= 0 {
+			defaultTTLSeconds = 3600
+		}
+
+		channelAffinityConversationCache = cachex.NewHybridCache[int](cachex.HybridCacheConfig[int]{
+			Namespace: cachex.Namespace(channelAffinityConversationNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec:       cachex.IntCodec{},
+			RedisOpTimeout:   routingCacheRedisOpTimeout,
+			RedisScanTimeout: routingCacheRedisScanTimeout,
+			RedisDelTimeout:  routingCacheRedisDelTimeout,
+			Memory: func() *hot.HotCache[string, int] {
+				return hot.NewHotCache[string, int](hot.LRU, capacity).
+					WithTTL(time.Duration(defaultTTLSeconds) * time.Second).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return channelAffinityConversationCache
+}
+
+// channelAffinityPendingConversation 待记录的首次会话，由 RecordChannelAffinity 在请求成功后写入缓存
+type channelAffinityPendingConversation struct {
+	Key string
+	TTL time.Duration
+}
+
+// isFirstConversationRequest 判断请求携带的会话 ID 是否为最近首次出现。
+// 首次出现的会话暂存在请求上下文中，仅在请求成功后由 RecordChannelAffinity 记录，失败的首个请求不会使后续请求误用旧亲和关系。
+// 未携带会话 ID 时返回 false，保持原有亲和性行为。
+func isFirstConversationRequest(c *gin.Context, setting *operation_setting.ChannelAffinitySetting, scope string, ttlSeconds int) bool {
+	if c == nil || c.Request == nil || setting == nil || !setting.FirstRequestBypass {
+		return false
+	}
+	conversationID := strings.TrimSpace(c.Request.Header.Get(setting.GetConversationIdHeader()))
+	if conversationID == "" {
+		return false
+	}
+	if setting.ConversationSeenTTLSeconds > 0 {
+		ttlSeconds = setting.ConversationSeenTTLSeconds
+	}
+	if ttlSeconds <= 0 {
+		ttlSeconds = 3600
+	}
+	key := scope + ":" + conversationID
+	cache := getChannelAffinityConversationCache()
+	_, seen, err := cache.Get(key)
+	if err != nil {
+		common.SysError(fmt.Sprintf("channel affinity conversation cache get failed: key=%s, err=%v", key, err))
+		return false
+	}
+	if !seen {
+		c.Set(ginKeyChannelAffinityConversation, channelAffinityPendingConversation{
+			Key: key,
+			TTL: time.Duration(ttlSeconds) * time.Second,
+		})
+	}
+	return !seen
+}
+
+// markChannelAffinityConversationSeen 将本次请求暂存的首次会话记录为已出现
+func markChannelAffinityConversationSeen(c *gin.Context) {
+	if c == nil {
+		return
+	}
+	anyPending, ok := c.Get(ginKeyChannelAffinityConversation)
+	if !ok {
+		return
+	}
+	pending, ok := anyPending.(channelAffinityPendingConversation)
+	if !ok || pending.Key == "" {
+		return
+	}
+	if err := getChannelAffinityConversationCache().SetWithTTL(pending.Key, 1, pending.TTL); err != nil {
+		common.SysError(fmt.Sprintf("channel affinity conversation cache set failed: key=%s, err=%v", pending.Key, err))
+	}
+}
+
 func GetChannelAffinityCacheStats() ChannelAffinityCacheStats {
 	setting := operation_setting.GetChannelAffinitySetting()
 	if setting == nil {
@@ -611,6 +709,11 @@ func GetPreferredChannelByAffinity(c *gin.Context, modelName string, usingGroup
 			RequestPath:    path,
 		})
 
+		// 新会话的首个请求没有可复用的缓存，跳过粘滞以按权重选择渠道，成功后仍会记录亲和性
+		if isFirstConversationRequest(c, setting, cacheKeySuffix, ttlSeconds) {
+			return 0, false
+		}
+
 		cache := getChannelAffinityCache()
 		channelID, found, err := cache.Get(cacheKeySuffix)
 		if err != nil {
@@ -625,6 +728,88 @@ func GetPreferredChannelByAffinity(c *gin.Context, modelName string, usingGroup
 	return 0, false
 }
 
+// channelAffinitySaturationPollInterval wait 模式下检查首选渠道是否空出的间隔
+const channelAffinitySaturationPollInterval = 10 * time.Millisecond
+
+// ShouldUseAffinityPreferredChannel 判断亲和首选渠道是否可用。渠道达到并发上限时按 saturation_mode 处理：
+// skip 直接降级，wait 在等待时间内轮询，仍满则降级。降级时记录替换信息，且本次请求成功后不会覆盖原亲和关系，
+// 渠道空出后的后续请求会重新命中原首选渠道。
+func ShouldUseAffinityPreferredChannel(c *gin.Context, channelID int, maxConcurrency int) bool {
+	// 首选渠道近期上游失败时本次降级，冷却期结束后恢复粘滞
+	if IsChannelRecentlyFailed(channelID) {
+		markChannelAffinityDecayed(c, channelID, "recently_failed", nil)
+		logger.LogInfo(c, fmt.Sprintf("channel affinity decayed: preferred channel #%d failed recently", channelID))
+		return false
+	}
+	if !IsChannelSaturated(channelID, maxConcurrency) {
+		return true
+	}
+	setting := operation_setting.GetChannelAffinitySetting()
+	switch setting.GetSaturationMode() {
+	case operation_setting.ChannelAffinitySaturationIgnore:
+		return true
+	case operation_setting.ChannelAffinitySaturationWait:
+		if waitChannelCapacity(c, channelID, maxConcurrency, setting.GetSaturationWait()) {
+			return true
+		}
+	}
+	markChannelAffinityDecayed(c, channelID, "saturated", map[string]interface{}{"max_concurrency": maxConcurrency})
+	logger.LogInfo(c, fmt.Sprintf("channel affinity decayed: preferred channel #%d reached max concurrency %d", channelID, maxConcurrency))
+	return false
+}
+
+func waitChannelCapacity(c *gin.Context, channelID int, maxConcurrency int, wait time.Duration) bool {
+	var done <-chan struct{}
+	if c != nil && c.Request != nil {
+		done = c.Request.Context().Done()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(channelAffinitySaturationPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return false
+		case <-timer.C:
+			return !IsChannelSaturated(channelID, maxConcurrency)
+		case <-ticker.C:
+			if !IsChannelSaturated(channelID, maxConcurrency) {
+				return true
+			}
+		}
+	}
+}
+
+func markChannelAffinityDecayed(c *gin.Context, channelID int, reason string, extra map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	c.Set(ginKeyChannelAffinityDecayed, channelID)
+	info := map[string]interface{}{
+		"reason":                  reason,
+		"decayed_from_channel_id": channelID,
+	}
+	for k, v := range extra {
+		info[k] = v
+	}
+	if meta, ok := getChannelAffinityMeta(c); ok {
+		info["rule_name"] = meta.RuleName
+		info["using_group"] = meta.UsingGroup
+		info["model"] = meta.ModelName
+		info["key_fp"] = meta.KeyFingerprint
+	}
+	c.Set(ginKeyChannelAffinityLogInfo, info)
+}
+
+// GetChannelAffinityDecayedChannel 返回本次请求因并发已满或近期失败而被跳过的亲和首选渠道，未降级时返回 0
+func GetChannelAffinityDecayedChannel(c *gin.Context) int {
+	if c == nil {
+		return 0
+	}
+	return c.GetInt(ginKeyChannelAffinityDecayed)
+}
+
 func ShouldSkipRetryAfterChannelAffinityFailure(c *gin.Context) bool {
 	if c == nil {
 		return false
@@ -688,6 +873,11 @@ func RecordChannelAffinity(c *gin.Context, channelID int) {
 	if setting == nil || !setting.Enabled {
 		return
 	}
+	markChannelAffinityConversationSeen(c)
+	// 首选渠道因并发已满被临时跳过时保留原亲和关系，待其空出后重新命中
+	if GetChannelAffinityDecayedChannel(c) > 0 {
+		return
+	}
 	if setting.SwitchOnSuccess && c != nil {
 		if successChannelID := c.GetInt("channel_id"); successChannelID > 0 {
 			channelID = successChannelID
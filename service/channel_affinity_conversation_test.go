@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelAffinityFirstRequestBypass(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	setting := operation_setting.GetChannelAffinitySetting()
+	require.NotNil(t, setting)
+	originalBypass, originalEnabled := setting.FirstRequestBypass, setting.Enabled
+	setting.FirstRequestBypass = true
+	setting.Enabled = true
+	t.Cleanup(func() {
+		setting.FirstRequestBypass, setting.Enabled = originalBypass, originalEnabled
+	})
+
+	var codexRule *operation_setting.ChannelAffinityRule
+	for i := range setting.Rules {
+		rule := &setting.Rules[i]
+		if strings.EqualFold(strings.TrimSpace(rule.Name), "codex cli trace") {
+			codexRule = rule
+			break
+		}
+	}
+	require.NotNil(t, codexRule)
+
+	affinityValue := fmt.Sprintf("pc-conv-%d", time.Now().UnixNano())
+	cacheKeySuffix := buildChannelAffinityCacheKeySuffix(*codexRule, "gpt-5", "default", affinityValue)
+	cache := getChannelAffinityCache()
+	require.NoError(t, cache.SetWithTTL(cacheKeySuffix, 9528, time.Minute))
+	t.Cleanup(func() {
+		_, _ = cache.DeleteMany([]string{cacheKeySuffix})
+	})
+
+	newCtx := func(conversationID string) *gin.Context {
+		rec := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(fmt.Sprintf(`{"prompt_cache_key":"%s"}`, affinityValue)))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+		if conversationID != "" {
+			ctx.Request.Header.Set(setting.GetConversationIdHeader(), conversationID)
+		}
+		return ctx
+	}
+
+	// 未携带会话 ID 时保持原有亲和性
+	channelID, found := GetPreferredChannelByAffinity(newCtx(""), "gpt-5", "default")
+	require.True(t, found)
+	require.Equal(t, 9528, channelID)
+
+	conversationID := fmt.Sprintf("conv-%d", time.Now().UnixNano())
+
+	firstCtx := newCtx(conversationID)
+	_, found = GetPreferredChannelByAffinity(firstCtx, "gpt-5", "default")
+	require.False(t, found)
+	cacheKey, _, ok := getChannelAffinityContext(firstCtx)
+	require.True(t, ok, "affinity meta should still be recorded for the first request")
+	require.NotEmpty(t, cacheKey)
+
+	// 首个请求未成功时会话不记录为已出现，重试仍按首次请求处理
+	_, found = GetPreferredChannelByAffinity(newCtx(conversationID), "gpt-5", "default")
+	require.False(t, found)
+
+	// 请求成功后记录会话，后续请求恢复粘滞
+	RecordChannelAffinity(firstCtx, 9528)
+	channelID, found = GetPreferredChannelByAffinity(newCtx(conversationID), "gpt-5", "default")
+	require.True(t, found)
+	require.Equal(t, 9528, channelID)
+
+	setting.FirstRequestBypass = false
+	channelID, found = GetPreferredChannelByAffinity(newCtx(fmt.Sprintf("conv-off-%d", time.Now().UnixNano())), "gpt-5", "default")
+	require.True(t, found)
+	require.Equal(t, 9528, channelID)
+}
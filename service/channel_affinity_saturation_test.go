@@ -0,0 +1,138 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newSaturationTestContext() *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	return ctx
+}
+
+func withChannelAffinitySaturation(t *testing.T, mode string, waitMs int) {
+	t.Helper()
+	setting := operation_setting.GetChannelAffinitySetting()
+	require.NotNil(t, setting)
+	originalMode, originalWait := setting.SaturationMode, setting.SaturationWaitMs
+	setting.SaturationMode = mode
+	setting.SaturationWaitMs = waitMs
+	t.Cleanup(func() {
+		setting.SaturationMode, setting.SaturationWaitMs = originalMode, originalWait
+	})
+}
+
+func occupyChannel(t *testing.T, channelID int) *gin.Context {
+	t.Helper()
+	holder := newSaturationTestContext()
+	TrackChannelInFlight(holder, channelID)
+	t.Cleanup(func() { ReleaseChannelInFlight(holder) })
+	return holder
+}
+
+func TestTrackChannelInFlight_ReleasesPreviousOnSwitch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ctx := newSaturationTestContext()
+	TrackChannelInFlight(ctx, 91001)
+	require.Equal(t, int64(1), GetChannelInFlight(91001))
+
+	TrackChannelInFlight(ctx, 91002)
+	require.Equal(t, int64(0), GetChannelInFlight(91001))
+	require.Equal(t, int64(1), GetChannelInFlight(91002))
+
+	ReleaseChannelInFlight(ctx)
+	ReleaseChannelInFlight(ctx)
+	require.Equal(t, int64(0), GetChannelInFlight(91002))
+}
+
+func TestShouldUseAffinityPreferredChannel_SkipWhenSaturated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withChannelAffinitySaturation(t, operation_setting.ChannelAffinitySaturationSkip, 0)
+
+	const channelID = 91010
+	ctx := newSaturationTestContext()
+	require.True(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 1))
+	require.True(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 0))
+	require.Zero(t, GetChannelAffinityDecayedChannel(ctx))
+
+	occupyChannel(t, channelID)
+	require.False(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 1))
+	require.Equal(t, channelID, GetChannelAffinityDecayedChannel(ctx))
+
+	adminInfo := map[string]interface{}{}
+	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	info, ok := adminInfo["channel_affinity"].(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, channelID, info["decayed_from_channel_id"])
+}
+
+func TestShouldUseAffinityPreferredChannel_WaitForCapacity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withChannelAffinitySaturation(t, operation_setting.ChannelAffinitySaturationWait, 500)
+
+	const channelID = 91020
+	holder := occupyChannel(t, channelID)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		ReleaseChannelInFlight(holder)
+	}()
+
+	ctx := newSaturationTestContext()
+	require.True(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 1))
+	require.Zero(t, GetChannelAffinityDecayedChannel(ctx))
+
+	// 等待超时仍满则降级
+	withChannelAffinitySaturation(t, operation_setting.ChannelAffinitySaturationWait, 20)
+	occupyChannel(t, channelID)
+	require.False(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 1))
+	require.Equal(t, channelID, GetChannelAffinityDecayedChannel(ctx))
+}
+
+func TestShouldUseAffinityPreferredChannel_Ignore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withChannelAffinitySaturation(t, operation_setting.ChannelAffinitySaturationIgnore, 0)
+
+	const channelID = 91030
+	occupyChannel(t, channelID)
+	ctx := newSaturationTestContext()
+	require.True(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 1))
+}
+
+func TestRecordChannelAffinity_KeepsPreferredAfterDecay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setting := operation_setting.GetChannelAffinitySetting()
+	require.NotNil(t, setting)
+	originalEnabled := setting.Enabled
+	setting.Enabled = true
+	t.Cleanup(func() { setting.Enabled = originalEnabled })
+
+	cacheKey := "test-affinity-decay-" + time.Now().Format("150405.000000000")
+	cache := getChannelAffinityCache()
+	require.NoError(t, cache.SetWithTTL(cacheKey, 91040, time.Minute))
+	t.Cleanup(func() { _, _ = cache.DeleteMany([]string{cacheKey}) })
+
+	ctx := newSaturationTestContext()
+	setChannelAffinityContext(ctx, channelAffinityMeta{CacheKey: channelAffinityCacheNamespace + ":" + cacheKey, TTLSeconds: 60})
+	ctx.Set(ginKeyChannelAffinityDecayed, 91040)
+	RecordChannelAffinity(ctx, 91041)
+
+	channelID, found, err := cache.Get(cacheKey)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 91040, channelID)
+
+	// 未降级时按原逻辑记录成功渠道
+	ctx.Set(ginKeyChannelAffinityDecayed, 0)
+	RecordChannelAffinity(ctx, 91041)
+	channelID, _, err = cache.Get(cacheKey)
+	require.NoError(t, err)
+	require.Equal(t, 91041, channelID)
+}
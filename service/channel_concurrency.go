@@ -0,0 +1,68 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ginKeyChannelInFlightRelease = "channel_in_flight_release"
+
+// channelInFlight 记录本实例内各渠道进行中的请求数，用于判断渠道是否已达到 max_concurrency
+var channelInFlight sync.Map // map[int]*atomic.Int64
+
+func channelInFlightCounter(channelID int) *atomic.Int64 {
+	if v, ok := channelInFlight.Load(channelID); ok {
+		return v.(*atomic.Int64)
+	}
+	v, _ := channelInFlight.LoadOrStore(channelID, &atomic.Int64{})
+	return v.(*atomic.Int64)
+}
+
+// GetChannelInFlight 返回渠道当前进行中的请求数
+func GetChannelInFlight(channelID int) int64 {
+	if v, ok := channelInFlight.Load(channelID); ok {
+		return v.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// IsChannelSaturated 判断渠道是否已达到并发上限，maxConcurrency <= 0 表示不限制
+func IsChannelSaturated(channelID int, maxConcurrency int) bool {
+	if channelID <= 0 || maxConcurrency <= 0 {
+		return false
+	}
+	return GetChannelInFlight(channelID) >= int64(maxConcurrency)
+}
+
+// TrackChannelInFlight 将当前请求计入渠道进行中数量；重试切换渠道时先释放上一个渠道的计数
+func TrackChannelInFlight(c *gin.Context, channelID int) {
+	if c == nil || channelID <= 0 {
+		return
+	}
+	ReleaseChannelInFlight(c)
+	counter := channelInFlightCounter(channelID)
+	counter.Add(1)
+	var once sync.Once
+	c.Set(ginKeyChannelInFlightRelease, func() {
+		once.Do(func() {
+			counter.Add(-1)
+		})
+	})
+}
+
+// ReleaseChannelInFlight 释放当前请求占用的渠道计数，可重复调用
+func ReleaseChannelInFlight(c *gin.Context) {
+	if c == nil {
+		return
+	}
+	v, ok := c.Get(ginKeyChannelInFlightRelease)
+	if !ok {
+		return
+	}
+	if release, ok := v.(func()); ok {
+		release()
+	}
+	c.Set(ginKeyChannelInFlightRelease, nil)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/gin-gonic/gin"
+)
+
+// estimateChannelRequestCost 估算渠道处理本次请求的相对成本：按次计费的模型取 价格×QuotaPerUnit，
+// 否则取 预估 token 数×模型倍率，最后乘以渠道成本倍率。模型按渠道的模型映射换算为上游模型后定价
+func estimateChannelRequestCost(channel *model.Channel, modelName string, estimatedTokens int) (float64, bool) {
+	upstreamModel := modelName
+	if mapping := channel.GetModelMapping(); mapping != "" && mapping != "{}" {
+		modelMap := make(map[string]string)
+		if err := common.UnmarshalJsonStr(mapping, &modelMap); err == nil && modelMap[modelName] != "" {
+			upstreamModel = modelMap[modelName]
+		}
+	}
+	var cost float64
+	if price, ok := ratio_setting.GetModelPrice(upstreamModel, false); ok {
+		cost = price * common.QuotaPerUnit
+	} else {
+		if estimatedTokens <= 0 {
+			return 0, false
+		}
+		ratio, ok, _ := ratio_setting.GetModelRatio(upstreamModel)
+		if !ok {
+			return 0, false
+		}
+		cost = ratio * float64(estimatedTokens)
+	}
+	if costRatio := channel.GetSetting().CostRatio; costRatio > 0 {
+		cost *= costRatio
+	}
+	return cost, true
+}
+
+// RankChannelsByCost 按预估成本从低到高排序候选渠道，成本相同的保持原有顺序；任一渠道无法估算时返回 false
+func RankChannelsByCost(channels []*model.Channel, modelName string, estimatedTokens int) ([]*model.Channel, []float64, bool) {
+	type rankedChannel struct {
+		channel *model.Channel
+		cost    float64
+	}
+	ranked := make([]rankedChannel, 0, len(channels))
+	for _, channel := range channels {
+		cost, ok := estimateChannelRequestCost(channel, modelName, estimatedTokens)
+		if !ok {
+			return nil, nil, false
+		}
+		ranked = append(ranked, rankedChannel{channel: channel, cost: cost})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].cost < ranked[j].cost
+	})
+	sorted := make([]*model.Channel, len(ranked))
+	costs := make([]float64, len(ranked))
+	for i, item := range ranked {
+		sorted[i], costs[i] = item.channel, item.cost
+	}
+	return sorted, costs, true
+}
+
+// selectLowestCostChannel 选出成本最低的渠道，最低成本有多个渠道并列时在其中随机；
+// 全部并列或无法估算时返回 false，交由常规随机选择
+func selectLowestCostChannel(channels []*model.Channel, modelName string, estimatedTokens int) (*model.Channel, bool) {
+	if len(channels) < 2 {
+		return nil, false
+	}
+	// 近期失败的渠道不参与成本排序，除非全部候选都处于冷却期
+	healthy := make([]*model.Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !IsChannelRecentlyFailed(channel.Id) {
+			healthy = append(healthy, channel)
+		}
+	}
+	if len(healthy) > 0 {
+		channels = healthy
+	}
+	sorted, costs, ok := RankChannelsByCost(channels, modelName, estimatedTokens)
+	if !ok || len(sorted) == 0 {
+		return nil, false
+	}
+	tied := 1
+	for tied < len(costs) && costs[tied] == costs[0] {
+		tied++
+	}
+	if tied == len(costs) {
+		return nil, false
+	}
+	return sorted[common.GetRandomInt(tied)], true
+}
+
+// CacheGetCostAwareChannel 在 COST_AWARE_ROUTING_ENABLED 开启时，从首个有候选渠道的分组中按预估成本选择渠道。
+// 返回 false 表示未启用、候选不足、成本全部相同或无法估算，调用方应回退为 CacheGetRandomSatisfiedChannel
+func CacheGetCostAwareChannel(c *gin.Context, modelName string, tokenGroup string, estimatedTokens int) (*model.Channel, string, bool) {
+	if !constant.CostAwareRoutingEnabled {
+		return nil, tokenGroup, false
+	}
+	groups := []string{tokenGroup}
+	if tokenGroup == "auto" {
+		groups = GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	}
+	for i, group := range groups {
+		channels, err := model.GetSatisfiedChannels(group, modelName, 0)
+		if err != nil {
+			return nil, tokenGroup, false
+		}
+		if len(channels) == 0 {
+			continue
+		}
+		channel, ok := selectLowestCostChannel(channels, modelName, estimatedTokens)
+		if !ok {
+			return nil, tokenGroup, false
+		}
+		if tokenGroup == "auto" {
+			common.SetContextKey(c, constant.ContextKeyAutoGroup, group)
+			common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, i)
+		}
+		return channel, group, true
+	}
+	return nil, tokenGroup, false
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func withModelRatios(t *testing.T, ratios map[string]float64) {
+	t.Helper()
+	original, err := common.Marshal(ratio_setting.GetModelRatioCopy())
+	require.NoError(t, err)
+	merged := ratio_setting.GetModelRatioCopy()
+	for name, ratio := range ratios {
+		merged[name] = ratio
+	}
+	updated, err := common.Marshal(merged)
+	require.NoError(t, err)
+	require.NoError(t, ratio_setting.UpdateModelRatioByJSONString(string(updated)))
+	t.Cleanup(func() { _ = ratio_setting.UpdateModelRatioByJSONString(string(original)) })
+}
+
+func costTestChannel(id int, setting string, mapping string) *model.Channel {
+	channel := &model.Channel{Id: id}
+	if setting != "" {
+		channel.Setting = &setting
+	}
+	if mapping != "" {
+		channel.ModelMapping = &mapping
+	}
+	return channel
+}
+
+func TestRankChannelsByCost(t *testing.T) {
+	withModelRatios(t, map[string]float64{"cost-test-large": 10, "cost-test-small": 1})
+
+	channels := []*model.Channel{
+		costTestChannel(1, "", ""),
+		costTestChannel(2, `{"cost_ratio":0.5}`, ""),
+		costTestChannel(3, "", `{"cost-test-large":"cost-test-small"}`),
+	}
+	sorted, costs, ok := RankChannelsByCost(channels, "cost-test-large", 1000)
+	require.True(t, ok)
+	require.Equal(t, []int{3, 2, 1}, []int{sorted[0].Id, sorted[1].Id, sorted[2].Id})
+	require.Equal(t, []float64{1000, 5000, 10000}, costs)
+
+	_, _, ok = RankChannelsByCost(channels, "cost-test-large", 0)
+	require.False(t, ok)
+}
+
+func TestSelectLowestCostChannelFallsBackOnTie(t *testing.T) {
+	withModelRatios(t, map[string]float64{"cost-test-tie": 2})
+
+	tied := []*model.Channel{costTestChannel(11, "", ""), costTestChannel(12, "", "")}
+	_, ok := selectLowestCostChannel(tied, "cost-test-tie", 100)
+	require.False(t, ok)
+
+	cheaper := append(tied, costTestChannel(13, `{"cost_ratio":0.1}`, ""))
+	channel, ok := selectLowestCostChannel(cheaper, "cost-test-tie", 100)
+	require.True(t, ok)
+	require.Equal(t, 13, channel.Id)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// recentFailureReselectAttempts 随机选择命中近期失败渠道时的重选次数，仍命中时沿用该渠道
+const recentFailureReselectAttempts = 3
+
+// channelRecentFailures 记录近期上游返回 5xx/429 的渠道，条目按冷却时长过期。
+// 仅在本进程内生效，用于应对短暂抖动，不影响渠道状态与自动禁用。
+var channelRecentFailures = common.NewTTLCache[int, struct{}]("channel_recent_failure", 10000, time.Minute)
+
+func isChannelTransientFailure(err *types.NewAPIError) bool {
+	if err == nil || types.IsSkipRetryError(err) {
+		return false
+	}
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= http.StatusInternalServerError
+}
+
+// RecordChannelRecentFailure 在上游返回 5xx/429 时将渠道标记为近期失败，冷却时长未配置时不记录
+func RecordChannelRecentFailure(channelID int, err *types.NewAPIError) {
+	if channelID <= 0 || !isChannelTransientFailure(err) {
+		return
+	}
+	cooldown := operation_setting.GetChannelAffinitySetting().GetRecentFailureCooldown()
+	if cooldown <= 0 {
+		return
+	}
+	channelRecentFailures.SetWithTTL(channelID, struct{}{}, cooldown)
+}
+
+// IsChannelRecentlyFailed 判断渠道是否处于近期失败的冷却期内
+func IsChannelRecentlyFailed(channelID int) bool {
+	if channelID <= 0 {
+		return false
+	}
+	_, ok := channelRecentFailures.Get(channelID)
+	return ok
+}
+
+// getRandomSatisfiedChannelAvoidingFailures 与 model.GetRandomSatisfiedChannel 相同，
+// 但命中近期失败的渠道时会重选，多次重选仍命中时返回首次选中的渠道
+func getRandomSatisfiedChannelAvoidingFailures(group string, modelName string, retry int) (*model.Channel, error) {
+	channel, err := model.GetRandomSatisfiedChannel(group, modelName, retry)
+	if err != nil || channel == nil || !IsChannelRecentlyFailed(channel.Id) {
+		return channel, err
+	}
+	for i := 0; i < recentFailureReselectAttempts; i++ {
+		candidate, err := model.GetRandomSatisfiedChannel(group, modelName, retry)
+		if err != nil || candidate == nil {
+			break
+		}
+		if !IsChannelRecentlyFailed(candidate.Id) {
+			return candidate, nil
+		}
+	}
+	return channel, nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withRecentFailureCooldown(t *testing.T, seconds int) {
+	t.Helper()
+	setting := operation_setting.GetChannelAffinitySetting()
+	original := setting.RecentFailureCooldownSeconds
+	setting.RecentFailureCooldownSeconds = seconds
+	t.Cleanup(func() { setting.RecentFailureCooldownSeconds = original })
+}
+
+func TestRecordChannelRecentFailure_OnlyTransientUpstreamErrors(t *testing.T) {
+	withRecentFailureCooldown(t, 30)
+
+	cases := []struct {
+		channelID int
+		err       *types.NewAPIError
+		recorded  bool
+	}{
+		{92001, types.NewOpenAIError(errors.New("bad gateway"), types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway), true},
+		{92002, types.NewOpenAIError(errors.New("rate limited"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests), true},
+		{92003, types.NewOpenAIError(errors.New("bad request"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest), false},
+		{92004, types.NewOpenAIError(errors.New("local"), types.ErrorCodeBadResponseStatusCode, http.StatusInternalServerError, types.ErrOptionWithSkipRetry()), false},
+	}
+	for _, tc := range cases {
+		t.Cleanup(func() { channelRecentFailures.Delete(tc.channelID) })
+		RecordChannelRecentFailure(tc.channelID, tc.err)
+		require.Equal(t, tc.recorded, IsChannelRecentlyFailed(tc.channelID), "channel %d", tc.channelID)
+	}
+}
+
+func TestRecordChannelRecentFailure_DisabledWithoutCooldown(t *testing.T) {
+	withRecentFailureCooldown(t, 0)
+
+	const channelID = 92010
+	err := types.NewOpenAIError(errors.New("bad gateway"), types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway)
+	RecordChannelRecentFailure(channelID, err)
+	require.False(t, IsChannelRecentlyFailed(channelID))
+}
+
+func TestShouldUseAffinityPreferredChannel_SkipWhenRecentlyFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withRecentFailureCooldown(t, 30)
+
+	const channelID = 92020
+	t.Cleanup(func() { channelRecentFailures.Delete(channelID) })
+	ctx := newSaturationTestContext()
+	require.True(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 0))
+
+	RecordChannelRecentFailure(channelID, types.NewOpenAIError(errors.New("unavailable"), types.ErrorCodeBadResponseStatusCode, http.StatusServiceUnavailable))
+	require.False(t, ShouldUseAffinityPreferredChannel(ctx, channelID, 0))
+	require.Equal(t, channelID, GetChannelAffinityDecayedChannel(ctx))
+
+	adminInfo := map[string]interface{}{}
+	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	info, ok := adminInfo["channel_affinity"].(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, "recently_failed", info["reason"])
+}
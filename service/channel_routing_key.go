@@ -0,0 +1,74 @@
+package service
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+)
+
+// RoutingKeyHeader 客户端指定的粘性路由键，相同的键在渠道集合不变时总是落到同一渠道
+const RoutingKeyHeader = "X-Routing-Key"
+
+// routingKeyScore 计算路由键与渠道的 rendezvous 哈希得分，渠道增减时只影响原本映射到该渠道的键
+func routingKeyScore(routingKey string, channelID int) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(routingKey))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(strconv.Itoa(channelID)))
+	return h.Sum64()
+}
+
+// pickChannelByRoutingKey 在候选渠道中选出与路由键得分最高的已启用渠道
+func pickChannelByRoutingKey(routingKey string, channels []*model.Channel) *model.Channel {
+	var picked *model.Channel
+	var bestScore uint64
+	for _, channel := range channels {
+		if channel == nil || channel.Status != common.ChannelStatusEnabled {
+			continue
+		}
+		score := routingKeyScore(routingKey, channel.Id)
+		if picked == nil || score > bestScore || (score == bestScore && channel.Id < picked.Id) {
+			picked, bestScore = channel, score
+		}
+	}
+	return picked
+}
+
+// GetChannelByRoutingKey 请求携带 X-Routing-Key 时，按一致性哈希在首个有候选渠道的分组中确定性地选择渠道。
+// 未携带请求头或没有可用渠道时返回 false，调用方继续走渠道亲和性与随机选择
+func GetChannelByRoutingKey(c *gin.Context, modelName string, usingGroup string) (*model.Channel, string, bool) {
+	if c == nil || c.Request == nil {
+		return nil, usingGroup, false
+	}
+	routingKey := strings.TrimSpace(c.Request.Header.Get(RoutingKeyHeader))
+	if routingKey == "" {
+		return nil, usingGroup, false
+	}
+	groups := []string{usingGroup}
+	if usingGroup == "auto" {
+		groups = GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	}
+	for i, group := range groups {
+		channels, err := model.GetSatisfiedChannels(group, modelName, 0)
+		if err != nil {
+			return nil, usingGroup, false
+		}
+		channel := pickChannelByRoutingKey(routingKey, channels)
+		if channel == nil {
+			continue
+		}
+		if usingGroup == "auto" {
+			common.SetContextKey(c, constant.ContextKeyAutoGroup, group)
+			common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, i)
+		}
+		logger.LogDebug(c, "routing key pinned channel #%d in group %s", channel.Id, group)
+		return channel, group, true
+	}
+	return nil, usingGroup, false
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickChannelByRoutingKeyIsStable(t *testing.T) {
+	channels := make([]*model.Channel, 0, 5)
+	for id := 1; id <= 5; id++ {
+		channels = append(channels, &model.Channel{Id: id, Status: common.ChannelStatusEnabled})
+	}
+
+	moved := 0
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		picked := pickChannelByRoutingKey(key, channels)
+		require.NotNil(t, picked)
+		// 顺序变化不影响结果
+		reversed := []*model.Channel{channels[4], channels[3], channels[2], channels[1], channels[0]}
+		require.Equal(t, picked.Id, pickChannelByRoutingKey(key, reversed).Id)
+
+		// 移除一个渠道时，只有原本映射到该渠道的键需要迁移
+		remaining := channels[:4]
+		repicked := pickChannelByRoutingKey(key, remaining)
+		if picked.Id != 5 {
+			require.Equal(t, picked.Id, repicked.Id)
+		} else {
+			moved++
+		}
+	}
+	require.Greater(t, moved, 0)
+
+	disabled := []*model.Channel{{Id: 9, Status: common.ChannelStatusManuallyDisabled}}
+	require.Nil(t, pickChannelByRoutingKey("session-1", disabled))
+}
@@ -51,6 +51,9 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if requestedModel := common.GetContextKeyString(ctx, constant.ContextKeyTokenRequestedModel); requestedModel != "" {
+		other["token_requested_model"] = requestedModel
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
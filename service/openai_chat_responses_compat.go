@@ -16,3 +16,7 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	return openaicompat.ExtractOutputTextFromResponses(resp)
 }
+
+func ExtractReasoningSummaryFromResponses(resp *dto.OpenAIResponsesResponse) string {
+	return openaicompat.ExtractReasoningSummaryFromResponses(resp)
+}
@@ -9,6 +9,10 @@ func ShouldChatCompletionsUseResponsesPolicy(policy model_setting.ChatCompletion
 	return openaicompat.ShouldChatCompletionsUseResponsesPolicy(policy, channelID, channelType, model)
 }
 
+func ShouldPassThroughResponsesReasoningGlobal(channelEnabled bool, model string) bool {
+	return openaicompat.ShouldPassThroughResponsesReasoningGlobal(channelEnabled, model)
+}
+
 func ShouldChatCompletionsUseResponsesGlobal(channelID int, channelType int, model string) bool {
 	return openaicompat.ShouldChatCompletionsUseResponsesGlobal(channelID, channelType, model)
 }
@@ -73,6 +73,22 @@ func convertChatResponseFormatToResponsesText(reqFormat *dto.ResponseFormat) jso
 	return textRaw
 }
 
+// responsesStatefulParams 是 chat 请求 extra_body 中可透传给 responses 的有状态会话参数
+type responsesStatefulParams struct {
+	PreviousResponseID string          `json:"previous_response_id,omitempty"`
+	Store              json.RawMessage `json:"store,omitempty"`
+}
+
+func parseResponsesStatefulParams(extraBody json.RawMessage) responsesStatefulParams {
+	var params responsesStatefulParams
+	if len(extraBody) == 0 {
+		return params
+	}
+	_ = common.Unmarshal(extraBody, &params)
+	params.PreviousResponseID = strings.TrimSpace(params.PreviousResponseID)
+	return params
+}
+
 func ChatCompletionsRequestToResponsesRequest(req *dto.GeneralOpenAIRequest) (*dto.OpenAIResponsesRequest, error) {
 	if req == nil {
 		return nil, errors.New("request is nil")
@@ -391,6 +407,14 @@ func ChatCompletionsRequestToResponsesRequest(req *dto.GeneralOpenAIRequest) (*d
 		out.MaxOutputTokens = lo.ToPtr(maxOutputTokens)
 	}
 
+	// chat 协议没有 previous_response_id，客户端可通过 extra_body 传入以使用 responses 的有状态会话；
+	// 顶层 store 优先于 extra_body 中的 store
+	stateful := parseResponsesStatefulParams(req.ExtraBody)
+	out.PreviousResponseID = stateful.PreviousResponseID
+	if len(out.Store) == 0 && len(stateful.Store) > 0 {
+		out.Store = stateful.Store
+	}
+
 	if req.ReasoningEffort != "" {
 		out.Reasoning = &dto.Reasoning{
 			Effort:  req.ReasoningEffort,
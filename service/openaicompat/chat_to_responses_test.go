@@ -0,0 +1,45 @@
+package openaicompat
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletionsRequestToResponsesRequest_PreviousResponseIDRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	raw := []byte(`{"model":"gpt-5","messages":[{"role":"user","content":"continue"}],"extra_body":{"previous_response_id":"resp_123","store":true}}`)
+	var chatReq dto.GeneralOpenAIRequest
+	require.NoError(t, common.Unmarshal(raw, &chatReq))
+
+	out, err := ChatCompletionsRequestToResponsesRequest(&chatReq)
+	require.NoError(t, err)
+	assert.Equal(t, "resp_123", out.PreviousResponseID)
+	assert.Equal(t, "true", string(out.Store))
+	assert.True(t, out.IsStateful())
+
+	body, err := common.Marshal(out)
+	require.NoError(t, err)
+	var decoded dto.OpenAIResponsesRequest
+	require.NoError(t, common.Unmarshal(body, &decoded))
+	assert.Equal(t, "resp_123", decoded.PreviousResponseID)
+	assert.Equal(t, "true", string(decoded.Store))
+}
+
+func TestChatCompletionsRequestToResponsesRequest_TopLevelStoreWins(t *testing.T) {
+	t.Parallel()
+
+	raw := []byte(`{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"store":false,"extra_body":{"store":true}}`)
+	var chatReq dto.GeneralOpenAIRequest
+	require.NoError(t, common.Unmarshal(raw, &chatReq))
+
+	out, err := ChatCompletionsRequestToResponsesRequest(&chatReq)
+	require.NoError(t, err)
+	assert.Equal(t, "false", string(out.Store))
+	assert.Empty(t, out.PreviousResponseID)
+	assert.False(t, out.IsStateful())
+}
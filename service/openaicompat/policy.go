@@ -1,14 +1,61 @@
 package openaicompat
 
-import "github.com/QuantumNous/new-api/setting/model_setting"
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/model_setting"
+)
 
 func ShouldChatCompletionsUseResponsesPolicy(policy model_setting.ChatCompletionsToResponsesPolicy, channelID int, channelType int, model string) bool {
+	if !policy.Enabled {
+		return false
+	}
+	if useResponses, matched := matchChatCompletionsRule(policy.Rules, channelID, channelType, model); matched {
+		return useResponses
+	}
 	if !policy.IsChannelEnabled(channelID, channelType) {
 		return false
 	}
 	return matchAnyRegex(policy.ModelPatterns, model)
 }
 
+// matchChatCompletionsRule 按顺序查找第一条命中 (渠道, 模型) 的规则，mode 无法识别的规则被忽略
+func matchChatCompletionsRule(rules []model_setting.ChatCompletionsToResponsesRule, channelID int, channelType int, model string) (useResponses bool, matched bool) {
+	for _, rule := range rules {
+		var mode bool
+		switch strings.ToLower(strings.TrimSpace(rule.Mode)) {
+		case model_setting.ChatCompletionsModeResponses:
+			mode = true
+		case model_setting.ChatCompletionsModeNative:
+			mode = false
+		default:
+			continue
+		}
+		if !rule.MatchChannel(channelID, channelType) || !matchAnyRegex(rule.ModelPatterns, model) {
+			continue
+		}
+		return mode, true
+	}
+	return false, false
+}
+
+// ShouldPassThroughResponsesReasoning 判断 Responses 转换回非流式 Chat Completions 时是否以 reasoning_content 返回推理摘要，
+// 渠道开启或模型命中 ReasoningContentModelPatterns 任一即可
+func ShouldPassThroughResponsesReasoning(policy model_setting.ChatCompletionsToResponsesPolicy, channelEnabled bool, model string) bool {
+	if channelEnabled {
+		return true
+	}
+	return matchAnyRegex(policy.ReasoningContentModelPatterns, model)
+}
+
+func ShouldPassThroughResponsesReasoningGlobal(channelEnabled bool, model string) bool {
+	return ShouldPassThroughResponsesReasoning(
+		model_setting.GetGlobalSettings().ChatCompletionsToResponsesPolicy,
+		channelEnabled,
+		model,
+	)
+}
+
 func ShouldChatCompletionsUseResponsesGlobal(channelID int, channelType int, model string) bool {
 	return ShouldChatCompletionsUseResponsesPolicy(
 		model_setting.GetGlobalSettings().ChatCompletionsToResponsesPolicy,
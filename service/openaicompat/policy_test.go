@@ -0,0 +1,81 @@
+package openaicompat
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldChatCompletionsUseResponsesPolicy_ChannelLevel(t *testing.T) {
+	t.Parallel()
+
+	policy := model_setting.ChatCompletionsToResponsesPolicy{
+		Enabled:       true,
+		ChannelIDs:    []int{1},
+		ModelPatterns: []string{"^gpt-5"},
+	}
+	assert.True(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 0, "gpt-5-mini"))
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 0, "gpt-4o"))
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 2, 0, "gpt-5-mini"))
+
+	policy.Enabled = false
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 0, "gpt-5-mini"))
+}
+
+func TestShouldChatCompletionsUseResponsesPolicy_PerChannelModelRules(t *testing.T) {
+	t.Parallel()
+
+	policy := model_setting.ChatCompletionsToResponsesPolicy{
+		Enabled:       true,
+		AllChannels:   true,
+		ModelPatterns: []string{"^o\\d"},
+		Rules: []model_setting.ChatCompletionsToResponsesRule{
+			// 渠道 1 上的 o3 支持原生 chat
+			{ChannelIDs: []int{1}, ModelPatterns: []string{"^o3$"}, Mode: "chat"},
+			// 渠道 1 上 codex 模型只支持 Responses
+			{ChannelIDs: []int{1}, ModelPatterns: []string{"codex"}, Mode: "responses"},
+			// 渠道类型 57 上所有 gpt-5 走 Responses
+			{ChannelTypes: []int{57}, ModelPatterns: []string{"^gpt-5"}, Mode: "Responses"},
+			{ModelPatterns: []string{".*"}, Mode: "unknown"},
+		},
+	}
+
+	// 同一渠道可同时服务原生 chat 模型与仅支持 Responses 的模型
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 1, "o3"))
+	assert.True(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 1, "gpt-5-codex"))
+	// 未命中规则时回退到渠道级 ModelPatterns
+	assert.True(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 1, "o4-mini"))
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 1, 1, "gpt-4o"))
+	// 规则只作用于匹配的渠道
+	assert.True(t, ShouldChatCompletionsUseResponsesPolicy(policy, 2, 1, "o3"))
+	assert.True(t, ShouldChatCompletionsUseResponsesPolicy(policy, 3, 57, "gpt-5"))
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 3, 1, "gpt-5"))
+}
+
+func TestShouldChatCompletionsUseResponsesPolicy_RuleOverridesDisabledChannel(t *testing.T) {
+	t.Parallel()
+
+	policy := model_setting.ChatCompletionsToResponsesPolicy{
+		Enabled: true,
+		Rules: []model_setting.ChatCompletionsToResponsesRule{
+			{ChannelIDs: []int{9}, ModelPatterns: []string{"^gpt-5-pro$"}, Mode: "responses"},
+		},
+	}
+	assert.True(t, ShouldChatCompletionsUseResponsesPolicy(policy, 9, 1, "gpt-5-pro"))
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 9, 1, "gpt-5"))
+	assert.False(t, ShouldChatCompletionsUseResponsesPolicy(policy, 8, 1, "gpt-5-pro"))
+}
+
+func TestShouldPassThroughResponsesReasoning(t *testing.T) {
+	t.Parallel()
+
+	policy := model_setting.ChatCompletionsToResponsesPolicy{
+		ReasoningContentModelPatterns: []string{"^o\\d"},
+	}
+	assert.True(t, ShouldPassThroughResponsesReasoning(policy, false, "o3"))
+	assert.False(t, ShouldPassThroughResponsesReasoning(policy, false, "gpt-5"))
+	// 渠道开启时不看模型规则
+	assert.True(t, ShouldPassThroughResponsesReasoning(policy, true, "gpt-5"))
+	assert.False(t, ShouldPassThroughResponsesReasoning(model_setting.ChatCompletionsToResponsesPolicy{}, false, "o3"))
+}
@@ -131,3 +131,25 @@ func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	}
 	return sb.String()
 }
+
+// ExtractReasoningSummaryFromResponses 拼接 reasoning 输出中的推理摘要，多段摘要之间以空行分隔
+func ExtractReasoningSummaryFromResponses(resp *dto.OpenAIResponsesResponse) string {
+	if resp == nil || len(resp.Output) == 0 {
+		return ""
+	}
+	parts := make([]string, 0)
+	for _, out := range resp.Output {
+		if out.Type != "reasoning" {
+			continue
+		}
+		for _, summary := range out.Summary {
+			if summary.Type != "" && summary.Type != "summary_text" {
+				continue
+			}
+			if summary.Text != "" {
+				parts = append(parts, summary.Text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	quotaRefundRecordCleanupLockKey   = "quota_refund_record_cleanup_lock"
+	quotaRefundRecordCleanupInterval  = time.Hour
+	quotaRefundRecordCleanupBatchSize = 1000
+)
+
+var (
+	quotaRefundRecordCleanupOnce    sync.Once
+	quotaRefundRecordCleanupRunning atomic.Bool
+)
+
+// StartQuotaRefundRecordCleanupTask 每小时删除超过 QUOTA_REFUND_RECORD_RETENTION_DAYS 的退款去重记录，保留天数为 0 时不启动。
+// 启用 Redis 时由分布式锁保证每个周期只有一个节点执行，否则仅主节点执行。
+func StartQuotaRefundRecordCleanupTask() {
+	quotaRefundRecordCleanupOnce.Do(func() {
+		if constant.QuotaRefundRecordRetentionDays <= 0 {
+			return
+		}
+		if !common.RedisEnabled && !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("quota refund record cleanup task started: retention=%dd", constant.QuotaRefundRecordRetentionDays))
+			ticker := time.NewTicker(quotaRefundRecordCleanupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runQuotaRefundRecordCleanupOnce()
+			}
+		})
+	})
+}
+
+func runQuotaRefundRecordCleanupOnce() {
+	if !quotaRefundRecordCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer quotaRefundRecordCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	if common.RedisEnabled && common.RDB != nil {
+		// 锁在本周期内保持不释放，避免其他节点在同一周期内重复清理
+		_, acquired, err := common.RedisTryLock(quotaRefundRecordCleanupLockKey, quotaRefundRecordCleanupInterval*9/10)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("quota refund record cleanup lock failed: %v", err))
+			return
+		}
+		if !acquired {
+			return
+		}
+	}
+
+	before := time.Now().AddDate(0, 0, -constant.QuotaRefundRecordRetentionDays).Unix()
+	rows, err := model.DeleteQuotaRefundRecordsBefore(ctx, before, quotaRefundRecordCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("quota refund record cleanup task failed: %v", err))
+		return
+	}
+	if rows > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("quota refund record cleanup task purged %d records", rows))
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	redemptionCleanupLockKey = "redemption_cleanup_lock"
+	// redemptionCleanupBatchSize 每批物理删除的兑换码数量，避免单条 SQL 超出数据库参数上限
+	redemptionCleanupBatchSize = 1000
+)
+
+var (
+	redemptionCleanupOnce    sync.Once
+	redemptionCleanupRunning atomic.Bool
+)
+
+// StartRedemptionCleanupTask 按 REDEMPTION_CLEANUP_INTERVAL_MINUTES 定期清理无效兑换码，间隔为 0 时不启动。
+// 启用 Redis 时由分布式锁保证每个周期只有一个节点执行，否则仅主节点执行。
+func StartRedemptionCleanupTask() {
+	redemptionCleanupOnce.Do(func() {
+		interval := time.Duration(constant.RedemptionCleanupIntervalMinutes) * time.Minute
+		if interval <= 0 {
+			return
+		}
+		if !common.RedisEnabled && !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("redemption cleanup task started: interval=%s", interval))
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runRedemptionCleanupOnce(interval)
+			}
+		})
+	})
+}
+
+func runRedemptionCleanupOnce(interval time.Duration) {
+	if !redemptionCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer redemptionCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	if common.RedisEnabled && common.RDB != nil {
+		// 锁在本周期内保持不释放，避免其他节点在同一周期内重复清理
+		_, acquired, err := common.RedisTryLock(redemptionCleanupLockKey, interval*9/10)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("redemption cleanup lock failed: %v", err))
+			return
+		}
+		if !acquired {
+			return
+		}
+	}
+
+	redemptions, usages, err := model.PurgeInvalidRedemptions(ctx, redemptionCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("redemption cleanup task failed after purging %d rows: %v", redemptions+usages, err))
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("redemption cleanup task purged %d rows (%d redemptions, %d usages)", redemptions+usages, redemptions, usages))
+}
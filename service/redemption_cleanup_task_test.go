@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRedemptionCleanupOnce_PurgesInvalidRedemptions(t *testing.T) {
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM redemptions")
+		model.DB.Exec("DELETE FROM redemption_usages")
+	})
+	now := common.GetTimestamp()
+	redemptions := []*model.Redemption{
+		{Key: "cleanup-valid", Status: common.RedemptionCodeStatusEnabled, CreatedTime: now},
+		{Key: "cleanup-used", Status: common.RedemptionCodeStatusUsed, CreatedTime: now},
+		{Key: "cleanup-disabled", Status: common.RedemptionCodeStatusDisabled, CreatedTime: now},
+		{Key: "cleanup-expired", Status: common.RedemptionCodeStatusEnabled, CreatedTime: now, ExpiredTime: now - 60},
+		{Key: "cleanup-soft-deleted", Status: common.RedemptionCodeStatusUsed, CreatedTime: now},
+	}
+	for _, r := range redemptions {
+		require.NoError(t, model.DB.Create(r).Error)
+	}
+	require.NoError(t, model.DB.Create(&model.RedemptionUsage{RedemptionId: redemptions[1].Id, UserId: 1, RedeemedTime: now}).Error)
+	require.NoError(t, model.DB.Create(&model.RedemptionUsage{RedemptionId: redemptions[4].Id, UserId: 1, RedeemedTime: now}).Error)
+	// 之前已软删除的无效兑换码同样会被物理删除
+	require.NoError(t, model.DB.Delete(redemptions[4]).Error)
+
+	runRedemptionCleanupOnce(time.Minute)
+
+	var keys []string
+	require.NoError(t, model.DB.Unscoped().Model(&model.Redemption{}).Pluck("key", &keys).Error)
+	assert.Equal(t, []string{"cleanup-valid"}, keys)
+	var usageCount int64
+	require.NoError(t, model.DB.Unscoped().Model(&model.RedemptionUsage{}).Count(&usageCount).Error)
+	assert.Zero(t, usageCount)
+}
@@ -1,12 +1,20 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
 )
 
 type sseConcurrencyCounter struct {
@@ -24,16 +32,20 @@ type sseConcurrencyTarget struct {
 const (
 	sseConcurrencyCounterCleanupInterval = 256
 	sseConcurrencyCounterIdleTTL         = 10 * time.Minute
+	sseConcurrencyQueuePollInterval      = 100 * time.Millisecond
 )
 
 var (
 	sseConcurrencyCounters       sync.Map // map[string]*sseConcurrencyCounter
 	sseConcurrencyCleanupCounter atomic.Uint64
 	sseConcurrencyCountersMu     sync.Mutex
+
+	sseConcurrencyReleased   = make(chan struct{})
+	sseConcurrencyReleasedMu sync.Mutex
 )
 
 func getOrCreateSSEConcurrencyCounter(key string) *sseConcurrencyCounter {
-	nowUnix := time.Now().Unix()
+	nowUnix := common.Now().Unix()
 	if key == "" {
 		counter := &sseConcurrencyCounter{}
 		counter.lastActiveUnix.Store(nowUnix)
@@ -63,7 +75,7 @@ func maybeCleanupSSEConcurrencyCounters() {
 	sseConcurrencyCountersMu.Lock()
 	defer sseConcurrencyCountersMu.Unlock()
 
-	nowUnix := time.Now().Unix()
+	nowUnix := common.Now().Unix()
 	sseConcurrencyCounters.Range(func(key, value any) bool {
 		counter, ok := value.(*sseConcurrencyCounter)
 		if !ok {
@@ -89,54 +101,125 @@ func decrementSSEConcurrencyCounter(_ string, counter *sseConcurrencyCounter) {
 	if current < 0 {
 		counter.count.Store(0)
 	}
-	counter.lastActiveUnix.Store(time.Now().Unix())
+	counter.lastActiveUnix.Store(common.Now().Unix())
+}
+
+// SSEConcurrencyIdentity 标识一次 SSE 请求所属的用户、令牌、分组与客户端 IP，零值字段不参与限制
+type SSEConcurrencyIdentity struct {
+	UserID   int
+	TokenID  int
+	Group    string
+	ClientIP string
 }
 
 // AcquireSSEConcurrencySlot 为 SSE 请求申请并发槽位。
 // 返回的 release 必须在请求结束时调用；若超过限制则返回错误。
 func AcquireSSEConcurrencySlot(userID int, tokenID int) (release func(), err error) {
+	return AcquireSSEConcurrencySlotFor(context.Background(), SSEConcurrencyIdentity{UserID: userID, TokenID: tokenID})
+}
+
+// AcquireSSEConcurrencySlotFor 与 AcquireSSEConcurrencySlot 相同，额外支持按分组与客户端 IP 限制。
+// 所有维度要么全部占用成功，要么全部回滚。配置了 SSEQueueWaitMs 时，达到上限后会在该时长内
+// 等待其他流释放名额，ctx 取消时立即放弃等待。
+func AcquireSSEConcurrencySlotFor(ctx context.Context, identity SSEConcurrencyIdentity) (release func(), err error) {
 	setting := operation_setting.GetGeneralSetting()
 	if setting == nil || !setting.SSEConcurrencyLimitEnabled {
 		return func() {}, nil
 	}
-	maybeCleanupSSEConcurrencyCounters()
-
-	sseConcurrencyCountersMu.Lock()
-	defer sseConcurrencyCountersMu.Unlock()
 
-	targets := make([]sseConcurrencyTarget, 0, 2)
-	if setting.SSEMaxConcurrentPerUser > 0 && userID > 0 {
-		key := fmt.Sprintf("sse:user:%d", userID)
+	targets := make([]sseConcurrencyTarget, 0, 4)
+	addTarget := func(key string, limit int, scope string) {
 		targets = append(targets, sseConcurrencyTarget{
-			entry: getOrCreateSSEConcurrencyCounter(key),
 			key:   key,
-			limit: setting.SSEMaxConcurrentPerUser,
-			scope: "user",
+			limit: limit,
+			scope: scope,
 		})
 	}
-	if setting.SSEMaxConcurrentPerToken > 0 && tokenID > 0 {
-		key := fmt.Sprintf("sse:token:%d", tokenID)
-		targets = append(targets, sseConcurrencyTarget{
-			entry: getOrCreateSSEConcurrencyCounter(key),
-			key:   key,
-			limit: setting.SSEMaxConcurrentPerToken,
-			scope: "token",
-		})
+	if setting.SSEMaxConcurrentPerUser > 0 && identity.UserID > 0 {
+		addTarget(fmt.Sprintf("sse:user:%d", identity.UserID), setting.SSEMaxConcurrentPerUser, "user")
+	}
+	if setting.SSEMaxConcurrentPerToken > 0 && identity.TokenID > 0 {
+		addTarget(fmt.Sprintf("sse:token:%d", identity.TokenID), setting.SSEMaxConcurrentPerToken, "token")
+	}
+	if setting.SSEMaxConcurrentPerGroup > 0 && identity.Group != "" {
+		addTarget("sse:group:"+identity.Group, setting.SSEMaxConcurrentPerGroup, "group")
+	}
+	if setting.SSEMaxConcurrentPerIP > 0 && identity.ClientIP != "" {
+		addTarget("sse:ip:"+identity.ClientIP, setting.SSEMaxConcurrentPerIP, "ip")
 	}
 	if len(targets) == 0 {
 		return func() {}, nil
 	}
 
+	if setting.SSEQueueWaitMs <= 0 {
+		return acquireSSEConcurrencyTargets(targets)
+	}
+	deadline := time.Now().Add(time.Duration(setting.SSEQueueWaitMs) * time.Millisecond)
+	for {
+		// 先取通知信号再尝试占用，避免错过两者之间发生的释放
+		released := sseConcurrencyReleasedSignal()
+		release, err = acquireSSEConcurrencyTargets(targets)
+		if err == nil {
+			return release, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return release, err
+		}
+		// 其他实例释放的 Redis 名额不会触发本地通知，因此同时按固定间隔轮询
+		timer := time.NewTimer(min(remaining, sseConcurrencyQueuePollInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return func() {}, ctx.Err()
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func acquireSSEConcurrencyTargets(targets []sseConcurrencyTarget) (release func(), err error) {
+	// 启用 Redis 时跨实例共享计数，Redis 不可用时退回进程内计数
+	if common.RedisEnabled && common.RDB != nil {
+		if release, handled, err := acquireRedisSSEConcurrencySlot(targets); handled {
+			return release, err
+		}
+	}
+	return acquireLocalSSEConcurrencySlot(targets)
+}
+
+// sseConcurrencyReleasedSignal 返回在下一次有名额释放时关闭的通道
+func sseConcurrencyReleasedSignal() <-chan struct{} {
+	sseConcurrencyReleasedMu.Lock()
+	defer sseConcurrencyReleasedMu.Unlock()
+	return sseConcurrencyReleased
+}
+
+func notifySSEConcurrencyReleased() {
+	sseConcurrencyReleasedMu.Lock()
+	defer sseConcurrencyReleasedMu.Unlock()
+	close(sseConcurrencyReleased)
+	sseConcurrencyReleased = make(chan struct{})
+}
+
+func acquireLocalSSEConcurrencySlot(targets []sseConcurrencyTarget) (release func(), err error) {
+	maybeCleanupSSEConcurrencyCounters()
+
+	sseConcurrencyCountersMu.Lock()
+	defer sseConcurrencyCountersMu.Unlock()
+
 	acquired := make([]sseConcurrencyTarget, 0, len(targets))
 	for _, target := range targets {
+		target.entry = getOrCreateSSEConcurrencyCounter(target.key)
 		current := target.entry.count.Add(1)
-		target.entry.lastActiveUnix.Store(time.Now().Unix())
+		target.entry.lastActiveUnix.Store(common.Now().Unix())
 		if current > int64(target.limit) {
 			decrementSSEConcurrencyCounter(target.key, target.entry)
 			for _, item := range acquired {
 				decrementSSEConcurrencyCounter(item.key, item.entry)
 			}
-			return func() {}, fmt.Errorf("too many concurrent sse streams (%s limit exceeded)", target.scope)
+			return func() {}, sseConcurrencyLimitError(target.scope)
 		}
 		acquired = append(acquired, target)
 	}
@@ -147,7 +230,34 @@ func AcquireSSEConcurrencySlot(userID int, tokenID int) (release func(), err err
 			for _, item := range acquired {
 				decrementSSEConcurrencyCounter(item.key, item.entry)
 			}
+			notifySSEConcurrencyReleased()
 		})
 	}
 	return release, nil
 }
+
+// SSEConcurrencyLimitError 表示 SSE 并发数超出某一维度（user/token/group/ip）的上限
+type SSEConcurrencyLimitError struct {
+	Scope string
+}
+
+func (e *SSEConcurrencyLimitError) Error() string {
+	return fmt.Sprintf("too many concurrent sse streams (%s limit exceeded)", e.Scope)
+}
+
+func sseConcurrencyLimitError(scope string) error {
+	return &SSEConcurrencyLimitError{Scope: scope}
+}
+
+// NewSSEConcurrencyLimitAPIError 将申请 SSE 并发槽位失败的错误转换为 429 响应，
+// 超出上限时按请求语言返回本地化提示，其他错误（如等待被取消）原样返回
+func NewSSEConcurrencyLimitAPIError(c *gin.Context, err error) *types.NewAPIError {
+	var limitErr *SSEConcurrencyLimitError
+	if errors.As(err, &limitErr) {
+		err = errors.New(i18n.T(c, i18n.MsgSSEConcurrencyLimitExceeded, map[string]any{"Scope": limitErr.Scope}))
+	}
+	return types.NewOpenAIError(err, types.ErrorCodeSSEConcurrencyLimitExceeded, http.StatusTooManyRequests,
+		types.ErrOptionWithSkipRetry(),
+		types.ErrOptionWithNoRecordErrorLog(),
+	)
+}
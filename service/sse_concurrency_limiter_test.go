@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireSSEConcurrencySlotFor_GroupAndIPLimits(t *testing.T) {
+	setting := operation_setting.GetGeneralSetting()
+	old := *setting
+	t.Cleanup(func() { *setting = old })
+	setting.SSEConcurrencyLimitEnabled = true
+	setting.SSEMaxConcurrentPerUser = 10
+	setting.SSEMaxConcurrentPerGroup = 2
+	setting.SSEMaxConcurrentPerIP = 1
+
+	first, err := AcquireSSEConcurrencySlotFor(context.Background(), SSEConcurrencyIdentity{UserID: 9101, Group: "sse_test_group", ClientIP: "10.0.0.1"})
+	require.NoError(t, err)
+	defer first()
+
+	// 同一 IP 超限时整体失败，已占用的用户与分组名额需要回滚
+	_, err = AcquireSSEConcurrencySlotFor(context.Background(), SSEConcurrencyIdentity{UserID: 9102, Group: "sse_test_group", ClientIP: "10.0.0.1"})
+	require.ErrorContains(t, err, "ip limit exceeded")
+
+	second, err := AcquireSSEConcurrencySlotFor(context.Background(), SSEConcurrencyIdentity{UserID: 9102, Group: "sse_test_group", ClientIP: "10.0.0.2"})
+	require.NoError(t, err)
+	defer second()
+
+	_, err = AcquireSSEConcurrencySlotFor(context.Background(), SSEConcurrencyIdentity{UserID: 9103, Group: "sse_test_group", ClientIP: "10.0.0.3"})
+	require.ErrorContains(t, err, "group limit exceeded")
+
+	second()
+	third, err := AcquireSSEConcurrencySlotFor(context.Background(), SSEConcurrencyIdentity{UserID: 9103, Group: "sse_test_group", ClientIP: "10.0.0.3"})
+	require.NoError(t, err)
+	third()
+}
+
+func TestAcquireSSEConcurrencySlotFor_QueueWaitsForRelease(t *testing.T) {
+	setting := operation_setting.GetGeneralSetting()
+	old := *setting
+	t.Cleanup(func() { *setting = old })
+	setting.SSEConcurrencyLimitEnabled = true
+	setting.SSEMaxConcurrentPerUser = 1
+	setting.SSEQueueWaitMs = 2000
+
+	identity := SSEConcurrencyIdentity{UserID: 9201}
+	first, err := AcquireSSEConcurrencySlotFor(context.Background(), identity)
+	require.NoError(t, err)
+
+	time.AfterFunc(50*time.Millisecond, first)
+	start := time.Now()
+	second, err := AcquireSSEConcurrencySlotFor(context.Background(), identity)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), time.Second)
+	second()
+}
+
+func TestAcquireSSEConcurrencySlotFor_QueueAbortsOnContextCancel(t *testing.T) {
+	setting := operation_setting.GetGeneralSetting()
+	old := *setting
+	t.Cleanup(func() { *setting = old })
+	setting.SSEConcurrencyLimitEnabled = true
+	setting.SSEMaxConcurrentPerUser = 1
+	setting.SSEQueueWaitMs = 5000
+
+	identity := SSEConcurrencyIdentity{UserID: 9202}
+	first, err := AcquireSSEConcurrencySlotFor(context.Background(), identity)
+	require.NoError(t, err)
+	defer first()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = AcquireSSEConcurrencySlotFor(ctx, identity)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestNewSSEConcurrencyLimitAPIError_Localized(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	gin.SetMode(gin.TestMode)
+
+	limitErr := sseConcurrencyLimitError("token")
+	var typed *SSEConcurrencyLimitError
+	require.ErrorAs(t, limitErr, &typed)
+	require.Equal(t, "token", typed.Scope)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	apiErr := NewSSEConcurrencyLimitAPIError(c, limitErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	require.Equal(t, types.ErrorCodeSSEConcurrencyLimitExceeded, apiErr.GetErrorCode())
+	require.Equal(t, "too many concurrent sse streams (token limit exceeded)", apiErr.Error())
+
+	c.Set(string(constant.ContextKeyLanguage), i18n.LangZhCN)
+	apiErr = NewSSEConcurrencyLimitAPIError(c, limitErr)
+	require.Contains(t, apiErr.Error(), "token")
+	require.NotContains(t, apiErr.Error(), "too many")
+
+	// 非超限错误（如等待被取消）保持原样
+	apiErr = NewSSEConcurrencyLimitAPIError(c, context.Canceled)
+	require.Equal(t, context.Canceled.Error(), apiErr.Error())
+}
+
+func TestAcquireSSEConcurrencySlotFor_RedisSlotsExpireIndividually(t *testing.T) {
+	server := miniredis.RunT(t)
+	oldRDB, oldEnabled := common.RDB, common.RedisEnabled
+	common.RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		_ = common.RDB.Close()
+		common.RDB, common.RedisEnabled = oldRDB, oldEnabled
+	})
+
+	setting := operation_setting.GetGeneralSetting()
+	old := *setting
+	t.Cleanup(func() { *setting = old })
+	setting.SSEConcurrencyLimitEnabled = true
+	setting.SSEMaxConcurrentPerUser = 2
+	setting.SSEQueueWaitMs = 0
+
+	identity := SSEConcurrencyIdentity{UserID: 9301}
+	first, err := AcquireSSEConcurrencySlotFor(context.Background(), identity)
+	require.NoError(t, err)
+	defer first()
+
+	key := "sse:user:9301"
+	// 模拟已退出实例遗留的名额：分数已过期，但键因其他名额续期而一直存在
+	_, err = common.RDB.ZAdd(context.Background(), key, &redis.Z{
+		Score:  float64(time.Now().Add(-time.Second).UnixMilli()),
+		Member: "leaked-slot",
+	}).Result()
+	require.NoError(t, err)
+
+	second, err := AcquireSSEConcurrencySlotFor(context.Background(), identity)
+	require.NoError(t, err)
+	members, err := common.RDB.ZRange(context.Background(), key, 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	require.NotContains(t, members, "leaked-slot")
+
+	_, err = AcquireSSEConcurrencySlotFor(context.Background(), identity)
+	require.ErrorContains(t, err, "user limit exceeded")
+
+	second()
+	first()
+	require.False(t, server.Exists(key))
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// sseConcurrencyRedisTTL 是单个名额的安全过期时间：实例在流式传输中途退出时，
+	// 未释放的名额最迟在该时间后被清理，不影响同一维度下其他仍在续期的名额
+	sseConcurrencyRedisTTL = 2 * time.Minute
+	// sseConcurrencyRedisRefreshInterval 为流式传输期间续期名额的间隔
+	sseConcurrencyRedisRefreshInterval = sseConcurrencyRedisTTL / 3
+)
+
+// sseConcurrencyAcquireScript 每个维度使用一个 ZSET，成员为单个名额，分数为该名额的过期时间（毫秒）。
+// 先清理所有键中已过期的名额，再检查是否超限，全部未超限时才写入新名额，因此无需回滚。
+// ARGV[1] 当前时间，ARGV[2] 名额过期时间，ARGV[3] 名额 ID，ARGV[4] 键过期毫秒数，ARGV[4+i] 各键上限。
+// 返回 0 表示全部占用成功，否则返回超限键的序号（从 1 开始）。
+var sseConcurrencyAcquireScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+for i = 1, #KEYS do
+	redis.call("ZREMRANGEBYSCORE", KEYS[i], "-inf", now)
+	if redis.call("ZCARD", KEYS[i]) >= tonumber(ARGV[i + 4]) then
+		return i
+	end
+end
+for i = 1, #KEYS do
+	redis.call("ZADD", KEYS[i], ARGV[2], ARGV[3])
+	redis.call("PEXPIRE", KEYS[i], ARGV[4])
+end
+return 0
+`)
+
+// sseConcurrencyRefreshScript 仅续期仍存在的名额，已被清理的名额不会被重新加入
+var sseConcurrencyRefreshScript = redis.NewScript(`
+for i = 1, #KEYS do
+	if redis.call("ZSCORE", KEYS[i], ARGV[2]) then
+		redis.call("ZADD", KEYS[i], ARGV[1], ARGV[2])
+		redis.call("PEXPIRE", KEYS[i], ARGV[3])
+	end
+end
+return 0
+`)
+
+var sseConcurrencyReleaseScript = redis.NewScript(`
+for i = 1, #KEYS do
+	redis.call("ZREM", KEYS[i], ARGV[1])
+	if redis.call("ZCARD", KEYS[i]) == 0 then
+		redis.call("DEL", KEYS[i])
+	end
+end
+return 0
+`)
+
+// acquireRedisSSEConcurrencySlot 通过 Redis 在所有实例间共享并发名额，每个名额单独过期。
+// handled 为 false 表示 Redis 操作失败，调用方应退回进程内计数。
+func acquireRedisSSEConcurrencySlot(targets []sseConcurrencyTarget) (release func(), handled bool, err error) {
+	slotID := common.GetUUID()
+	now := time.Now()
+	keys := make([]string, 0, len(targets))
+	args := make([]interface{}, 0, len(targets)+4)
+	args = append(args,
+		now.UnixMilli(),
+		now.Add(sseConcurrencyRedisTTL).UnixMilli(),
+		slotID,
+		sseConcurrencyRedisTTL.Milliseconds(),
+	)
+	for _, target := range targets {
+		keys = append(keys, target.key)
+		args = append(args, target.limit)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), common.RateLimitRedisOpTimeout)
+	defer cancel()
+	result, err := sseConcurrencyAcquireScript.Run(ctx, common.RDB, keys, args...).Int()
+	if err != nil {
+		common.SysError(fmt.Sprintf("sse concurrency acquire via redis failed, falling back to local counter: %v", err))
+		return nil, false, nil
+	}
+	if result > 0 {
+		return func() {}, true, sseConcurrencyLimitError(targets[result-1].scope)
+	}
+
+	stop := make(chan struct{})
+	go refreshRedisSSEConcurrencySlot(keys, slotID, stop)
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			close(stop)
+			ctx, cancel := context.WithTimeout(context.Background(), common.RateLimitRedisOpTimeout)
+			defer cancel()
+			if err := sseConcurrencyReleaseScript.Run(ctx, common.RDB, keys, slotID).Err(); err != nil {
+				common.SysError(fmt.Sprintf("sse concurrency release via redis failed: %v", err))
+			}
+			notifySSEConcurrencyReleased()
+		})
+	}
+	return release, true, nil
+}
+
+// refreshRedisSSEConcurrencySlot 在流式传输期间定期续期本名额的过期时间，直到 stop 被关闭
+func refreshRedisSSEConcurrencySlot(keys []string, slotID string, stop <-chan struct{}) {
+	ticker := time.NewTicker(sseConcurrencyRedisRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), common.RateLimitRedisOpTimeout)
+			expireAt := strconv.FormatInt(time.Now().Add(sseConcurrencyRedisTTL).UnixMilli(), 10)
+			if err := sseConcurrencyRefreshScript.Run(ctx, common.RDB, keys,
+				expireAt, slotID, sseConcurrencyRedisTTL.Milliseconds()).Err(); err != nil {
+				common.SysError(fmt.Sprintf("sse concurrency ttl refresh via redis failed: %v", err))
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	subscriptionAutoRenewTickInterval = 2 * time.Minute
+	subscriptionAutoRenewBatchSize    = 200
+	// 到期前多久开始尝试续费
+	subscriptionAutoRenewLeadSeconds = int64(10 * 60)
+	// 到期后仍继续尝试续费的宽限期，超过后放弃本周期
+	subscriptionAutoRenewGraceSeconds = int64(24 * 3600)
+	subscriptionAutoRenewLockKey      = "subscription_auto_renew:lock"
+	subscriptionAutoRenewLockTTL      = 5 * time.Minute
+	subscriptionAutoRenewPaymentType  = "wallet"
+)
+
+var (
+	subscriptionAutoRenewOnce    sync.Once
+	subscriptionAutoRenewRunning atomic.Bool
+	// subscriptionAutoRenewSkipNotified 记录本周期已通知过跳过原因的续费订单号，避免每轮扫描重复通知
+	subscriptionAutoRenewSkipNotified = common.NewTTLCache[string, struct{}]("subscription_auto_renew_skip", 10000, time.Duration(subscriptionAutoRenewLeadSeconds+subscriptionAutoRenewGraceSeconds)*time.Second)
+)
+
+type subscriptionAutoRenewResult int
+
+const (
+	subscriptionAutoRenewRenewed subscriptionAutoRenewResult = iota
+	subscriptionAutoRenewAlreadyDone
+	subscriptionAutoRenewWaiting
+	subscriptionAutoRenewSkipped
+	subscriptionAutoRenewFailed
+)
+
+func StartSubscriptionAutoRenewTask() {
+	subscriptionAutoRenewOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("subscription auto renew task started: tick=%s", subscriptionAutoRenewTickInterval))
+			ticker := time.NewTicker(subscriptionAutoRenewTickInterval)
+			defer ticker.Stop()
+
+			runSubscriptionAutoRenewOnce()
+			for range ticker.C {
+				runSubscriptionAutoRenewOnce()
+			}
+		})
+	})
+}
+
+func runSubscriptionAutoRenewOnce() {
+	if !subscriptionAutoRenewRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer subscriptionAutoRenewRunning.Store(false)
+
+	ctx := context.Background()
+	// 多个主节点共享 Redis 时只允许一个节点执行本轮扫描
+	if common.RedisEnabled && common.RDB != nil {
+		token, acquired, err := common.RedisTryLock(subscriptionAutoRenewLockKey, subscriptionAutoRenewLockTTL)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew lock failed: %v", err))
+			return
+		}
+		if !acquired {
+			return
+		}
+		defer func() { _ = common.RedisUnlock(subscriptionAutoRenewLockKey, token) }()
+	}
+
+	subs, err := model.GetAutoRenewDueSubscriptions(model.GetDBTimestamp(), subscriptionAutoRenewLeadSeconds, subscriptionAutoRenewGraceSeconds, subscriptionAutoRenewBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew scan failed: %v", err))
+		return
+	}
+	renewed := 0
+	for i := range subs {
+		if renewSubscriptionFromWallet(ctx, &subs[i]) == subscriptionAutoRenewRenewed {
+			renewed++
+		}
+	}
+	if common.DebugEnabled && len(subs) > 0 {
+		logger.LogDebug(ctx, "subscription auto renew: due=%d, renewed=%d", len(subs), renewed)
+	}
+}
+
+// renewSubscriptionFromWallet 使用钱包余额为一条即将到期的订阅续购同一套餐，每个续费周期最多扣费一次
+func renewSubscriptionFromWallet(ctx context.Context, sub *model.UserSubscription) subscriptionAutoRenewResult {
+	tradeNo := model.SubscriptionAutoRenewTradeNo(sub)
+	if order := model.GetSubscriptionOrderByTradeNo(tradeNo); order != nil && order.Status == common.TopUpStatusSuccess {
+		// 上一轮已扣费但未来得及转移标记
+		if err := model.FinishSubscriptionAutoRenew(sub); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew finish failed: subscription_id=%d, error=%v", sub.Id, err))
+		}
+		return subscriptionAutoRenewAlreadyDone
+	}
+
+	plan, err := model.GetSubscriptionPlanById(sub.PlanId)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew load plan failed: subscription_id=%d, plan_id=%d, error=%v", sub.Id, sub.PlanId, err))
+		return subscriptionAutoRenewFailed
+	}
+	if !plan.AllowWalletPay {
+		notifySubscriptionAutoRenewSkipped(sub, tradeNo, plan, "该套餐已不支持余额支付")
+		return subscriptionAutoRenewSkipped
+	}
+	if ok, reason, err := CanUserPurchasePlan(sub.UserId, plan); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew check failed: subscription_id=%d, error=%v", sub.Id, err))
+		return subscriptionAutoRenewFailed
+	} else if !ok {
+		notifySubscriptionAutoRenewSkipped(sub, tradeNo, plan, reason)
+		return subscriptionAutoRenewSkipped
+	}
+	if err := model.CheckSubscriptionPurchaseEligibility(sub.UserId, plan); err != nil {
+		if sub.Status == "active" {
+			// 禁止叠加等规则在原订阅到期后即可满足，等待下一轮
+			return subscriptionAutoRenewWaiting
+		}
+		notifySubscriptionAutoRenewSkipped(sub, tradeNo, plan, err.Error())
+		return subscriptionAutoRenewSkipped
+	}
+
+	quotaCost, displayAmount, displayRate := CalcSubscriptionWalletQuota(plan, nil)
+	user, err := model.GetUserById(sub.UserId, true)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew load user failed: user_id=%d, error=%v", sub.UserId, err))
+		return subscriptionAutoRenewFailed
+	}
+	if quotaCost > 0 && user.Quota < quotaCost {
+		notifySubscriptionAutoRenewSkipped(sub, tradeNo, plan, fmt.Sprintf("余额不足，还需 %s", logger.FormatQuota(quotaCost-user.Quota)))
+		return subscriptionAutoRenewSkipped
+	}
+
+	payload := map[string]any{
+		"payment_method":          subscriptionAutoRenewPaymentType,
+		"auto_renew":              true,
+		"renewed_subscription_id": sub.Id,
+		"quota_cost":              quotaCost,
+		"display_amount":          displayAmount,
+		"display_rate":            displayRate,
+	}
+	payloadStr := ""
+	if payloadBytes, err := common.Marshal(payload); err == nil {
+		payloadStr = string(payloadBytes)
+	}
+	if err := model.CompleteWalletSubscriptionOrder(tradeNo, sub.UserId, plan, subscriptionAutoRenewPaymentType, quotaCost, payloadStr, nil); err != nil {
+		// 订单号唯一约束冲突说明其他执行已完成续费
+		if order := model.GetSubscriptionOrderByTradeNo(tradeNo); order != nil && order.Status == common.TopUpStatusSuccess {
+			_ = model.FinishSubscriptionAutoRenew(sub)
+			return subscriptionAutoRenewAlreadyDone
+		}
+		logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew failed: subscription_id=%d, trade_no=%s, error=%v", sub.Id, tradeNo, err))
+		return subscriptionAutoRenewFailed
+	}
+	if err := model.FinishSubscriptionAutoRenew(sub); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("subscription auto renew finish failed: subscription_id=%d, error=%v", sub.Id, err))
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("subscription auto renewed: user_id=%d, subscription_id=%d, plan_id=%d, trade_no=%s, quota_cost=%d", sub.UserId, sub.Id, plan.Id, tradeNo, quotaCost))
+	model.RecordLog(sub.UserId, model.LogTypeSystem, fmt.Sprintf("订阅自动续费成功，套餐: %s，扣除额度: %s", plan.Title, logger.FormatQuota(quotaCost)))
+	return subscriptionAutoRenewRenewed
+}
+
+// notifySubscriptionAutoRenewSkipped 记录跳过原因并通知用户，同一续费周期只记录与通知一次
+func notifySubscriptionAutoRenewSkipped(sub *model.UserSubscription, tradeNo string, plan *model.SubscriptionPlan, reason string) {
+	if _, notified := subscriptionAutoRenewSkipNotified.Get(tradeNo); notified {
+		return
+	}
+	subscriptionAutoRenewSkipNotified.Set(tradeNo, struct{}{})
+
+	content := fmt.Sprintf("订阅自动续费未执行，套餐: %s，原因: %s", plan.Title, reason)
+	logger.LogInfo(context.Background(), fmt.Sprintf("subscription auto renew skipped: user_id=%d, subscription_id=%d, plan_id=%d, reason=%s", sub.UserId, sub.Id, plan.Id, reason))
+	model.RecordLog(sub.UserId, model.LogTypeSystem, content)
+
+	user, err := model.GetUserById(sub.UserId, true)
+	if err != nil {
+		return
+	}
+	gopool.Go(func() {
+		if err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(dto.NotifyTypeSubscriptionRenew, "订阅自动续费失败", content, nil)); err != nil {
+			common.SysLog(fmt.Sprintf("failed to send subscription auto renew notification to user %d: %s", user.Id, err.Error()))
+		}
+	})
+}
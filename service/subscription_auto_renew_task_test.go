@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func seedAutoRenewSubscription(t *testing.T, userId int, quota int) (*model.SubscriptionPlan, *model.UserSubscription) {
+	t.Helper()
+	// 续费事务内会另行查询数据库时间，需要可多连接共享的内存库，避免单连接死锁
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Log{}, &model.TopUp{}, &model.SubscriptionPlan{}, &model.SubscriptionOrder{}, &model.UserSubscription{}))
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	model.DB, model.LOG_DB = db, db
+	t.Cleanup(func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	seedUser(t, userId, quota)
+	plan := &model.SubscriptionPlan{Title: "monthly", PriceAmount: 1, Enabled: true, AllowWalletPay: true, DurationUnit: "month", DurationValue: 1}
+	require.NoError(t, model.DB.Create(plan).Error)
+	model.InvalidateSubscriptionPlanCache(plan.Id)
+
+	now := model.GetDBTimestamp()
+	sub := &model.UserSubscription{UserId: userId, PlanId: plan.Id, StartTime: now - 3600, EndTime: now - 60, Status: "expired", AutoRenew: true}
+	require.NoError(t, model.DB.Create(sub).Error)
+	return plan, sub
+}
+
+func TestRenewSubscriptionFromWalletRunsOncePerCycle(t *testing.T) {
+	quota := int(common.QuotaPerUnit * 2)
+	plan, sub := seedAutoRenewSubscription(t, 9301, quota)
+
+	due, err := model.GetAutoRenewDueSubscriptions(model.GetDBTimestamp(), 600, 3600, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, sub.Id, due[0].Id)
+
+	require.Equal(t, subscriptionAutoRenewRenewed, renewSubscriptionFromWallet(context.Background(), &due[0]))
+	require.Equal(t, subscriptionAutoRenewAlreadyDone, renewSubscriptionFromWallet(context.Background(), &due[0]))
+
+	user, err := model.GetUserById(9301, true)
+	require.NoError(t, err)
+	require.Equal(t, quota-int(common.QuotaPerUnit), user.Quota)
+
+	var subs []model.UserSubscription
+	require.NoError(t, model.DB.Where("user_id = ? AND plan_id = ?", 9301, plan.Id).Order("id asc").Find(&subs).Error)
+	require.Len(t, subs, 2)
+	require.False(t, subs[0].AutoRenew)
+	require.True(t, subs[1].AutoRenew)
+	require.Equal(t, "active", subs[1].Status)
+	require.Equal(t, model.SubscriptionAutoRenewTradeNo(&due[0]), subs[1].OrderTradeNo)
+
+	// 用户随后手动购买同一套餐时，重复执行收尾不会把标记转移到手动购买的订阅
+	manual := &model.UserSubscription{UserId: 9301, PlanId: plan.Id, StartTime: subs[1].StartTime, EndTime: subs[1].EndTime, Status: "active"}
+	require.NoError(t, model.DB.Create(manual).Error)
+	require.NoError(t, model.FinishSubscriptionAutoRenew(&due[0]))
+	require.NoError(t, model.DB.First(manual, manual.Id).Error)
+	require.False(t, manual.AutoRenew)
+	var renewed model.UserSubscription
+	require.NoError(t, model.DB.First(&renewed, subs[1].Id).Error)
+	require.True(t, renewed.AutoRenew)
+
+	due, err = model.GetAutoRenewDueSubscriptions(model.GetDBTimestamp(), 600, 3600, 10)
+	require.NoError(t, err)
+	require.Empty(t, due)
+}
+
+func TestRenewSubscriptionFromWalletSkipsOnInsufficientBalance(t *testing.T) {
+	_, sub := seedAutoRenewSubscription(t, 9302, int(common.QuotaPerUnit/2))
+
+	require.Equal(t, subscriptionAutoRenewSkipped, renewSubscriptionFromWallet(context.Background(), sub))
+	require.Nil(t, model.GetSubscriptionOrderByTradeNo(model.SubscriptionAutoRenewTradeNo(sub)))
+
+	var logCount int64
+	require.NoError(t, model.DB.Model(&model.Log{}).Where("user_id = ? AND type = ?", 9302, model.LogTypeSystem).Count(&logCount).Error)
+	require.Equal(t, int64(1), logCount)
+
+	// 同一周期再次扫描不会重复记录
+	require.Equal(t, subscriptionAutoRenewSkipped, renewSubscriptionFromWallet(context.Background(), sub))
+	require.NoError(t, model.DB.Model(&model.Log{}).Where("user_id = ? AND type = ?", 9302, model.LogTypeSystem).Count(&logCount).Error)
+	require.Equal(t, int64(1), logCount)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// CanUserPurchasePlan 校验用户能否购买套餐：套餐已启用、金额合法且未达到单用户购买上限。
+// 不满足时返回 false 及按用户语言本地化的原因；err 仅表示查询失败。
+// 各支付方式在创建订单前统一调用，此处仅为提前提示，最终以 model.CheckSubscriptionPurchaseEligibility 的事务内校验为准
+func CanUserPurchasePlan(userId int, plan *model.SubscriptionPlan) (bool, string, error) {
+	if userId <= 0 {
+		return false, i18n.TForUser(userId, i18n.MsgSubscriptionInvalidUserId), nil
+	}
+	if plan == nil || plan.Id <= 0 {
+		return false, i18n.TForUser(userId, i18n.MsgSubscriptionInvalidId), nil
+	}
+	if !plan.Enabled {
+		return false, i18n.TForUser(userId, i18n.MsgSubscriptionNotEnabled), nil
+	}
+	if plan.PriceAmount < 0 {
+		return false, i18n.TForUser(userId, i18n.MsgSubscriptionPriceNegative), nil
+	}
+	if plan.MaxPurchasePerUser > 0 {
+		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
+		if err != nil {
+			return false, "", err
+		}
+		if count >= int64(plan.MaxPurchasePerUser) {
+			return false, i18n.TForUser(userId, i18n.MsgSubscriptionPurchaseMax), nil
+		}
+	}
+	return true, "", nil
+}
+
+// SubscriptionPurchaseErrorMessage 返回购买资格校验失败时展示给用户的信息，已知错误按用户语言本地化
+func SubscriptionPurchaseErrorMessage(userId int, err error) string {
+	if errors.Is(err, model.ErrSubscriptionPurchaseLimitReached) {
+		return i18n.TForUser(userId, i18n.MsgSubscriptionPurchaseMax)
+	}
+	var shortErr *model.SubscriptionBalanceShortError
+	if errors.As(err, &shortErr) {
+		return i18n.TForUser(userId, i18n.MsgSubscriptionBalanceShort, map[string]any{
+			"Shortfall": logger.FormatQuota(shortErr.Shortfall),
+		})
+	}
+	return err.Error()
+}
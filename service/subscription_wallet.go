@@ -0,0 +1,14 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+)
+
+// CalcSubscriptionWalletQuota 计算余额支付所需额度及展示金额，proration 不为空时扣除其折算抵扣
+func CalcSubscriptionWalletQuota(plan *model.SubscriptionPlan, proration *model.SubscriptionProration) (int, float64, float64) {
+	credit := 0
+	if !proration.IsEmpty() {
+		credit = proration.Credit
+	}
+	return model.CalcSubscriptionWalletQuota(plan, credit)
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalcSubscriptionWalletQuota_RoundingModes(t *testing.T) {
+	quotaSetting := operation_setting.GetQuotaSetting()
+	generalSetting := operation_setting.GetGeneralSetting()
+	originalMode, originalDisplay, originalQuotaPerUnit := quotaSetting.WalletQuotaRoundingMode, generalSetting.QuotaDisplayType, common.QuotaPerUnit
+	t.Cleanup(func() {
+		quotaSetting.WalletQuotaRoundingMode = originalMode
+		generalSetting.QuotaDisplayType = originalDisplay
+		common.QuotaPerUnit = originalQuotaPerUnit
+	})
+	generalSetting.QuotaDisplayType = operation_setting.QuotaDisplayTypeUSD
+	common.QuotaPerUnit = 500000
+
+	cases := []struct {
+		name      string
+		price     float64
+		proration *model.SubscriptionProration
+		quota     map[string]int
+	}{
+		{name: "below half", price: 0.0000008, quota: map[string]int{"truncate": 0, "round_half_up": 0, "ceil": 1}},
+		{name: "exact half", price: 0.000001, quota: map[string]int{"truncate": 0, "round_half_up": 1, "ceil": 1}},
+		{name: "just above integer", price: 0.0000021, quota: map[string]int{"truncate": 1, "round_half_up": 1, "ceil": 2}},
+		{name: "integer", price: 2, quota: map[string]int{"truncate": 1000000, "round_half_up": 1000000, "ceil": 1000000}},
+		{
+			name:      "prorated half",
+			price:     0.000005,
+			proration: &model.SubscriptionProration{ReplacedSubscriptionIds: []int{1}, Credit: 1},
+			quota:     map[string]int{"truncate": 1, "round_half_up": 2, "ceil": 2},
+		},
+	}
+	for _, mode := range []string{
+		operation_setting.QuotaRoundingTruncate,
+		operation_setting.QuotaRoundingRoundHalfUp,
+		operation_setting.QuotaRoundingCeil,
+	} {
+		quotaSetting.WalletQuotaRoundingMode = mode
+		for _, tc := range cases {
+			quota, display, rate := CalcSubscriptionWalletQuota(&model.SubscriptionPlan{PriceAmount: tc.price}, tc.proration)
+			require.Equal(t, tc.quota[mode], quota, "%s/%s", mode, tc.name)
+			require.Equal(t, float64(1), rate)
+			require.InDelta(t, float64(tc.quota[mode])/common.QuotaPerUnit, display, 1e-9, "%s/%s", mode, tc.name)
+		}
+	}
+
+	quotaSetting.WalletQuotaRoundingMode = "unknown"
+	require.Equal(t, operation_setting.QuotaRoundingTruncate, operation_setting.GetWalletQuotaRoundingMode())
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/glebarez/sqlite"
@@ -44,6 +45,8 @@ func TestMain(m *testing.M) {
 		&model.Channel{},
 		&model.TopUp{},
 		&model.UserSubscription{},
+		&model.Redemption{},
+		&model.RedemptionUsage{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -714,3 +717,11 @@ func TestSettle_NonPerCall_AdaptorAdjustWorks(t *testing.T) {
 	require.NotNil(t, log)
 	assert.Equal(t, model.LogTypeRefund, log.Type)
 }
+
+func TestTaskFailReason_DefaultsToLocalizedMessage(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	assert.Equal(t, "upstream error", taskFailReason(1, "upstream error"))
+	reason := taskFailReason(1, "")
+	assert.Equal(t, i18n.TForUser(1, i18n.MsgTaskFailed), reason)
+	assert.NotEqual(t, i18n.MsgTaskFailed, reason)
+}
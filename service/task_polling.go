@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay/channel/task/taskcommon"
@@ -49,8 +50,6 @@ func sweepTimedOutTasks(ctx context.Context) {
 	}
 
 	const legacyTaskCutoff int64 = 1740182400 // 2026-02-22 00:00:00 UTC
-	reason := fmt.Sprintf("任务超时（%d分钟）", constant.TaskTimeoutMinutes)
-	legacyReason := "任务超时（旧系统遗留任务，不进行退款，请联系管理员）"
 	now := time.Now().Unix()
 	timedOutCount := 0
 
@@ -62,9 +61,9 @@ func sweepTimedOutTasks(ctx context.Context) {
 		task.Progress = "100%"
 		task.FinishTime = now
 		if isLegacy {
-			task.FailReason = legacyReason
+			task.FailReason = i18n.TForUser(task.UserId, i18n.MsgTaskTimeoutLegacy)
 		} else {
-			task.FailReason = reason
+			task.FailReason = i18n.TForUser(task.UserId, i18n.MsgTaskTimeout, map[string]any{"Minutes": constant.TaskTimeoutMinutes})
 		}
 
 		won, err := task.UpdateWithStatus(oldStatus)
@@ -78,7 +77,7 @@ func sweepTimedOutTasks(ctx context.Context) {
 		}
 		timedOutCount++
 		if !isLegacy && task.Quota != 0 {
-			RefundTaskQuota(ctx, task, reason)
+			RefundTaskQuota(ctx, task, task.FailReason)
 		}
 	}
 
@@ -457,7 +456,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 		if task.FinishTime == 0 {
 			task.FinishTime = now
 		}
-		task.FailReason = taskResult.Reason
+		task.FailReason = taskFailReason(task.UserId, taskResult.Reason)
 		logger.LogInfo(ctx, fmt.Sprintf("Task %s failed: %s", task.TaskID, task.FailReason))
 		taskResult.Progress = taskcommon.ProgressComplete
 		if quota != 0 {
@@ -535,6 +534,14 @@ func truncateBase64(s string) string {
 	return s[:maxKeep] + "..."
 }
 
+// taskFailReason 上游未返回失败原因时使用按用户语言本地化的默认原因
+func taskFailReason(userId int, reason string) string {
+	if reason != "" {
+		return reason
+	}
+	return i18n.TForUser(userId, i18n.MsgTaskFailed)
+}
+
 // settleTaskBillingOnComplete 任务完成时的统一计费调整。
 // 优先级：1. adaptor.AdjustBillingOnComplete 返回正数 → 使用 adaptor 计算的额度
 //
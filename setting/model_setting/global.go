@@ -13,6 +13,39 @@ type ChatCompletionsToResponsesPolicy struct {
 	ChannelIDs    []int    `json:"channel_ids,omitempty"`
 	ChannelTypes  []int    `json:"channel_types,omitempty"`
 	ModelPatterns []string `json:"model_patterns,omitempty"`
+	// Rules 按 (渠道, 模型) 细粒度指定走 Responses 还是原生 Chat，按顺序匹配，先命中者生效；
+	// 均未命中时回退到上面的渠道级 + ModelPatterns 判断
+	Rules []ChatCompletionsToResponsesRule `json:"rules,omitempty"`
+	// ReasoningContentModelPatterns 命中的模型在转换回非流式 Chat Completions 时以 reasoning_content 返回推理摘要（流式始终返回），
+	// 也可通过渠道设置 responses_reasoning_content 按渠道开启
+	ReasoningContentModelPatterns []string `json:"reasoning_content_model_patterns,omitempty"`
+}
+
+const (
+	ChatCompletionsModeResponses = "responses"
+	ChatCompletionsModeNative    = "chat"
+)
+
+// ChatCompletionsToResponsesRule 描述一组渠道下一组模型的 Chat Completions 处理方式，
+// ChannelIDs 与 ChannelTypes 均为空时匹配所有渠道
+type ChatCompletionsToResponsesRule struct {
+	ChannelIDs    []int    `json:"channel_ids,omitempty"`
+	ChannelTypes  []int    `json:"channel_types,omitempty"`
+	ModelPatterns []string `json:"model_patterns,omitempty"`
+	Mode          string   `json:"mode"`
+}
+
+func (r ChatCompletionsToResponsesRule) MatchChannel(channelID int, channelType int) bool {
+	if len(r.ChannelIDs) == 0 && len(r.ChannelTypes) == 0 {
+		return true
+	}
+	if channelID > 0 && slices.Contains(r.ChannelIDs, channelID) {
+		return true
+	}
+	if channelType > 0 && slices.Contains(r.ChannelTypes, channelType) {
+		return true
+	}
+	return false
 }
 
 func (p ChatCompletionsToResponsesPolicy) IsChannelEnabled(channelID int, channelType int) bool {
@@ -1,6 +1,11 @@
 package operation_setting
 
-import "github.com/QuantumNous/new-api/setting/config"
+import (
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
 
 type ChannelAffinityKeySource struct {
 	Type string `json:"type"` // context_int, context_string, gjson
@@ -27,12 +32,67 @@ type ChannelAffinityRule struct {
 	IncludeRuleName   bool `json:"include_rule_name"`
 }
 
+// DefaultConversationIdHeader 客户端用于标识会话的请求头
+const DefaultConversationIdHeader = "X-Conversation-Id"
+
+// 亲和首选渠道达到并发上限时的处理方式
+const (
+	ChannelAffinitySaturationSkip   = "skip"   // 直接降级，本次改选其他渠道
+	ChannelAffinitySaturationWait   = "wait"   // 短暂等待渠道空出，超时后降级
+	ChannelAffinitySaturationIgnore = "ignore" // 忽略并发上限，继续使用首选渠道
+)
+
+const defaultChannelAffinitySaturationWaitMs = 200
+
 type ChannelAffinitySetting struct {
 	Enabled           bool                  `json:"enabled"`
 	SwitchOnSuccess   bool                  `json:"switch_on_success"`
 	MaxEntries        int                   `json:"max_entries"`
 	DefaultTTLSeconds int                   `json:"default_ttl_seconds"`
 	Rules             []ChannelAffinityRule `json:"rules"`
+
+	// FirstRequestBypass 开启后，携带会话 ID 请求头的新会话首个请求不走亲和性，
+	// 按权重随机选择渠道，后续同一会话的请求才粘滞到首次选中的渠道。
+	FirstRequestBypass bool `json:"first_request_bypass"`
+	// ConversationIdHeader 会话 ID 请求头名称，为空时使用 X-Conversation-Id
+	ConversationIdHeader string `json:"conversation_id_header"`
+	// ConversationSeenTTLSeconds 会话 ID 被视为"最近出现过"的时长，<=0 时使用规则 TTL
+	ConversationSeenTTLSeconds int `json:"conversation_seen_ttl_seconds"`
+
+	// SaturationMode 首选渠道达到 max_concurrency 时的处理方式：skip（默认）、wait 或 ignore
+	SaturationMode string `json:"saturation_mode"`
+	// SaturationWaitMs wait 模式下的最长等待时间，<=0 时使用 200ms
+	SaturationWaitMs int `json:"saturation_wait_ms"`
+
+	// RecentFailureCooldownSeconds 渠道上游返回 5xx/429 后被视为"近期失败"的时长，
+	// 期间亲和首选与随机选择会尽量避开该渠道但不禁用，<=0 时关闭
+	RecentFailureCooldownSeconds int `json:"recent_failure_cooldown_seconds"`
+}
+
+func (s *ChannelAffinitySetting) GetSaturationMode() string {
+	if s == nil {
+		return ChannelAffinitySaturationSkip
+	}
+	switch mode := strings.ToLower(strings.TrimSpace(s.SaturationMode)); mode {
+	case ChannelAffinitySaturationWait, ChannelAffinitySaturationIgnore:
+		return mode
+	default:
+		return ChannelAffinitySaturationSkip
+	}
+}
+
+func (s *ChannelAffinitySetting) GetSaturationWait() time.Duration {
+	if s == nil || s.SaturationWaitMs <= 0 {
+		return defaultChannelAffinitySaturationWaitMs * time.Millisecond
+	}
+	return time.Duration(s.SaturationWaitMs) * time.Millisecond
+}
+
+func (s *ChannelAffinitySetting) GetRecentFailureCooldown() time.Duration {
+	if s == nil || s.RecentFailureCooldownSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(s.RecentFailureCooldownSeconds) * time.Second
 }
 
 var codexCliPassThroughHeaders = []string{
@@ -78,6 +138,9 @@ var channelAffinitySetting = ChannelAffinitySetting{
 	SwitchOnSuccess:   true,
 	MaxEntries:        100_000,
 	DefaultTTLSeconds: 3600,
+
+	FirstRequestBypass:   false,
+	ConversationIdHeader: DefaultConversationIdHeader,
 	Rules: []ChannelAffinityRule{
 		{
 			Name:       "codex cli trace",
@@ -119,3 +182,10 @@ func init() {
 func GetChannelAffinitySetting() *ChannelAffinitySetting {
 	return &channelAffinitySetting
 }
+
+func (s *ChannelAffinitySetting) GetConversationIdHeader() string {
+	if s == nil || strings.TrimSpace(s.ConversationIdHeader) == "" {
+		return DefaultConversationIdHeader
+	}
+	return strings.TrimSpace(s.ConversationIdHeader)
+}
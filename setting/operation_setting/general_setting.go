@@ -14,12 +14,32 @@ type GeneralSetting struct {
 	DocsLink            string `json:"docs_link"`
 	PingIntervalEnabled bool   `json:"ping_interval_enabled"`
 	PingIntervalSeconds int    `json:"ping_interval_seconds"`
+	// 允许连续发送 ping 失败的次数，达到后才终止保活，<=1 表示首次失败即终止
+	PingMaxConsecutiveFailures int `json:"ping_max_consecutive_failures"`
+	// 流式写队列持续满载超过该秒数即判定客户端已不再读取并终止流，<=0 表示不检测
+	StreamBackpressureTimeoutSeconds int `json:"stream_backpressure_timeout_seconds"`
+	// 上游连续该秒数无任何数据时主动向客户端发送 ping 并重置流式超时，<=0 表示关闭
+	IdleHeartbeatSeconds int `json:"idle_heartbeat_seconds"`
+	// 开启空闲心跳后，上游连续无数据超过该秒数仍判定为超时，<=0 时使用 600 秒
+	HardStreamTimeoutSeconds int `json:"hard_stream_timeout_seconds"`
+	// 按模型覆盖流式超时秒数（模型名 -> 秒），优先于渠道设置与 STREAMING_TIMEOUT，<=0 的项被忽略
+	ModelStreamingTimeoutSeconds map[string]int `json:"model_streaming_timeout_seconds"`
+	// 流式响应自开始起的最长总时长秒数，超过即终止（不受数据间隔重置），<=0 表示不限制
+	MaxStreamDurationSeconds int `json:"max_stream_duration_seconds"`
+	// 客户端通过 X-Request-Timeout-Ms 请求头设置请求预算时允许的最大毫秒数，超出按该值截断，<=0 表示忽略该请求头
+	MaxClientRequestTimeoutMs int `json:"max_client_request_timeout_ms"`
 	// 是否启用 SSE 并发限制
 	SSEConcurrencyLimitEnabled bool `json:"sse_concurrency_limit_enabled"`
 	// 单用户最大 SSE 并发连接数，<=0 表示不限制
 	SSEMaxConcurrentPerUser int `json:"sse_max_concurrent_per_user"`
 	// 单令牌最大 SSE 并发连接数，<=0 表示不限制
 	SSEMaxConcurrentPerToken int `json:"sse_max_concurrent_per_token"`
+	// 单分组最大 SSE 并发连接数，<=0 表示不限制
+	SSEMaxConcurrentPerGroup int `json:"sse_max_concurrent_per_group"`
+	// 单客户端 IP 最大 SSE 并发连接数，<=0 表示不限制
+	SSEMaxConcurrentPerIP int `json:"sse_max_concurrent_per_ip"`
+	// 达到 SSE 并发上限时排队等待空闲名额的最长毫秒数，<=0 表示立即拒绝
+	SSEQueueWaitMs int `json:"sse_queue_wait_ms"`
 	// 当前站点额度展示类型：USD / CNY / TOKENS
 	QuotaDisplayType string `json:"quota_display_type"`
 	// 自定义货币符号，用于 CUSTOM 展示类型
@@ -33,9 +53,13 @@ var generalSetting = GeneralSetting{
 	DocsLink:                   "https://docs.newapi.pro",
 	PingIntervalEnabled:        false,
 	PingIntervalSeconds:        60,
+	PingMaxConsecutiveFailures: 1,
+	MaxClientRequestTimeoutMs:  600000,
 	SSEConcurrencyLimitEnabled: false,
 	SSEMaxConcurrentPerUser:    0,
 	SSEMaxConcurrentPerToken:   0,
+	SSEMaxConcurrentPerGroup:   0,
+	SSEMaxConcurrentPerIP:      0,
 	QuotaDisplayType:           QuotaDisplayTypeUSD,
 	CustomCurrencySymbol:       "¤",
 	CustomCurrencyExchangeRate: 1.0,
@@ -50,6 +74,17 @@ func GetGeneralSetting() *GeneralSetting {
 	return &generalSetting
 }
 
+// GetModelStreamingTimeoutSeconds 返回模型配置的流式超时秒数，未配置时返回 0
+func GetModelStreamingTimeoutSeconds(modelName string) int {
+	if modelName == "" {
+		return 0
+	}
+	if seconds := generalSetting.ModelStreamingTimeoutSeconds[modelName]; seconds > 0 {
+		return seconds
+	}
+	return 0
+}
+
 // IsCurrencyDisplay 是否以货币形式展示（美元或人民币）
 func IsCurrencyDisplay() bool {
 	return generalSetting.QuotaDisplayType != QuotaDisplayTypeTokens
@@ -0,0 +1,62 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// GetQuotaDisplayRate 返回当前额度展示货币相对美元的汇率，汇率未配置（<=0）或按 Token 展示时返回 1
+func GetQuotaDisplayRate() float64 {
+	switch generalSetting.QuotaDisplayType {
+	case QuotaDisplayTypeCNY:
+		if USDExchangeRate > 0 {
+			return USDExchangeRate
+		}
+		return 1
+	case QuotaDisplayTypeCustom:
+		if generalSetting.CustomCurrencyExchangeRate > 0 {
+			return generalSetting.CustomCurrencyExchangeRate
+		}
+		return 1
+	default:
+		return 1
+	}
+}
+
+// GetCurrencyDisplayRate 返回指定展示货币（USD / CNY / CUSTOM）相对美元的汇率，currency 为空时使用当前展示类型。
+// 与 GetQuotaDisplayRate 不同，汇率未配置或货币无法换算时返回错误而不是回退为 1，用于需要精确换算额度的场景
+func GetCurrencyDisplayRate(currency string) (float64, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = generalSetting.QuotaDisplayType
+	}
+	var rate float64
+	switch currency {
+	case QuotaDisplayTypeUSD:
+		rate = 1
+	case QuotaDisplayTypeCNY:
+		rate = USDExchangeRate
+	case QuotaDisplayTypeCustom:
+		rate = generalSetting.CustomCurrencyExchangeRate
+	default:
+		return 0, fmt.Errorf("unsupported display currency: %s", currency)
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("exchange rate for %s is not configured", currency)
+	}
+	return rate, nil
+}
+
+// RoundQuotaDecimal 按额度取整方式（QuotaRoundingTruncate 等）保留 places 位小数
+func RoundQuotaDecimal(value decimal.Decimal, places int32, mode string) decimal.Decimal {
+	switch mode {
+	case QuotaRoundingRoundHalfUp:
+		return value.Round(places)
+	case QuotaRoundingCeil:
+		return value.RoundCeil(places)
+	default:
+		return value.Truncate(places)
+	}
+}
@@ -2,13 +2,27 @@ package operation_setting
 
 import "github.com/QuantumNous/new-api/setting/config"
 
+// 钱包扣费额度取整方式
+const (
+	QuotaRoundingTruncate    = "truncate"      // 向零截断（默认）
+	QuotaRoundingRoundHalfUp = "round_half_up" // 四舍五入
+	QuotaRoundingCeil        = "ceil"          // 向上取整
+)
+
 type QuotaSetting struct {
 	EnableFreeModelPreConsume bool `json:"enable_free_model_pre_consume"` // 是否对免费模型启用预消耗
+	// 是否在中继响应中返回 X-Quota-Remaining / X-Quota-Warning 头，出于隐私考虑默认关闭
+	QuotaHeaderEnabled bool `json:"quota_header_enabled"`
+	// 剩余额度低于该值时返回 X-Quota-Warning: low，不大于 0 时沿用 QuotaRemindThreshold
+	QuotaHeaderLowThreshold int `json:"quota_header_low_threshold"`
+	// 余额支付套餐时额度的取整方式：truncate / round_half_up / ceil，展示金额按扣费额度反算并采用相同方式取整
+	WalletQuotaRoundingMode string `json:"wallet_quota_rounding_mode"`
 }
 
 // 默认配置
 var quotaSetting = QuotaSetting{
 	EnableFreeModelPreConsume: true,
+	WalletQuotaRoundingMode:   QuotaRoundingTruncate,
 }
 
 func init() {
@@ -19,3 +33,13 @@ func init() {
 func GetQuotaSetting() *QuotaSetting {
 	return &quotaSetting
 }
+
+// GetWalletQuotaRoundingMode 返回钱包扣费额度取整方式，未配置或无法识别时按 truncate 处理
+func GetWalletQuotaRoundingMode() string {
+	switch quotaSetting.WalletQuotaRoundingMode {
+	case QuotaRoundingRoundHalfUp, QuotaRoundingCeil:
+		return quotaSetting.WalletQuotaRoundingMode
+	default:
+		return QuotaRoundingTruncate
+	}
+}
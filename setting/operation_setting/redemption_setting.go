@@ -0,0 +1,36 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RedemptionSetting 兑换码相关配置
+type RedemptionSetting struct {
+	MaxRedemptionsPerHour int `json:"max_redemptions_per_hour"` // 每用户滚动一小时内最多成功兑换次数，<=0 表示不限制
+	// 生成兑换码使用的字符集，为空时使用 32 位十六进制（默认）
+	KeyCharset string `json:"key_charset"`
+	// 兑换码随机部分的字符数（不含前缀与分隔符），<=0 表示在 32 位内尽量填满
+	KeyLength int `json:"key_length"`
+	// 随机部分每隔多少个字符插入一个分隔符，<=0 表示不分组
+	KeyGroupSize int `json:"key_group_size"`
+	// 分组分隔符，为空时使用 "-"；分组仅用于展示，存储与兑换时会去除分隔符
+	KeySeparator string `json:"key_separator"`
+}
+
+// 默认配置
+var redemptionSetting = RedemptionSetting{
+	MaxRedemptionsPerHour: 0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("redemption_setting", &redemptionSetting)
+}
+
+// GetRedemptionSetting 获取兑换码配置
+func GetRedemptionSetting() *RedemptionSetting {
+	return &redemptionSetting
+}
+
+// GetMaxRedemptionsPerHour 获取每用户每小时最多兑换次数
+func GetMaxRedemptionsPerHour() int {
+	return redemptionSetting.MaxRedemptionsPerHour
+}
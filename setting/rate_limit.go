@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"path"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
@@ -11,23 +14,32 @@ import (
 
 var ModelRequestRateLimitEnabled = false
 var ModelRequestRateLimitDurationMinutes = 1
+
+// ModelRequestRateLimitDurationSeconds 大于 0 时优先于分钟配置，用于秒级窗口
+var ModelRequestRateLimitDurationSeconds = 0
 var ModelRequestRateLimitCount = 0
 var ModelRequestRateLimitSuccessCount = 1000
 
 // 兼容语法：
 // 1) 旧语法：{"group": [total, success]}
 // 2) 新语法：{"user_group": {"token_group": [total, success]}}
+// 分组键支持通配（如 "team-*"）与 "*" 默认值，查找顺序为 精确 -> 通配 -> "*"
 var ModelRequestRateLimitGroup = map[string][2]int{}
 var ModelRequestRateLimitByUserTokenGroup = map[string]map[string][2]int{}
 
 // 基于 IP 的模型请求速率限制扩展
 var ModelRequestIPRateLimitEnabled = false
 var ModelRequestIPRateLimitDurationMinutes = 1
+var ModelRequestIPRateLimitDurationSeconds = 0
 var ModelRequestIPRateLimitUserCount = 0
 var ModelRequestIPRateLimitUserSuccessCount = 0
 var ModelRequestIPRateLimitGroup = map[string][2]int{}
 var ModelRequestIPRateLimitByUserTokenGroup = map[string]map[string][2]int{}
 
+// 豁免模型请求限流（含 IP 限流）的令牌与用户 ID，常用于内部监控令牌
+var RateLimitExemptTokenIds []int
+var RateLimitExemptUserIds []int
+
 var ModelRequestRateLimitMutex sync.RWMutex
 
 func mergeRateLimitGroups(simple map[string][2]int, byUserToken map[string]map[string][2]int) map[string]any {
@@ -135,6 +147,9 @@ func parseRateLimitGroupConfig(jsonStr string) (map[string][2]int, map[string]ma
 	byUserToken := make(map[string]map[string][2]int)
 
 	for groupName, groupValue := range raw {
+		if err := validateRateLimitGroupKey(groupName); err != nil {
+			return nil, nil, err
+		}
 		if limits, err := parseRateLimitPair(groupValue); err == nil {
 			simple[groupName] = limits
 			continue
@@ -147,6 +162,9 @@ func parseRateLimitGroupConfig(jsonStr string) (map[string][2]int, map[string]ma
 
 		tokenGroupLimits := make(map[string][2]int)
 		for tokenGroup, tokenGroupValue := range tokenGroupObj {
+			if err := validateRateLimitGroupKey(tokenGroup); err != nil {
+				return nil, nil, fmt.Errorf("group %s: %w", groupName, err)
+			}
 			limits, err := parseRateLimitPair(tokenGroupValue)
 			if err != nil {
 				return nil, nil, fmt.Errorf("group %s token-group %s format invalid: %w", groupName, tokenGroup, err)
@@ -159,44 +177,67 @@ func parseRateLimitGroupConfig(jsonStr string) (map[string][2]int, map[string]ma
 	return simple, byUserToken, nil
 }
 
-func UpdateModelRequestRateLimitGroupByJSONString(jsonStr string) error {
-	simple, byUserToken, err := parseRateLimitGroupConfig(jsonStr)
-	if err != nil {
-		return err
-	}
+// rateLimitDefaultGroupKey 为未命中任何具体分组或通配分组时使用的默认配置
+const rateLimitDefaultGroupKey = "*"
 
-	ModelRequestRateLimitMutex.Lock()
-	defer ModelRequestRateLimitMutex.Unlock()
+func isRateLimitGlobKey(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
 
-	ModelRequestRateLimitGroup = simple
-	ModelRequestRateLimitByUserTokenGroup = byUserToken
+func validateRateLimitGroupKey(key string) error {
+	if !isRateLimitGlobKey(key) {
+		return nil
+	}
+	if _, err := path.Match(key, ""); err != nil {
+		return fmt.Errorf("group pattern %s invalid: %w", key, err)
+	}
 	return nil
 }
 
-func GetGroupRateLimit(group string) (totalCount, successCount int, found bool) {
-	ModelRequestRateLimitMutex.RLock()
-	defer ModelRequestRateLimitMutex.RUnlock()
+// matchRateLimitGroupKey 按 精确匹配 -> 通配匹配 -> "*" 默认 的顺序查找分组键。
+// 多个通配键同时命中时，取非通配字符最多的那个（更具体），仍相同时按字典序取较小者，保证结果稳定。
+func matchRateLimitGroupKey[V any](groups map[string]V, group string) (V, bool) {
+	if value, ok := groups[group]; ok {
+		return value, true
+	}
+	bestKey := ""
+	bestScore := -1
+	for key := range groups {
+		if key == rateLimitDefaultGroupKey || !isRateLimitGlobKey(key) {
+			continue
+		}
+		if matched, _ := path.Match(key, group); !matched {
+			continue
+		}
+		score := len(key) - strings.Count(key, "*") - strings.Count(key, "?")
+		if score > bestScore || (score == bestScore && key < bestKey) {
+			bestKey = key
+			bestScore = score
+		}
+	}
+	if bestScore >= 0 {
+		return groups[bestKey], true
+	}
+	value, ok := groups[rateLimitDefaultGroupKey]
+	return value, ok
+}
 
-	if ModelRequestRateLimitGroup == nil {
+func lookupGroupRateLimit(groups map[string][2]int, group string) (totalCount, successCount int, found bool) {
+	if groups == nil {
 		return 0, 0, false
 	}
-
-	limits, found := ModelRequestRateLimitGroup[group]
+	limits, found := matchRateLimitGroupKey(groups, group)
 	if !found {
 		return 0, 0, false
 	}
 	return limits[0], limits[1], true
 }
 
-func GetGroupRateLimitByUserAndToken(userGroup, tokenGroup string) (totalCount, successCount int, found bool) {
-	ModelRequestRateLimitMutex.RLock()
-	defer ModelRequestRateLimitMutex.RUnlock()
-
-	if ModelRequestRateLimitByUserTokenGroup == nil || userGroup == "" {
+func lookupUserTokenGroupRateLimit(groups map[string]map[string][2]int, userGroup, tokenGroup string) (totalCount, successCount int, found bool) {
+	if groups == nil || userGroup == "" {
 		return 0, 0, false
 	}
-
-	limitsByToken, ok := ModelRequestRateLimitByUserTokenGroup[userGroup]
+	limitsByToken, ok := matchRateLimitGroupKey(groups, userGroup)
 	if !ok {
 		return 0, 0, false
 	}
@@ -205,11 +246,35 @@ func GetGroupRateLimitByUserAndToken(userGroup, tokenGroup string) (totalCount,
 	if normalizedTokenGroup == "" {
 		normalizedTokenGroup = userGroup
 	}
-	limits, found := limitsByToken[normalizedTokenGroup]
-	if !found {
-		return 0, 0, false
+	return lookupGroupRateLimit(limitsByToken, normalizedTokenGroup)
+}
+
+func UpdateModelRequestRateLimitGroupByJSONString(jsonStr string) error {
+	simple, byUserToken, err := parseRateLimitGroupConfig(jsonStr)
+	if err != nil {
+		return err
 	}
-	return limits[0], limits[1], true
+
+	ModelRequestRateLimitMutex.Lock()
+	defer ModelRequestRateLimitMutex.Unlock()
+
+	ModelRequestRateLimitGroup = simple
+	ModelRequestRateLimitByUserTokenGroup = byUserToken
+	return nil
+}
+
+func GetGroupRateLimit(group string) (totalCount, successCount int, found bool) {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+
+	return lookupGroupRateLimit(ModelRequestRateLimitGroup, group)
+}
+
+func GetGroupRateLimitByUserAndToken(userGroup, tokenGroup string) (totalCount, successCount int, found bool) {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+
+	return lookupUserTokenGroupRateLimit(ModelRequestRateLimitByUserTokenGroup, userGroup, tokenGroup)
 }
 
 func ModelRequestIPRateLimitGroup2JSONString() string {
@@ -241,39 +306,14 @@ func GetIPGroupRateLimit(group string) (totalCount, successCount int, found bool
 	ModelRequestRateLimitMutex.RLock()
 	defer ModelRequestRateLimitMutex.RUnlock()
 
-	if ModelRequestIPRateLimitGroup == nil {
-		return 0, 0, false
-	}
-
-	limits, found := ModelRequestIPRateLimitGroup[group]
-	if !found {
-		return 0, 0, false
-	}
-	return limits[0], limits[1], true
+	return lookupGroupRateLimit(ModelRequestIPRateLimitGroup, group)
 }
 
 func GetIPGroupRateLimitByUserAndToken(userGroup, tokenGroup string) (totalCount, successCount int, found bool) {
 	ModelRequestRateLimitMutex.RLock()
 	defer ModelRequestRateLimitMutex.RUnlock()
 
-	if ModelRequestIPRateLimitByUserTokenGroup == nil || userGroup == "" {
-		return 0, 0, false
-	}
-
-	limitsByToken, ok := ModelRequestIPRateLimitByUserTokenGroup[userGroup]
-	if !ok {
-		return 0, 0, false
-	}
-
-	normalizedTokenGroup := tokenGroup
-	if normalizedTokenGroup == "" {
-		normalizedTokenGroup = userGroup
-	}
-	limits, found := limitsByToken[normalizedTokenGroup]
-	if !found {
-		return 0, 0, false
-	}
-	return limits[0], limits[1], true
+	return lookupUserTokenGroupRateLimit(ModelRequestIPRateLimitByUserTokenGroup, userGroup, tokenGroup)
 }
 
 func checkRateLimitGroupMap(rateLimitGroup map[string][2]int) error {
@@ -323,3 +363,126 @@ func CheckModelRequestIPRateLimitGroup(jsonStr string) error {
 	}
 	return checkRateLimitNestedGroupMap(byUserToken)
 }
+
+const (
+	RateLimitSourceNested  = "nested"
+	RateLimitSourceSimple  = "simple"
+	RateLimitSourceDefault = "default"
+)
+
+// ExplainRateLimitGroup 解析给定的分组限流配置（不修改全局状态），返回 (userGroup, tokenGroup)
+// 最终生效的限制及其来源：nested 为新语法命中，simple 为旧语法命中，default 为全局默认值。
+// 查找顺序与限流中间件一致：先新语法，再按令牌分组（为空时取用户分组）查旧语法。
+func ExplainRateLimitGroup(jsonStr, userGroup, tokenGroup string) (total, success int, source string, err error) {
+	simple, byUserToken, err := parseRateLimitGroupConfig(jsonStr)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if err := checkRateLimitGroupMap(simple); err != nil {
+		return 0, 0, "", err
+	}
+	if err := checkRateLimitNestedGroupMap(byUserToken); err != nil {
+		return 0, 0, "", err
+	}
+
+	if total, success, found := lookupUserTokenGroupRateLimit(byUserToken, userGroup, tokenGroup); found {
+		return total, success, RateLimitSourceNested, nil
+	}
+	group := tokenGroup
+	if group == "" {
+		group = userGroup
+	}
+	if total, success, found := lookupGroupRateLimit(simple, group); found {
+		return total, success, RateLimitSourceSimple, nil
+	}
+	return ModelRequestRateLimitCount, ModelRequestRateLimitSuccessCount, RateLimitSourceDefault, nil
+}
+
+func rateLimitExemptIds2JSONString(ids []int) string {
+	if ids == nil {
+		ids = []int{}
+	}
+	jsonBytes, err := common.Marshal(ids)
+	if err != nil {
+		common.SysLog("error marshalling rate limit exempt ids: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func RateLimitExemptTokenIds2JSONString() string {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+	return rateLimitExemptIds2JSONString(RateLimitExemptTokenIds)
+}
+
+func RateLimitExemptUserIds2JSONString() string {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+	return rateLimitExemptIds2JSONString(RateLimitExemptUserIds)
+}
+
+// CheckRateLimitExemptIds 校验豁免名单为正整数 ID 的 JSON 数组
+func CheckRateLimitExemptIds(jsonStr string) error {
+	_, err := parseRateLimitExemptIds(jsonStr)
+	return err
+}
+
+func parseRateLimitExemptIds(jsonStr string) ([]int, error) {
+	ids := make([]int, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return ids, nil
+	}
+	if err := common.UnmarshalJsonStr(jsonStr, &ids); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, fmt.Errorf("rate limit exempt id must be positive, got %d", id)
+		}
+	}
+	return ids, nil
+}
+
+func UpdateRateLimitExemptTokenIdsByJSONString(jsonStr string) error {
+	ids, err := parseRateLimitExemptIds(jsonStr)
+	if err != nil {
+		return err
+	}
+	ModelRequestRateLimitMutex.Lock()
+	defer ModelRequestRateLimitMutex.Unlock()
+	RateLimitExemptTokenIds = ids
+	return nil
+}
+
+func UpdateRateLimitExemptUserIdsByJSONString(jsonStr string) error {
+	ids, err := parseRateLimitExemptIds(jsonStr)
+	if err != nil {
+		return err
+	}
+	ModelRequestRateLimitMutex.Lock()
+	defer ModelRequestRateLimitMutex.Unlock()
+	RateLimitExemptUserIds = ids
+	return nil
+}
+
+// IsRateLimitExempt 判断令牌或用户是否在限流豁免名单中，ID 为 0 时视为未知不匹配
+func IsRateLimitExempt(tokenId, userId int) bool {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+
+	if tokenId > 0 && slices.Contains(RateLimitExemptTokenIds, tokenId) {
+		return true
+	}
+	return userId > 0 && slices.Contains(RateLimitExemptUserIds, userId)
+}
+
+// CheckRateLimitWindow 校验限流窗口：分钟与秒均不能为负，且至少有一项为正数
+func CheckRateLimitWindow(minutes, seconds int) error {
+	if minutes < 0 || seconds < 0 {
+		return fmt.Errorf("rate limit window must not be negative")
+	}
+	if minutes == 0 && seconds == 0 {
+		return fmt.Errorf("rate limit window requires a positive duration in minutes or seconds")
+	}
+	return nil
+}
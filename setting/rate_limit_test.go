@@ -0,0 +1,150 @@
+package setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withRateLimitGroupConfig(t *testing.T, jsonStr string) {
+	t.Helper()
+	ModelRequestRateLimitMutex.RLock()
+	oldSimple, oldNested := ModelRequestRateLimitGroup, ModelRequestRateLimitByUserTokenGroup
+	ModelRequestRateLimitMutex.RUnlock()
+	t.Cleanup(func() {
+		ModelRequestRateLimitMutex.Lock()
+		ModelRequestRateLimitGroup, ModelRequestRateLimitByUserTokenGroup = oldSimple, oldNested
+		ModelRequestRateLimitMutex.Unlock()
+	})
+	require.NoError(t, UpdateModelRequestRateLimitGroupByJSONString(jsonStr))
+}
+
+func TestGetGroupRateLimit_Precedence(t *testing.T) {
+	withRateLimitGroupConfig(t, `{
+		"team-123": [1, 1],
+		"team-*": [2, 2],
+		"team-1*": [3, 3],
+		"*": [4, 4]
+	}`)
+
+	cases := []struct {
+		group string
+		total int
+	}{
+		{"team-123", 1}, // 精确匹配优先
+		{"team-145", 3}, // 更具体的通配优先
+		{"team-456", 2},
+		{"vip", 4}, // 默认
+	}
+	for _, tc := range cases {
+		total, success, found := GetGroupRateLimit(tc.group)
+		require.True(t, found, tc.group)
+		assert.Equal(t, tc.total, total, tc.group)
+		assert.Equal(t, tc.total, success, tc.group)
+	}
+}
+
+func TestGetGroupRateLimit_NoDefault(t *testing.T) {
+	withRateLimitGroupConfig(t, `{"team-*": [2, 2]}`)
+
+	_, _, found := GetGroupRateLimit("vip")
+	assert.False(t, found)
+	_, _, found = GetGroupRateLimit("team-")
+	assert.True(t, found)
+}
+
+func TestGetGroupRateLimitByUserAndToken_Precedence(t *testing.T) {
+	withRateLimitGroupConfig(t, `{
+		"team-1": {"team-1": [1, 1], "*": [5, 5]},
+		"team-*": {"vip": [2, 2], "vip-*": [3, 3]},
+		"*": {"*": [4, 4]}
+	}`)
+
+	cases := []struct {
+		userGroup  string
+		tokenGroup string
+		total      int
+		found      bool
+	}{
+		{"team-1", "", 1, true},
+		{"team-1", "other", 5, true},
+		{"team-2", "vip", 2, true},
+		{"team-2", "vip-a", 3, true},
+		{"team-2", "other", 0, false}, // 用户分组命中通配后，不再回退到 "*" 用户分组
+		{"default", "anything", 4, true},
+	}
+	for _, tc := range cases {
+		total, _, found := GetGroupRateLimitByUserAndToken(tc.userGroup, tc.tokenGroup)
+		assert.Equal(t, tc.found, found, "%s/%s", tc.userGroup, tc.tokenGroup)
+		assert.Equal(t, tc.total, total, "%s/%s", tc.userGroup, tc.tokenGroup)
+	}
+}
+
+func TestCheckModelRequestRateLimitGroup_InvalidPattern(t *testing.T) {
+	assert.Error(t, CheckModelRequestRateLimitGroup(`{"team-[": [1, 1]}`))
+	assert.Error(t, CheckModelRequestRateLimitGroup(`{"team": {"vip-[": [1, 1]}}`))
+	assert.NoError(t, CheckModelRequestRateLimitGroup(`{"team-*": [1, 1], "*": {"*": [1, 1]}}`))
+}
+
+func TestExplainRateLimitGroup(t *testing.T) {
+	config := `{
+		"vip": {"vip": [10, 9], "team-*": [8, 7]},
+		"team-*": [6, 5]
+	}`
+
+	total, success, source, err := ExplainRateLimitGroup(config, "vip", "")
+	require.NoError(t, err)
+	assert.Equal(t, [3]any{10, 9, RateLimitSourceNested}, [3]any{total, success, source})
+
+	total, success, source, err = ExplainRateLimitGroup(config, "vip", "team-1")
+	require.NoError(t, err)
+	assert.Equal(t, [3]any{8, 7, RateLimitSourceNested}, [3]any{total, success, source})
+
+	total, success, source, err = ExplainRateLimitGroup(config, "default", "team-2")
+	require.NoError(t, err)
+	assert.Equal(t, [3]any{6, 5, RateLimitSourceSimple}, [3]any{total, success, source})
+
+	total, success, source, err = ExplainRateLimitGroup(config, "default", "")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitSourceDefault, source)
+	assert.Equal(t, ModelRequestRateLimitCount, total)
+	assert.Equal(t, ModelRequestRateLimitSuccessCount, success)
+
+	_, _, _, err = ExplainRateLimitGroup(`{"vip": [1, 0]}`, "vip", "")
+	assert.Error(t, err)
+	_, _, _, err = ExplainRateLimitGroup(`not json`, "vip", "")
+	assert.Error(t, err)
+}
+
+func TestRateLimitExemptIds(t *testing.T) {
+	ModelRequestRateLimitMutex.RLock()
+	oldTokens, oldUsers := RateLimitExemptTokenIds, RateLimitExemptUserIds
+	ModelRequestRateLimitMutex.RUnlock()
+	t.Cleanup(func() {
+		ModelRequestRateLimitMutex.Lock()
+		RateLimitExemptTokenIds, RateLimitExemptUserIds = oldTokens, oldUsers
+		ModelRequestRateLimitMutex.Unlock()
+	})
+
+	require.NoError(t, UpdateRateLimitExemptTokenIdsByJSONString(`[7, 9]`))
+	require.NoError(t, UpdateRateLimitExemptUserIdsByJSONString(`[3]`))
+	assert.Equal(t, "[7,9]", RateLimitExemptTokenIds2JSONString())
+
+	assert.True(t, IsRateLimitExempt(9, 0))
+	assert.True(t, IsRateLimitExempt(1, 3))
+	assert.False(t, IsRateLimitExempt(1, 2))
+	assert.False(t, IsRateLimitExempt(0, 0))
+
+	assert.Error(t, CheckRateLimitExemptIds(`[0]`))
+	assert.Error(t, CheckRateLimitExemptIds(`{"a": 1}`))
+	require.NoError(t, UpdateRateLimitExemptUserIdsByJSONString(""))
+	assert.Equal(t, "[]", RateLimitExemptUserIds2JSONString())
+}
+
+func TestCheckRateLimitWindow(t *testing.T) {
+	assert.NoError(t, CheckRateLimitWindow(1, 0))
+	assert.NoError(t, CheckRateLimitWindow(0, 10))
+	assert.Error(t, CheckRateLimitWindow(0, 0))
+	assert.Error(t, CheckRateLimitWindow(1, -1))
+}
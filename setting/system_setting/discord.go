@@ -13,20 +13,26 @@ type DiscordSettings struct {
 	ClientId     string `json:"client_id"`
 	ClientSecret string `json:"client_secret"`
 	Guilds       string `json:"guilds"`
+	// 登录时公会规则判定结果与身份组查询的缓存秒数，<=0 表示不缓存
+	RuleCacheSeconds int `json:"rule_cache_seconds"`
 }
 
 type DiscordRoleSetProvider func(guildID string) (map[string]struct{}, error)
 
 type DiscordGuildRule struct {
+	// Version 为规则原始配置的哈希，用于区分不同配置下的缓存结果
+	Version         string
 	RequiredGuilds  []*DiscordGuildClause
 	OptionalGuilds  []*DiscordGuildClause
 	ForbiddenGuilds []*DiscordGuildClause
+	// Expr 为结构化语法解析出的表达式树，非空时忽略上面的扁平字段
+	Expr *DiscordRuleExpr
 }
 
 type DiscordGuildClause struct {
-	GuildID         string
-	RequiredRoleIDs []string
-	OptionalRoleIDs []string
+	GuildID          string
+	RequiredRoleIDs  []string
+	OptionalRoleIDs  []string
 	ForbiddenRoleIDs []string
 }
 
@@ -48,11 +54,32 @@ func ParseDiscordGuildRule(raw string) (*DiscordGuildRule, error) {
 		return &DiscordGuildRule{}, nil
 	}
 
+	var rawNode map[string]any
+	if err := common.UnmarshalJsonStr(trimmed, &rawNode); err != nil {
+		return nil, err
+	}
+	if isDiscordRuleOperatorNode(rawNode) {
+		expr, err := parseDiscordRuleExpr(rawNode, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &DiscordGuildRule{Version: common.Sha1([]byte(trimmed)), Expr: expr}, nil
+	}
+
 	var rawRule map[string][]string
 	if err := common.UnmarshalJsonStr(trimmed, &rawRule); err != nil {
 		return nil, err
 	}
+	rule, err := buildFlatDiscordGuildRule(rawRule)
+	if err != nil {
+		return nil, err
+	}
+	rule.Version = common.Sha1([]byte(trimmed))
+	return rule, nil
+}
 
+// buildFlatDiscordGuildRule 解析扁平语法：公会 ID 到身份组列表的映射，支持 +/- 前缀
+func buildFlatDiscordGuildRule(rawRule map[string][]string) (*DiscordGuildRule, error) {
 	rule := &DiscordGuildRule{}
 	requiredGuildSet := make(map[string]struct{})
 	optionalGuildSet := make(map[string]struct{})
@@ -118,7 +145,7 @@ func ParseDiscordGuildRule(raw string) (*DiscordGuildRule, error) {
 }
 
 func (r *DiscordGuildRule) IsEmpty() bool {
-	return r == nil || (len(r.RequiredGuilds) == 0 && len(r.OptionalGuilds) == 0 && len(r.ForbiddenGuilds) == 0)
+	return r == nil || (r.Expr == nil && len(r.RequiredGuilds) == 0 && len(r.OptionalGuilds) == 0 && len(r.ForbiddenGuilds) == 0)
 }
 
 func (r *DiscordGuildRule) Evaluate(guildSet map[string]struct{}, roleProvider DiscordRoleSetProvider) (bool, error) {
@@ -128,6 +155,9 @@ func (r *DiscordGuildRule) Evaluate(guildSet map[string]struct{}, roleProvider D
 	if guildSet == nil {
 		guildSet = make(map[string]struct{})
 	}
+	if r.Expr != nil {
+		return r.Expr.Evaluate(guildSet, roleProvider)
+	}
 
 	for _, clause := range r.RequiredGuilds {
 		ok, err := clause.MatchGuildAndRoles(guildSet, roleProvider)
@@ -0,0 +1,68 @@
+package system_setting
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// discordRuleEvalCache 缓存公会规则的最终判定结果，键包含用户标识、规则版本与公会集合，
+// 不同用户即使公会集合相同也不会共享结果
+var discordRuleEvalCache = common.NewTTLCacheFromEnv[string, discordRuleEvalResult]("discord_rule_eval", 10000, 5*time.Minute)
+
+// discordRoleSetCache 缓存用户在各公会中的身份组，键包含用户标识与公会 ID
+var discordRoleSetCache = common.NewTTLCacheFromEnv[string, map[string]struct{}]("discord_role_set", 10000, time.Minute)
+
+type discordRuleEvalResult struct {
+	matched bool
+	reason  string
+}
+
+// NewCachedDiscordRoleProvider 为 inner 增加按 userKey + 公会 ID 的短期缓存，查询失败的结果不缓存。
+// 缓存为包级共享，不同用户互不复用；userKey 为空或 ttl <= 0 时直接返回 inner。
+func NewCachedDiscordRoleProvider(userKey string, inner DiscordRoleSetProvider, ttl time.Duration) DiscordRoleSetProvider {
+	if inner == nil || userKey == "" || ttl <= 0 {
+		return inner
+	}
+	return func(guildID string) (map[string]struct{}, error) {
+		key := userKey + "\n" + guildID
+		if roleSet, ok := discordRoleSetCache.Get(key); ok {
+			return roleSet, nil
+		}
+		roleSet, err := inner(guildID)
+		if err != nil {
+			return nil, err
+		}
+		discordRoleSetCache.SetWithTTL(key, roleSet, ttl)
+		return roleSet, nil
+	}
+}
+
+// EvaluateCached 与 EvaluateWithReason 相同，但会按 userKey + 规则版本 + 公会集合缓存判定结果 ttl 时长。
+// userKey 为空或 ttl <= 0 时不使用缓存；出错的判定不缓存。
+func (r *DiscordGuildRule) EvaluateCached(userKey string, guildSet map[string]struct{}, roleProvider DiscordRoleSetProvider, ttl time.Duration) (bool, string, error) {
+	if r == nil || r.IsEmpty() || userKey == "" || ttl <= 0 {
+		return r.EvaluateWithReason(guildSet, roleProvider)
+	}
+	key := discordRuleEvalCacheKey(userKey, r.Version, guildSet)
+	if result, ok := discordRuleEvalCache.Get(key); ok {
+		return result.matched, result.reason, nil
+	}
+	matched, reason, err := r.EvaluateWithReason(guildSet, roleProvider)
+	if err != nil {
+		return false, "", err
+	}
+	discordRuleEvalCache.SetWithTTL(key, discordRuleEvalResult{matched: matched, reason: reason}, ttl)
+	return matched, reason, nil
+}
+
+func discordRuleEvalCacheKey(userKey string, version string, guildSet map[string]struct{}) string {
+	guildIDs := make([]string, 0, len(guildSet))
+	for guildID := range guildSet {
+		guildIDs = append(guildIDs, guildID)
+	}
+	sort.Strings(guildIDs)
+	return common.Sha1([]byte(userKey + "\n" + version + "\n" + strings.Join(guildIDs, ",")))
+}
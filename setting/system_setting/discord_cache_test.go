@@ -0,0 +1,82 @@
+package system_setting
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCachedDiscordRoleProvider_CachesAndExpires(t *testing.T) {
+	calls := 0
+	inner := func(guildID string) (map[string]struct{}, error) {
+		calls++
+		if guildID == "broken" {
+			return nil, fmt.Errorf("mock provider error")
+		}
+		return toSet("role_" + guildID), nil
+	}
+	provider := NewCachedDiscordRoleProvider("role_cache_user_a", inner, 50*time.Millisecond)
+
+	roles, err := provider("a")
+	require.NoError(t, err)
+	require.Equal(t, toSet("role_a"), roles)
+	_, _ = provider("a")
+	require.Equal(t, 1, calls)
+
+	// 错误结果不缓存
+	_, err = provider("broken")
+	require.Error(t, err)
+	_, err = provider("broken")
+	require.Error(t, err)
+	require.Equal(t, 3, calls)
+
+	// 缓存按用户隔离，其他用户查询同一公会仍会调用 inner
+	_, _ = NewCachedDiscordRoleProvider("role_cache_user_b", inner, 50*time.Millisecond)("a")
+	require.Equal(t, 4, calls)
+
+	// 新建的 provider 共享包级缓存
+	_, _ = NewCachedDiscordRoleProvider("role_cache_user_a", inner, 50*time.Millisecond)("a")
+	require.Equal(t, 4, calls)
+
+	time.Sleep(80 * time.Millisecond)
+	_, _ = provider("a")
+	require.Equal(t, 5, calls)
+}
+
+func TestDiscordGuildRule_EvaluateCachedIsolatedByUser(t *testing.T) {
+	rule, err := ParseDiscordGuildRule(`{"server_1":["+role_1"]}`)
+	require.NoError(t, err)
+	require.NotEmpty(t, rule.Version)
+
+	calls := 0
+	providerFor := func(roles ...string) DiscordRoleSetProvider {
+		return func(guildID string) (map[string]struct{}, error) {
+			calls++
+			return toSet(roles...), nil
+		}
+	}
+
+	matched, _, err := rule.EvaluateCached("user_a", toSet("server_1"), providerFor("role_1"), time.Minute)
+	require.NoError(t, err)
+	require.True(t, matched)
+	matched, _, err = rule.EvaluateCached("user_a", toSet("server_1"), providerFor("role_1"), time.Minute)
+	require.NoError(t, err)
+	require.True(t, matched)
+	require.Equal(t, 1, calls)
+
+	// 公会集合相同但用户不同，不能复用其他用户的判定结果
+	matched, _, err = rule.EvaluateCached("user_b", toSet("server_1"), providerFor("role_2"), time.Minute)
+	require.NoError(t, err)
+	require.False(t, matched)
+	require.Equal(t, 2, calls)
+
+	// 规则变化后版本不同，缓存不再命中
+	changed, err := ParseDiscordGuildRule(`{"server_1":["+role_2"]}`)
+	require.NoError(t, err)
+	matched, _, err = changed.EvaluateCached("user_a", toSet("server_1"), providerFor("role_1"), time.Minute)
+	require.NoError(t, err)
+	require.False(t, matched)
+	require.Equal(t, 3, calls)
+}
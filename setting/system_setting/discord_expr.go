@@ -0,0 +1,162 @@
+package system_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	DiscordRuleOpAnd  = "and"
+	DiscordRuleOpOr   = "or"
+	DiscordRuleOpNot  = "not"
+	DiscordRuleOpLeaf = "leaf"
+
+	// maxDiscordRuleExprDepth 限制结构化规则的嵌套层数，避免异常配置导致深度递归
+	maxDiscordRuleExprDepth = 8
+)
+
+// DiscordRuleExpr 是结构化公会规则的表达式节点：
+// and/or/not 节点通过 Children 组合子表达式，leaf 节点使用扁平语法的 DiscordGuildRule 判定。
+//
+// 示例：{"or":[{"guild_A":["role_x"]},{"and":[{"+guild_B":[]},{"+guild_C":[]}]}]}
+type DiscordRuleExpr struct {
+	Op       string
+	Children []*DiscordRuleExpr
+	Leaf     *DiscordGuildRule
+}
+
+func (e *DiscordRuleExpr) Evaluate(guildSet map[string]struct{}, roleProvider DiscordRoleSetProvider) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	switch e.Op {
+	case DiscordRuleOpAnd:
+		for _, child := range e.Children {
+			ok, err := child.Evaluate(guildSet, roleProvider)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case DiscordRuleOpOr:
+		for _, child := range e.Children {
+			ok, err := child.Evaluate(guildSet, roleProvider)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	case DiscordRuleOpNot:
+		if len(e.Children) != 1 {
+			return false, fmt.Errorf("discord guild rule not operator requires exactly one operand")
+		}
+		ok, err := e.Children[0].Evaluate(guildSet, roleProvider)
+		if err != nil {
+			return false, err
+		}
+		return !ok, nil
+	default:
+		return e.Leaf.Evaluate(guildSet, roleProvider)
+	}
+}
+
+func normalizeDiscordRuleOp(key string) string {
+	op := strings.ToLower(strings.TrimSpace(key))
+	switch op {
+	case DiscordRuleOpAnd, DiscordRuleOpOr, DiscordRuleOpNot:
+		return op
+	}
+	return ""
+}
+
+// isStructuredDiscordRuleOperand 判断运算符的值是否为结构化操作数（对象或对象数组）。
+// 扁平语法中 and/or 的值为字符串数组，按 legacy 语法忽略，不视为结构化节点。
+func isStructuredDiscordRuleOperand(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return true
+	case []any:
+		if len(v) == 0 {
+			return false
+		}
+		for _, item := range v {
+			if _, ok := item.(map[string]any); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isDiscordRuleOperatorNode(node map[string]any) bool {
+	for key, value := range node {
+		if normalizeDiscordRuleOp(key) != "" && isStructuredDiscordRuleOperand(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDiscordRuleExpr(node map[string]any, depth int) (*DiscordRuleExpr, error) {
+	if depth > maxDiscordRuleExprDepth {
+		return nil, fmt.Errorf("discord guild rule nesting exceeds max depth %d", maxDiscordRuleExprDepth)
+	}
+	if !isDiscordRuleOperatorNode(node) {
+		return parseDiscordRuleLeaf(node)
+	}
+	if len(node) != 1 {
+		return nil, fmt.Errorf("discord guild rule operator must be the only key in its object")
+	}
+
+	var op string
+	var operand any
+	for key, value := range node {
+		op = normalizeDiscordRuleOp(key)
+		operand = value
+	}
+
+	var operands []map[string]any
+	switch v := operand.(type) {
+	case map[string]any:
+		operands = []map[string]any{v}
+	case []any:
+		for _, item := range v {
+			operands = append(operands, item.(map[string]any))
+		}
+	}
+	if op == DiscordRuleOpNot && len(operands) != 1 {
+		return nil, fmt.Errorf("discord guild rule not operator requires exactly one operand")
+	}
+
+	expr := &DiscordRuleExpr{Op: op, Children: make([]*DiscordRuleExpr, 0, len(operands))}
+	for _, item := range operands {
+		child, err := parseDiscordRuleExpr(item, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expr.Children = append(expr.Children, child)
+	}
+	return expr, nil
+}
+
+func parseDiscordRuleLeaf(node map[string]any) (*DiscordRuleExpr, error) {
+	raw, err := common.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	var rawRule map[string][]string
+	if err := common.Unmarshal(raw, &rawRule); err != nil {
+		return nil, fmt.Errorf("discord guild rule leaf must map guild id to role list: %w", err)
+	}
+	leaf, err := buildFlatDiscordGuildRule(rawRule)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscordRuleExpr{Op: DiscordRuleOpLeaf, Leaf: leaf}, nil
+}
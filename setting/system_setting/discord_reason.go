@@ -0,0 +1,142 @@
+package system_setting
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EvaluateWithReason 与 Evaluate 判定逻辑一致，判定失败时额外返回第一个未满足条件的说明，
+// 用于提示用户缺少哪个服务器或身份组。只需布尔结果时应使用 Evaluate。
+func (r *DiscordGuildRule) EvaluateWithReason(guildSet map[string]struct{}, roleProvider DiscordRoleSetProvider) (bool, string, error) {
+	if r == nil || r.IsEmpty() {
+		return true, "", nil
+	}
+	if guildSet == nil {
+		guildSet = make(map[string]struct{})
+	}
+	if r.Expr != nil {
+		return r.Expr.EvaluateWithReason(guildSet, roleProvider)
+	}
+
+	for _, clause := range r.RequiredGuilds {
+		ok, reason, err := clause.matchWithReason(guildSet, roleProvider)
+		if err != nil {
+			return false, "", err
+		}
+		if !ok {
+			return false, reason, nil
+		}
+	}
+
+	for _, clause := range r.ForbiddenGuilds {
+		ok, err := clause.MatchGuildAndRoles(guildSet, roleProvider)
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			return false, fmt.Sprintf("member of forbidden guild %s", clause.GuildID), nil
+		}
+	}
+
+	if len(r.OptionalGuilds) > 0 {
+		reasons := make([]string, 0, len(r.OptionalGuilds))
+		for _, clause := range r.OptionalGuilds {
+			ok, reason, err := clause.matchWithReason(guildSet, roleProvider)
+			if err != nil {
+				return false, "", err
+			}
+			if ok {
+				return true, "", nil
+			}
+			reasons = append(reasons, reason)
+		}
+		if len(reasons) == 1 {
+			return false, reasons[0], nil
+		}
+		return false, "none of the guild conditions satisfied: " + strings.Join(reasons, "; "), nil
+	}
+
+	return true, "", nil
+}
+
+func (e *DiscordRuleExpr) EvaluateWithReason(guildSet map[string]struct{}, roleProvider DiscordRoleSetProvider) (bool, string, error) {
+	if e == nil {
+		return true, "", nil
+	}
+	switch e.Op {
+	case DiscordRuleOpAnd:
+		for _, child := range e.Children {
+			ok, reason, err := child.EvaluateWithReason(guildSet, roleProvider)
+			if err != nil || !ok {
+				return false, reason, err
+			}
+		}
+		return true, "", nil
+	case DiscordRuleOpOr:
+		reasons := make([]string, 0, len(e.Children))
+		for _, child := range e.Children {
+			ok, reason, err := child.EvaluateWithReason(guildSet, roleProvider)
+			if err != nil {
+				return false, "", err
+			}
+			if ok {
+				return true, "", nil
+			}
+			reasons = append(reasons, reason)
+		}
+		return false, "none of the conditions satisfied: " + strings.Join(reasons, "; "), nil
+	case DiscordRuleOpNot:
+		ok, err := e.Evaluate(guildSet, roleProvider)
+		if err != nil || ok {
+			return ok, "", err
+		}
+		return false, "matched an excluded guild condition", nil
+	default:
+		return e.Leaf.EvaluateWithReason(guildSet, roleProvider)
+	}
+}
+
+// matchWithReason 与 MatchGuildAndRoles 判定一致，不匹配时返回原因
+func (c *DiscordGuildClause) matchWithReason(guildSet map[string]struct{}, roleProvider DiscordRoleSetProvider) (bool, string, error) {
+	if c == nil || c.GuildID == "" {
+		return false, "invalid guild condition", nil
+	}
+	if _, ok := guildSet[c.GuildID]; !ok {
+		return false, fmt.Sprintf("missing required guild %s", c.GuildID), nil
+	}
+	if len(c.RequiredRoleIDs) == 0 && len(c.OptionalRoleIDs) == 0 && len(c.ForbiddenRoleIDs) == 0 {
+		return true, "", nil
+	}
+	if roleProvider == nil {
+		return false, "", fmt.Errorf("discord role provider is nil")
+	}
+
+	roleSet, err := roleProvider(c.GuildID)
+	if err != nil {
+		return false, "", err
+	}
+	if roleSet == nil {
+		roleSet = make(map[string]struct{})
+	}
+
+	for _, roleID := range c.RequiredRoleIDs {
+		if _, ok := roleSet[roleID]; !ok {
+			return false, fmt.Sprintf("missing role %s in %s", roleID, c.GuildID), nil
+		}
+	}
+	for _, roleID := range c.ForbiddenRoleIDs {
+		if _, ok := roleSet[roleID]; ok {
+			return false, fmt.Sprintf("has forbidden role %s in %s", roleID, c.GuildID), nil
+		}
+	}
+	if len(c.OptionalRoleIDs) > 0 {
+		for _, roleID := range c.OptionalRoleIDs {
+			if _, ok := roleSet[roleID]; ok {
+				return true, "", nil
+			}
+		}
+		return false, fmt.Sprintf("missing any of roles %s in %s", strings.Join(c.OptionalRoleIDs, ", "), c.GuildID), nil
+	}
+
+	return true, "", nil
+}
@@ -67,60 +67,60 @@ func TestParseDiscordGuildRule_ParsePrefixSemantics(t *testing.T) {
 
 func TestDiscordGuildRule_EvaluateSamples(t *testing.T) {
 	tests := []struct {
-		name        string
-		raw         string
-		guilds      []string
+		name         string
+		raw          string
+		guilds       []string
 		rolesByGuild map[string][]string
-		wantMatch   bool
+		wantMatch    bool
 	}{
 		{
-			name:      "服务器1 AND 身份组1或身份组2",
-			raw:       `{"server_1":["role_1","role_2"]}`,
-			guilds:    []string{"server_1"},
+			name:         "服务器1 AND 身份组1或身份组2",
+			raw:          `{"server_1":["role_1","role_2"]}`,
+			guilds:       []string{"server_1"},
 			rolesByGuild: map[string][]string{"server_1": []string{"role_2"}},
-			wantMatch: true,
+			wantMatch:    true,
 		},
 		{
-			name:      "服务器1 AND 身份组1 AND 身份组2",
-			raw:       `{"server_1":["+role_1","+role_2"]}`,
-			guilds:    []string{"server_1"},
+			name:         "服务器1 AND 身份组1 AND 身份组2",
+			raw:          `{"server_1":["+role_1","+role_2"]}`,
+			guilds:       []string{"server_1"},
 			rolesByGuild: map[string][]string{"server_1": []string{"role_1", "role_2"}},
-			wantMatch: true,
+			wantMatch:    true,
 		},
 		{
-			name:      "服务器1 AND NOT 身份组1",
-			raw:       `{"server_1":["-role_1"]}`,
-			guilds:    []string{"server_1"},
+			name:         "服务器1 AND NOT 身份组1",
+			raw:          `{"server_1":["-role_1"]}`,
+			guilds:       []string{"server_1"},
 			rolesByGuild: map[string][]string{"server_1": []string{"role_2"}},
-			wantMatch: true,
+			wantMatch:    true,
 		},
 		{
-			name:      "服务器1 AND NOT 身份组1 AND 身份组2或身份组3 AND 身份组4",
-			raw:       `{"server_1":["-role_1","role_2","role_3","+role_4"]}`,
-			guilds:    []string{"server_1"},
+			name:         "服务器1 AND NOT 身份组1 AND 身份组2或身份组3 AND 身份组4",
+			raw:          `{"server_1":["-role_1","role_2","role_3","+role_4"]}`,
+			guilds:       []string{"server_1"},
 			rolesByGuild: map[string][]string{"server_1": []string{"role_3", "role_4"}},
-			wantMatch: true,
+			wantMatch:    true,
 		},
 		{
-			name:      "NOT 服务器2",
-			raw:       `{"-server_2":[]}`,
-			guilds:    []string{"server_1"},
+			name:         "NOT 服务器2",
+			raw:          `{"-server_2":[]}`,
+			guilds:       []string{"server_1"},
 			rolesByGuild: map[string][]string{},
-			wantMatch: true,
+			wantMatch:    true,
 		},
 		{
-			name:      "NOT 服务器2且身份组1 子句命中时拒绝",
-			raw:       `{"-server_2":["role_1"]}`,
-			guilds:    []string{"server_2"},
+			name:         "NOT 服务器2且身份组1 子句命中时拒绝",
+			raw:          `{"-server_2":["role_1"]}`,
+			guilds:       []string{"server_2"},
 			rolesByGuild: map[string][]string{"server_2": []string{"role_1"}},
-			wantMatch: false,
+			wantMatch:    false,
 		},
 		{
-			name:      "OR 服务器子句：满足其中一个",
-			raw:       `{"server_1":["role_1"],"server_2":["role_2"]}`,
-			guilds:    []string{"server_2"},
+			name:         "OR 服务器子句：满足其中一个",
+			raw:          `{"server_1":["role_1"],"server_2":["role_2"]}`,
+			guilds:       []string{"server_2"},
 			rolesByGuild: map[string][]string{"server_2": []string{"role_2"}},
-			wantMatch: true,
+			wantMatch:    true,
 		},
 	}
 
@@ -198,3 +198,112 @@ func findGuildClauseByID(t *testing.T, clauses []*DiscordGuildClause, guildID st
 	require.FailNow(t, "guild clause not found", "guildID=%s", guildID)
 	return nil
 }
+
+func TestParseDiscordGuildRule_NestedExpression(t *testing.T) {
+	rule, err := ParseDiscordGuildRule(`{"or":[{"guild_A":["+role_x"]},{"and":[{"+guild_B":[]},{"+guild_C":[]}]}]}`)
+	require.NoError(t, err)
+	require.NotNil(t, rule.Expr)
+	require.False(t, rule.IsEmpty())
+	require.Equal(t, DiscordRuleOpOr, rule.Expr.Op)
+	require.Len(t, rule.Expr.Children, 2)
+	require.Equal(t, DiscordRuleOpAnd, rule.Expr.Children[1].Op)
+
+	provider := func(guildID string) (map[string]struct{}, error) {
+		if guildID == "guild_A" {
+			return toSet("role_x"), nil
+		}
+		return toSet(), nil
+	}
+
+	tests := []struct {
+		name   string
+		guilds map[string]struct{}
+		want   bool
+	}{
+		{name: "first branch with role", guilds: toSet("guild_A"), want: true},
+		{name: "second branch both guilds", guilds: toSet("guild_B", "guild_C"), want: true},
+		{name: "second branch missing one guild", guilds: toSet("guild_B"), want: false},
+		{name: "no matching guild", guilds: toSet("guild_D"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, evalErr := rule.Evaluate(tt.guilds, provider)
+			require.NoError(t, evalErr)
+			require.Equal(t, tt.want, matched)
+		})
+	}
+
+	noRole := func(guildID string) (map[string]struct{}, error) { return toSet(), nil }
+	matched, evalErr := rule.Evaluate(toSet("guild_A"), noRole)
+	require.NoError(t, evalErr)
+	require.False(t, matched)
+}
+
+func TestParseDiscordGuildRule_NestedNotExpression(t *testing.T) {
+	rule, err := ParseDiscordGuildRule(`{"and":[{"+guild_A":[]},{"not":{"or":[{"+guild_B":[]},{"guild_A":["+role_banned"]}]}}]}`)
+	require.NoError(t, err)
+
+	provider := func(guildID string) (map[string]struct{}, error) {
+		return toSet("role_banned"), nil
+	}
+	matched, evalErr := rule.Evaluate(toSet("guild_A"), provider)
+	require.NoError(t, evalErr)
+	require.False(t, matched)
+
+	matched, evalErr = rule.Evaluate(toSet("guild_A"), func(guildID string) (map[string]struct{}, error) { return toSet(), nil })
+	require.NoError(t, evalErr)
+	require.True(t, matched)
+
+	matched, evalErr = rule.Evaluate(toSet("guild_A", "guild_B"), func(guildID string) (map[string]struct{}, error) { return toSet(), nil })
+	require.NoError(t, evalErr)
+	require.False(t, matched)
+}
+
+func TestParseDiscordGuildRule_NestedExpressionInvalid(t *testing.T) {
+	_, err := ParseDiscordGuildRule(`{"or":[{"guild_A":[]}],"guild_B":[]}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only key")
+
+	_, err = ParseDiscordGuildRule(`{"not":[{"guild_A":[]},{"guild_B":[]}]}`)
+	require.Error(t, err)
+
+	_, err = ParseDiscordGuildRule(`{"or":[{"+guild_A":[],"-guild_A":[]}]}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "conflicted required and forbidden guild")
+}
+
+func TestDiscordGuildRule_EvaluateWithReason(t *testing.T) {
+	provider := func(guildID string) (map[string]struct{}, error) {
+		return toSet("role_1", "role_bad"), nil
+	}
+
+	tests := []struct {
+		name   string
+		rule   string
+		guilds map[string]struct{}
+		want   bool
+		reason string
+	}{
+		{name: "missing required guild", rule: `{"+server_1":[]}`, guilds: toSet("server_2"), reason: "missing required guild server_1"},
+		{name: "missing required role", rule: `{"+server_1":["+role_4"]}`, guilds: toSet("server_1"), reason: "missing role role_4 in server_1"},
+		{name: "forbidden role", rule: `{"+server_1":["-role_bad"]}`, guilds: toSet("server_1"), reason: "has forbidden role role_bad in server_1"},
+		{name: "forbidden guild", rule: `{"-server_2":[]}`, guilds: toSet("server_2"), reason: "member of forbidden guild server_2"},
+		{name: "optional role list", rule: `{"server_1":["role_2","role_3"]}`, guilds: toSet("server_1"), reason: "missing any of roles role_2, role_3 in server_1"},
+		{name: "matched", rule: `{"+server_1":["+role_1"]}`, guilds: toSet("server_1"), want: true},
+		{name: "nested and reports first failing branch", rule: `{"and":[{"+server_1":[]},{"+server_2":["+role_4"]}]}`, guilds: toSet("server_1", "server_2"), reason: "missing role role_4 in server_2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseDiscordGuildRule(tt.rule)
+			require.NoError(t, err)
+			matched, reason, evalErr := rule.EvaluateWithReason(tt.guilds, provider)
+			require.NoError(t, evalErr)
+			require.Equal(t, tt.want, matched)
+			require.Equal(t, tt.reason, reason)
+
+			fast, evalErr := rule.Evaluate(tt.guilds, provider)
+			require.NoError(t, evalErr)
+			require.Equal(t, matched, fast)
+		})
+	}
+}
@@ -63,7 +63,9 @@ const (
 	// client request error
 	ErrorCodeReadRequestBodyFailed      ErrorCode = "read_request_body_failed"
 	ErrorCodeConvertRequestFailed       ErrorCode = "convert_request_failed"
+	ErrorCodeConvertedRequestTooLarge   ErrorCode = "converted_request_too_large"
 	ErrorCodeAccessDenied               ErrorCode = "access_denied"
+	ErrorCodeRequestBudgetExceeded      ErrorCode = "request_budget_exceeded"
 	ErrorCodeSSEConcurrencyLimitExceeded ErrorCode = "sse_concurrency_limit_exceeded"
 
 	// request error
@@ -86,6 +88,10 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+
+	// rate limit error
+	ErrorCodeRateLimitExceeded      ErrorCode = "rate_limit_exceeded"
+	ErrorCodeRateLimitInternalError ErrorCode = "rate_limit_internal_error"
 )
 
 type NewAPIError struct {